@@ -1,11 +1,17 @@
 package amino
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
 	"fmt"
+	"hash"
 	"io"
+	"io/ioutil"
 	"reflect"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"encoding/binary"
 	"encoding/json"
@@ -22,6 +28,14 @@ var (
 
 	// ErrNoPointer is thrown when you call a method that expects a pointer, e.g. Unmarshal
 	ErrNoPointer = errors.New("expected a pointer")
+
+	// ErrFieldNotFound is returned (wrapped) by GetField when a field of the
+	// path isn't in the encoding.
+	ErrFieldNotFound = errors.New("field not found")
+
+	// ErrChecksumMismatch is returned (wrapped) by UnmarshalBinaryChecksummed
+	// when the checksum doesn't match the encoding, e.g. due to bit rot.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
 )
 
 const (
@@ -182,6 +196,27 @@ func (cdc *Codec) MarshalBinaryLengthPrefixedWriter(w io.Writer, o interface{})
 	return
 }
 
+// CountFittingElements returns how many of elements, from the first, fit
+// within maxBytes when each is encoded with MarshalBinaryLengthPrefixed, e.g.
+// as consecutive frames in a batch, along with their total size.  The
+// encodings are only counted, not kept.  If an element fails to encode, the
+// count and size of the elements before it are returned with the error.
+func (cdc *Codec) CountFittingElements(elements []interface{}, maxBytes int) (count int, totalBytes int, err error) {
+	for _, o := range elements {
+		cw := new(countingWriter)
+		if err = cdc.marshalBinaryBare(cw, o); err != nil {
+			return
+		}
+		size := UvarintSize(uint64(cw.n)) + cw.n
+		if totalBytes+size > maxBytes {
+			return
+		}
+		count++
+		totalBytes += size
+	}
+	return
+}
+
 // Panics if error.
 func (cdc *Codec) MustMarshalBinaryLengthPrefixed(o interface{}) []byte {
 	bz, err := cdc.MarshalBinaryLengthPrefixed(o)
@@ -191,10 +226,210 @@ func (cdc *Codec) MustMarshalBinaryLengthPrefixed(o interface{}) []byte {
 	return bz
 }
 
+// MarshalBinaryPadded is like MarshalBinaryLengthPrefixed, but pads the
+// output with zero bytes to the next multiple of blockSize, e.g. for storing
+// messages in fixed-size slots.  Use UnmarshalBinaryPadded to decode it.
+func (cdc *Codec) MarshalBinaryPadded(o interface{}, blockSize int) ([]byte, error) {
+	if blockSize <= 0 {
+		return nil, errors.Errorf("invalid block size %v", blockSize)
+	}
+	bz, err := cdc.MarshalBinaryLengthPrefixed(o)
+	if err != nil {
+		return nil, err
+	}
+	if rem := len(bz) % blockSize; rem != 0 {
+		bz = append(bz, make([]byte, blockSize-rem)...)
+	}
+	return bz, nil
+}
+
+// MarshalBinaryChecksummed is like MarshalBinaryBare, but appends a checksum
+// of the encoding, CRC-32 (IEEE, 4 bytes big-endian) unless set otherwise by
+// Codec.SetChecksumHash, e.g. for detecting corruption of records on disk.
+// Use UnmarshalBinaryChecksummed to verify and decode it.
+func (cdc *Codec) MarshalBinaryChecksummed(o interface{}) ([]byte, error) {
+	bz, err := cdc.MarshalBinaryBare(o)
+	if err != nil {
+		return nil, err
+	}
+	h := cdc.newChecksumHash()
+	h.Write(bz) // nolint: errcheck
+	return h.Sum(bz), nil
+}
+
+// MarshalBinaryBareInterned is like MarshalBinaryBare, but encodes each
+// distinct string once, in a table prefixed to the encoding, and each string
+// value as its index in the table, e.g. for messages with many repeated
+// strings such as denominations or addresses.  The table is uvarint(count)
+// followed by the byte-length prefixed strings in order of first use, and
+// string values are byte-length prefixed uvarint indices.
+//
+// NOTE: This is not Amino:binary, and can only be decoded with
+// UnmarshalBinaryBareInterned.
+func (cdc *Codec) MarshalBinaryBareInterned(o interface{}) ([]byte, error) {
+	es := cdc.newEncodeState()
+	es.strings = newStringTable()
+	body := new(bytes.Buffer)
+	if err := cdc.marshalBinaryBareState(es, body, o, ""); err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err := EncodeUvarint(buf, uint64(len(es.strings.list))); err != nil {
+		return nil, err
+	}
+	for _, str := range es.strings.list {
+		if err := EncodeString(buf, str); err != nil {
+			return nil, err
+		}
+	}
+	buf.Write(body.Bytes()) // nolint: errcheck
+	return buf.Bytes(), nil
+}
+
+// MarshalBinaryBareWith is like MarshalBinaryBare, but omits the struct
+// fields for which omit returns true, e.g. to leave out internal fields when
+// encoding for external clients.  omit is called with the dot-separated path
+// of Go field names from o (e.g. "Owner.Email", where elements of lists are
+// not distinguished) and the value of each field that would be encoded, so
+// not with fields omitted for having default values, nor with the fields of
+// omitted structs.
+func (cdc *Codec) MarshalBinaryBareWith(o interface{}, omit func(fieldPath string, v interface{}) bool) ([]byte, error) {
+	es := cdc.newEncodeState()
+	es.omit = omit
+	buf := new(bytes.Buffer)
+	if err := cdc.marshalBinaryBareState(es, buf, o, ""); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalBinarySelfDescribing is like MarshalBinaryBare, but prefixes the
+// encoding with the schema hash of o (see SchemaHash) and its registered
+// name (or Go type name if unregistered), each byte-length prefixed, so that
+// UnmarshalBinarySelfDescribing can detect blobs of an older schema.
+func (cdc *Codec) MarshalBinarySelfDescribing(o interface{}) ([]byte, error) {
+	hash, name, err := cdc.schemaHashAndName(reflect.TypeOf(o))
+	if err != nil {
+		return nil, err
+	}
+	buf := new(bytes.Buffer)
+	if err = EncodeByteSlice(buf, hash); err != nil {
+		return nil, err
+	}
+	if err = EncodeString(buf, name); err != nil {
+		return nil, err
+	}
+	if err = cdc.marshalBinaryBare(buf, o); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns the schema hash and name of rt (dereferenced), as written by
+// MarshalBinarySelfDescribing.
+func (cdc *Codec) schemaHashAndName(rt reflect.Type) (hash []byte, name string, err error) {
+	if rt == nil {
+		return nil, "", errors.New("cannot describe the schema of nil")
+	}
+	rt = derefType(rt)
+	info, err := cdc.getTypeInfoWlock(rt)
+	if err != nil {
+		return nil, "", err
+	}
+	hash, err = cdc.SchemaHash(reflect.Zero(rt).Interface())
+	if err != nil {
+		return nil, "", err
+	}
+	name = schemaTypeName(rt)
+	if info.Registered {
+		name = info.Name
+	}
+	return hash, name, nil
+}
+
 // MarshalBinaryBare encodes the object o according to the Amino spec.
 // MarshalBinaryBare doesn't prefix the byte-length of the encoding,
 // so the caller must handle framing.
 func (cdc *Codec) MarshalBinaryBare(o interface{}) ([]byte, error) {
+	return cdc.MarshalBinaryBareBuf(o, nil)
+}
+
+// MarshalBinaryBareBuf is like MarshalBinaryBare, but writes the encoding
+// into buf[:0] to avoid allocating a new output slice.
+//
+// CONTRACT: The returned slice aliases buf iff the encoding fits within
+// cap(buf).  Otherwise a new slice is returned, and buf may be partially
+// overwritten with the start of the encoding (as it may be upon an error).
+// So callers must not retain references to previous results encoded into
+// the same buf, e.g. when recycling buffers through a pool.
+func (cdc *Codec) MarshalBinaryBareBuf(o interface{}, buf []byte) ([]byte, error) {
+	w := bytes.NewBuffer(buf[:0])
+	if err := cdc.marshalBinaryBare(w, o); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// MarshalBinaryBareHash is like MarshalBinaryBare, but writes the encoding
+// to h, e.g. to compute the sign bytes hash of a message without allocating
+// the encoding.  Use h.Sum(nil) to get the hash.
+func (cdc *Codec) MarshalBinaryBareHash(o interface{}, h hash.Hash) error {
+	return cdc.marshalBinaryBare(h, o)
+}
+
+// MarshalBinaryBareReader is like MarshalBinaryBare, but returns a reader
+// that encodes o as it is read, e.g. for an HTTP request body.  Encoding
+// errors are returned by Read.  The reader is also an io.Closer, to stop
+// encoding if it isn't read to the end.  o must not be modified until then.
+// Unlike MarshalBinaryBare, it returns an error rather than panicking if o is
+// a nil pointer.
+func (cdc *Codec) MarshalBinaryBareReader(o interface{}) (io.Reader, error) {
+	// Fail early, before encoding in the background.
+	var rv, _, isNilPtr = derefPointers(reflect.ValueOf(o))
+	if isNilPtr {
+		return nil, errors.New("MarshalBinaryBareReader cannot marshal a nil pointer directly. Try wrapping in a struct?")
+	}
+	if _, err := cdc.getTypeInfoWlock(rv.Type()); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		var err error
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("panic while encoding %v: %v", rv.Type(), r)
+			}
+			pw.CloseWithError(err) // nolint: errcheck
+		}()
+		err = cdc.marshalBinaryBare(pw, o)
+	}()
+	return pr, nil
+}
+
+// MarshalBinaryBareAs is like MarshalBinaryBare, but encodes o with the
+// prefix bytes of its registration named name, for concrete types registered
+// under more than one name (see RegisterConcrete).
+func (cdc *Codec) MarshalBinaryBareAs(name string, o interface{}) ([]byte, error) {
+	w := new(bytes.Buffer)
+	if err := cdc.marshalBinaryBareAs(w, o, name); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+func (cdc *Codec) marshalBinaryBare(w io.Writer, o interface{}) error {
+	return cdc.marshalBinaryBareAs(w, o, "")
+}
+
+// If name is empty, o is encoded with its default registration, if any.
+func (cdc *Codec) marshalBinaryBareAs(w io.Writer, o interface{}, name string) error {
+	return cdc.marshalBinaryBareState(cdc.newEncodeState(), w, o, name)
+}
+
+// Like marshalBinaryBareAs, but with the given encode state, e.g. with a
+// string table for MarshalBinaryBareInterned.
+func (cdc *Codec) marshalBinaryBareState(es *encodeState, w io.Writer, o interface{}, name string) error {
 
 	// Dereference value if pointer.
 	var rv, _, isNilPtr = derefPointers(reflect.ValueOf(o))
@@ -205,43 +440,57 @@ func (cdc *Codec) MarshalBinaryBare(o interface{}) ([]byte, error) {
 	}
 
 	// Encode Amino:binary bytes.
-	var bz []byte
-	buf := new(bytes.Buffer)
 	rt := rv.Type()
 	info, err := cdc.getTypeInfoWlock(rt)
 	if err != nil {
-		return nil, err
+		return err
 	}
-	// in the case of of a repeated struct (e.g. type Alias []SomeStruct),
-	// we do not need to prepend with `(field_number << 3) | wire_type` as this
-	// would need to be done for each struct and not only for the first.
-	if rv.Kind() != reflect.Struct && !isStructOrRepeatedStruct(info) {
-		writeEmpty := false
-		typ3 := typeToTyp3(info.Type, FieldOptions{})
-		bare := typ3 != Typ3ByteLength
-		if err = cdc.writeFieldIfNotEmpty(buf, 1, info, FieldOptions{}, FieldOptions{}, rv, writeEmpty, bare); err != nil {
-			return nil, err
-		}
-		bz = buf.Bytes()
-	} else {
-		err = cdc.encodeReflectBinary(buf, info, rv, FieldOptions{BinFieldNum: 1}, true)
-		if err != nil {
-			return nil, err
+	if name != "" {
+		if info, err = cdc.getTypeInfoForNameRlock(rt, name); err != nil {
+			return err
 		}
-		bz = buf.Bytes()
 	}
-	// If registered concrete, prepend prefix bytes.
+	if es.maxSize > 0 {
+		w = maxSizeWriter{w, es}
+	}
+	// If registered concrete, write prefix bytes first.
 	if info.Registered {
 		// TODO: https://github.com/tendermint/go-amino/issues/267
 		//return MarshalBinaryBare(RegisteredAny{
 		//	AminoPreOrDisfix: info.Prefix.Bytes(),
 		//	Value: bz,
 		//})
-		pb := info.Prefix.Bytes()
-		bz = append(pb, bz...)
+		if _, err = w.Write(info.Prefix.Bytes()); err != nil {
+			return err
+		}
+		if info.Version > 0 {
+			if err = EncodeUvarint(w, uint64(info.Version)); err != nil {
+				return err
+			}
+		}
 	}
-
-	return bz, nil
+	// in the case of of a repeated struct (e.g. type Alias []SomeStruct),
+	// we do not need to prepend with `(field_number << 3) | wire_type` as this
+	// would need to be done for each struct and not only for the first.
+	// Likewise for maps, which are encoded as repeated key/value structs.
+	if rv.Kind() != reflect.Struct && rv.Kind() != reflect.Map && !isStructOrRepeatedStruct(info) {
+		writeEmpty := false
+		typ3 := typeToTyp3(info.Type, FieldOptions{})
+		bare := typ3 != Typ3ByteLength
+		// writeFieldIfNotEmpty requires a buffer to truncate empty fields.
+		buf, isBuf := w.(*bytes.Buffer)
+		if !isBuf {
+			buf = new(bytes.Buffer)
+		}
+		if err = cdc.writeFieldIfNotEmpty(es, buf, 1, info, FieldOptions{}, FieldOptions{}, rv, writeEmpty, bare); err != nil {
+			return err
+		}
+		if !isBuf {
+			_, err = w.Write(buf.Bytes())
+		}
+		return err
+	}
+	return cdc.encodeReflectBinary(es, w, info, rv, FieldOptions{BinFieldNum: 1}, true)
 }
 
 //type RegisteredAny struct {
@@ -255,7 +504,531 @@ func (cdc *Codec) MustMarshalBinaryBare(o interface{}) []byte {
 	if err != nil {
 		panic(err)
 	}
-	return bz
+	return bz
+}
+
+// MarshalBinaryBareExcluding is like MarshalBinaryBare, but omits the given
+// top-level field numbers of the struct o, e.g. to compute the sign bytes of
+// a message without its signature field.  Fields of nested structs are not
+// affected.  Returns an error if o isn't a struct (or if it is an
+// amino-marshaler, if its repr isn't a struct).
+func (cdc *Codec) MarshalBinaryBareExcluding(o interface{}, excludeFields ...uint32) ([]byte, error) {
+	info, err := cdc.getStructTypeInfo(reflect.TypeOf(o), "MarshalBinaryBareExcluding")
+	if err != nil {
+		return nil, err
+	}
+	bz, err := cdc.MarshalBinaryBare(o)
+	if err != nil {
+		return nil, err
+	}
+
+	// Copy the prefix bytes (and version) and all fields except those excluded.
+	n, err := registeredPrefixLen(bz, info)
+	if err != nil {
+		return nil, err
+	}
+	var res = make([]byte, 0, len(bz))
+	res = append(res, bz[:n]...)
+	err = scanFields(bz, info, func(fnum uint32, start, end int) {
+		if !containsFieldNum(excludeFields, fnum) {
+			res = append(res, bz[start:end]...)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// IndexBinary validates that bz decodes as the struct type of typ (which may
+// be a pointer or a nil pointer), and returns the [start, end) offsets in bz
+// of each top-level field present, by field number.  Ranges include the
+// field keys, so the range of a repeated field covers all of its entries.
+// Like MarshalBinaryBareExcluding, amino-marshalers refer to their repr.
+func (cdc *Codec) IndexBinary(bz []byte, typ interface{}) (map[uint32][2]int, error) {
+	if typ == nil {
+		return nil, errors.New("IndexBinary cannot index a nil type")
+	}
+	rt := derefType(reflect.TypeOf(typ))
+	info, err := cdc.getStructTypeInfo(rt, "IndexBinary")
+	if err != nil {
+		return nil, err
+	}
+	if err = cdc.UnmarshalBinaryBare(bz, reflect.New(rt).Interface()); err != nil {
+		return nil, err
+	}
+
+	var index = make(map[uint32][2]int)
+	err = scanFields(bz, info, func(fnum uint32, start, end int) {
+		if rng, ok := index[fnum]; ok {
+			start = rng[0]
+		}
+		index[fnum] = [2]int{start, end}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// UnmarshalBinaryBarePresence is like UnmarshalBinaryBare, but also returns
+// the field numbers of the top-level fields of the struct ptr points to that
+// are present in bz, e.g. to tell fields set to their default value apart
+// from fields left out, like proto3 presence.  Fields of nested structs
+// aren't reported.  Note that Amino:binary omits fields with default values,
+// so they're only present if encoded by another encoder.
+func (cdc *Codec) UnmarshalBinaryBarePresence(bz []byte, ptr interface{}) (map[uint32]bool, error) {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr {
+		return nil, ErrNoPointer
+	}
+	info, err := cdc.getStructTypeInfo(rv.Type(), "UnmarshalBinaryBarePresence")
+	if err != nil {
+		return nil, err
+	}
+	if err = cdc.UnmarshalBinaryBare(bz, ptr); err != nil {
+		return nil, err
+	}
+
+	var present = make(map[uint32]bool)
+	err = scanFields(bz, info, func(fnum uint32, start, end int) {
+		present[fnum] = true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return present, nil
+}
+
+// GetField decodes into out only the field at path of the struct type of
+// typ (which may be a pointer or a nil pointer) encoded in bz, as returned
+// by MarshalBinaryBare, without decoding the rest of bz.  The path is made
+// of dot-separated Go field names, e.g. "Header.Time", where all but the
+// last refer to (pointers to) structs.  out must be a pointer to the type
+// of the field, or to the type it points to.  If any field of the path
+// isn't encoded, which is also the case for empty values, the error wraps
+// ErrFieldNotFound.  Unlike UnmarshalBinaryBare, the rest of bz isn't
+// validated.
+func (cdc *Codec) GetField(bz []byte, typ interface{}, path string, out interface{}) error {
+	orv := reflect.ValueOf(out)
+	if orv.Kind() != reflect.Ptr || orv.IsNil() {
+		return ErrNoPointer
+	}
+	if typ == nil {
+		return errors.New("GetField cannot decode a nil type")
+	}
+	ds := cdc.newDecodeState()
+	defer ds.releaseBuffers()
+
+	rt := derefType(reflect.TypeOf(typ))
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		info, err := cdc.getTypeInfoWlock(rt)
+		if err != nil {
+			return err
+		}
+		if !hasStructFields(info) {
+			return fmt.Errorf("GetField cannot get field %v of %v, which isn't a struct", name, rt)
+		}
+		field, ok := info.fieldByName(name)
+		if !ok {
+			return fmt.Errorf("%v has no field %v", rt, name)
+		}
+		finfo, err := cdc.getTypeInfoWlock(field.Type)
+		if err != nil {
+			return err
+		}
+
+		// Find the entries of the field.
+		var n int
+		if i == 0 {
+			if n, err = registeredPrefixLen(bz, info); err != nil {
+				return errors.Wrap(err, "GetField")
+			}
+		}
+		var start, end = -1, -1
+		err = scanFieldsAt(bz, n, func(fnum uint32, s, e int) {
+			if fnum == field.BinFieldNum {
+				if start < 0 {
+					start = s
+				}
+				end = e
+			}
+		})
+		if err != nil {
+			return err
+		}
+		ds.pushField(name)
+		if start < 0 {
+			return errors.Wrap(ErrFieldNotFound, strings.Join(ds.path, "."))
+		}
+
+		if i == len(names)-1 {
+			// Decode the last field, like decodeReflectBinaryStruct.
+			frv := reflect.New(field.Type).Elem()
+			fbz := bz[start:end]
+			if field.UnpackedList {
+				_, err = cdc.decodeReflectBinary(ds, fbz, finfo, frv, field.FieldOptions, true)
+			} else {
+				var typ3 Typ3
+				_, typ3, n, err = decodeFieldNumberAndTyp3(fbz)
+				if err != nil {
+					return err
+				}
+				if typWanted := typeToTyp3(finfo.Type, field.FieldOptions); typ3 != typWanted {
+					return fmt.Errorf("expected field type %v for # %v of %v, got %v",
+						typWanted, field.BinFieldNum, rt, typ3)
+				}
+				_, err = cdc.decodeReflectBinary(ds, fbz[n:], finfo, frv, field.FieldOptions, false)
+			}
+			if err != nil {
+				return err
+			}
+			return setFieldOut(orv.Elem(), frv)
+		}
+
+		// Descend into the struct of the field.
+		if field.UnpackedList || field.Type.Kind() == reflect.Interface {
+			return fmt.Errorf("GetField cannot get field %v of %v %v", names[i+1], field.Type, name)
+		}
+		_, typ3, n, err := decodeFieldNumberAndTyp3(bz[start:end])
+		if err != nil {
+			return err
+		}
+		if typ3 != Typ3ByteLength {
+			return fmt.Errorf("expected field type %v for # %v of %v, got %v",
+				Typ3ByteLength, field.BinFieldNum, rt, typ3)
+		}
+		bz, _, err = DecodeByteSlice(bz[start+n : end])
+		if err != nil {
+			return err
+		}
+		rt = derefType(field.Type)
+	}
+	return nil
+}
+
+// Sets out to the value frv decoded by GetField, or to the value it points
+// to if out isn't a pointer.
+func setFieldOut(out, frv reflect.Value) error {
+	switch {
+	case out.Type() == frv.Type():
+		out.Set(frv)
+	case frv.Kind() == reflect.Ptr && out.Type() == frv.Type().Elem():
+		if frv.IsNil() {
+			out.Set(reflect.Zero(out.Type()))
+		} else {
+			out.Set(frv.Elem())
+		}
+	default:
+		return fmt.Errorf("GetField expected out to be a *%v, got *%v", frv.Type(), out.Type())
+	}
+	return nil
+}
+
+// NonCanonicalError is returned by IsCanonical when bz decodes fine but
+// isn't the canonical encoding of the decoded value.
+type NonCanonicalError struct {
+	Type      reflect.Type
+	Input     []byte
+	Reencoded []byte // The canonical encoding of the decoded value.
+}
+
+func (e *NonCanonicalError) Error() string {
+	return fmt.Sprintf("non-canonical encoding of %v: got %X, expected %X", e.Type, e.Input, e.Reencoded)
+}
+
+// IsCanonical decodes bz as the type of typ (which may be a pointer or a nil
+// pointer) with UnmarshalBinaryBare, re-encodes the result, and reports
+// whether that is byte-identical to bz.  E.g. non-minimal varints or fields
+// out of order are decodable but not canonical.  If bz isn't canonical, the
+// error is a *NonCanonicalError holding the re-encoded bytes.  Decoding and
+// encoding errors are returned as is.  So it never returns false with a nil
+// error.
+func (cdc *Codec) IsCanonical(bz []byte, typ interface{}) (bool, error) {
+	if typ == nil {
+		return false, errors.New("IsCanonical cannot decode into a nil type")
+	}
+	rt := derefType(reflect.TypeOf(typ))
+	prv := reflect.New(rt)
+	if err := cdc.UnmarshalBinaryBare(bz, prv.Interface()); err != nil {
+		return false, err
+	}
+	bz2, err := cdc.MarshalBinaryBare(prv.Elem().Interface())
+	if err != nil {
+		return false, err
+	}
+	if !bytes.Equal(bz, bz2) {
+		return false, &NonCanonicalError{Type: rt, Input: bz, Reencoded: bz2}
+	}
+	return true, nil
+}
+
+// EqualBinary reports whether a and b have the same Amino:binary encoding,
+// or if they're of a registered type with ConcreteOptions.Equal, whether
+// that function considers them equal.  Values of different types are never
+// equal.
+func (cdc *Codec) EqualBinary(a, b interface{}) (bool, error) {
+	rt := reflect.TypeOf(a)
+	if rt == nil || reflect.TypeOf(b) != rt {
+		return false, nil
+	}
+	if equal := cdc.getEqualFunc(rt); equal != nil {
+		return equal(a, b), nil
+	}
+	bza, err := cdc.MarshalBinaryBare(a)
+	if err != nil {
+		return false, err
+	}
+	bzb, err := cdc.MarshalBinaryBare(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(bza, bzb), nil
+}
+
+// DedupBinary returns elements without those equal to an earlier one, as
+// per EqualBinary, keeping the order of the rest.  Elements of different
+// types are never equal.
+func (cdc *Codec) DedupBinary(elements []interface{}) ([]interface{}, error) {
+	var (
+		deduped   = make([]interface{}, 0, len(elements))
+		encodings = make(map[reflect.Type]map[string]struct{})
+		byEqual   = make(map[reflect.Type][]interface{}) // For types with ConcreteOptions.Equal.
+	)
+	for _, o := range elements {
+		rt := reflect.TypeOf(o)
+		if rt == nil {
+			return nil, errors.New("DedupBinary cannot encode a nil element")
+		}
+		if equal := cdc.getEqualFunc(rt); equal != nil {
+			dup := false
+			for _, kept := range byEqual[rt] {
+				if dup = equal(kept, o); dup {
+					break
+				}
+			}
+			if !dup {
+				byEqual[rt] = append(byEqual[rt], o)
+				deduped = append(deduped, o)
+			}
+			continue
+		}
+		bz, err := cdc.MarshalBinaryBare(o)
+		if err != nil {
+			return nil, err
+		}
+		if encodings[rt] == nil {
+			encodings[rt] = make(map[string]struct{})
+		}
+		if _, ok := encodings[rt][string(bz)]; ok {
+			continue
+		}
+		encodings[rt][string(bz)] = struct{}{}
+		deduped = append(deduped, o)
+	}
+	return deduped, nil
+}
+
+// EqualBinaryIgnoring reports whether a and b have the same Amino:binary
+// encoding, after setting the fields at each of ignoreFields to their zero
+// values, e.g. to compare the meaningful content of messages regardless of
+// their timestamps or signatures.  Field paths are dot-separated Go field
+// names, as for UnmarshalBinaryBareWithHints, and a field within a list is
+// ignored in every element.  a and b themselves aren't modified.  The
+// copies are then compared like with EqualBinary.
+func (cdc *Codec) EqualBinaryIgnoring(a, b interface{}, ignoreFields ...string) (bool, error) {
+	rt := reflect.TypeOf(a)
+	if rt == nil || reflect.TypeOf(b) != rt {
+		return false, nil
+	}
+	var paths = make([][]string, 0, len(ignoreFields))
+	for _, path := range ignoreFields {
+		if path == "" {
+			return false, errors.New("cannot ignore an empty field path")
+		}
+		if _, err := fieldTypeByPath(rt, path); err != nil {
+			return false, err
+		}
+		paths = append(paths, strings.Split(path, "."))
+	}
+	var cpys [2]interface{}
+	for i, o := range []interface{}{a, b} {
+		cpy := reflect.New(rt).Elem()
+		cpy.Set(reflect.ValueOf(o))
+		for _, names := range paths {
+			zeroFieldByPath(cpy, names)
+		}
+		cpys[i] = cpy.Interface()
+	}
+	return cdc.EqualBinary(cpys[0], cpys[1])
+}
+
+// MarshalBinaryBareFields is like MarshalBinaryBare, but o must be a struct
+// (or a pointer to one), and the numbers of its fields that were written
+// are returned too, in the order written, e.g. to audit which optional
+// fields were set, since fields with default values are omitted.  Only the
+// fields of o itself are reported, not those of the structs within it.
+func (cdc *Codec) MarshalBinaryBareFields(o interface{}) ([]byte, []uint32, error) {
+	if o == nil {
+		return nil, nil, errors.New("MarshalBinaryBareFields expects a struct, got nil")
+	}
+	rt := derefType(reflect.TypeOf(o))
+	info, err := cdc.getTypeInfoWlock(rt)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !hasStructFields(info) {
+		return nil, nil, fmt.Errorf("MarshalBinaryBareFields expects a struct, got %v", rt)
+	}
+	bz, err := cdc.MarshalBinaryBare(o)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var fnums []uint32
+	err = scanFields(bz, info, func(fnum uint32, start, end int) {
+		// The entries of unpacked lists (and maps) have the same number.
+		if len(fnums) == 0 || fnums[len(fnums)-1] != fnum {
+			fnums = append(fnums, fnum)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return bz, fnums, nil
+}
+
+// MarshalBinaryBareMasked is like MarshalBinaryBare, but only encodes the
+// fields at the given paths (and the structs containing them), like a
+// protobuf FieldMask, e.g. for partial updates.  The other fields are
+// omitted, as if they had their zero values.  Field paths are dot-separated
+// Go field names, as for EqualBinaryIgnoring, and a field within a list is
+// kept in every element.  o itself isn't modified.
+func (cdc *Codec) MarshalBinaryBareMasked(o interface{}, paths []string) ([]byte, error) {
+	rt := reflect.TypeOf(o)
+	if rt == nil {
+		return nil, errors.New("cannot mask fields of nil")
+	}
+	var mask = make(fieldMask)
+	for _, path := range paths {
+		if path == "" {
+			return nil, errors.New("cannot mask an empty field path")
+		}
+		if _, err := fieldTypeByPath(rt, path); err != nil {
+			return nil, err
+		}
+		mask.add(path)
+	}
+	cpy := reflect.New(rt).Elem()
+	cpy.Set(reflect.ValueOf(o))
+	zeroUnmaskedFields(cpy, mask)
+	return cdc.MarshalBinaryBare(cpy.Interface())
+}
+
+// Transcode decodes bz as the type of typ (which may be a pointer or a nil
+// pointer) with UnmarshalBinaryBare of src, and re-encodes the result with
+// MarshalBinaryBare of dst, e.g. to migrate stored data after renaming
+// registered types, which changes their prefix bytes, or changing field
+// options such as `binary:"fixed64"`.  Both codecs decode into and encode
+// the same Go type, so only the registrations and options may differ:
+// fields unknown to typ are dropped, and interface values must be of
+// concrete types registered with both codecs.
+func Transcode(src *Codec, dst *Codec, bz []byte, typ interface{}) ([]byte, error) {
+	if typ == nil {
+		return nil, errors.New("transcode: cannot decode into a nil type")
+	}
+	prv := reflect.New(derefType(reflect.TypeOf(typ)))
+	if err := src.UnmarshalBinaryBare(bz, prv.Interface()); err != nil {
+		return nil, errors.Wrap(err, "transcode: decoding with src")
+	}
+	bz2, err := dst.MarshalBinaryBare(prv.Elem().Interface())
+	if err != nil {
+		return nil, errors.Wrap(err, "transcode: encoding with dst")
+	}
+	return bz2, nil
+}
+
+// Returns the TypeInfo of rt (dereferenced), if its encoding is a struct.
+func (cdc *Codec) getStructTypeInfo(rt reflect.Type, method string) (*TypeInfo, error) {
+	if rt == nil {
+		return nil, fmt.Errorf("%v expected a struct, got nil", method)
+	}
+	rt = derefType(rt)
+	info, err := cdc.getTypeInfoWlock(rt)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsAminoMarshaler {
+		rt = derefType(info.AminoMarshalReprType)
+	}
+	if rt.Kind() != reflect.Struct || rt == timeType {
+		return nil, fmt.Errorf("%v expected a struct, got %v", method, rt)
+	}
+	return info, nil
+}
+
+// Calls fn with the offsets of each top-level field of the struct encoded in
+// bz, as returned by MarshalBinaryBare, skipping the prefix bytes and version
+// if any.
+func scanFields(bz []byte, info *TypeInfo, fn func(fnum uint32, start, end int)) error {
+	n, err := registeredPrefixLen(bz, info)
+	if err != nil {
+		return err
+	}
+	return scanFieldsAt(bz, n, fn)
+}
+
+// Returns the length of the prefix bytes and version (see
+// ConcreteOptions.Version) at the start of bz, as written by
+// MarshalBinaryBare if info is registered, after checking that they're those
+// of info.  Returns 0 if info isn't registered.
+func registeredPrefixLen(bz []byte, info *TypeInfo) (int, error) {
+	if !info.Registered {
+		return 0, nil
+	}
+	pb := info.Prefix.Bytes()
+	if len(bz) < PrefixBytesLen || !bytes.Equal(bz[:PrefixBytesLen], pb) {
+		return 0, fmt.Errorf("expected prefix bytes %X of %v", pb, info.Type)
+	}
+	n := PrefixBytesLen
+	if info.Version > 0 {
+		version, _n, err := DecodeUvarint(bz[n:])
+		if err != nil {
+			return 0, errors.Wrapf(err, "could not decode version of %v", info.Name)
+		}
+		if version != uint64(info.Version) {
+			return 0, fmt.Errorf("expected version %v of %v, got %v", info.Version, info.Name, version)
+		}
+		n += _n
+	}
+	return n, nil
+}
+
+// Like scanFields, but starts at offset n of bz.
+func scanFieldsAt(bz []byte, n int, fn func(fnum uint32, start, end int)) error {
+	for n < len(bz) {
+		fnum, typ, _n, err := decodeFieldNumberAndTyp3(bz[n:])
+		if err != nil {
+			return err
+		}
+		_n2, err := consumeAny(typ, bz[n+_n:])
+		if err != nil {
+			return err
+		}
+		fn(fnum, n, n+_n+_n2)
+		n += _n + _n2
+	}
+	return nil
+}
+
+func containsFieldNum(fnums []uint32, fnum uint32) bool {
+	for _, f := range fnums {
+		if f == fnum {
+			return true
+		}
+	}
+	return false
 }
 
 // Like UnmarshalBinaryBare, but will first decode the byte-length prefix.
@@ -267,10 +1040,14 @@ func (cdc *Codec) UnmarshalBinaryLengthPrefixed(bz []byte, ptr interface{}) erro
 	}
 
 	// Read byte-length prefix.
+	ds := cdc.newDecodeState()
 	u64, n := binary.Uvarint(bz)
 	if n < 0 {
 		return errors.Errorf("Error reading msg byte-length prefix: got code %v", n)
 	}
+	if ds.rejectNonMinVarints && isNonMinimalVarint(bz) {
+		return errors.Errorf("non-minimal varint in msg byte-length prefix %X", bz[:n])
+	}
 	if u64 > uint64(len(bz)-n) {
 		return errors.Errorf("Not enough bytes to read in UnmarshalBinaryLengthPrefixed, want %v more bytes but only have %v",
 			u64, len(bz)-n)
@@ -281,6 +1058,150 @@ func (cdc *Codec) UnmarshalBinaryLengthPrefixed(bz []byte, ptr interface{}) erro
 	bz = bz[n:]
 
 	// Decode.
+	return cdc.unmarshalBinaryBare(ds, bz, ptr)
+}
+
+// UnmarshalBinaryLengthPrefixedN is like UnmarshalBinaryLengthPrefixed, but
+// decodes only the first length-prefixed message in bz, and returns the
+// number of bytes read (prefix and body), i.e. where the next message starts.
+func (cdc *Codec) UnmarshalBinaryLengthPrefixedN(bz []byte, ptr interface{}) (n int, err error) {
+	if len(bz) == 0 {
+		return 0, errors.New("UnmarshalBinaryLengthPrefixedN cannot decode empty bytes")
+	}
+
+	// Read byte-length prefix.
+	ds := cdc.newDecodeState()
+	u64, n := binary.Uvarint(bz)
+	if n <= 0 {
+		return 0, errors.Errorf("Error reading msg byte-length prefix: got code %v", n)
+	}
+	if ds.rejectNonMinVarints && isNonMinimalVarint(bz) {
+		return 0, errors.Errorf("non-minimal varint in msg byte-length prefix %X", bz[:n])
+	}
+	if u64 > uint64(len(bz)-n) {
+		return 0, errors.Errorf("Not enough bytes to read in UnmarshalBinaryLengthPrefixedN, want %v more bytes but only have %v",
+			u64, len(bz)-n)
+	}
+
+	// Decode.
+	if err = cdc.unmarshalBinaryBare(ds, bz[n:n+int(u64)], ptr); err != nil {
+		return 0, err
+	}
+	return n + int(u64), nil
+}
+
+// UnmarshalBinaryPadded decodes bz as encoded by MarshalBinaryPadded with
+// the same blockSize.  The length of bz must be a multiple of blockSize, and
+// the padding must be the fewest zero bytes to get there.
+func (cdc *Codec) UnmarshalBinaryPadded(bz []byte, ptr interface{}, blockSize int) error {
+	if blockSize <= 0 {
+		return errors.Errorf("invalid block size %v", blockSize)
+	}
+	if len(bz)%blockSize != 0 {
+		return errors.Errorf("UnmarshalBinaryPadded expected a multiple of %v bytes, got %v", blockSize, len(bz))
+	}
+	n, err := cdc.UnmarshalBinaryLengthPrefixedN(bz, ptr)
+	if err != nil {
+		return err
+	}
+	padding := bz[n:]
+	if len(padding) >= blockSize {
+		return errors.Errorf("UnmarshalBinaryPadded expected less than %v bytes of padding, got %v", blockSize, len(padding))
+	}
+	for _, b := range padding {
+		if b != 0x00 {
+			return errors.Errorf("UnmarshalBinaryPadded expected zero padding, got %X", padding)
+		}
+	}
+	return nil
+}
+
+// UnmarshalBinaryChecksummed decodes bz as encoded by
+// MarshalBinaryChecksummed with the same checksum hash, after verifying the
+// checksum.  A checksum that doesn't match returns ErrChecksumMismatch
+// (wrapped, use errors.Cause) without decoding.
+func (cdc *Codec) UnmarshalBinaryChecksummed(bz []byte, ptr interface{}) error {
+	h := cdc.newChecksumHash()
+	size := h.Size()
+	if len(bz) < size {
+		return errors.Errorf("UnmarshalBinaryChecksummed expected at least %v bytes of checksum, got %v", size, len(bz))
+	}
+	payload, sum := bz[:len(bz)-size], bz[len(bz)-size:]
+	h.Write(payload) // nolint: errcheck
+	if want := h.Sum(nil); !bytes.Equal(sum, want) {
+		return errors.Wrapf(ErrChecksumMismatch, "expected %X, got %X", want, sum)
+	}
+	return cdc.UnmarshalBinaryBare(payload, ptr)
+}
+
+// UnmarshalBinaryBareInterned decodes bz as encoded by
+// MarshalBinaryBareInterned into ptr.  String indices out of the range of the
+// string table return an error.
+func (cdc *Codec) UnmarshalBinaryBareInterned(bz []byte, ptr interface{}) error {
+	ds := cdc.newDecodeState()
+	count, n, err := DecodeUvarint(bz)
+	if err != nil {
+		return errors.Wrap(err, "UnmarshalBinaryBareInterned could not decode string table size")
+	}
+	bz = bz[n:]
+	// Each string takes at least one byte, so don't trust a larger count.
+	if count > uint64(len(bz)) {
+		return errors.Errorf("UnmarshalBinaryBareInterned string table size %v exceeds %v remaining bytes", count, len(bz))
+	}
+	ds.strings = make([]string, count)
+	for i := range ds.strings {
+		str, n, err := DecodeString(bz)
+		if err != nil {
+			return errors.Wrapf(err, "UnmarshalBinaryBareInterned could not decode string table entry %v", i)
+		}
+		if err = ds.alloc(len(str)); err != nil {
+			return err
+		}
+		if ds.validateUTF8 && !utf8.ValidString(str) {
+			return errors.Errorf("UnmarshalBinaryBareInterned got invalid UTF-8 in string table entry %v", i)
+		}
+		ds.strings[i] = str
+		bz = bz[n:]
+	}
+	return cdc.unmarshalBinaryBare(ds, bz, ptr)
+}
+
+// UnmarshalBinarySelfDescribing decodes bz as written by
+// MarshalBinarySelfDescribing into ptr, and returns an error if the type
+// name or schema hash in bz doesn't match the current type of ptr.  If ptr
+// points to an interface, the registered concrete type of that name is
+// checked instead.
+func (cdc *Codec) UnmarshalBinarySelfDescribing(bz []byte, ptr interface{}) error {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr {
+		return ErrNoPointer
+	}
+	hash, n, err := DecodeByteSlice(bz)
+	if err != nil {
+		return errors.Wrap(err, "UnmarshalBinarySelfDescribing could not decode schema hash")
+	}
+	bz = bz[n:]
+	name, n, err := DecodeString(bz)
+	if err != nil {
+		return errors.Wrap(err, "UnmarshalBinarySelfDescribing could not decode type name")
+	}
+	bz = bz[n:]
+	rt := rv.Type().Elem()
+	if rt.Kind() == reflect.Interface {
+		info, err := cdc.getTypeInfoFromNameRlock(name)
+		if err != nil {
+			return err
+		}
+		rt = info.Type
+	}
+	wantHash, wantName, err := cdc.schemaHashAndName(rt)
+	if err != nil {
+		return err
+	}
+	if name != wantName || !bytes.Equal(hash, wantHash) {
+		return fmt.Errorf("schema mismatch, got %v with schema hash %X, expected %v with schema hash %X",
+			name, hash, wantName, wantHash)
+	}
 	return cdc.UnmarshalBinaryBare(bz, ptr)
 }
 
@@ -337,7 +1258,9 @@ func (cdc *Codec) UnmarshalBinaryLengthPrefixedReader(r io.Reader, ptr interface
 	}
 
 	// Read that many bytes.
-	var bz = make([]byte, l)
+	ds := cdc.newDecodeState()
+	defer ds.releaseBuffers()
+	bz := ds.getBuffer(int(l))
 	_, err = io.ReadFull(r, bz)
 	if err != nil {
 		return
@@ -345,7 +1268,7 @@ func (cdc *Codec) UnmarshalBinaryLengthPrefixedReader(r io.Reader, ptr interface
 	n += l
 
 	// Decode.
-	err = cdc.UnmarshalBinaryBare(bz, ptr)
+	err = cdc.unmarshalBinaryBare(ds, bz, ptr)
 	return n, err
 }
 
@@ -359,20 +1282,245 @@ func (cdc *Codec) MustUnmarshalBinaryLengthPrefixed(bz []byte, ptr interface{})
 
 // UnmarshalBinaryBare will panic if ptr is a nil-pointer.
 func (cdc *Codec) UnmarshalBinaryBare(bz []byte, ptr interface{}) error {
+	return cdc.unmarshalBinaryBare(cdc.newDecodeState(), bz, ptr)
+}
+
+// UnmarshalBinaryBareValue is like UnmarshalBinaryBare, but decodes into rv
+// itself rather than into what a pointer points to, e.g. a struct field or
+// slice element from reflection in generated code.  rv must be settable,
+// i.e. addressable and not obtained through unexported fields.
+func (cdc *Codec) UnmarshalBinaryBareValue(bz []byte, rv reflect.Value) error {
+	if !rv.IsValid() {
+		return errors.New("UnmarshalBinaryBareValue cannot decode into an invalid reflect.Value")
+	}
+	if !rv.CanSet() {
+		return errors.Errorf("UnmarshalBinaryBareValue cannot decode into an unsettable %v", rv.Type())
+	}
+	return cdc.unmarshalBinaryBareValue(cdc.newDecodeState(), bz, rv)
+}
+
+// UnmarshalBinaryBareAs is like UnmarshalBinaryBare, but expects the prefix
+// bytes of the registration named name of the concrete type of ptr, rather
+// than of its first registration.  See MarshalBinaryBareAs.
+func (cdc *Codec) UnmarshalBinaryBareAs(name string, bz []byte, ptr interface{}) error {
+	ds := cdc.newDecodeState()
+	ds.asName = name
+	return cdc.unmarshalBinaryBare(ds, bz, ptr)
+}
+
+// UnmarshalProto decodes a protobuf message encoded by another library,
+// e.g. gogoproto, into ptr, on a best-effort basis.  It's like
+// UnmarshalBinaryBare, except that no prefix bytes are expected even if the
+// type of ptr is a registered concrete type, since Amino:binary struct
+// fields are encoded like protobuf fields.  Repeated scalar fields may be
+// packed or not, and fields unknown to ptr are skipped.  Limitations:
+//   - The protobuf field numbers must be those of the Go struct fields,
+//     i.e. 1, 2, 3... in declaration order, and fields must be encoded in
+//     that order, as most protobuf libraries do.
+//   - Interface fields don't map to oneofs or Any, as they expect Amino
+//     prefix bytes in their values.
+//   - There are no equivalents of sint32/sint64 (zigzag) or fixed-width
+//     fields other than with `binary:"fixed32"` and `binary:"fixed64"`.
+func (cdc *Codec) UnmarshalProto(bz []byte, ptr interface{}) error {
+	ds := cdc.newDecodeState()
+	ds.noPrefix = true
+	return cdc.unmarshalBinaryBare(ds, bz, ptr)
+}
+
+// UnmarshalBinaryBareAny decodes bz as each of the types of candidates in
+// turn, and returns the value of the first one that decodes, e.g. to tell
+// which of a few known types some data is.  Decoding is like with
+// UnmarshalBinaryBare, so all of bz must be read, except that unknown
+// struct fields are rejected rather than skipped, so that data of a type
+// with more fields doesn't decode as a type with a subset of them.
+// Candidates are instances of the types, like in RegisterConcrete, and the
+// value is returned as a pointer if the candidate is one.  If none decodes,
+// the error lists the error of each candidate.
+func (cdc *Codec) UnmarshalBinaryBareAny(bz []byte, candidates ...interface{}) (interface{}, error) {
+	if len(candidates) == 0 {
+		return nil, errors.New("UnmarshalBinaryBareAny needs at least one candidate")
+	}
+	var errs = make([]string, 0, len(candidates))
+	var opts = cdc.decodeOptions()
+	for _, candidate := range candidates {
+		rt := reflect.TypeOf(candidate)
+		if rt == nil {
+			return nil, errors.New("UnmarshalBinaryBareAny cannot decode into a nil candidate")
+		}
+		prv := reflect.New(derefType(rt))
+		ds := &decodeState{decodeOptions: opts, rejectUnknownFields: true}
+		err := cdc.unmarshalBinaryBare(ds, bz, prv.Interface())
+		if err == nil {
+			if rt.Kind() == reflect.Ptr {
+				return prv.Interface(), nil
+			}
+			return prv.Elem().Interface(), nil
+		}
+		errs = append(errs, fmt.Sprintf("%v: %v", rt, err))
+	}
+	return nil, fmt.Errorf("UnmarshalBinaryBareAny could not decode any candidate: %v", strings.Join(errs, "; "))
+}
+
+// UnmarshalBinaryBareTyped is like UnmarshalBinaryBare, but ifacePtr must
+// point to an interface (e.g. *interface{}), and the concrete type decoded
+// into it is returned, or nil if it decoded to nil.
+func (cdc *Codec) UnmarshalBinaryBareTyped(bz []byte, ifacePtr interface{}) (reflect.Type, error) {
+	rv := reflect.ValueOf(ifacePtr)
+	if rv.Kind() != reflect.Ptr {
+		return nil, ErrNoPointer
+	}
+	if rv.Elem().Kind() != reflect.Interface {
+		return nil, fmt.Errorf("UnmarshalBinaryBareTyped expected a pointer to an interface, got %v", rv.Type())
+	}
+	if err := cdc.UnmarshalBinaryBare(bz, ifacePtr); err != nil {
+		return nil, err
+	}
+	if rv.Elem().IsNil() {
+		return nil, nil
+	}
+	return rv.Elem().Elem().Type(), nil
+}
 
+// UnmarshalBinaryBareWithHints is like UnmarshalBinaryBare, but decodes the
+// interface values found at the given field paths as the hinted concrete
+// types, regardless of their prefix bytes.  This is useful to reinterpret
+// old data with an evolved type during migrations.
+//
+// Field paths are dot-separated Go field names relative to ptr, e.g.
+// "Header.Pubkey"; the empty path refers to ptr itself.  A hint applies to
+// all elements when the field is a list of interfaces.  Hint values are
+// instances of the concrete type, like in RegisterConcrete, and must be
+// registered concrete types that implement the field's interface.
+func (cdc *Codec) UnmarshalBinaryBareWithHints(bz []byte, ptr interface{}, hints map[string]interface{}) error {
 	rv := reflect.ValueOf(ptr)
 	if rv.Kind() != reflect.Ptr {
 		return ErrNoPointer
 	}
-	rv = rv.Elem()
+	ds, err := cdc.newDecodeStateWithHints(rv.Type().Elem(), hints)
+	if err != nil {
+		return err
+	}
+	return cdc.unmarshalBinaryBare(ds, bz, ptr)
+}
+
+// UnmarshalBinaryBareCollectErrors is like UnmarshalBinaryBare, but doesn't
+// stop at the first struct field that fails to decode, e.g. due to a
+// mismatched wire type.  Such fields are skipped and left with their default
+// value, and their errors are all returned together as FieldErrors.  Errors
+// that make it impossible to skip a field, e.g. truncated input, are still
+// returned as is.
+func (cdc *Codec) UnmarshalBinaryBareCollectErrors(bz []byte, ptr interface{}) error {
+	ds := cdc.newDecodeState()
+	ds.collectErrors = true
+	err := cdc.unmarshalBinaryBare(ds, bz, ptr)
+	if err != nil {
+		return err
+	}
+	if len(ds.fieldErrors) > 0 {
+		return ds.fieldErrors
+	}
+	return nil
+}
+
+// UnmarshalBinaryBareMapFunc decodes bz as encoded by MarshalBinaryBare of a
+// map (see SetAllowMaps), without constructing the map.  Instead, fn is called
+// with the key and value of each entry, in encoded order, e.g. to populate a
+// sync.Map.  Keys and values are decoded as the types of keyTemplate and
+// valueTemplate, which needn't be registered, and fn is called with values of
+// those types.  As with DecodeJSONArrayStream, if valueTemplate is a (nil)
+// pointer to an interface, values are decoded as that interface.  Unlike when
+// decoding a map, duplicate keys aren't detected.
+func (cdc *Codec) UnmarshalBinaryBareMapFunc(bz []byte, keyTemplate, valueTemplate interface{},
+	fn func(key, value interface{})) error {
+	krt, vrt := reflect.TypeOf(keyTemplate), reflect.TypeOf(valueTemplate)
+	if krt == nil || vrt == nil {
+		return errors.New("UnmarshalBinaryBareMapFunc cannot decode into a nil template")
+	}
+	if !isMapKeyKind(krt.Kind()) {
+		return fmt.Errorf("unsupported map key type %v, must be a string or integer", krt)
+	}
+	if vrt.Kind() == reflect.Ptr && vrt.Elem().Kind() == reflect.Interface {
+		vrt = vrt.Elem()
+	}
+	kinfo, err := cdc.getTypeInfoWlock(krt)
+	if err != nil {
+		return err
+	}
+	vinfo, err := cdc.getTypeInfoWlock(vrt)
+	if err != nil {
+		return err
+	}
+
+	ds := cdc.newDecodeState()
+	defer ds.releaseBuffers()
+	n, err := cdc.decodeBinaryMapEntries(ds, bz, reflect.MapOf(krt, vrt), kinfo, vinfo, FieldOptions{BinFieldNum: 1},
+		func(krv, vrv reflect.Value) error {
+			fn(krv.Interface(), vrv.Interface())
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	if n != len(bz) {
+		return fmt.Errorf("unmarshal to map of %v to %v didn't read all bytes. Expected to read %v, only read %v: %X",
+			krt, vrt, len(bz), n, bz)
+	}
+	return nil
+}
+
+// Validates the type hints for decoding into rt, see UnmarshalBinaryBareWithHints.
+func (cdc *Codec) newDecodeStateWithHints(rt reflect.Type, hints map[string]interface{}) (*decodeState, error) {
+	ds := cdc.newDecodeState()
+	ds.hints = make(map[string]*TypeInfo, len(hints))
+	for path, o := range hints {
+		irt, err := fieldTypeByPath(rt, path)
+		if err != nil {
+			return nil, err
+		}
+		irt = derefListType(irt)
+		if irt.Kind() != reflect.Interface {
+			return nil, errors.Errorf("type hint for %q: expected an interface field, got %v", path, irt)
+		}
+		cinfo, err := cdc.getTypeInfoWlock(reflect.TypeOf(o))
+		if err != nil {
+			return nil, err
+		}
+		if !cinfo.Registered {
+			return nil, errors.Errorf("type hint for %q: %v is not a registered concrete type", path, cinfo.Type)
+		}
+		if !cinfo.PtrToType.Implements(irt) {
+			return nil, errors.Errorf("type hint for %q: %v does not implement %v", path, cinfo.Type, irt)
+		}
+		ds.hints[path] = cinfo
+	}
+	return ds, nil
+}
+
+func (cdc *Codec) unmarshalBinaryBare(ds *decodeState, bz []byte, ptr interface{}) error {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr {
+		return ErrNoPointer
+	}
+	return cdc.unmarshalBinaryBareValue(ds, bz, rv.Elem())
+}
+
+// CONTRACT: rv is settable, except that it panics if rv is invalid, e.g.
+// from a nil pointer.
+func (cdc *Codec) unmarshalBinaryBareValue(ds *decodeState, bz []byte, rv reflect.Value) error {
+	defer ds.releaseBuffers()
 	rt := rv.Type()
 	info, err := cdc.getTypeInfoWlock(rt)
 	if err != nil {
 		return err
 	}
+	if ds.asName != "" {
+		if info, err = cdc.getTypeInfoForNameRlock(rt, ds.asName); err != nil {
+			return err
+		}
+	}
 
 	// If registered concrete, consume and verify prefix bytes.
-	if info.Registered {
+	if info.Registered && !ds.noPrefix {
 		// TODO: https://github.com/tendermint/go-amino/issues/267
 		pb := info.Prefix.Bytes()
 		if len(bz) < 4 {
@@ -387,6 +1535,20 @@ func (cdc *Codec) UnmarshalBinaryBare(bz []byte, ptr interface{}) error {
 			)
 		}
 		bz = bz[4:]
+		if info.Version > 0 {
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return err
+			}
+			version, n, err := DecodeUvarint(bz)
+			if err != nil {
+				return err
+			}
+			if version != uint64(info.Version) {
+				return fmt.Errorf("unmarshalBinaryBare expected version %v of %v but got %v",
+					info.Version, info.Name, version)
+			}
+			bz = bz[n:]
+		}
 	}
 	// Only add length prefix if we have another typ3 then Typ3ByteLength.
 	// Default is non-length prefixed:
@@ -412,8 +1574,8 @@ func (cdc *Codec) UnmarshalBinaryBare(bz []byte, ptr interface{}) error {
 		}
 		typWanted := typeToTyp3(info.Type, FieldOptions{})
 		if typ != typWanted {
-			return fmt.Errorf("expected field type %v for # %v of %v, got %v",
-				typWanted, fnum, info.Type, typ)
+			return ds.wireTypeError(fmt.Errorf("expected field type %v for # %v of %v, got %v",
+				typWanted, fnum, info.Type, typ), fnum, info.Type, typWanted, typ)
 		}
 
 		slide(&bz, &nWrap, nFnumTyp3)
@@ -421,8 +1583,11 @@ func (cdc *Codec) UnmarshalBinaryBare(bz []byte, ptr interface{}) error {
 	}
 
 	// Decode contents into rv.
-	n, err := cdc.decodeReflectBinary(bz, info, rv, FieldOptions{BinFieldNum: 1}, bare)
+	n, err := cdc.decodeReflectBinary(ds, bz, info, rv, FieldOptions{BinFieldNum: 1}, bare)
 	if err != nil {
+		if _, ok := errors.Cause(err).(*WireTypeError); ok {
+			return err
+		}
 		return fmt.Errorf(
 			"unmarshal to %v failed after %d bytes (%v): %X",
 			info.Type,
@@ -448,9 +1613,24 @@ func isStructOrRepeatedStruct(info *TypeInfo) bool {
 	if info.Type.Kind() == reflect.Struct {
 		return true
 	}
-	isRepeatedStructAr := info.Type.Kind() == reflect.Array && info.Type.Elem().Kind() == reflect.Struct
-	isRepeatedStructSl := info.Type.Kind() == reflect.Slice && info.Type.Elem().Kind() == reflect.Struct
-	return isRepeatedStructAr || isRepeatedStructSl
+	// Lists of struct pointers (e.g. []*time.Time) are repeated structs too.
+	isRepeatedStructAr := info.Type.Kind() == reflect.Array && derefType(info.Type.Elem()).Kind() == reflect.Struct
+	isRepeatedStructSl := info.Type.Kind() == reflect.Slice && derefType(info.Type.Elem()).Kind() == reflect.Struct
+	return isRepeatedStructAr || isRepeatedStructSl || isRepeatedByteSlice(info.Type)
+}
+
+// Returns true iff rt is a list of byte lists, e.g. [][]byte or [4][32]byte.
+// Like repeated structs, these are encoded as repeated length-delimited
+// fields, one entry per inner byte list.
+func isRepeatedByteSlice(rt reflect.Type) bool {
+	if rt.Kind() != reflect.Array && rt.Kind() != reflect.Slice {
+		return false
+	}
+	ert := rt.Elem()
+	if ert.Kind() != reflect.Array && ert.Kind() != reflect.Slice {
+		return false
+	}
+	return ert.Elem().Kind() == reflect.Uint8
 }
 
 func isPointerToStructOrToRepeatedStruct(rv reflect.Value, rt reflect.Type) bool {
@@ -493,38 +1673,71 @@ func (cdc *Codec) MustUnmarshalBinaryBare(bz []byte, ptr interface{}) {
 }
 
 func (cdc *Codec) MarshalJSON(o interface{}) ([]byte, error) {
+	w := new(bytes.Buffer)
+	if err := cdc.marshalJSON(w, o); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// MarshalJSONAs is like MarshalJSON, but encodes o with the name of its
+// registration named name, see MarshalBinaryBareAs.
+func (cdc *Codec) MarshalJSONAs(name string, o interface{}) ([]byte, error) {
+	w := new(bytes.Buffer)
+	if err := cdc.marshalJSONAs(w, o, name); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+func (cdc *Codec) marshalJSON(w io.Writer, o interface{}) error {
+	return cdc.marshalJSONAs(w, o, "")
+}
+
+// If name is empty, o is encoded with its default registration, if any.
+func (cdc *Codec) marshalJSONAs(w io.Writer, o interface{}, name string) error {
+	return cdc.marshalJSONState(cdc.newEncodeState(), w, o, name)
+}
+
+// Like marshalJSONAs, but with the given encode state.
+func (cdc *Codec) marshalJSONState(es *encodeState, w io.Writer, o interface{}, name string) error {
 	rv := reflect.ValueOf(o)
 	if rv.Kind() == reflect.Invalid {
-		return []byte("null"), nil
+		return writeStr(w, "null")
 	}
 	rt := rv.Type()
-	w := new(bytes.Buffer)
 	info, err := cdc.getTypeInfoWlock(rt)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if name != "" {
+		if info, err = cdc.getTypeInfoForNameRlock(rt, name); err != nil {
+			return err
+		}
 	}
 
 	// Write the disfix wrapper if it is a registered concrete type.
-	if info.Registered {
-		err = writeStr(w, _fmt(`{"type":"%s","value":`, info.Name))
+	wrap := info.Registered && !es.bareJSON
+	if wrap {
+		err = writeJSONWrapperStart(w, info)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
 
 	// Write the rest from rv.
-	if err = cdc.encodeReflectJSON(w, info, rv, FieldOptions{}); err != nil {
-		return nil, err
+	if err = cdc.encodeReflectJSON(es, w, info, rv, FieldOptions{}); err != nil {
+		return err
 	}
 
 	// disfix wrapper continued...
-	if info.Registered {
+	if wrap {
 		err = writeStr(w, `}`)
 		if err != nil {
-			return nil, err
+			return err
 		}
 	}
-	return w.Bytes(), nil
+	return nil
 }
 
 // MustMarshalJSON panics if an error occurs. Besides that behaves exactly like MarshalJSON.
@@ -537,10 +1750,38 @@ func (cdc *Codec) MustMarshalJSON(o interface{}) []byte {
 }
 
 func (cdc *Codec) UnmarshalJSON(bz []byte, ptr interface{}) error {
+	return cdc.unmarshalJSON(cdc.newDecodeState(), bz, ptr)
+}
+
+// UnmarshalJSONAs is like UnmarshalJSON, but expects the name of the
+// registration named name of the concrete type of ptr, see
+// UnmarshalBinaryBareAs.
+func (cdc *Codec) UnmarshalJSONAs(name string, bz []byte, ptr interface{}) error {
+	ds := cdc.newDecodeState()
+	ds.asName = name
+	return cdc.unmarshalJSON(ds, bz, ptr)
+}
+
+// UnmarshalJSONWithHints is like UnmarshalJSON, but decodes the interface
+// values found at the given field paths as the hinted concrete types.  See
+// UnmarshalBinaryBareWithHints for the format of hints.  Hints are also used
+// to decode bare (not enveloped) interface values.
+func (cdc *Codec) UnmarshalJSONWithHints(bz []byte, ptr interface{}, hints map[string]interface{}) error {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Ptr {
+		return errors.New("expected a pointer")
+	}
+	ds, err := cdc.newDecodeStateWithHints(rv.Type().Elem(), hints)
+	if err != nil {
+		return err
+	}
+	return cdc.unmarshalJSON(ds, bz, ptr)
+}
+
+func (cdc *Codec) unmarshalJSON(ds *decodeState, bz []byte, ptr interface{}) error {
 	if len(bz) == 0 {
 		return errors.New("cannot decode empty bytes")
 	}
-
 	rv := reflect.ValueOf(ptr)
 	if rv.Kind() != reflect.Ptr {
 		return errors.New("expected a pointer")
@@ -551,10 +1792,15 @@ func (cdc *Codec) UnmarshalJSON(bz []byte, ptr interface{}) error {
 	if err != nil {
 		return err
 	}
+	if ds.asName != "" {
+		if info, err = cdc.getTypeInfoForNameRlock(rt, ds.asName); err != nil {
+			return err
+		}
+	}
 	// If registered concrete, consume and verify type wrapper.
-	if info.Registered {
+	if info.Registered && !ds.bareJSON {
 		// Consume type wrapper info.
-		name, data, err := decodeInterfaceJSON(bz)
+		name, version, data, err := decodeInterfaceJSON(bz)
 		if err != nil {
 			return err
 		}
@@ -562,9 +1808,12 @@ func (cdc *Codec) UnmarshalJSON(bz []byte, ptr interface{}) error {
 		if name != info.Name {
 			return errors.Errorf("wanted to decode %v but found %v", info.Name, name)
 		}
+		if version != info.Version {
+			return errors.Errorf("wanted to decode version %v of %v but found %v", info.Version, info.Name, version)
+		}
 		bz = data
 	}
-	return cdc.decodeReflectJSON(bz, info, rv, FieldOptions{})
+	return cdc.decodeReflectJSON(ds, bz, info, rv, FieldOptions{})
 }
 
 // MustUnmarshalJSON panics if an error occurs. Besides that behaves exactly like UnmarshalJSON.
@@ -575,16 +1824,151 @@ func (cdc *Codec) MustUnmarshalJSON(bz []byte, ptr interface{}) {
 }
 
 // MarshalJSONIndent calls json.Indent on the output of cdc.MarshalJSON
-// using the given prefix and indent string.
+// using the given prefix and indent string.  If enabled with
+// SetJSONComments, field comments are included.
 func (cdc *Codec) MarshalJSONIndent(o interface{}, prefix, indent string) ([]byte, error) {
+	es := cdc.newEncodeState()
+	buf := new(bytes.Buffer)
+	var w io.Writer = buf
+	if es.jsonComments {
+		w = &jsonCommentWriter{buf}
+	}
+	if err := cdc.marshalJSONState(es, w, o, ""); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	err := json.Indent(&out, buf.Bytes(), prefix, indent)
+	if err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// MarshalJSONGzip is like MarshalJSON, but gzip-compresses the output.
+func (cdc *Codec) MarshalJSONGzip(o interface{}) ([]byte, error) {
 	bz, err := cdc.MarshalJSON(o)
 	if err != nil {
 		return nil, err
 	}
 	var out bytes.Buffer
-	err = json.Indent(&out, bz, prefix, indent)
-	if err != nil {
+	zw := gzip.NewWriter(&out)
+	if _, err = zw.Write(bz); err != nil {
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
 		return nil, err
 	}
 	return out.Bytes(), nil
 }
+
+// UnmarshalJSONGzip is like UnmarshalJSON, but first decompresses bz if it
+// starts with the gzip magic bytes, as written by MarshalJSONGzip.  Otherwise
+// bz is decoded as plain JSON.  The decompressed size is limited by
+// SetMaxDecompressedSize.
+func (cdc *Codec) UnmarshalJSONGzip(bz []byte, ptr interface{}) error {
+	ds := cdc.newDecodeState()
+	if len(bz) >= 2 && bz[0] == 0x1f && bz[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(bz))
+		if err != nil {
+			return errors.Wrap(err, "UnmarshalJSONGzip")
+		}
+		limit := ds.maxDecompressedSize
+		// Read one byte more than the limit, to tell if it's exceeded.
+		bz, err = ioutil.ReadAll(io.LimitReader(zr, int64(limit)+1))
+		if err != nil {
+			return errors.Wrap(err, "UnmarshalJSONGzip")
+		}
+		if len(bz) > limit {
+			return errors.Errorf("UnmarshalJSONGzip decompressed JSON exceeds max size %v", limit)
+		}
+	}
+	return cdc.unmarshalJSON(ds, bz, ptr)
+}
+
+// DecodeJSONArrayStream decodes a JSON array from r one element at a time,
+// so that arbitrarily large arrays can be processed in constant memory.  Each
+// element is decoded with UnmarshalJSON as the type of elemTemplate, and fn
+// is called with the decoded value, of the same type as elemTemplate.  If
+// elemTemplate is a (nil) pointer to an interface, e.g. (*MyInterface)(nil),
+// elements are decoded as that interface (from the type/value envelope), and
+// fn is called with their concrete values.  Decoding stops at the first error,
+// including any returned by fn, which is returned as is.
+func (cdc *Codec) DecodeJSONArrayStream(r io.Reader, elemTemplate interface{}, fn func(interface{}) error) error {
+	ert := reflect.TypeOf(elemTemplate)
+	if ert == nil {
+		return errors.New("DecodeJSONArrayStream cannot decode into a nil template")
+	}
+	if ert.Kind() == reflect.Ptr && ert.Elem().Kind() == reflect.Interface {
+		ert = ert.Elem()
+	}
+
+	opts := cdc.decodeOptions()
+	dec := json.NewDecoder(r)
+	if err := expectJSONDelim(dec, '['); err != nil {
+		return err
+	}
+	for i := 0; dec.More(); i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return errors.Wrapf(err, "DecodeJSONArrayStream reading element %v", i)
+		}
+		prv := reflect.New(ert)
+		if err := cdc.unmarshalJSON(&decodeState{decodeOptions: opts}, raw, prv.Interface()); err != nil {
+			return errors.Wrapf(err, "DecodeJSONArrayStream decoding element %v", i)
+		}
+		if err := fn(prv.Elem().Interface()); err != nil {
+			return err
+		}
+	}
+	return expectJSONDelim(dec, ']')
+}
+
+// DecodeJSONLines decodes newline-delimited JSON (JSON Lines) from r, one
+// value per line, e.g. from a log file.  Each line is decoded with
+// UnmarshalJSON like the elements of DecodeJSONArrayStream, and fn is called
+// with the decoded value, which is of the type of template, or is the concrete
+// value if template is a (nil) pointer to an interface.  Blank lines are
+// skipped.  Decoding stops at the first error, including any returned by fn,
+// which is returned as is.
+func (cdc *Codec) DecodeJSONLines(r io.Reader, template interface{}, fn func(interface{}) error) error {
+	rt := reflect.TypeOf(template)
+	if rt == nil {
+		return errors.New("DecodeJSONLines cannot decode into a nil template")
+	}
+	if rt.Kind() == reflect.Ptr && rt.Elem().Kind() == reflect.Interface {
+		rt = rt.Elem()
+	}
+
+	opts := cdc.decodeOptions()
+	br := bufio.NewReader(r)
+	for lineNum := 1; ; lineNum++ {
+		line, err := br.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return errors.Wrapf(err, "DecodeJSONLines reading line %v", lineNum)
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			prv := reflect.New(rt)
+			if err := cdc.unmarshalJSON(&decodeState{decodeOptions: opts}, line, prv.Interface()); err != nil {
+				return errors.Wrapf(err, "DecodeJSONLines decoding line %v", lineNum)
+			}
+			if err := fn(prv.Elem().Interface()); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// Reads the next token from dec, which must be the delimiter delim.
+func expectJSONDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return errors.Wrapf(err, "expected %v in JSON array", delim)
+	}
+	if tok != delim {
+		return errors.Errorf("expected %v in JSON array, got %v", delim, tok)
+	}
+	return nil
+}
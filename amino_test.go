@@ -2,10 +2,18 @@ package amino_test
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	amino "github.com/tendermint/go-amino"
 )
 
@@ -179,3 +187,1031 @@ func TestBoolPointers(t *testing.T) {
 	assert.NotNil(t, s2.BoolPtrTrue)
 	assert.NotNil(t, s2.BoolPtrFalse)
 }
+
+func TestMarshalBinaryBareBuf(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.RegisterConcrete(stringWrapper{}, "amino_test/stringWrapper", nil)
+
+	s := stringWrapper{"foo"}
+	want, err := cdc.MarshalBinaryBare(s)
+	assert.Nil(t, err)
+
+	// The result aliases buf when it fits.
+	buf := make([]byte, 0, 64)
+	bz, err := cdc.MarshalBinaryBareBuf(s, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, want, bz)
+	assert.True(t, &buf[:1][0] == &bz[0], "expected result to alias buf")
+
+	// Reusing buf overwrites the previous result.
+	bz2, err := cdc.MarshalBinaryBareBuf(stringWrapper{"bar"}, buf)
+	assert.Nil(t, err)
+	assert.Equal(t, bz2, bz)
+	assert.NotEqual(t, want, bz)
+
+	// Otherwise a new slice is allocated.
+	small := make([]byte, 0, 2)
+	bz, err = cdc.MarshalBinaryBareBuf(s, small)
+	assert.Nil(t, err)
+	assert.Equal(t, want, bz)
+	assert.False(t, &small[:1][0] == &bz[0], "expected result not to alias buf")
+
+	// A nil buf behaves like MarshalBinaryBare.
+	bz, err = cdc.MarshalBinaryBareBuf(s, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, want, bz)
+}
+
+type hintAnimal interface{ Sound() string }
+
+type hintCat struct{ Name string }
+
+type hintCatV2 struct {
+	Name string
+	Age  int
+}
+
+type hintDog struct{ Name string }
+
+func (hintCat) Sound() string   { return "meow" }
+func (hintCatV2) Sound() string { return "meow" }
+func (hintDog) Sound() string   { return "woof" }
+
+type hintZoo struct {
+	Star    hintAnimal
+	Animals []hintAnimal
+}
+
+type hintCity struct {
+	Zoo *hintZoo
+}
+
+func newHintCodec() *amino.Codec {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc.RegisterConcrete(hintCat{}, "amino_test/hintCat", nil)
+	cdc.RegisterConcrete(hintCatV2{}, "amino_test/hintCatV2", nil)
+	cdc.RegisterConcrete(hintDog{}, "amino_test/hintDog", nil)
+	return cdc
+}
+
+func TestUnmarshalBinaryBareWithHints(t *testing.T) {
+	cdc := newHintCodec()
+
+	city := hintCity{Zoo: &hintZoo{
+		Star:    hintCat{"Tom"},
+		Animals: []hintAnimal{hintCat{"Felix"}, hintCat{"Garfield"}},
+	}}
+	bz, err := cdc.MarshalBinaryBare(city)
+	assert.NoError(t, err)
+
+	// Without hints, the prefix bytes determine the concrete type.
+	var got hintCity
+	err = cdc.UnmarshalBinaryBare(bz, &got)
+	assert.NoError(t, err)
+	assert.Equal(t, city, got)
+
+	// With hints, the hinted type is used regardless of the prefix bytes.
+	got = hintCity{}
+	err = cdc.UnmarshalBinaryBareWithHints(bz, &got, map[string]interface{}{
+		"Zoo.Star":    hintCatV2{},
+		"Zoo.Animals": hintCatV2{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, hintCity{Zoo: &hintZoo{
+		Star:    hintCatV2{Name: "Tom"},
+		Animals: []hintAnimal{hintCatV2{Name: "Felix"}, hintCatV2{Name: "Garfield"}},
+	}}, got)
+
+	// Other interface fields are unaffected.
+	got = hintCity{}
+	err = cdc.UnmarshalBinaryBareWithHints(bz, &got, map[string]interface{}{
+		"Zoo.Animals": hintDog{},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, hintCat{"Tom"}, got.Zoo.Star)
+	assert.Equal(t, []hintAnimal{hintDog{"Felix"}, hintDog{"Garfield"}}, got.Zoo.Animals)
+}
+
+func TestUnmarshalBinaryBareWithHintsValidation(t *testing.T) {
+	cdc := newHintCodec()
+	cdc.RegisterConcrete(stringWrapper{}, "amino_test/stringWrapper", nil)
+	bz, err := cdc.MarshalBinaryBare(hintCity{})
+	assert.NoError(t, err)
+
+	type unregistered struct{ hintCat }
+
+	cases := []struct {
+		name  string
+		hints map[string]interface{}
+	}{
+		{"unknown field", map[string]interface{}{"Zoo.Nope": hintCat{}}},
+		{"not an interface", map[string]interface{}{"Zoo": hintCat{}}},
+		{"unregistered", map[string]interface{}{"Zoo.Star": unregistered{}}},
+		{"not implementing", map[string]interface{}{"Zoo.Star": stringWrapper{}}},
+	}
+	for _, tc := range cases {
+		var got hintCity
+		err = cdc.UnmarshalBinaryBareWithHints(bz, &got, tc.hints)
+		assert.Error(t, err, tc.name)
+	}
+}
+
+type lintLimits struct {
+	Max   int64
+	Label string
+}
+
+type lintConfig struct {
+	Name   string
+	Port   uint16
+	Limits lintLimits
+}
+
+func TestUnmarshalBinaryBareCollectErrors(t *testing.T) {
+	cdc := amino.NewCodec()
+
+	bz := []byte{
+		0x08, 0x05, // Name as a varint.
+		0x10, 0x50, // Port 80.
+		0x1a, 0x04, // Limits:
+		0x08, 0x01, //   Max 1.
+		0x10, 0x07, //   Label as a varint.
+	}
+
+	// By default, decoding stops at the first error.
+	var c lintConfig
+	assert.Error(t, cdc.UnmarshalBinaryBare(bz, &c))
+
+	// All field errors are returned, and the other fields are decoded.
+	c = lintConfig{}
+	err := cdc.UnmarshalBinaryBareCollectErrors(bz, &c)
+	require.Error(t, err)
+	fes, ok := err.(amino.FieldErrors)
+	require.True(t, ok, "expected FieldErrors, got %T", err)
+	require.Len(t, fes, 2)
+	assert.Equal(t, "Name", fes[0].Path)
+	assert.Equal(t, "Limits.Label", fes[1].Path)
+	assert.Contains(t, err.Error(), "2 field error(s)")
+	assert.Equal(t, lintConfig{Port: 80, Limits: lintLimits{Max: 1}}, c)
+
+	// Valid input has no errors.
+	bz, err = cdc.MarshalBinaryBare(lintConfig{Name: "x", Port: 1})
+	require.NoError(t, err)
+	assert.NoError(t, cdc.UnmarshalBinaryBareCollectErrors(bz, &c))
+
+	// Framing errors abort.
+	err = cdc.UnmarshalBinaryBareCollectErrors([]byte{0x0a, 0x05, 'x'}, &c)
+	require.Error(t, err)
+	_, ok = err.(amino.FieldErrors)
+	assert.False(t, ok)
+}
+
+type hiddenOnly struct {
+	count int64
+	name  string
+}
+
+type partlyHidden struct {
+	hiddenOnly
+	secret []byte
+	Name   string
+	flag   bool
+	Count  uint8
+}
+
+type partlyHiddenPublic struct {
+	Name  string
+	Count uint8
+}
+
+func TestUnexportedFieldsSkipped(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	// A struct with only unexported fields encodes to empty.
+	bz, err := cdc.MarshalBinaryBare(hiddenOnly{count: 1, name: "x"})
+	require.NoError(t, err)
+	assert.Empty(t, bz)
+	jsonBz, err := cdc.MarshalJSON(hiddenOnly{count: 1, name: "x"})
+	require.NoError(t, err)
+	assert.Equal(t, `{}`, string(jsonBz))
+
+	// Unexported fields don't take up field numbers.
+	ph := partlyHidden{hiddenOnly: hiddenOnly{count: 1, name: "x"}, secret: []byte("s"), Name: "n", flag: true, Count: 2}
+	bz, err = cdc.MarshalBinaryBare(ph)
+	require.NoError(t, err)
+	bz2, err := cdc.MarshalBinaryBare(partlyHiddenPublic{Name: "n", Count: 2})
+	require.NoError(t, err)
+	assert.Equal(t, bz2, bz)
+	jsonBz, err = cdc.MarshalJSON(ph)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Name":"n","Count":2}`, string(jsonBz))
+
+	// Decoding leaves unexported fields untouched.
+	var ph2 = partlyHidden{secret: []byte("keep"), flag: true}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &ph2))
+	assert.Equal(t, partlyHidden{secret: []byte("keep"), Name: "n", flag: true, Count: 2}, ph2)
+	var ph3 = partlyHidden{hiddenOnly: hiddenOnly{count: 5}}
+	require.NoError(t, cdc.UnmarshalJSON(jsonBz, &ph3))
+	assert.Equal(t, partlyHidden{hiddenOnly: hiddenOnly{count: 5}, Name: "n", Count: 2}, ph3)
+
+	// Unexported JSON keys are ignored rather than set.
+	var ho hiddenOnly
+	require.NoError(t, cdc.UnmarshalJSON([]byte(`{"count":"3","name":"y"}`), &ho))
+	assert.Equal(t, hiddenOnly{}, ho)
+	require.NoError(t, cdc.UnmarshalBinaryBare(nil, &ho))
+	assert.Equal(t, hiddenOnly{}, ho)
+}
+
+type signedTransfer struct {
+	From      string
+	To        string
+	Amount    uint64
+	Memos     []string
+	Signature []byte
+}
+
+func TestMarshalBinaryBareFields(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	tx := signedTransfer{From: "alice", Amount: 1, Memos: []string{"x", "y"}}
+	bz, fnums, err := cdc.MarshalBinaryBareFields(tx)
+	require.NoError(t, err)
+	assert.Equal(t, cdc.MustMarshalBinaryBare(tx), bz)
+	assert.Equal(t, []uint32{1, 3, 4}, fnums)
+
+	_, fnums, err = cdc.MarshalBinaryBareFields(&signedTransfer{})
+	require.NoError(t, err)
+	assert.Empty(t, fnums)
+
+	// Prefix bytes are skipped.
+	cdc.RegisterConcrete(signedTransfer{}, "bank/SignedTransfer", nil)
+	bz, fnums, err = cdc.MarshalBinaryBareFields(&signedTransfer{To: "bob", Signature: []byte{1}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x12, 0x03, 'b', 'o', 'b', 0x2A, 0x01, 0x01}, bz[4:])
+	assert.Equal(t, []uint32{2, 5}, fnums)
+
+	// And so is the version.
+	cdcV := amino.NewCodec()
+	cdcV.RegisterConcrete(signedTransfer{}, "bank/SignedTransfer", &amino.ConcreteOptions{Version: 300})
+	bz, fnums, err = cdcV.MarshalBinaryBareFields(&signedTransfer{To: "bob", Signature: []byte{1}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x12, 0x03, 'b', 'o', 'b', 0x2A, 0x01, 0x01}, bz[6:])
+	assert.Equal(t, []uint32{2, 5}, fnums)
+
+	_, _, err = cdc.MarshalBinaryBareFields(time.Now())
+	assert.Error(t, err)
+	_, _, err = cdc.MarshalBinaryBareFields([]signedTransfer{tx})
+	assert.Error(t, err)
+	_, _, err = cdc.MarshalBinaryBareFields(nil)
+	assert.Error(t, err)
+}
+
+func TestMarshalBinaryBareExcluding(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	tx := signedTransfer{From: "alice", To: "bob", Amount: 10, Memos: []string{"a", "b"}, Signature: []byte{0x01, 0x02}}
+	unsigned := tx
+	unsigned.Signature = nil
+	want, err := cdc.MarshalBinaryBare(unsigned)
+	require.NoError(t, err)
+
+	bz, err := cdc.MarshalBinaryBareExcluding(tx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, want, bz)
+	bz, err = cdc.MarshalBinaryBareExcluding(&tx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, want, bz)
+
+	// Repeated fields are omitted entirely.
+	noMemos := tx
+	noMemos.Memos = nil
+	want, err = cdc.MarshalBinaryBare(noMemos)
+	require.NoError(t, err)
+	bz, err = cdc.MarshalBinaryBareExcluding(tx, 4)
+	require.NoError(t, err)
+	assert.Equal(t, want, bz)
+
+	// Prefix bytes are kept for registered types.
+	cdc.RegisterConcrete(signedTransfer{}, "test/signedTransfer", nil)
+	want, err = cdc.MarshalBinaryBare(unsigned)
+	require.NoError(t, err)
+	bz, err = cdc.MarshalBinaryBareExcluding(tx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, want, bz)
+
+	// And so is the version.
+	cdc = amino.NewCodec()
+	cdc.RegisterConcrete(signedTransfer{}, "test/signedTransfer", &amino.ConcreteOptions{Version: 300})
+	want, err = cdc.MarshalBinaryBare(unsigned)
+	require.NoError(t, err)
+	bz, err = cdc.MarshalBinaryBareExcluding(tx, 5)
+	require.NoError(t, err)
+	assert.Equal(t, want, bz)
+
+	_, err = cdc.MarshalBinaryBareExcluding([]string{"a"}, 1)
+	assert.Error(t, err)
+	_, err = cdc.MarshalBinaryBareExcluding(nil, 1)
+	assert.Error(t, err)
+}
+
+func TestMarshalBinaryBareHash(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.RegisterConcrete(signedTransfer{}, "test/signedTransfer", nil)
+
+	for _, o := range []interface{}{
+		signedTransfer{From: "alice", To: "bob", Amount: 10, Memos: []string{"a"}},
+		&signedTransfer{},
+		int64(0),
+		"hello",
+		[]string{"a", "b"},
+	} {
+		bz, err := cdc.MarshalBinaryBare(o)
+		require.NoError(t, err)
+		want := sha256.Sum256(bz)
+
+		h := sha256.New()
+		require.NoError(t, cdc.MarshalBinaryBareHash(o, h))
+		assert.Equal(t, want[:], h.Sum(nil), "%#v", o)
+	}
+}
+
+func TestIndexBinary(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	tx := signedTransfer{From: "alice", Amount: 10, Memos: []string{"a", "bc"}, Signature: []byte{0x01}}
+	bz, err := cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+
+	index, err := cdc.IndexBinary(bz, (*signedTransfer)(nil))
+	require.NoError(t, err)
+	assert.Equal(t, map[uint32][2]int{
+		1: {0, 7},   // 0x0A 0x05 "alice"
+		3: {7, 9},   // 0x18 0x0A
+		4: {9, 16},  // 0x22 0x01 "a" 0x22 0x02 "bc"
+		5: {16, 19}, // 0x2A 0x01 0x01
+	}, index)
+
+	// Each range can be decoded on its own.
+	var tx2 signedTransfer
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz[index[4][0]:index[4][1]], &tx2))
+	assert.Equal(t, signedTransfer{Memos: []string{"a", "bc"}}, tx2)
+
+	// Offsets include the prefix bytes of registered types.
+	cdc.RegisterConcrete(signedTransfer{}, "test/signedTransfer", nil)
+	bz, err = cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	index, err = cdc.IndexBinary(bz, signedTransfer{})
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{4, 11}, index[1])
+
+	// And the version.
+	cdcV := amino.NewCodec()
+	cdcV.RegisterConcrete(signedTransfer{}, "test/signedTransfer", &amino.ConcreteOptions{Version: 300})
+	bzV, err := cdcV.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	index, err = cdcV.IndexBinary(bzV, signedTransfer{})
+	require.NoError(t, err)
+	assert.Equal(t, [2]int{6, 13}, index[1])
+	assert.Equal(t, [2]int{22, 25}, index[5])
+
+	_, err = cdc.IndexBinary(bz[:len(bz)-1], signedTransfer{})
+	assert.Error(t, err)
+	_, err = cdc.IndexBinary(bz, []string{})
+	assert.Error(t, err)
+	_, err = cdc.IndexBinary(bz, nil)
+	assert.Error(t, err)
+}
+
+func TestMarshalBinaryBareWith(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	type contact struct {
+		Name     string
+		Internal string
+	}
+	type counts struct {
+		Sent, Received int64
+	}
+	type account struct {
+		Owner    contact
+		Contacts []contact
+		Counts   counts
+		Internal []byte
+	}
+	acc := account{
+		Owner:    contact{"alice", "vip"},
+		Contacts: []contact{{"bob", "spam"}, {"carol", ""}},
+		Counts:   counts{1, 2},
+		Internal: []byte{0x01},
+	}
+
+	var paths []string
+	bz, err := cdc.MarshalBinaryBareWith(acc, func(path string, v interface{}) bool {
+		paths = append(paths, path)
+		return path == "Internal" || strings.HasSuffix(path, ".Internal") || path == "Counts.Received"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Owner", "Owner.Name", "Owner.Internal",
+		"Contacts", "Contacts.Name", "Contacts.Internal", "Contacts.Name",
+		"Counts", "Counts.Sent", "Counts.Received",
+		"Internal",
+	}, paths)
+	want, err := cdc.MarshalBinaryBare(account{
+		Owner:    contact{Name: "alice"},
+		Contacts: []contact{{Name: "bob"}, {Name: "carol"}},
+		Counts:   counts{Sent: 1},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, want, bz)
+
+	// Omitting a struct omits its fields.
+	paths = nil
+	bz, err = cdc.MarshalBinaryBareWith(acc, func(path string, v interface{}) bool {
+		paths = append(paths, path)
+		return path != "Counts" && path != "Counts.Sent" && path != "Counts.Received"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Owner", "Contacts", "Counts", "Counts.Sent", "Counts.Received", "Internal"}, paths)
+	var acc2 account
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &acc2))
+	assert.Equal(t, account{Counts: counts{1, 2}}, acc2)
+
+	// The predicate sees the values.
+	bz, err = cdc.MarshalBinaryBareWith(acc, func(path string, v interface{}) bool {
+		c, ok := v.(contact)
+		return ok && c.Internal == "vip"
+	})
+	require.NoError(t, err)
+	acc2 = account{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &acc2))
+	assert.Equal(t, contact{}, acc2.Owner)
+	assert.Equal(t, acc.Contacts, acc2.Contacts)
+}
+
+func TestUnmarshalBinaryBarePresence(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	tx := signedTransfer{From: "alice", Amount: 10}
+	bz, err := cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	var tx2 signedTransfer
+	present, err := cdc.UnmarshalBinaryBarePresence(bz, &tx2)
+	require.NoError(t, err)
+	assert.Equal(t, tx, tx2)
+	assert.Equal(t, map[uint32]bool{1: true, 3: true}, present)
+
+	// Fields explicitly set to their default value are present.
+	tx2 = signedTransfer{}
+	present, err = cdc.UnmarshalBinaryBarePresence([]byte{0x0A, 0x00, 0x18, 0x00}, &tx2)
+	require.NoError(t, err)
+	assert.Equal(t, signedTransfer{}, tx2)
+	assert.Equal(t, map[uint32]bool{1: true, 3: true}, present)
+
+	// Including with prefix bytes.
+	cdc.RegisterConcrete(signedTransfer{}, "test/signedTransfer", nil)
+	bz, err = cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	present, err = cdc.UnmarshalBinaryBarePresence(bz, &tx2)
+	require.NoError(t, err)
+	assert.Equal(t, map[uint32]bool{1: true, 3: true}, present)
+
+	// And a version.
+	cdcV := amino.NewCodec()
+	cdcV.RegisterConcrete(signedTransfer{}, "test/signedTransfer", &amino.ConcreteOptions{Version: 300})
+	bzV, err := cdcV.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	tx2 = signedTransfer{}
+	present, err = cdcV.UnmarshalBinaryBarePresence(bzV, &tx2)
+	require.NoError(t, err)
+	assert.Equal(t, tx, tx2)
+	assert.Equal(t, map[uint32]bool{1: true, 3: true}, present)
+
+	_, err = cdc.UnmarshalBinaryBarePresence(bz[:len(bz)-1], &tx2)
+	assert.Error(t, err)
+	_, err = cdc.UnmarshalBinaryBarePresence(bz, tx2)
+	assert.Equal(t, amino.ErrNoPointer, err)
+	var s []string
+	_, err = cdc.UnmarshalBinaryBarePresence([]byte{}, &s)
+	assert.Error(t, err)
+}
+
+func TestMarshalBinaryBareReader(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	tx := signedTransfer{From: "alice", To: "bob", Amount: 10, Memos: []string{"a", "b"}}
+	want, err := cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	r, err := cdc.MarshalBinaryBareReader(tx)
+	require.NoError(t, err)
+	bz, err := ioutil.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, want, bz)
+
+	// Encoding errors are returned by Read.
+	type event struct {
+		Name string
+		At   time.Time
+	}
+	r, err = cdc.MarshalBinaryBareReader(event{Name: "late", At: time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC)})
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(r)
+	assert.Error(t, err)
+
+	// Encoding can be stopped early.
+	r, err = cdc.MarshalBinaryBareReader(tx)
+	require.NoError(t, err)
+	require.NoError(t, r.(io.Closer).Close())
+	_, err = r.Read(make([]byte, 1))
+	assert.Equal(t, io.ErrClosedPipe, err)
+
+	// Nil pointers are rejected up front.
+	_, err = cdc.MarshalBinaryBareReader((*signedTransfer)(nil))
+	assert.Error(t, err)
+}
+
+func TestUnmarshalBinaryLengthPrefixedN(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	txs := []signedTransfer{{From: "alice", Amount: 1}, {}, {To: "bob", Memos: []string{"x"}}}
+	var buf []byte
+	for _, tx := range txs {
+		bz, err := cdc.MarshalBinaryLengthPrefixed(tx)
+		require.NoError(t, err)
+		buf = append(buf, bz...)
+	}
+
+	var decoded []signedTransfer
+	for bz := buf; len(bz) > 0; {
+		var tx signedTransfer
+		n, err := cdc.UnmarshalBinaryLengthPrefixedN(bz, &tx)
+		require.NoError(t, err)
+		decoded = append(decoded, tx)
+		bz = bz[n:]
+	}
+	assert.Equal(t, txs, decoded)
+
+	var tx signedTransfer
+	_, err := cdc.UnmarshalBinaryLengthPrefixedN(nil, &tx)
+	assert.Error(t, err)
+	_, err = cdc.UnmarshalBinaryLengthPrefixedN(buf[:3], &tx)
+	assert.Error(t, err, "truncated body")
+	_, err = cdc.UnmarshalBinaryLengthPrefixedN([]byte{0x80}, &tx)
+	assert.Error(t, err, "truncated prefix")
+}
+
+func TestCountFittingElements(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	txs := []interface{}{
+		signedTransfer{From: "alice", Amount: 1},
+		signedTransfer{},
+		&signedTransfer{To: "bob", Memos: []string{"x", "y", "z"}},
+		signedTransfer{From: "carol"},
+	}
+	var sizes []int
+	for _, tx := range txs {
+		bz, err := cdc.MarshalBinaryLengthPrefixed(tx)
+		require.NoError(t, err)
+		sizes = append(sizes, len(bz))
+	}
+
+	all := sizes[0] + sizes[1] + sizes[2] + sizes[3]
+	for _, tc := range []struct {
+		maxBytes, count, total int
+	}{
+		{0, 0, 0},
+		{sizes[0] - 1, 0, 0},
+		{sizes[0], 1, sizes[0]},
+		{sizes[0] + sizes[1] + sizes[2], 3, sizes[0] + sizes[1] + sizes[2]},
+		{all - 1, 3, sizes[0] + sizes[1] + sizes[2]},
+		{all, 4, all},
+		{all + 100, 4, all},
+	} {
+		count, total, err := cdc.CountFittingElements(txs, tc.maxBytes)
+		require.NoError(t, err)
+		assert.Equal(t, tc.count, count, "maxBytes %v", tc.maxBytes)
+		assert.Equal(t, tc.total, total, "maxBytes %v", tc.maxBytes)
+	}
+
+	// The elements before one that fails to encode are still counted.
+	cdc.SetMaxEncodeSize(sizes[0] - 1) // Without the length prefix.
+	count, total, err := cdc.CountFittingElements(txs, all)
+	assert.Error(t, err)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, sizes[0]+sizes[1], total)
+}
+
+func TestIsCanonical(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	tx := signedTransfer{From: "alice", Amount: 10}
+	bz, err := cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	ok, err := cdc.IsCanonical(bz, (*signedTransfer)(nil))
+	assert.True(t, ok)
+	assert.NoError(t, err)
+
+	for _, bz := range [][]byte{
+		{0x0A, 0x05, 'a', 'l', 'i', 'c', 'e', 0x18, 0x8A, 0x00},       // Non-minimal varint.
+		{0x0A, 0x05, 'a', 'l', 'i', 'c', 'e', 0x12, 0x00, 0x18, 0x0A}, // Empty field written.
+	} {
+		ok, err = cdc.IsCanonical(bz, signedTransfer{})
+		assert.False(t, ok)
+		if assert.IsType(t, &amino.NonCanonicalError{}, err) {
+			assert.Equal(t, bz, err.(*amino.NonCanonicalError).Input)
+			assert.Equal(t, []byte{0x0A, 0x05, 'a', 'l', 'i', 'c', 'e', 0x18, 0x0A}, err.(*amino.NonCanonicalError).Reencoded)
+		}
+	}
+
+	// Decoding errors are returned as is.
+	ok, err = cdc.IsCanonical(bz[:len(bz)-1], signedTransfer{})
+	assert.False(t, ok)
+	assert.Error(t, err)
+	_, isNonCanonical := err.(*amino.NonCanonicalError)
+	assert.False(t, isNonCanonical)
+
+	ok, err = cdc.IsCanonical(bz, nil)
+	assert.False(t, ok)
+	assert.Error(t, err)
+}
+
+func TestTranscode(t *testing.T) {
+	var src = amino.NewCodec()
+	src.RegisterInterface((*hintAnimal)(nil), nil)
+	src.RegisterConcrete(hintCat{}, "zoo/Cat", nil)
+	src.RegisterConcrete(hintDog{}, "zoo/Dog", nil)
+	src.RegisterConcrete(hintZoo{}, "zoo/Zoo", nil)
+
+	var dst = amino.NewCodec()
+	dst.RegisterInterface((*hintAnimal)(nil), nil)
+	dst.RegisterConcrete(hintCat{}, "com.zoo/Cat", nil)
+	dst.RegisterConcrete(hintDog{}, "com.zoo/Dog", nil)
+	dst.RegisterConcrete(hintZoo{}, "com.zoo/Zoo", nil)
+
+	zoo := hintZoo{Star: hintCat{"Tom"}, Animals: []hintAnimal{hintDog{"Rex"}, hintCat{"Kit"}}}
+	bz, err := src.MarshalBinaryBare(zoo)
+	require.NoError(t, err)
+
+	bz2, err := amino.Transcode(src, dst, bz, (*hintZoo)(nil))
+	require.NoError(t, err)
+	want, err := dst.MarshalBinaryBare(zoo)
+	require.NoError(t, err)
+	assert.Equal(t, want, bz2)
+
+	// The old encoding doesn't decode with dst, but the new one does.
+	var zoo2 hintZoo
+	assert.Error(t, dst.UnmarshalBinaryBare(bz, &zoo2))
+	require.NoError(t, dst.UnmarshalBinaryBare(bz2, &zoo2))
+	assert.Equal(t, zoo, zoo2)
+
+	// Interface values of types not registered with dst fail to encode.
+	var dst2 = amino.NewCodec()
+	dst2.RegisterInterface((*hintAnimal)(nil), nil)
+	dst2.RegisterConcrete(hintCat{}, "com.zoo/Cat", nil)
+	_, err = amino.Transcode(src, dst2, bz, hintZoo{})
+	assert.Error(t, err)
+
+	_, err = amino.Transcode(src, dst, bz[:len(bz)-1], hintZoo{})
+	assert.Error(t, err)
+	_, err = amino.Transcode(src, dst, bz, nil)
+	assert.Error(t, err)
+}
+
+func TestMarshalBinaryPadded(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	for _, tx := range []signedTransfer{{}, {From: "alice", Amount: 10}, {Memos: []string{string(make([]byte, 40))}}} {
+		bz, err := cdc.MarshalBinaryPadded(tx, 16)
+		require.NoError(t, err)
+		assert.Equal(t, 0, len(bz)%16)
+		lbz, err := cdc.MarshalBinaryLengthPrefixed(tx)
+		require.NoError(t, err)
+		assert.Equal(t, lbz, bz[:len(lbz)])
+		assert.True(t, len(bz)-len(lbz) < 16)
+
+		var tx2 signedTransfer
+		require.NoError(t, cdc.UnmarshalBinaryPadded(bz, &tx2, 16))
+		assert.Equal(t, tx, tx2)
+	}
+
+	bz, err := cdc.MarshalBinaryPadded(signedTransfer{From: "alice"}, 16)
+	require.NoError(t, err)
+	var tx signedTransfer
+	assert.Error(t, cdc.UnmarshalBinaryPadded(bz, &tx, 8), "a whole block of padding")
+	assert.Error(t, cdc.UnmarshalBinaryPadded(bz[:15], &tx, 16), "truncated")
+	assert.Error(t, cdc.UnmarshalBinaryPadded(append(bz, make([]byte, 16)...), &tx, 16), "extra block")
+	bz[15] = 0x01
+	assert.Error(t, cdc.UnmarshalBinaryPadded(bz, &tx, 16), "non-zero padding")
+
+	_, err = cdc.MarshalBinaryPadded(tx, 0)
+	assert.Error(t, err)
+}
+
+func TestMarshalBinaryChecksummed(t *testing.T) {
+	var cdc = amino.NewCodec()
+	tx := signedTransfer{From: "alice", Amount: 10}
+	bare, err := cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+
+	// CRC-32 (IEEE) by default.
+	bz, err := cdc.MarshalBinaryChecksummed(tx)
+	require.NoError(t, err)
+	require.Len(t, bz, len(bare)+4)
+	assert.Equal(t, bare, bz[:len(bare)])
+	sum := crc32.ChecksumIEEE(bare)
+	assert.Equal(t, []byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)}, bz[len(bare):])
+
+	var tx2 signedTransfer
+	require.NoError(t, cdc.UnmarshalBinaryChecksummed(bz, &tx2))
+	assert.Equal(t, tx, tx2)
+
+	// Any flipped bit is a checksum mismatch.
+	for i := range bz {
+		corrupt := append([]byte(nil), bz...)
+		corrupt[i] ^= 0x10
+		err = cdc.UnmarshalBinaryChecksummed(corrupt, &tx2)
+		assert.Equal(t, amino.ErrChecksumMismatch, errors.Cause(err), "byte %v", i)
+	}
+	err = cdc.UnmarshalBinaryChecksummed(bz[:3], &tx2)
+	require.Error(t, err)
+	assert.NotEqual(t, amino.ErrChecksumMismatch, errors.Cause(err))
+
+	// Decoding errors aren't checksum mismatches.
+	h := crc32.NewIEEE()
+	h.Write([]byte{0x0A, 0x05}) // nolint: errcheck
+	err = cdc.UnmarshalBinaryChecksummed(h.Sum([]byte{0x0A, 0x05}), &tx2)
+	require.Error(t, err)
+	assert.NotEqual(t, amino.ErrChecksumMismatch, errors.Cause(err))
+
+	// The checksum is selectable.
+	cdc.SetChecksumHash(sha256.New)
+	bz, err = cdc.MarshalBinaryChecksummed(tx)
+	require.NoError(t, err)
+	require.Len(t, bz, len(bare)+sha256.Size)
+	digest := sha256.Sum256(bare)
+	assert.Equal(t, digest[:], bz[len(bare):])
+	tx2 = signedTransfer{}
+	require.NoError(t, cdc.UnmarshalBinaryChecksummed(bz, &tx2))
+	assert.Equal(t, tx, tx2)
+}
+
+func TestMarshalBinaryBareInterned(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.SetAllowMaps(true)
+	cdc.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc.RegisterConcrete(hintCat{}, "zoo/Cat", nil)
+
+	type ledger struct {
+		Transfers []signedTransfer
+		Denoms    map[string]string
+		Animals   []hintAnimal
+		Tags      []string
+	}
+	l := ledger{
+		Transfers: []signedTransfer{
+			{From: "cosmos1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5lzv7xu", Amount: 1},
+			{From: "cosmos1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5lzv7xu", Amount: 2},
+			{From: "cosmos1qypqxpq9qcrsszg2pvxq6rs0zqg3yyc5lzv7xu", Amount: 3},
+		},
+		Denoms:  map[string]string{"atom": "uatom", "photon": "uatom"},
+		Animals: []hintAnimal{hintCat{"uatom"}},
+		Tags:    []string{"", "atom", ""},
+	}
+	bare, err := cdc.MarshalBinaryBare(l)
+	require.NoError(t, err)
+	bz, err := cdc.MarshalBinaryBareInterned(l)
+	require.NoError(t, err)
+	assert.True(t, len(bz) < len(bare), "%v >= %v", len(bz), len(bare))
+
+	var l2 ledger
+	require.NoError(t, cdc.UnmarshalBinaryBareInterned(bz, &l2))
+	assert.Equal(t, l, l2)
+
+	// Each distinct string is in the table once.
+	type named struct{ A, B, C string }
+	bz, err = cdc.MarshalBinaryBareInterned(named{"x", "yy", "x"})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x02, 0x01, 'x', 0x02, 'y', 'y', // The string table.
+		0x0A, 0x01, 0x00, 0x12, 0x01, 0x01, 0x1A, 0x01, 0x00,
+	}, bz)
+
+	// Indices must be within the table.
+	var n named
+	err = cdc.UnmarshalBinaryBareInterned([]byte{0x01, 0x01, 'x', 0x0A, 0x01, 0x01}, &n)
+	assert.Error(t, err)
+	err = cdc.UnmarshalBinaryBareInterned([]byte{0x05, 0x01, 'x'}, &n)
+	assert.Error(t, err)
+
+	// It's not Amino:binary.
+	err = cdc.UnmarshalBinaryBare(bz, &n)
+	assert.Error(t, err)
+}
+
+func TestUnmarshalBinaryBareValue(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc.RegisterConcrete(hintCat{}, "zoo/Cat", nil)
+
+	type zoo struct {
+		Keeper  signedTransfer
+		Animals []hintAnimal
+		count   int
+	}
+	tx := signedTransfer{From: "alice", Amount: 10}
+	txbz, err := cdc.MarshalBinaryBare(tx)
+	require.NoError(t, err)
+	var animal hintAnimal = hintCat{"Tom"}
+	animalbz, err := cdc.MarshalBinaryBare(animal)
+	require.NoError(t, err)
+
+	// Decode into a struct field, and an interface slice element.
+	var z = zoo{Animals: make([]hintAnimal, 1)}
+	rv := reflect.ValueOf(&z).Elem()
+	require.NoError(t, cdc.UnmarshalBinaryBareValue(txbz, rv.Field(0)))
+	assert.Equal(t, tx, z.Keeper)
+	require.NoError(t, cdc.UnmarshalBinaryBareValue(animalbz, rv.Field(1).Index(0)))
+	assert.Equal(t, animal, z.Animals[0])
+
+	// Scalars too.
+	n := int64(0)
+	bz, err := cdc.MarshalBinaryBare(int64(-7))
+	require.NoError(t, err)
+	require.NoError(t, cdc.UnmarshalBinaryBareValue(bz, reflect.ValueOf(&n).Elem()))
+	assert.Equal(t, int64(-7), n)
+
+	// Values must be settable.
+	assert.Error(t, cdc.UnmarshalBinaryBareValue(txbz, reflect.ValueOf(tx)))
+	assert.Error(t, cdc.UnmarshalBinaryBareValue(bz, rv.Field(2)), "unexported")
+	assert.Error(t, cdc.UnmarshalBinaryBareValue(bz, reflect.Value{}))
+	assert.Error(t, cdc.UnmarshalBinaryBareValue(bz, rv.Field(0)), "wrong type")
+}
+
+func TestUnmarshalBinaryBareTyped(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc.RegisterInterface((*interface{})(nil), nil)
+	cdc.RegisterConcrete(hintCat{}, "zoo/Cat", nil)
+	cdc.RegisterConcrete(hintDog{}, "zoo/Dog", nil)
+
+	for _, animal := range []hintAnimal{hintCat{"Tom"}, hintDog{"Rex"}} {
+		bz, err := cdc.MarshalBinaryBare(animal)
+		require.NoError(t, err)
+
+		var a hintAnimal
+		rt, err := cdc.UnmarshalBinaryBareTyped(bz, &a)
+		require.NoError(t, err)
+		assert.Equal(t, reflect.TypeOf(animal), rt)
+		assert.Equal(t, animal, a)
+
+		var i interface{}
+		rt, err = cdc.UnmarshalBinaryBareTyped(bz, &i)
+		require.NoError(t, err)
+		assert.Equal(t, reflect.TypeOf(animal), rt)
+		assert.Equal(t, animal, i)
+	}
+
+	bz, err := cdc.MarshalBinaryBare(hintCat{"Tom"})
+	require.NoError(t, err)
+	var cat hintCat
+	_, err = cdc.UnmarshalBinaryBareTyped(bz, &cat)
+	assert.Error(t, err, "not an interface")
+	var a hintAnimal
+	_, err = cdc.UnmarshalBinaryBareTyped(bz, a)
+	assert.Equal(t, amino.ErrNoPointer, err)
+	_, err = cdc.UnmarshalBinaryBareTyped([]byte{0x01, 0x02, 0x03, 0x04}, &a)
+	assert.Error(t, err, "unregistered prefix")
+}
+
+func TestUnmarshalBinaryBareAny(t *testing.T) {
+	type ping struct {
+		Nonce uint64
+	}
+	type note struct {
+		Text string
+	}
+	type tagged struct {
+		Text string
+		Tags []string
+	}
+	var cdc = amino.NewCodec()
+
+	bz := cdc.MustMarshalBinaryBare(ping{Nonce: 5})
+	o, err := cdc.UnmarshalBinaryBareAny(bz, note{}, ping{})
+	require.NoError(t, err)
+	assert.Equal(t, ping{Nonce: 5}, o)
+
+	// Pointer candidates decode as pointers.
+	o, err = cdc.UnmarshalBinaryBareAny(bz, &note{}, &ping{})
+	require.NoError(t, err)
+	assert.Equal(t, &ping{Nonce: 5}, o)
+
+	// The first candidate that decodes wins.
+	bz = cdc.MustMarshalBinaryBare(note{Text: "hi"})
+	o, err = cdc.UnmarshalBinaryBareAny(bz, ping{}, note{}, tagged{})
+	require.NoError(t, err)
+	assert.Equal(t, note{Text: "hi"}, o)
+	o, err = cdc.UnmarshalBinaryBareAny(bz, ping{}, tagged{}, note{})
+	require.NoError(t, err)
+	assert.Equal(t, tagged{Text: "hi"}, o)
+
+	// Trailing bytes fail, even if a prefix of bz decodes.
+	bz = cdc.MustMarshalBinaryBare(tagged{Text: "hi", Tags: []string{"a"}})
+	o, err = cdc.UnmarshalBinaryBareAny(bz, note{}, ping{})
+	assert.Nil(t, o)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "amino_test.note: ")
+		assert.Contains(t, err.Error(), "amino_test.ping: ")
+	}
+
+	_, err = cdc.UnmarshalBinaryBareAny(bz)
+	assert.Error(t, err)
+}
+
+func TestMarshalBinarySelfDescribing(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc.RegisterConcrete(hintCat{}, "zoo/Cat", nil)
+
+	bz, err := cdc.MarshalBinarySelfDescribing(hintCat{"Tom"})
+	require.NoError(t, err)
+	hash, err := cdc.SchemaHash(hintCat{})
+	require.NoError(t, err)
+	assert.Len(t, hash, amino.SchemaHashLen)
+	assert.Equal(t, append([]byte{amino.SchemaHashLen}, hash...), bz[:1+amino.SchemaHashLen])
+
+	var cat hintCat
+	require.NoError(t, cdc.UnmarshalBinarySelfDescribing(bz, &cat))
+	assert.Equal(t, hintCat{"Tom"}, cat)
+	var animal hintAnimal
+	require.NoError(t, cdc.UnmarshalBinarySelfDescribing(bz, &animal))
+	assert.Equal(t, hintCat{"Tom"}, animal)
+
+	// The same name, with a different schema.
+	cdc2 := amino.NewCodec()
+	cdc2.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc2.RegisterConcrete(hintCatV2{}, "zoo/Cat", nil)
+	hash2, err := cdc2.SchemaHash(hintCatV2{})
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, hash2)
+	var cat2 hintCatV2
+	err = cdc2.UnmarshalBinarySelfDescribing(bz, &cat2)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "schema mismatch")
+	}
+	animal = nil
+	assert.Error(t, cdc2.UnmarshalBinarySelfDescribing(bz, &animal))
+
+	// A different type with the same schema.
+	var dog hintDog
+	assert.Error(t, cdc.UnmarshalBinarySelfDescribing(bz, &dog))
+
+	// Descriptions don't affect the hash.
+	cdc3 := amino.NewCodec()
+	cdc3.RegisterConcrete(hintCat{}, "zoo/Cat", &amino.ConcreteOptions{Description: "A cat."})
+	hash3, err := cdc3.SchemaHash(hintCat{})
+	require.NoError(t, err)
+	assert.Equal(t, hash, hash3)
+	require.NoError(t, cdc3.UnmarshalBinarySelfDescribing(bz, &cat))
+
+	assert.Error(t, cdc.UnmarshalBinarySelfDescribing(bz[:5], &cat), "truncated")
+}
+
+func TestMaxEncodeSize(t *testing.T) {
+	type blob struct {
+		Chunks [][]byte
+		Data   []byte
+		Counts []uint64
+	}
+	var cdc = amino.NewCodec()
+	cdc.SetMaxEncodeSize(64)
+
+	small := blob{Chunks: [][]byte{{0x01}}, Counts: []uint64{1, 2, 3}}
+	bz, err := cdc.MarshalBinaryBare(small)
+	require.NoError(t, err)
+	assert.True(t, len(bz) <= 64)
+	_, err = cdc.MarshalBinaryLengthPrefixed(small)
+	require.NoError(t, err)
+
+	for _, big := range []interface{}{
+		blob{Chunks: make([][]byte, 100)},
+		blob{Data: make([]byte, 100)},
+		blob{Counts: make([]uint64, 10000)},
+		make([]uint64, 100),
+		"a string that is longer than sixty-four bytes, in a single field",
+	} {
+		_, err = cdc.MarshalBinaryBare(big)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "max size of 64 bytes")
+		}
+		_, err = cdc.MarshalBinaryBareBuf(big, make([]byte, 0, 1024))
+		assert.Error(t, err)
+	}
+
+	cdc.SetMaxEncodeSize(0)
+	_, err = cdc.MarshalBinaryBare(blob{Data: make([]byte, 100)})
+	assert.NoError(t, err)
+	assert.Panics(t, func() { cdc.SetMaxEncodeSize(-1) })
+}
@@ -1,10 +1,16 @@
 package amino
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"math"
+	"math/big"
+	"net/url"
 	"reflect"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/pkg/errors"
 
@@ -15,20 +21,308 @@ import (
 // cdc.decodeReflectBinary
 
 var (
-	ErrOverflowInt = errors.New("encoded integer value overflows int(32)")
+	ErrOverflowInt  = errors.New("encoded integer value overflows int(32)")
+	ErrOverflowUint = errors.New("encoded integer value overflows uint(32)")
 )
 
 const (
 	// architecture dependent int limits:
-	maxInt = int(^uint(0) >> 1)
-	minInt = -maxInt - 1
+	maxInt  = int(^uint(0) >> 1)
+	minInt  = -maxInt - 1
+	maxUint = uint(^uint(0))
 )
 
+// MaxFieldNumber is the largest field number of a field key, as in protobuf.
+const MaxFieldNumber = 1<<29 - 1
+
+// FieldError is an error decoding the struct field at Path, the
+// dot-separated Go field names relative to the decoded value.
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+func (fe FieldError) Error() string {
+	return fmt.Sprintf("field %v: %v", fe.Path, fe.Err)
+}
+
+// FieldErrors is returned by UnmarshalBinaryBareCollectErrors when
+// decoding any fields failed.
+type FieldErrors []FieldError
+
+func (fes FieldErrors) Error() string {
+	msgs := make([]string, len(fes))
+	for i, fe := range fes {
+		msgs[i] = fe.Error()
+	}
+	return fmt.Sprintf("%d field error(s): %v", len(fes), strings.Join(msgs, "; "))
+}
+
+// WireTypeError is returned instead of the default error when the wire type
+// of a field doesn't match its Go type, if strict types are enabled with
+// Codec.SetStrictTypes.
+type WireTypeError struct {
+	FieldNum uint32
+	Type     reflect.Type // The Go type of the field (or list element).
+	Expected Typ3
+	Got      Typ3
+}
+
+func (e *WireTypeError) Error() string {
+	return fmt.Sprintf("field %v: expected %v for %v, got %v",
+		e.FieldNum, typ3WireName(e.Expected), e.Type, typ3WireName(e.Got))
+}
+
+// Returns the Proto3 name of the wire type.
+func typ3WireName(typ Typ3) string {
+	switch typ {
+	case Typ3Varint:
+		return "varint"
+	case Typ38Byte:
+		return "fixed64"
+	case Typ3ByteLength:
+		return "length-delimited"
+	case Typ3_4Byte:
+		return "fixed32"
+	default:
+		return typ.String()
+	}
+}
+
+// Returns a *WireTypeError if strict types are enabled, or else err.
+func (ds *decodeState) wireTypeError(err error, fnum uint32, rt reflect.Type, expected, got Typ3) error {
+	if !ds.strictTypes {
+		return err
+	}
+	return &WireTypeError{FieldNum: fnum, Type: rt, Expected: expected, Got: got}
+}
+
+// decodeState holds the per-call state of a binary (or JSON) decode.
+// A fresh one is created for every top-level Unmarshal* call and
+// passed through all decodeReflect* calls.
+type decodeState struct {
+	decodeOptions
+
+	path  []string             // Names of the struct fields being decoded.
+	hints map[string]*TypeInfo // Field path -> concrete type for interface values.
+
+	collectErrors bool        // If true, skip fields that fail to decode.
+	fieldErrors   FieldErrors // The errors of skipped fields.
+
+	allocated int // Bytes allocated so far, counted if maxAlloc > 0.
+
+	asName string // See Codec.UnmarshalBinaryBareAs, empty for the default.
+
+	ifaceDepth int // Number of interface values being decoded.
+
+	noPrefix bool // See Codec.UnmarshalProto.
+
+	rejectUnknownFields bool // See Codec.UnmarshalBinaryBareAny.
+
+	strings []string // See Codec.UnmarshalBinaryBareInterned, nil if not interned.
+
+	buffers []*[]byte // Taken from bufferPool, see releaseBuffers.
+}
+
+func (cdc *Codec) newDecodeState() *decodeState {
+	return &decodeState{decodeOptions: cdc.decodeOptions()}
+}
+
+// Returns defaultValue(rt), but with the epoch set by Codec.SetTimeEpoch (if
+// any) as the default time, since that's what encodes as no bytes.
+func (ds *decodeState) defaultValue(rt reflect.Type) reflect.Value {
+	rv := defaultValue(rt)
+	if ds.timeEpoch.IsZero() {
+		return rv
+	}
+	erv := rv
+	for erv.Kind() == reflect.Ptr && !erv.IsNil() {
+		erv = erv.Elem()
+	}
+	if erv.Type() == timeType {
+		erv.Set(reflect.ValueOf(ds.timeEpoch))
+	}
+	return rv
+}
+
+// Like DecodeByteSlice, but the copy is only for use while decoding, e.g. of
+// the bytes of a string, or of a nested struct or list, so it's taken from
+// the buffer pool if any, and returned by releaseBuffers.  It must not be
+// retained by the decoded value.
+func (ds *decodeState) decodeTransientByteSlice(bz []byte) (buf []byte, n int, err error) {
+	if ds.bufferPool == nil {
+		return DecodeByteSlice(bz)
+	}
+	var count int
+	count, n, err = decodeByteSliceLength(bz)
+	if err != nil {
+		return
+	}
+	buf = ds.getBuffer(count)
+	copy(buf, bz[n:n+count])
+	n += count
+	return
+}
+
+// Like DecodeString, but with the bytes from decodeTransientByteSlice.
+func (ds *decodeState) decodeString(bz []byte) (str string, n int, err error) {
+	var buf []byte
+	buf, n, err = ds.decodeTransientByteSlice(bz)
+	str = string(buf)
+	return
+}
+
+// Returns a buffer of length n, from the buffer pool if any.  It's returned to
+// the pool by releaseBuffers.
+func (ds *decodeState) getBuffer(n int) []byte {
+	bufp := getPooledBuffer(ds.bufferPool, n)
+	if ds.bufferPool != nil {
+		ds.buffers = append(ds.buffers, bufp)
+	}
+	return *bufp
+}
+
+// Returns the buffers from getBuffer to the buffer pool, once the message is
+// decoded.
+func (ds *decodeState) releaseBuffers() {
+	for _, bufp := range ds.buffers {
+		ds.bufferPool.Put(bufp)
+	}
+	ds.buffers = nil
+}
+
+func (ds *decodeState) pushField(name string) {
+	ds.path = append(ds.path, name)
+}
+
+func (ds *decodeState) popField() {
+	ds.path = ds.path[:len(ds.path)-1]
+}
+
+// Returns the dot-separated path of the field being decoded, e.g. "Header.Time".
+func (ds *decodeState) fieldPath() string {
+	return strings.Join(ds.path, ".")
+}
+
+// If collecting errors, records err for the field being decoded and returns
+// true, in which case the caller should skip the field and continue.
+func (ds *decodeState) collectFieldError(err error) bool {
+	if !ds.collectErrors || ds.allocExceeded() {
+		return false
+	}
+	ds.fieldErrors = append(ds.fieldErrors, FieldError{Path: ds.fieldPath(), Err: err})
+	return true
+}
+
+// Counts size bytes toward the max allocation, and returns an error if it's
+// exceeded.
+func (ds *decodeState) alloc(size int) error {
+	if ds.maxAlloc == 0 {
+		return nil
+	}
+	ds.allocated += size
+	if ds.allocExceeded() {
+		return fmt.Errorf("decoding exceeds the max allocation of %v bytes", ds.maxAlloc)
+	}
+	return nil
+}
+
+// Returns str normalized with the function set by Codec.SetNormalizeStrings,
+// if any.
+func (ds *decodeState) normalizeString(str string) string {
+	if ds.normalize == nil {
+		return str
+	}
+	return ds.normalize(str)
+}
+
+// Decodes a string encoded as its index in the string table, see
+// Codec.MarshalBinaryBareInterned.  The string isn't counted towards the max
+// allocation, since it's shared with the table.
+func (ds *decodeState) decodeInternedString(bz []byte) (str string, n int, err error) {
+	ibz, n, err := ds.decodeTransientByteSlice(bz)
+	if err != nil {
+		return
+	}
+	idx, _n, err := DecodeUvarint(ibz)
+	if err != nil {
+		return
+	}
+	if _n != len(ibz) {
+		err = fmt.Errorf("interned string index has %v trailing bytes at field path %q", len(ibz)-_n, ds.fieldPath())
+		return
+	}
+	if idx >= uint64(len(ds.strings)) {
+		err = fmt.Errorf("interned string index %v out of range of %v strings at field path %q", idx, len(ds.strings), ds.fieldPath())
+		return
+	}
+	str = ds.strings[idx]
+	return
+}
+
+func (ds *decodeState) allocExceeded() bool {
+	return ds.maxAlloc > 0 && ds.allocated > ds.maxAlloc
+}
+
+// Returns an error if a list (or map) of type rt can't have another element
+// after count, as per the max slice length.
+func (ds *decodeState) checkSliceLen(rt reflect.Type, count int) error {
+	if ds.maxSliceLen > 0 && count >= ds.maxSliceLen {
+		return fmt.Errorf("too many elements for %v, max is %v", rt, ds.maxSliceLen)
+	}
+	return nil
+}
+
+// Counts an interface value being decoded within the others, and returns an
+// error if they're nested deeper than the max interface depth.  If there's no
+// error, the caller must call exitInterface when done.
+func (ds *decodeState) enterInterface(iinfo *TypeInfo) error {
+	if ds.maxIfaceDepth > 0 && ds.ifaceDepth >= ds.maxIfaceDepth {
+		return fmt.Errorf("%v value at field path %q exceeds the max interface depth of %v",
+			iinfo.Type, ds.fieldPath(), ds.maxIfaceDepth)
+	}
+	ds.ifaceDepth++
+	return nil
+}
+
+func (ds *decodeState) exitInterface() {
+	ds.ifaceDepth--
+}
+
+// Returns an error if bz starts with a non-minimal varint and those are
+// rejected.  A truncated varint is left for the decoder to report.
+func (ds *decodeState) checkMinimalVarint(bz []byte) error {
+	if ds.rejectNonMinVarints && isNonMinimalVarint(bz) {
+		return fmt.Errorf("non-minimal varint at field path %q", ds.fieldPath())
+	}
+	return nil
+}
+
+// Returns true if bz starts with a varint encoded with more bytes than
+// necessary, i.e. its last byte is zero but not its only byte.
+func isNonMinimalVarint(bz []byte) bool {
+	for i, b := range bz {
+		if b < 0x80 {
+			return i > 0 && b == 0
+		}
+	}
+	return false
+}
+
+// Returns the concrete type hinted for the interface field being decoded.
+func (ds *decodeState) typeHint() (cinfo *TypeInfo, ok bool) {
+	if len(ds.hints) == 0 {
+		return nil, false
+	}
+	cinfo, ok = ds.hints[ds.fieldPath()]
+	return
+}
+
 // This is the main entrypoint for decoding all types from binary form. This
 // function calls decodeReflectBinary*, and generally those functions should
 // only call this one, for the prefix bytes are consumed here when present.
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
+func (cdc *Codec) decodeReflectBinary(ds *decodeState, bz []byte, info *TypeInfo,
 	rv reflect.Value, fopts FieldOptions, bare bool) (n int, err error) {
 
 	if !rv.CanAddr() {
@@ -52,12 +346,25 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 	// This works for pointer-pointers.
 	for rv.Kind() == reflect.Ptr {
 		if rv.IsNil() {
+			if err = ds.alloc(int(rv.Type().Elem().Size())); err != nil {
+				return
+			}
 			newPtr := reflect.New(rv.Type().Elem())
 			rv.Set(newPtr)
 		}
 		rv = rv.Elem()
 	}
 
+	// Validate the decoded value of a registered type, see
+	// ConcreteOptions.Validate.
+	if info.Registered && info.Validate != nil {
+		defer func() {
+			if err == nil {
+				err = validateConcrete(info, rv)
+			}
+		}()
+	}
+
 	// Handle override if a pointer to rv implements UnmarshalAmino.
 	if info.IsAminoUnmarshaler {
 		// First, decode repr instance from bytes.
@@ -67,7 +374,7 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 		if err != nil {
 			return
 		}
-		_n, err = cdc.decodeReflectBinary(bz, rinfo, rrv, fopts, bare)
+		_n, err = cdc.decodeReflectBinary(ds, bz, rinfo, rrv, fopts, bare)
 		if slide(&bz, &n, _n) && err != nil {
 			return
 		}
@@ -87,34 +394,72 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 	// Complex
 
 	case reflect.Interface:
-		_n, err = cdc.decodeReflectBinaryInterface(bz, info, rv, fopts, bare)
+		if info.Type == ioReaderType {
+			// Special case: io.Reader
+			var byteslice []byte
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return
+			}
+			byteslice, _n, err = DecodeByteSlice(bz)
+			if slide(&bz, &n, _n) && err != nil {
+				return
+			}
+			if err = ds.alloc(len(byteslice)); err != nil {
+				return
+			}
+			setReaderBytes(rv, byteslice)
+			return
+		}
+		_n, err = cdc.decodeReflectBinaryInterface(ds, bz, info, rv, fopts, bare)
 		n += _n
 		return
 
 	case reflect.Array:
 		ert := info.Type.Elem()
 		if ert.Kind() == reflect.Uint8 {
-			_n, err = cdc.decodeReflectBinaryByteArray(bz, info, rv, fopts)
+			_n, err = cdc.decodeReflectBinaryByteArray(ds, bz, info, rv, fopts)
 			n += _n
 		} else {
-			_n, err = cdc.decodeReflectBinaryArray(bz, info, rv, fopts, bare)
+			_n, err = cdc.decodeReflectBinaryArray(ds, bz, info, rv, fopts, bare)
 			n += _n
+			if err == nil && fopts.BinSorted && ds.sortLists {
+				err = cdc.sortListByEncoding(ds, info, rv, fopts)
+			}
 		}
 		return
 
 	case reflect.Slice:
 		ert := info.Type.Elem()
 		if ert.Kind() == reflect.Uint8 {
-			_n, err = cdc.decodeReflectBinaryByteSlice(bz, info, rv, fopts)
+			_n, err = cdc.decodeReflectBinaryByteSlice(ds, bz, info, rv, fopts)
 			n += _n
 		} else {
-			_n, err = cdc.decodeReflectBinarySlice(bz, info, rv, fopts, bare)
+			_n, err = cdc.decodeReflectBinarySlice(ds, bz, info, rv, fopts, bare)
 			n += _n
+			if err == nil && fopts.BinSorted && ds.sortLists {
+				err = cdc.sortListByEncoding(ds, info, rv, fopts)
+			}
 		}
 		return
 
 	case reflect.Struct:
-		_n, err = cdc.decodeReflectBinaryStruct(bz, info, rv, fopts, bare)
+		_n, err = cdc.decodeReflectBinaryStruct(ds, bz, info, rv, fopts, bare)
+		n += _n
+		return
+
+	case reflect.Map:
+		if !ds.allowMaps {
+			panic(fmt.Sprintf("unknown field type %v (see Codec.SetAllowMaps)", info.Type.Kind()))
+		}
+		_n, err = cdc.decodeReflectBinaryMap(ds, bz, info, rv, fopts, bare)
+		n += _n
+		return
+
+	case reflect.Chan:
+		if !fopts.DrainChan {
+			panic(fmt.Sprintf("unknown field type %v", info.Type.Kind()))
+		}
+		_n, err = cdc.decodeReflectBinaryChan(ds, bz, info, rv, fopts, bare)
 		n += _n
 		return
 
@@ -123,7 +468,14 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 
 	case reflect.Int64:
 		var num int64
-		if fopts.BinFixed64 {
+		if fopts.BinFixed64 && fopts.BinBigEndian {
+			var u64 uint64
+			u64, _n, err = decodeFixedBigEndian(bz, 8)
+			if slide(&bz, &n, _n) && err != nil {
+				return
+			}
+			rv.SetInt(int64(u64))
+		} else if fopts.BinFixed64 {
 			num, _n, err = DecodeInt64(bz)
 			if slide(&bz, &n, _n) && err != nil {
 				return
@@ -131,6 +483,9 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 			rv.SetInt(num)
 		} else {
 			var u64 uint64
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return
+			}
 			u64, _n, err = DecodeUvarint(bz)
 			if slide(&bz, &n, _n) && err != nil {
 				return
@@ -140,7 +495,14 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 		return
 
 	case reflect.Int32:
-		if fopts.BinFixed32 {
+		if fopts.BinFixed32 && fopts.BinBigEndian {
+			var u64 uint64
+			u64, _n, err = decodeFixedBigEndian(bz, 4)
+			if slide(&bz, &n, _n) && err != nil {
+				return
+			}
+			rv.SetInt(int64(int32(u64)))
+		} else if fopts.BinFixed32 {
 			var num int32
 			num, _n, err = DecodeInt32(bz)
 			if slide(&bz, &n, _n) && err != nil {
@@ -149,6 +511,9 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 			rv.SetInt(int64(num))
 		} else {
 			var num uint64
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return
+			}
 			num, _n, err = DecodeUvarint(bz)
 			if slide(&bz, &n, _n) && err != nil {
 				return
@@ -163,6 +528,9 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 
 	case reflect.Int16:
 		var num int16
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
 		num, _n, err = DecodeInt16(bz)
 		if slide(&bz, &n, _n) && err != nil {
 			return
@@ -172,6 +540,9 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 
 	case reflect.Int8:
 		var num int8
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
 		num, _n, err = DecodeInt8(bz)
 		if slide(&bz, &n, _n) && err != nil {
 			return
@@ -181,6 +552,9 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 
 	case reflect.Int:
 		var num uint64
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
 		num, _n, err = DecodeUvarint(bz)
 		if slide(&bz, &n, _n) && err != nil {
 			return
@@ -197,13 +571,22 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 
 	case reflect.Uint64:
 		var num uint64
-		if fopts.BinFixed64 {
+		if fopts.BinFixed64 && fopts.BinBigEndian {
+			num, _n, err = decodeFixedBigEndian(bz, 8)
+			if slide(&bz, &n, _n) && err != nil {
+				return
+			}
+			rv.SetUint(num)
+		} else if fopts.BinFixed64 {
 			num, _n, err = DecodeUint64(bz)
 			if slide(&bz, &n, _n) && err != nil {
 				return
 			}
 			rv.SetUint(num)
 		} else {
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return
+			}
 			num, _n, err = DecodeUvarint(bz)
 			if slide(&bz, &n, _n) && err != nil {
 				return
@@ -213,7 +596,14 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 		return
 
 	case reflect.Uint32:
-		if fopts.BinFixed32 {
+		if fopts.BinFixed32 && fopts.BinBigEndian {
+			var num uint64
+			num, _n, err = decodeFixedBigEndian(bz, 4)
+			if slide(&bz, &n, _n) && err != nil {
+				return
+			}
+			rv.SetUint(num)
+		} else if fopts.BinFixed32 {
 			var num uint32
 			num, _n, err = DecodeUint32(bz)
 			if slide(&bz, &n, _n) && err != nil {
@@ -222,16 +612,26 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 			rv.SetUint(uint64(num))
 		} else {
 			var num uint64
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return
+			}
 			num, _n, err = DecodeUvarint(bz)
 			if slide(&bz, &n, _n) && err != nil {
 				return
 			}
+			if num > math.MaxUint32 {
+				err = ErrOverflowUint
+				return
+			}
 			rv.SetUint(num)
 		}
 		return
 
 	case reflect.Uint16:
 		var num uint16
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
 		num, _n, err = DecodeUint16(bz)
 		if slide(&bz, &n, _n) && err != nil {
 			return
@@ -241,6 +641,9 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 
 	case reflect.Uint8:
 		var num uint8
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
 		num, _n, err = DecodeUint8(bz)
 		if slide(&bz, &n, _n) && err != nil {
 			return
@@ -250,10 +653,17 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 
 	case reflect.Uint:
 		var num uint64
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
 		num, _n, err = DecodeUvarint(bz)
 		if slide(&bz, &n, _n) && err != nil {
 			return
 		}
+		if num > uint64(maxUint) {
+			err = ErrOverflowUint
+			return
+		}
 		rv.SetUint(num)
 		return
 
@@ -297,11 +707,45 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 
 	case reflect.String:
 		var str string
-		str, _n, err = DecodeString(bz)
+		if ds.strings != nil {
+			str, _n, err = ds.decodeInternedString(bz)
+			if slide(&bz, &n, _n) && err != nil {
+				return
+			}
+			rv.SetString(ds.normalizeString(str))
+			return
+		}
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		str, _n, err = ds.decodeString(bz)
+		if slide(&bz, &n, _n) && err != nil {
+			return
+		}
+		if err = ds.alloc(len(str)); err != nil {
+			return
+		}
+		if ds.validateUTF8 && !utf8.ValidString(str) {
+			err = fmt.Errorf("invalid UTF-8 in string at field path %q", ds.fieldPath())
+			return
+		}
+		rv.SetString(ds.normalizeString(str))
+		return
+
+	case reflect.Complex64, reflect.Complex128:
+		if err = checkComplex(fopts, ds.allowComplex); err != nil {
+			return
+		}
+		var rinfo *TypeInfo
+		if rinfo, err = cdc.getComplexReprInfo(info.Type); err != nil {
+			return
+		}
+		rrv := reflect.New(rinfo.Type).Elem()
+		_n, err = cdc.decodeReflectBinary(ds, bz, rinfo, rrv, fopts, bare)
 		if slide(&bz, &n, _n) && err != nil {
 			return
 		}
-		rv.SetString(str)
+		setComplexFromRepr(rv, rrv)
 		return
 
 	default:
@@ -310,8 +754,24 @@ func (cdc *Codec) decodeReflectBinary(bz []byte, info *TypeInfo,
 
 }
 
+// Reads size (4 or 8) bytes in big-endian order, for fields tagged with
+// `amino:"bigendian"`.
+func decodeFixedBigEndian(bz []byte, size int) (u uint64, n int, err error) {
+	if len(bz) < size {
+		err = fmt.Errorf("EOF decoding big-endian fixed%v", size*8)
+		return
+	}
+	if size == 4 {
+		u = uint64(binary.BigEndian.Uint32(bz))
+	} else {
+		u = binary.BigEndian.Uint64(bz)
+	}
+	n = size
+	return
+}
+
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectBinaryInterface(bz []byte, iinfo *TypeInfo, rv reflect.Value,
+func (cdc *Codec) decodeReflectBinaryInterface(ds *decodeState, bz []byte, iinfo *TypeInfo, rv reflect.Value,
 	fopts FieldOptions, bare bool) (n int, err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
@@ -329,6 +789,10 @@ func (cdc *Codec) decodeReflectBinaryInterface(bz []byte, iinfo *TypeInfo, rv re
 		err = errors.New("decoding to a non-nil interface is not supported yet")
 		return
 	}
+	if err = ds.enterInterface(iinfo); err != nil {
+		return
+	}
+	defer ds.exitInterface()
 
 	if !bare {
 		// Read byte-length prefixed byteslice.
@@ -336,7 +800,10 @@ func (cdc *Codec) decodeReflectBinaryInterface(bz []byte, iinfo *TypeInfo, rv re
 			buf []byte
 			_n  int
 		)
-		buf, _n, err = DecodeByteSlice(bz)
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		buf, _n, err = ds.decodeTransientByteSlice(bz)
 		if slide(&bz, nil, _n) && err != nil {
 			return
 		}
@@ -345,15 +812,48 @@ func (cdc *Codec) decodeReflectBinaryInterface(bz []byte, iinfo *TypeInfo, rv re
 		bz = buf
 	}
 
+	if len(iinfo.OneofVariants) > 0 {
+		_n, err := cdc.decodeReflectBinaryOneof(ds, bz, iinfo, rv, fopts)
+		slide(&bz, &n, _n)
+		return n, err
+	}
+
+	if ds.compactIDs {
+		// Consume the compact ID instead, see Codec.EnableCompactInterfaceIDs.
+		var (
+			id uint64
+			_n int
+		)
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		id, _n, err = DecodeUvarint(bz)
+		if slide(&bz, &n, _n) && err != nil {
+			return
+		}
+		var cinfo, hinted = ds.typeHint()
+		if !hinted {
+			if cinfo, err = cdc.getTypeInfoFromCompactIDRlock(iinfo, id); err != nil {
+				return
+			}
+		}
+		_n, err = cdc.decodeReflectBinaryInterfaceContents(ds, bz, cinfo, rv, fopts)
+		n += _n
+		return
+	}
+
 	// Consume disambiguation / prefix bytes.
 	disamb, hasDisamb, prefix, hasPrefix, _n, err := DecodeDisambPrefixBytes(bz)
 	if slide(&bz, &n, _n) && err != nil {
 		return n, err
 	}
 
-	// Get concrete type info from disfix/prefix.
-	var cinfo *TypeInfo
+	// Get concrete type info from disfix/prefix,
+	// unless the caller hinted the concrete type for this field.
+	var cinfo, hinted = ds.typeHint()
 	switch {
+	case hinted:
+		// Use the hinted type regardless of disfix/prefix.
 	case hasDisamb:
 		cinfo, err = cdc.getTypeInfoFromDisfixRlock(toDisfix(disamb, prefix))
 	case hasPrefix:
@@ -364,9 +864,45 @@ func (cdc *Codec) decodeReflectBinaryInterface(bz []byte, iinfo *TypeInfo, rv re
 	if err != nil {
 		return
 	}
+	if cinfo.Version > 0 {
+		// Pick the Go type of the encoded version.
+		var version uint64
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		version, _n, err = DecodeUvarint(bz)
+		if slide(&bz, &n, _n) && err != nil {
+			return
+		}
+		if version > math.MaxUint32 {
+			err = fmt.Errorf("invalid version %v of %v", version, cinfo.Name)
+			return
+		}
+		if cinfo, err = cdc.getTypeInfoFromVersionRlock(cinfo, uint32(version)); err != nil {
+			return
+		}
+	}
+
+	_n, err = cdc.decodeReflectBinaryInterfaceContents(ds, bz, cinfo, rv, fopts)
+	n += _n
+	return
+}
+
+// Decodes the concrete value of type cinfo of an interface from bz, which
+// follows the prefix bytes (or compact ID).
+// CONTRACT: rv.CanAddr() is true.
+func (cdc *Codec) decodeReflectBinaryInterfaceContents(ds *decodeState, bz []byte, cinfo *TypeInfo,
+	rv reflect.Value, fopts FieldOptions) (n int, err error) {
+	var _n int
 
 	// Construct the concrete type.
-	var crv, irvSet = constructConcreteType(cinfo)
+	if err = ds.alloc(int(cinfo.Type.Size())); err != nil {
+		return
+	}
+	crv, irvSet, err := constructConcreteType(cinfo)
+	if err != nil {
+		return
+	}
 	isKnownType := (cinfo.Type.Kind() != reflect.Map) && (cinfo.Type.Kind() != reflect.Func)
 	if !isStructOrRepeatedStruct(cinfo) &&
 		!isPointerToStructOrToRepeatedStruct(crv, cinfo.Type) &&
@@ -379,6 +915,9 @@ func (cdc *Codec) decodeReflectBinaryInterface(bz []byte, iinfo *TypeInfo, rv re
 			typ       Typ3
 			nFnumTyp3 int
 		)
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
 		fnum, typ, nFnumTyp3, err = decodeFieldNumberAndTyp3(bz)
 		if err != nil {
 			return n, errors.Wrap(err, "could not decode field number and type")
@@ -388,14 +927,16 @@ func (cdc *Codec) decodeReflectBinaryInterface(bz []byte, iinfo *TypeInfo, rv re
 		}
 		typWanted := typeToTyp3(cinfo.Type, FieldOptions{})
 		if typ != typWanted {
-			return n, fmt.Errorf("expected field type %v for # %v of %v, got %v",
-				typWanted, fnum, cinfo.Type, typ)
+			return n, ds.wireTypeError(fmt.Errorf("expected field type %v for # %v of %v, got %v",
+				typWanted, fnum, cinfo.Type, typ), fnum, cinfo.Type, typWanted, typ)
 		}
 		slide(&bz, &n, nFnumTyp3)
 	}
 
 	// Decode into the concrete type.
-	_n, err = cdc.decodeReflectBinary(bz, cinfo, crv, fopts, true)
+	// NOTE: This applies the UnmarshalAmino of the concrete type, if any,
+	// since crv is addressable.
+	_n, err = cdc.decodeReflectBinary(ds, bz, cinfo, crv, fopts, true)
 	if slide(&bz, &n, _n) && err != nil {
 		rv.Set(irvSet) // Helps with debugging
 		return
@@ -417,16 +958,76 @@ func (cdc *Codec) decodeReflectBinaryInterface(bz []byte, iinfo *TypeInfo, rv re
 	return n, err
 }
 
+// Decodes the contents of an interface registered with RegisterOneof, where
+// the field number determines the concrete type.  See encodeReflectBinaryOneof.
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectBinaryByteArray(bz []byte, info *TypeInfo, rv reflect.Value,
+func (cdc *Codec) decodeReflectBinaryOneof(ds *decodeState, bz []byte, iinfo *TypeInfo, rv reflect.Value,
 	fopts FieldOptions) (n int, err error) {
-	if !rv.CanAddr() {
-		panic("rv not addressable")
+	if len(bz) == 0 {
+		// Nil interface.
+		return
 	}
-	if printLog {
-		fmt.Println("(d) decodeReflectBinaryByteArray")
-		defer func() {
-			fmt.Printf("(d) -> err: %v\n", err)
+
+	// Read field key (number and type).
+	var (
+		fnum uint32
+		typ  Typ3
+		_n   int
+	)
+	if err = ds.checkMinimalVarint(bz); err != nil {
+		return
+	}
+	fnum, typ, _n, err = decodeFieldNumberAndTyp3(bz)
+	if slide(&bz, &n, _n) && err != nil {
+		return
+	}
+
+	// Get concrete type info from the field number,
+	// unless the caller hinted the concrete type for this field.
+	var cinfo, hinted = ds.typeHint()
+	if !hinted {
+		if fnum == 0 || int(fnum) > len(iinfo.OneofVariants) {
+			err = fmt.Errorf("unknown oneof field number %v for %v", fnum, iinfo.Type)
+			return
+		}
+		cinfo = iinfo.OneofVariants[fnum-1]
+	}
+	cfopts := fopts
+	cfopts.BinFieldNum = fnum
+	typWanted := typeToTyp3(cinfo.Type, cfopts)
+	if typ != typWanted {
+		err = ds.wireTypeError(fmt.Errorf("expected field type %v for # %v of %v, got %v",
+			typWanted, fnum, iinfo.Type, typ), fnum, cinfo.Type, typWanted, typ)
+		return
+	}
+
+	// Decode into the concrete type.
+	crv, irvSet, err := constructConcreteType(cinfo)
+	if err != nil {
+		return
+	}
+	_n, err = cdc.decodeReflectBinary(ds, bz, cinfo, crv, cfopts, false)
+	if slide(&bz, &n, _n) && err != nil {
+		return
+	}
+	if len(bz) > 0 {
+		err = errors.New("bytes left over after reading interface contents")
+		return
+	}
+	rv.Set(irvSet)
+	return
+}
+
+// CONTRACT: rv.CanAddr() is true.
+func (cdc *Codec) decodeReflectBinaryByteArray(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value,
+	fopts FieldOptions) (n int, err error) {
+	if !rv.CanAddr() {
+		panic("rv not addressable")
+	}
+	if printLog {
+		fmt.Println("(d) decodeReflectBinaryByteArray")
+		defer func() {
+			fmt.Printf("(d) -> err: %v\n", err)
 		}()
 	}
 	ert := info.Type.Elem()
@@ -439,7 +1040,10 @@ func (cdc *Codec) decodeReflectBinaryByteArray(bz []byte, info *TypeInfo, rv ref
 	}
 
 	// Read byte-length prefixed byteslice.
-	byteslice, _n, err := DecodeByteSlice(bz)
+	if err = ds.checkMinimalVarint(bz); err != nil {
+		return
+	}
+	byteslice, _n, err := ds.decodeTransientByteSlice(bz)
 	if slide(&bz, &n, _n) && err != nil {
 		return
 	}
@@ -456,7 +1060,7 @@ func (cdc *Codec) decodeReflectBinaryByteArray(bz []byte, info *TypeInfo, rv ref
 
 // CONTRACT: rv.CanAddr() is true.
 // NOTE: Keep the code structure similar to decodeReflectBinarySlice.
-func (cdc *Codec) decodeReflectBinaryArray(bz []byte, info *TypeInfo, rv reflect.Value,
+func (cdc *Codec) decodeReflectBinaryArray(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value,
 	fopts FieldOptions, bare bool) (n int, err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
@@ -483,7 +1087,10 @@ func (cdc *Codec) decodeReflectBinaryArray(bz []byte, info *TypeInfo, rv reflect
 			buf []byte
 			_n  int
 		)
-		buf, _n, err = DecodeByteSlice(bz)
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		buf, _n, err = ds.decodeTransientByteSlice(bz)
 		if slide(&bz, nil, _n) && err != nil {
 			return
 		}
@@ -496,14 +1103,36 @@ func (cdc *Codec) decodeReflectBinaryArray(bz []byte, info *TypeInfo, rv reflect
 	// This is a Proto wart due to Proto backwards compatibility issues.
 	// Amino2 will probably migrate to use the List typ3.
 	typ3 := typeToTyp3(einfo.Type, fopts)
-	if typ3 != Typ3ByteLength {
+	if typ3 != Typ3ByteLength && fopts.BinUnpacked {
+		// Read elements in unpacked (or packed) form.
+		var (
+			srv reflect.Value
+			_n  int
+		)
+		srv, _n, err = cdc.decodeReflectBinaryScalarEntries(ds, bz, info, einfo, fopts, typ3)
+		if slide(&bz, &n, _n) && err != nil {
+			return
+		}
+		if srv.Len() < length {
+			err = arrayLengthError(info.Type, srv.Len())
+			return
+		} else if srv.Len() > length {
+			err = fmt.Errorf("too many elements for %v in repeated field number %v", info.Type, fopts.BinFieldNum)
+			return
+		}
+		reflect.Copy(rv, srv)
+	} else if typ3 != Typ3ByteLength {
 		// Read elements in packed form.
 		for i := 0; i < length; i++ {
+			if len(bz) == 0 {
+				err = arrayLengthError(info.Type, i)
+				return
+			}
 			erv := rv.Index(i)
 			var _n int
-			_n, err = cdc.decodeReflectBinary(bz, einfo, erv, fopts, false)
+			_n, err = cdc.decodeReflectBinary(ds, bz, einfo, erv, fopts, false)
 			if slide(&bz, &n, _n) && err != nil {
-				err = fmt.Errorf("error reading array contents: %v", err)
+				err = errors.Wrap(err, "error reading array contents")
 				return
 			}
 			// Special case when reading default value, prefer nil.
@@ -517,7 +1146,8 @@ func (cdc *Codec) decodeReflectBinaryArray(bz []byte, info *TypeInfo, rv reflect
 		}
 		// Ensure that we read the whole buffer.
 		if len(bz) > 0 {
-			err = errors.New("bytes left over after reading array contents")
+			err = fmt.Errorf("bytes left over after reading array contents, expected %v elements for %v",
+				length, info.Type)
 			return
 		}
 	} else {
@@ -532,14 +1162,29 @@ func (cdc *Codec) decodeReflectBinaryArray(bz []byte, info *TypeInfo, rv reflect
 				typ  Typ3
 				_n   int
 			)
+			if len(bz) == 0 {
+				err = arrayLengthError(info.Type, i)
+				return
+			}
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return
+			}
 			fnum, typ, _n, err = decodeFieldNumberAndTyp3(bz)
+			if err != nil {
+				return
+			}
 			// Validate field number and typ3.
+			if fnum > fopts.BinFieldNum {
+				err = arrayLengthError(info.Type, i)
+				return
+			}
 			if fnum != fopts.BinFieldNum {
 				err = errors.New(fmt.Sprintf("expected repeated field number %v, got %v", fopts.BinFieldNum, fnum))
 				return
 			}
 			if typ != Typ3ByteLength {
-				err = errors.New(fmt.Sprintf("expected repeated field type %v, got %v", Typ3ByteLength, typ))
+				err = ds.wireTypeError(errors.New(fmt.Sprintf("expected repeated field type %v, got %v", Typ3ByteLength, typ)),
+					fnum, ert, Typ3ByteLength, typ)
 				return
 			}
 			if slide(&bz, &n, _n) && err != nil {
@@ -556,16 +1201,16 @@ func (cdc *Codec) decodeReflectBinaryArray(bz []byte, info *TypeInfo, rv reflect
 				!(isErtStructPointer && fopts.EmptyElements) {
 
 				slide(&bz, &n, 1)
-				erv.Set(defaultValue(erv.Type()))
+				erv.Set(ds.defaultValue(erv.Type()))
 				continue
 			}
 			// Normal case, read next non-nil element from bz.
 			// In case of any inner lists in unpacked form.
 			efopts := fopts
 			efopts.BinFieldNum = 1
-			_n, err = cdc.decodeReflectBinary(bz, einfo, erv, efopts, false)
+			_n, err = cdc.decodeReflectBinary(ds, bz, einfo, erv, efopts, false)
 			if slide(&bz, &n, _n) && err != nil {
-				err = fmt.Errorf("error reading array contents: %v", err)
+				err = errors.Wrap(err, "error reading array contents")
 				return
 			}
 		}
@@ -574,11 +1219,18 @@ func (cdc *Codec) decodeReflectBinaryArray(bz []byte, info *TypeInfo, rv reflect
 		// This is to provide better error messages.
 		if len(bz) > 0 {
 			var fnum uint32
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return
+			}
 			fnum, _, _, err = decodeFieldNumberAndTyp3(bz)
 			if err != nil {
 				return
 			}
-			if fnum <= fopts.BinFieldNum {
+			if fnum == fopts.BinFieldNum {
+				err = fmt.Errorf("too many elements for %v in repeated field number %v", info.Type, fnum)
+				return
+			}
+			if fnum < fopts.BinFieldNum {
 				err = fmt.Errorf("unexpected field number %v after repeated field number %v", fnum, fopts.BinFieldNum)
 				return
 			}
@@ -587,8 +1239,13 @@ func (cdc *Codec) decodeReflectBinaryArray(bz []byte, info *TypeInfo, rv reflect
 	return n, err
 }
 
+// Returns the error for an array of type rt with only got elements.
+func arrayLengthError(rt reflect.Type, got int) error {
+	return fmt.Errorf("too few elements for %v, got %v", rt, got)
+}
+
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectBinaryByteSlice(bz []byte, info *TypeInfo, rv reflect.Value,
+func (cdc *Codec) decodeReflectBinaryByteSlice(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value,
 	fopts FieldOptions) (n int, err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
@@ -614,10 +1271,16 @@ func (cdc *Codec) decodeReflectBinaryByteSlice(bz []byte, info *TypeInfo, rv ref
 		byteslice []byte
 		_n        int
 	)
+	if err = ds.checkMinimalVarint(bz); err != nil {
+		return
+	}
 	byteslice, _n, err = DecodeByteSlice(bz)
 	if slide(&bz, &n, _n) && err != nil {
 		return
 	}
+	if err = ds.alloc(len(byteslice)); err != nil {
+		return
+	}
 	if len(byteslice) == 0 {
 		// Special case when length is 0.
 		// NOTE: We prefer nil slices.
@@ -630,7 +1293,7 @@ func (cdc *Codec) decodeReflectBinaryByteSlice(bz []byte, info *TypeInfo, rv ref
 
 // CONTRACT: rv.CanAddr() is true.
 // NOTE: Keep the code structure similar to decodeReflectBinaryArray.
-func (cdc *Codec) decodeReflectBinarySlice(bz []byte, info *TypeInfo, rv reflect.Value,
+func (cdc *Codec) decodeReflectBinarySlice(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value,
 	fopts FieldOptions, bare bool) (n int, err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
@@ -661,7 +1324,10 @@ func (cdc *Codec) decodeReflectBinarySlice(bz []byte, info *TypeInfo, rv reflect
 			buf []byte
 			_n  int
 		)
-		buf, _n, err = DecodeByteSlice(bz)
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		buf, _n, err = ds.decodeTransientByteSlice(bz)
 		if slide(&bz, nil, _n) && err != nil {
 			return
 		}
@@ -674,16 +1340,29 @@ func (cdc *Codec) decodeReflectBinarySlice(bz []byte, info *TypeInfo, rv reflect
 	// This is a Proto wart due to Proto backwards compatibility issues.
 	// Amino2 will probably migrate to use the List typ3.
 	typ3 := typeToTyp3(einfo.Type, fopts)
-	if typ3 != Typ3ByteLength {
+	if typ3 != Typ3ByteLength && fopts.BinUnpacked {
+		// Read elems in unpacked (or packed) form.
+		var _n int
+		srv, _n, err = cdc.decodeReflectBinaryScalarEntries(ds, bz, info, einfo, fopts, typ3)
+		if slide(&bz, &n, _n) && err != nil {
+			return
+		}
+	} else if typ3 != Typ3ByteLength {
 		// Read elems in packed form.
 		for {
 			if len(bz) == 0 {
 				break
 			}
+			if err = ds.checkSliceLen(info.Type, srv.Len()); err != nil {
+				return
+			}
+			if err = ds.alloc(int(ert.Size())); err != nil {
+				return
+			}
 			erv, _n := reflect.New(ert).Elem(), int(0)
-			_n, err = cdc.decodeReflectBinary(bz, einfo, erv, fopts, false)
+			_n, err = cdc.decodeReflectBinary(ds, bz, einfo, erv, fopts, false)
 			if slide(&bz, &n, _n) && err != nil {
-				err = fmt.Errorf("error reading array contents: %v", err)
+				err = errors.Wrap(err, "error reading array contents")
 				return
 			}
 			// Special case when reading default value, prefer nil.
@@ -712,6 +1391,9 @@ func (cdc *Codec) decodeReflectBinarySlice(bz []byte, info *TypeInfo, rv reflect
 				_n   int
 				fnum uint32
 			)
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return
+			}
 			fnum, typ, _n, err = decodeFieldNumberAndTyp3(bz)
 			// Validate field number and typ3.
 			if fnum < fopts.BinFieldNum {
@@ -722,13 +1404,20 @@ func (cdc *Codec) decodeReflectBinarySlice(bz []byte, info *TypeInfo, rv reflect
 				break
 			}
 			if typ != Typ3ByteLength {
-				err = errors.New(fmt.Sprintf("expected repeated field type %v, got %v", Typ3ByteLength, typ))
+				err = ds.wireTypeError(errors.New(fmt.Sprintf("expected repeated field type %v, got %v", Typ3ByteLength, typ)),
+					fnum, ert, Typ3ByteLength, typ)
 				return
 			}
 			if slide(&bz, &n, _n) && err != nil {
 				return
 			}
 			// Decode the next ByteLength bytes into erv.
+			if err = ds.checkSliceLen(info.Type, srv.Len()); err != nil {
+				return
+			}
+			if err = ds.alloc(int(ert.Size())); err != nil {
+				return
+			}
 			erv, _n := reflect.New(ert).Elem(), int(0)
 			// Special case if:
 			//  * next ByteLength bytes are 0x00, and
@@ -739,7 +1428,7 @@ func (cdc *Codec) decodeReflectBinarySlice(bz []byte, info *TypeInfo, rv reflect
 				!(isErtStructPointer && fopts.EmptyElements) {
 
 				slide(&bz, &n, 1)
-				erv.Set(defaultValue(erv.Type()))
+				erv.Set(ds.defaultValue(erv.Type()))
 				srv = reflect.Append(srv, erv)
 				continue
 			}
@@ -747,9 +1436,9 @@ func (cdc *Codec) decodeReflectBinarySlice(bz []byte, info *TypeInfo, rv reflect
 			// In case of any inner lists in unpacked form.
 			efopts := fopts
 			efopts.BinFieldNum = 1
-			_n, err = cdc.decodeReflectBinary(bz, einfo, erv, efopts, false)
+			_n, err = cdc.decodeReflectBinary(ds, bz, einfo, erv, efopts, false)
 			if slide(&bz, &n, _n) && err != nil {
-				err = fmt.Errorf("error reading array contents: %v", err)
+				err = errors.Wrap(err, "error reading array contents")
 				return
 			}
 			srv = reflect.Append(srv, erv)
@@ -759,8 +1448,99 @@ func (cdc *Codec) decodeReflectBinarySlice(bz []byte, info *TypeInfo, rv reflect
 	return n, err
 }
 
+// Reads the entries of the repeated field fopts.BinFieldNum at the start of
+// bz, for a list of type info.Type whose elements are scalars with typ3, and
+// returns the elements as a slice.  Like in protobuf, each entry may be a
+// single element, or elements in packed form (as a ByteLength), so the list
+// may have been encoded either way.
+func (cdc *Codec) decodeReflectBinaryScalarEntries(ds *decodeState, bz []byte, info, einfo *TypeInfo,
+	fopts FieldOptions, typ3 Typ3) (srv reflect.Value, n int, err error) {
+	ert := info.Type.Elem()
+	srv = reflect.Zero(reflect.SliceOf(ert))
+
+	// Decodes the next element from ebz and appends it to srv.
+	appendElem := func(ebz []byte) (n int, err error) {
+		if err = ds.checkSliceLen(info.Type, srv.Len()); err != nil {
+			return
+		}
+		if err = ds.alloc(int(ert.Size())); err != nil {
+			return
+		}
+		erv := reflect.New(ert).Elem()
+		n, err = cdc.decodeReflectBinary(ds, ebz, einfo, erv, fopts, false)
+		if err != nil {
+			err = errors.Wrap(err, "error reading array contents")
+			return
+		}
+		// Special case when reading default value, prefer nil.
+		if ert.Kind() == reflect.Ptr {
+			if _, isDefault := isDefaultValue(erv); isDefault {
+				erv = reflect.Zero(ert)
+			}
+		}
+		srv = reflect.Append(srv, erv)
+		return
+	}
+
+	for len(bz) > 0 {
+		// Read field key (number and type).
+		var (
+			fnum uint32
+			typ  Typ3
+			_n   int
+		)
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		fnum, typ, _n, err = decodeFieldNumberAndTyp3(bz)
+		if err != nil {
+			return
+		}
+		// Validate field number and typ3.
+		if fnum < fopts.BinFieldNum {
+			err = errors.New(fmt.Sprintf("expected repeated field number %v or greater, got %v", fopts.BinFieldNum, fnum))
+			return
+		}
+		if fnum > fopts.BinFieldNum {
+			break
+		}
+		if typ != typ3 && typ != Typ3ByteLength {
+			err = ds.wireTypeError(errors.New(fmt.Sprintf("expected repeated field type %v, got %v", typ3, typ)),
+				fnum, ert, typ3, typ)
+			return
+		}
+		slide(&bz, &n, _n)
+
+		if typ == Typ3ByteLength {
+			// Read elements in packed form.
+			var ebz []byte
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return
+			}
+			ebz, _n, err = ds.decodeTransientByteSlice(bz)
+			if slide(&bz, &n, _n) && err != nil {
+				return
+			}
+			for len(ebz) > 0 {
+				_n, err = appendElem(ebz)
+				if err != nil {
+					return
+				}
+				ebz = ebz[_n:]
+			}
+		} else {
+			// Read a single element.
+			_n, err = appendElem(bz)
+			if slide(&bz, &n, _n) && err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectBinaryStruct(bz []byte, info *TypeInfo, rv reflect.Value,
+func (cdc *Codec) decodeReflectBinaryStruct(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value,
 	_ FieldOptions, bare bool) (n int, err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
@@ -779,7 +1559,10 @@ func (cdc *Codec) decodeReflectBinaryStruct(bz []byte, info *TypeInfo, rv reflec
 	if !bare {
 		// Read byte-length prefixed byteslice.
 		var buf []byte
-		buf, _n, err = DecodeByteSlice(bz)
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		buf, _n, err = ds.decodeTransientByteSlice(bz)
 		if slide(&bz, nil, _n) && err != nil {
 			return
 		}
@@ -793,12 +1576,55 @@ func (cdc *Codec) decodeReflectBinaryStruct(bz []byte, info *TypeInfo, rv reflec
 	case timeType:
 		// Special case: time.Time
 		var t time.Time
-		t, _n, err = DecodeTime(bz)
+		t, _n, err = decodeTimeSince(bz, ds.timeEpoch)
+		if err == nil && ds.rejectNonMinVarints {
+			err = checkCanonicalTime(t, ds.timeEpoch, bz[:_n])
+		}
 		if slide(&bz, &n, _n) && err != nil {
 			return
 		}
 		rv.Set(reflect.ValueOf(t))
 
+	case bigFloatType:
+		// Special case: big.Float
+		err = decodeBigFloat(string(bz), rv)
+		if err != nil {
+			return
+		}
+		slide(&bz, &n, len(bz))
+
+	case urlType:
+		// Special case: url.URL
+		err = decodeURL(string(bz), rv)
+		if err != nil {
+			return
+		}
+		slide(&bz, &n, len(bz))
+
+	case netipAddrType:
+		// Special case: netip.Addr
+		err = decodeNetipAddrBytes(bz, rv)
+		if err != nil {
+			return
+		}
+		slide(&bz, &n, len(bz))
+
+	case netipPrefixType:
+		// Special case: netip.Prefix
+		err = decodeNetipText(string(bz), rv)
+		if err != nil {
+			return
+		}
+		slide(&bz, &n, len(bz))
+
+	case bufferType:
+		// Special case: bytes.Buffer
+		if err = ds.alloc(len(bz)); err != nil {
+			return
+		}
+		setBufferBytes(rv, bz)
+		slide(&bz, &n, len(bz))
+
 	default:
 		// Track the last seen field number.
 		var lastFieldNum uint32
@@ -814,14 +1640,21 @@ func (cdc *Codec) decodeReflectBinaryStruct(bz []byte, info *TypeInfo, rv reflec
 
 			// We're done if we've consumed all the bytes.
 			if len(bz) == 0 {
-				frv.Set(defaultValue(frv.Type()))
+				frv.Set(ds.defaultValue(frv.Type()))
 				continue
 			}
 
 			if field.UnpackedList {
-				// This is a list that was encoded unpacked, e.g.
+				// This is a list (or map) that was encoded unpacked, e.g.
 				// with repeated field entries for each list item.
-				_n, err = cdc.decodeReflectBinary(bz, finfo, frv, field.FieldOptions, true)
+				var lbz = bz
+				if info.positions != nil {
+					// Fields may be out of order, so only pass this field's entries.
+					lbz = bz[:repeatedFieldLen(bz, field.BinFieldNum)]
+				}
+				ds.pushField(field.Name)
+				_n, err = cdc.decodeReflectBinary(ds, lbz, finfo, frv, field.FieldOptions, true)
+				ds.popField()
 				if slide(&bz, &n, _n) && err != nil {
 					return
 				}
@@ -831,19 +1664,41 @@ func (cdc *Codec) decodeReflectBinaryStruct(bz []byte, info *TypeInfo, rv reflec
 					fnum uint32
 					typ  Typ3
 				)
+				if err = ds.checkMinimalVarint(bz); err != nil {
+					return
+				}
 				fnum, typ, _n, err = decodeFieldNumberAndTyp3(bz)
-				if field.BinFieldNum < fnum {
+				if info.fieldPosition(field.BinFieldNum) < info.fieldPosition(fnum) {
 					// Set zero field value.
-					frv.Set(defaultValue(frv.Type()))
+					frv.Set(ds.defaultValue(frv.Type()))
 					continue
 					// Do not slide, we will read it again.
 				}
-				if fnum <= lastFieldNum {
+				if info.fieldPosition(fnum) <= info.fieldPosition(lastFieldNum) {
 					err = fmt.Errorf("encountered fieldnNum: %v, but we have already seen fnum: %v\nbytes:%X",
 						fnum, lastFieldNum, bz)
 					return
 				}
 				lastFieldNum = fnum
+				if etyp3, ok := scalarListTyp3(finfo.Type, field.FieldOptions); ok &&
+					err == nil && fnum == field.BinFieldNum && typ == etyp3 {
+					// This is a list of scalars that was encoded unpacked,
+					// which is read like `amino:"unpacked"`, as in protobuf.
+					var lbz = bz
+					if info.positions != nil {
+						// Fields may be out of order, so only pass this field's entries.
+						lbz = bz[:repeatedFieldLen(bz, field.BinFieldNum)]
+					}
+					var ufopts = field.FieldOptions
+					ufopts.BinUnpacked = true
+					ds.pushField(field.Name)
+					_n, err = cdc.decodeReflectBinary(ds, lbz, finfo, frv, ufopts, true)
+					ds.popField()
+					if slide(&bz, &n, _n) && err != nil {
+						return
+					}
+					continue
+				}
 				if slide(&bz, &n, _n) && err != nil {
 					return
 				}
@@ -858,13 +1713,21 @@ func (cdc *Codec) decodeReflectBinaryStruct(bz []byte, info *TypeInfo, rv reflec
 					return
 				}
 				typWanted := typeToTyp3(finfo.Type, field.FieldOptions)
+				ds.pushField(field.Name)
 				if typ != typWanted {
-					err = errors.New(fmt.Sprintf("expected field type %v for # %v of %v, got %v",
-						typWanted, fnum, info.Type, typ))
-					return
+					err = ds.wireTypeError(errors.New(fmt.Sprintf("expected field type %v for # %v of %v, got %v",
+						typWanted, fnum, info.Type, typ)), fnum, finfo.Type, typWanted, typ)
+					_n = 0
+				} else {
+					// Decode field into frv.
+					_n, err = cdc.decodeReflectBinary(ds, bz, finfo, frv, field.FieldOptions, false)
+				}
+				if err != nil && ds.collectFieldError(err) {
+					// Skip the field, unless it can't be framed.
+					frv.Set(ds.defaultValue(frv.Type()))
+					_n, err = consumeAny(typ, bz)
 				}
-				// Decode field into frv.
-				_n, err = cdc.decodeReflectBinary(bz, finfo, frv, field.FieldOptions, false)
+				ds.popField()
 				if slide(&bz, &n, _n) && err != nil {
 					return
 				}
@@ -875,28 +1738,345 @@ func (cdc *Codec) decodeReflectBinaryStruct(bz []byte, info *TypeInfo, rv reflec
 		var (
 			fnum uint32
 			typ3 Typ3
+			hook func(typeName string, fieldNum uint32, wireType byte, raw []byte)
 		)
+		if len(bz) > 0 {
+			hook = ds.unknownFieldHook
+		}
 		for len(bz) > 0 {
+			if err = ds.checkMinimalVarint(bz); err != nil {
+				return
+			}
 			fnum, typ3, _n, err = decodeFieldNumberAndTyp3(bz)
 			if slide(&bz, &n, _n) && err != nil {
 				return
 			}
-			if fnum <= lastFieldNum {
+			if ds.rejectUnknownFields {
+				err = fmt.Errorf("unknown field number %v of %v", fnum, info.Type)
+				return
+			}
+			if ds.maxFieldNum > 0 && fnum > ds.maxFieldNum {
+				err = fmt.Errorf("field number %v of %v exceeds max field number %v",
+					fnum, info.Type, ds.maxFieldNum)
+				return
+			}
+			if info.fieldPosition(fnum) <= info.fieldPosition(lastFieldNum) {
 				err = fmt.Errorf("encountered fieldnNum: %v, but we have already seen fnum: %v\nbytes:%X",
 					fnum, lastFieldNum, bz)
 				return
 			}
 			lastFieldNum = fnum
 
+			if typ3 == Typ3Varint || typ3 == Typ3ByteLength {
+				if err = ds.checkMinimalVarint(bz); err != nil {
+					return
+				}
+			}
 			_n, err = consumeAny(typ3, bz)
+			if err == nil && hook != nil {
+				var typeName = info.Name
+				if !info.Registered {
+					typeName = info.Type.String()
+				}
+				hook(typeName, fnum, byte(typ3), bz[:_n])
+			}
 			if slide(&bz, &n, _n) && err != nil {
 				return
 			}
 		}
+
+		// Validate the decoded fields.
+		err = cdc.validateStructFields(ds, info, rv)
+	}
+	return n, err
+}
+
+// Decodes the text s of a big.Float, as written by Text('g', -1), into rv.
+// Unless rv already has a precision, it's set to the precision needed to
+// represent all the digits of s, and at least 64 bits.
+// CONTRACT: rv.CanAddr() is true.
+func decodeBigFloat(s string, rv reflect.Value) error {
+	f := rv.Addr().Interface().(*big.Float)
+	if f.Prec() == 0 {
+		var digits int
+		for _, c := range s {
+			if c == 'e' || c == 'E' {
+				break
+			}
+			if '0' <= c && c <= '9' {
+				digits++
+			}
+		}
+		prec := uint(math.Ceil(float64(digits) * math.Log2(10)))
+		if prec < 64 {
+			prec = 64
+		}
+		f.SetPrec(prec)
+	}
+	if _, _, err := f.Parse(s, 10); err != nil {
+		return fmt.Errorf("invalid big.Float %q: %v", s, err)
+	}
+	return nil
+}
+
+func decodeURL(s string, rv reflect.Value) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return fmt.Errorf("invalid url.URL %q: %v", s, err)
+	}
+	rv.Set(reflect.ValueOf(*u))
+	return nil
+}
+
+// Decodes a time like DecodeTime, but as the seconds and nanoseconds since
+// epoch, or since the Unix epoch if epoch is zero.  See Codec.SetTimeEpoch.
+func decodeTimeSince(bz []byte, epoch time.Time) (t time.Time, n int, err error) {
+	t, n, err = DecodeTime(bz)
+	if err != nil || epoch.IsZero() {
+		return
+	}
+	t = time.Unix(epoch.Unix()+t.Unix(), int64(epoch.Nanosecond()+t.Nanosecond())).UTC()
+	if s := t.Unix(); s < minSeconds || s >= maxSeconds {
+		err = InvalidTimeErr(fmt.Sprintf("seconds have to be >= %d and < %d, got: %d",
+			minSeconds, maxSeconds, s))
+	}
+	return
+}
+
+// Returns an error unless bz, from which t was decoded (relative to epoch),
+// is how t encodes, e.g. because a varint in bz is non-minimal.
+func checkCanonicalTime(t time.Time, epoch time.Time, bz []byte) error {
+	buf := new(bytes.Buffer)
+	if err := encodeTimeSince(buf, t, epoch); err != nil {
+		return err
+	}
+	if !bytes.Equal(buf.Bytes(), bz) {
+		return fmt.Errorf("non-canonical encoding of time %X", bz)
+	}
+	return nil
+}
+
+// Returns the length of the leading entries of repeated field fnum in bz.
+func repeatedFieldLen(bz []byte, fnum uint32) (n int) {
+	for n < len(bz) {
+		fnum2, typ, _n, err := decodeFieldNumberAndTyp3(bz[n:])
+		if err != nil || fnum2 != fnum {
+			break
+		}
+		_n2, err := consumeAny(typ, bz[n+_n:])
+		if err != nil {
+			break
+		}
+		n += _n + _n2
+	}
+	return
+}
+
+// CONTRACT: rv.CanAddr() is true.
+// NOTE: Keep the code structure similar to decodeReflectBinarySlice.
+func (cdc *Codec) decodeReflectBinaryMap(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value,
+	fopts FieldOptions, bare bool) (n int, err error) {
+	if !rv.CanAddr() {
+		panic("rv not addressable")
+	}
+	if printLog {
+		fmt.Println("(d) decodeReflectBinaryMap")
+		defer func() {
+			fmt.Printf("(d) -> err: %v\n", err)
+		}()
+	}
+	krt, vrt := info.Type.Key(), info.Type.Elem()
+	if !isMapKeyKind(krt.Kind()) {
+		err = fmt.Errorf("unsupported map key type %v, must be a string or integer", krt)
+		return
+	}
+	kinfo, err := cdc.getTypeInfoWlock(krt)
+	if err != nil {
+		return
+	}
+	vinfo, err := cdc.getTypeInfoWlock(vrt)
+	if err != nil {
+		return
+	}
+
+	if !bare {
+		// Read byte-length prefixed byteslice.
+		var (
+			buf []byte
+			_n  int
+		)
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		buf, _n, err = ds.decodeTransientByteSlice(bz)
+		if slide(&bz, nil, _n) && err != nil {
+			return
+		}
+		// This is a trick for debuggability -- we slide on &n more later.
+		n += UvarintSize(uint64(len(buf)))
+		bz = buf
+	}
+
+	var mrv = reflect.MakeMap(info.Type)
+	_n, err := cdc.decodeBinaryMapEntries(ds, bz, info.Type, kinfo, vinfo, fopts,
+		func(krv, vrv reflect.Value) error {
+			if mrv.MapIndex(krv).IsValid() {
+				return fmt.Errorf("duplicate map key %v", krv.Interface())
+			}
+			mrv.SetMapIndex(krv, vrv)
+			return nil
+		})
+	if slide(&bz, &n, _n) && err != nil {
+		return
+	}
+	if mrv.Len() == 0 {
+		// Special case when length is 0.
+		// NOTE: We prefer nil maps.
+		rv.Set(info.ZeroValue)
+	} else {
+		rv.Set(mrv)
 	}
 	return n, err
 }
 
+// Decodes the entries of a map of type rt, encoded as repeated field
+// fopts.BinFieldNum (see decodeReflectBinaryMap), and calls fn with the key
+// and value of each, in order.  Stops at the first field of another number.
+func (cdc *Codec) decodeBinaryMapEntries(ds *decodeState, bz []byte, rt reflect.Type, kinfo, vinfo *TypeInfo,
+	fopts FieldOptions, fn func(krv, vrv reflect.Value) error) (n int, err error) {
+	krt, vrt := rt.Key(), rt.Elem()
+	kfopts := FieldOptions{BinFieldNum: 1}
+	vfopts := fopts
+	vfopts.BinFieldNum = 2
+
+	for count := 0; len(bz) > 0; count++ {
+		// Read field key (number and type).
+		var (
+			fnum  uint32
+			typ   Typ3
+			_n    int
+			entry []byte
+		)
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		fnum, typ, _n, err = decodeFieldNumberAndTyp3(bz)
+		if err != nil {
+			return
+		}
+		// Validate field number and typ3.
+		if fnum < fopts.BinFieldNum {
+			err = fmt.Errorf("expected repeated field number %v or greater, got %v", fopts.BinFieldNum, fnum)
+			return
+		}
+		if fnum > fopts.BinFieldNum {
+			break
+		}
+		if typ != Typ3ByteLength {
+			err = ds.wireTypeError(fmt.Errorf("expected repeated field type %v, got %v", Typ3ByteLength, typ),
+				fnum, rt, Typ3ByteLength, typ)
+			return
+		}
+		slide(&bz, &n, _n)
+		if err = ds.checkMinimalVarint(bz); err != nil {
+			return
+		}
+		entry, _n, err = ds.decodeTransientByteSlice(bz)
+		if slide(&bz, &n, _n) && err != nil {
+			return
+		}
+		// Decode the key (field 1) and value (field 2) of the entry.
+		if err = ds.checkSliceLen(rt, count); err != nil {
+			return
+		}
+		if err = ds.alloc(int(krt.Size() + vrt.Size())); err != nil {
+			return
+		}
+		krv, vrv := reflect.New(krt).Elem(), reflect.New(vrt).Elem()
+		krv.Set(ds.defaultValue(krt))
+		vrv.Set(ds.defaultValue(vrt))
+		var lastFieldNum uint32
+		for len(entry) > 0 {
+			if err = ds.checkMinimalVarint(entry); err != nil {
+				return
+			}
+			fnum, typ, _n, err = decodeFieldNumberAndTyp3(entry)
+			if slide(&entry, nil, _n) && err != nil {
+				return
+			}
+			if fnum <= lastFieldNum || fnum > 2 {
+				err = fmt.Errorf("unexpected field number %v in map entry", fnum)
+				return
+			}
+			lastFieldNum = fnum
+			var (
+				finfo  = kinfo
+				frv    = krv
+				ffopts = kfopts
+			)
+			if fnum == 2 {
+				finfo, frv, ffopts = vinfo, vrv, vfopts
+			}
+			typWanted := typeToTyp3(finfo.Type, ffopts)
+			if typ != typWanted {
+				err = ds.wireTypeError(fmt.Errorf("expected field type %v for # %v of map entry, got %v",
+					typWanted, fnum, typ), fnum, finfo.Type, typWanted, typ)
+				return
+			}
+			_n, err = cdc.decodeReflectBinary(ds, entry, finfo, frv, ffopts, false)
+			if slide(&entry, nil, _n) && err != nil {
+				return
+			}
+		}
+		if err = fn(krv, vrv); err != nil {
+			return
+		}
+	}
+	return n, nil
+}
+
+// Decodes a slice, and constructs a channel buffering its values.
+// See encodeReflectBinaryChan.
+// CONTRACT: rv.CanAddr() is true.
+// CONTRACT: fopts.DrainChan is true.
+func (cdc *Codec) decodeReflectBinaryChan(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value,
+	fopts FieldOptions, bare bool) (n int, err error) {
+	if !rv.CanAddr() {
+		panic("rv not addressable")
+	}
+	if printLog {
+		fmt.Println("(d) decodeReflectBinaryChan")
+		defer func() {
+			fmt.Printf("(d) -> err: %v\n", err)
+		}()
+	}
+	if !ds.drainChannels {
+		err = errors.New("amino chan support requires Codec.SetDrainChannels(true)")
+		return
+	}
+	srt := reflect.SliceOf(info.Type.Elem())
+	sinfo, err := cdc.getTypeInfoWlock(srt)
+	if err != nil {
+		return
+	}
+	var srv = reflect.New(srt).Elem()
+	n, err = cdc.decodeReflectBinary(ds, bz, sinfo, srv, fopts, bare)
+	if err != nil {
+		return
+	}
+	if srv.Len() == 0 {
+		// NOTE: We prefer nil channels, like nil slices.
+		rv.Set(info.ZeroValue)
+		return
+	}
+	var crv = reflect.MakeChan(info.Type, srv.Len())
+	for i := 0; i < srv.Len(); i++ {
+		crv.Send(srv.Index(i))
+	}
+	rv.Set(crv)
+	return
+}
+
 //----------------------------------------
 // consume* for skipping struct fields
 
@@ -969,7 +2149,7 @@ func decodeFieldNumberAndTyp3(bz []byte) (num uint32, typ Typ3, n int, err error
 
 	// Decode num.
 	num64 := value64 >> 3
-	if num64 > (1<<29 - 1) {
+	if num64 > MaxFieldNumber {
 		err = fmt.Errorf("invalid field num %v", num64)
 		return
 	}
@@ -6,8 +6,13 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/big"
+	"net/url"
 	"reflect"
+	"sort"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/davecgh/go-spew/spew"
 )
@@ -15,6 +20,159 @@ import (
 //----------------------------------------
 // cdc.encodeReflectBinary
 
+// encodeState holds the per-call state of a binary encode.  A fresh one is
+// created for every top-level Marshal* call and passed through all
+// encodeReflect* calls.
+type encodeState struct {
+	encodeOptions
+
+	path     []string              // Names of the struct fields being encoded.
+	visiting map[visitKey]struct{} // The structs, lists and maps being encoded.
+	written  int                   // Bytes written to the output so far.
+
+	strings *stringTable // See Codec.MarshalBinaryBareInterned, nil if not interning.
+
+	omit func(fieldPath string, v interface{}) bool // See Codec.MarshalBinaryBareWith.
+}
+
+// The strings of a message encoded by Codec.MarshalBinaryBareInterned, in
+// order of first use.
+type stringTable struct {
+	index map[string]uint64
+	list  []string
+}
+
+func newStringTable() *stringTable {
+	return &stringTable{index: make(map[string]uint64)}
+}
+
+// Returns the index of str, adding it to the table if needed.
+func (st *stringTable) intern(str string) uint64 {
+	idx, ok := st.index[str]
+	if !ok {
+		idx = uint64(len(st.list))
+		st.index[str] = idx
+		st.list = append(st.list, str)
+	}
+	return idx
+}
+
+// Identifies a struct (by address), or a list or map (by data pointer).
+type visitKey struct {
+	ptr uintptr
+	len int
+	rt  reflect.Type
+}
+
+func (cdc *Codec) newEncodeState() *encodeState {
+	return &encodeState{encodeOptions: cdc.encodeOptions()}
+}
+
+// Returns the value to encode for the field of the struct of info with value
+// frv, as returned by the field hook.  See Codec.SetFieldEncodeHook.
+func (es *encodeState) callFieldHook(info *TypeInfo, field FieldInfo, frv reflect.Value) (reflect.Value, error) {
+	var typeName = info.Name
+	if !info.Registered {
+		typeName = info.Type.String()
+	}
+	v := es.fieldHook(typeName, field.Name, frv.Interface())
+	if v == nil {
+		return reflect.Zero(field.Type), nil
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.Type().AssignableTo(field.Type) {
+		return rv, fmt.Errorf("field hook returned %v for field %v of type %v", rv.Type(), field.Name, field.Type)
+	}
+	hrv := reflect.New(field.Type).Elem()
+	hrv.Set(rv)
+	return hrv, nil
+}
+
+func (es *encodeState) pushField(name string) {
+	es.path = append(es.path, name)
+}
+
+func (es *encodeState) popField() {
+	es.path = es.path[:len(es.path)-1]
+}
+
+// Returns an error if an encoding of n bytes exceeds the max encode size.
+// Since everything ends up in the output, this can be checked as buffers
+// grow, before the output is written.
+func (es *encodeState) checkSize(n int) error {
+	if es.maxSize > 0 && n > es.maxSize {
+		return fmt.Errorf("encoding exceeds max size of %v bytes at field path %v", es.maxSize, es.fieldPath())
+	}
+	return nil
+}
+
+// Returns the dot-separated path of the field being encoded, or "<root>".
+func (es *encodeState) fieldPath() string {
+	path := strings.Join(es.path, ".")
+	if path == "" {
+		path = "<root>"
+	}
+	return path
+}
+
+// Wraps the output of an encoding, to check its total size.
+type maxSizeWriter struct {
+	w  io.Writer
+	es *encodeState
+}
+
+func (msw maxSizeWriter) Write(p []byte) (int, error) {
+	msw.es.written += len(p)
+	if err := msw.es.checkSize(msw.es.written); err != nil {
+		return 0, err
+	}
+	return msw.w.Write(p)
+}
+
+// Counts the bytes of an encoding, without keeping them.
+type countingWriter struct {
+	n int
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.n += len(p)
+	return len(p), nil
+}
+
+// Marks rv as being encoded, and returns the function to call once it's
+// done, or an error if rv is already being encoded, i.e. if it contains
+// itself, in which case encoding would never end.  Only addressable structs
+// (e.g. pointed to), and non-empty lists and maps, can be part of a cycle.
+func (es *encodeState) enter(rv reflect.Value) (exit func(), err error) {
+	var key visitKey
+	switch rv.Kind() {
+	case reflect.Struct:
+		if !rv.CanAddr() {
+			return func() {}, nil
+		}
+		key = visitKey{rv.UnsafeAddr(), 0, rv.Type()}
+	case reflect.Slice, reflect.Map:
+		if rv.Len() == 0 {
+			return func() {}, nil
+		}
+		key = visitKey{rv.Pointer(), rv.Len(), rv.Type()}
+	default:
+		return func() {}, nil
+	}
+	if _, ok := es.visiting[key]; ok {
+		path := strings.Join(es.path, ".")
+		if path == "" {
+			path = "<root>"
+		}
+		return nil, fmt.Errorf("cyclic reference detected at field path %v (%v)", path, rv.Type())
+	}
+	if es.visiting == nil {
+		es.visiting = make(map[visitKey]struct{})
+	}
+	es.visiting[key] = struct{}{}
+	return func() { delete(es.visiting, key) }, nil
+}
+
 // This is the main entrypoint for encoding all types in binary form.  This
 // function calls encodeReflectBinary*, and generally those functions should
 // only call this one, for the prefix bytes are only written here.
@@ -22,7 +180,7 @@ import (
 // The following contracts apply to all similar encode methods.
 // CONTRACT: rv is not a pointer
 // CONTRACT: rv is valid.
-func (cdc *Codec) encodeReflectBinary(w io.Writer, info *TypeInfo, rv reflect.Value,
+func (cdc *Codec) encodeReflectBinary(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
 	fopts FieldOptions, bare bool) (err error) {
 	if rv.Kind() == reflect.Ptr {
 		panic("not allowed to be called with a reflect.Ptr")
@@ -38,6 +196,10 @@ func (cdc *Codec) encodeReflectBinary(w io.Writer, info *TypeInfo, rv reflect.Va
 		}()
 	}
 
+	if info.Deprecated {
+		cdc.warnDeprecated(info)
+	}
+
 	// Handle override if rv implements json.Marshaler.
 	if info.IsAminoMarshaler {
 		// First, encode rv into repr instance.
@@ -52,7 +214,7 @@ func (cdc *Codec) encodeReflectBinary(w io.Writer, info *TypeInfo, rv reflect.Va
 			return
 		}
 		// Then, encode the repr instance.
-		err = cdc.encodeReflectBinary(w, rinfo, rrv, fopts, bare)
+		err = cdc.encodeReflectBinary(es, w, rinfo, rrv, fopts, bare)
 		return
 	}
 
@@ -62,71 +224,81 @@ func (cdc *Codec) encodeReflectBinary(w io.Writer, info *TypeInfo, rv reflect.Va
 	// Complex
 
 	case reflect.Interface:
-		err = cdc.encodeReflectBinaryInterface(w, info, rv, fopts, bare)
+		if info.Type == ioReaderType {
+			// Special case: io.Reader, encoded like a byte slice.
+			var bz []byte
+			bz, err = readerBytes(rv)
+			if err != nil {
+				return
+			}
+			err = EncodeByteSlice(w, bz)
+			return
+		}
+		err = cdc.encodeReflectBinaryInterface(es, w, info, rv, fopts, bare)
 
 	case reflect.Array:
 		if info.Type.Elem().Kind() == reflect.Uint8 {
-			err = cdc.encodeReflectBinaryByteArray(w, info, rv, fopts)
+			err = cdc.encodeReflectBinaryByteArray(es, w, info, rv, fopts)
 		} else if kind := info.Type.Elem().Kind(); kind == reflect.Slice || kind == reflect.Array {
 			// for proto3 compatibility, we do not allow multidimensional arrays,
 			// unless the elements involved are bytes (e.g. [][]byte)
-			if info.Type.Elem().Elem().Kind() != reflect.Uint8 { // byte is an alias for uint8
-				elem := info.Type.Elem()
-				for {
-					if elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array {
-						elem = elem.Elem()
-						continue
-					}
-					if elem.Kind() == reflect.Uint8 { // byte is an alias for uint8
-						break
-					}
-					err = errors.New("multidimensional arrays not allowed")
-					break
-				}
+			if isMultidimensionalNonBytes(info.Type) {
+				err = errors.New("multidimensional arrays not allowed")
+			} else {
+				err = cdc.encodeReflectBinaryList(es, w, info, rv, fopts, bare)
 			}
 		} else {
-			err = cdc.encodeReflectBinaryList(w, info, rv, fopts, bare)
+			err = cdc.encodeReflectBinaryList(es, w, info, rv, fopts, bare)
 		}
 
 	case reflect.Slice:
 		switch info.Type.Elem().Kind() {
 
 		case reflect.Uint8:
-			err = cdc.encodeReflectBinaryByteSlice(w, info, rv, fopts)
+			err = cdc.encodeReflectBinaryByteSlice(es, w, info, rv, fopts)
 		case reflect.Slice, reflect.Array:
 			// for proto3 compatibility, we do not allow multidimensional slices,
 			// unless the elements involved are bytes (e.g. [][]byte)
-			elem := info.Type.Elem()
-			for {
-				if elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array {
-					elem = elem.Elem()
-					continue
-				}
-				if elem.Kind() == reflect.Uint8 { // byte is an alias for uint8
-					break
-				}
+			if isMultidimensionalNonBytes(info.Type) {
 				err = errors.New("multidimensional slices not allowed")
-				break
+			} else {
+				err = cdc.encodeReflectBinaryList(es, w, info, rv, fopts, bare)
 			}
 		default:
-			err = cdc.encodeReflectBinaryList(w, info, rv, fopts, bare)
+			err = cdc.encodeReflectBinaryList(es, w, info, rv, fopts, bare)
 		}
 
 	case reflect.Struct:
-		err = cdc.encodeReflectBinaryStruct(w, info, rv, fopts, bare)
+		err = cdc.encodeReflectBinaryStruct(es, w, info, rv, fopts, bare)
+
+	case reflect.Map:
+		if !es.allowMaps {
+			panic(fmt.Sprintf("unsupported type %v (see Codec.SetAllowMaps)", info.Type.Kind()))
+		}
+		err = cdc.encodeReflectBinaryMap(es, w, info, rv, fopts, bare)
+
+	case reflect.Chan:
+		if !fopts.DrainChan {
+			panic(fmt.Sprintf("unsupported type %v", info.Type.Kind()))
+		}
+		err = cdc.encodeReflectBinaryChan(es, w, info, rv, fopts, bare)
 
 	//----------------------------------------
 	// Signed
 
 	case reflect.Int64:
-		if fopts.BinFixed64 {
+		if fopts.BinFixed64 && fopts.BinBigEndian {
+			err = encodeFixedBigEndian(w, uint64(rv.Int()), 8)
+		} else if fopts.BinFixed64 {
 			err = EncodeInt64(w, rv.Int())
 		} else {
 			err = EncodeUvarint(w, uint64(rv.Int()))
 		}
 
 	case reflect.Int32:
-		if fopts.BinFixed32 {
+		if fopts.BinFixed32 && fopts.BinBigEndian {
+			err = encodeFixedBigEndian(w, uint64(rv.Int()), 4)
+		} else if fopts.BinFixed32 {
 			err = EncodeInt32(w, int32(rv.Int()))
 		} else {
 			err = EncodeUvarint(w, uint64(rv.Int()))
@@ -145,14 +317,18 @@ func (cdc *Codec) encodeReflectBinary(w io.Writer, info *TypeInfo, rv reflect.Va
 	// Unsigned
 
 	case reflect.Uint64:
-		if fopts.BinFixed64 {
+		if fopts.BinFixed64 && fopts.BinBigEndian {
+			err = encodeFixedBigEndian(w, rv.Uint(), 8)
+		} else if fopts.BinFixed64 {
 			err = EncodeUint64(w, rv.Uint())
 		} else {
 			err = EncodeUvarint(w, rv.Uint())
 		}
 
 	case reflect.Uint32:
-		if fopts.BinFixed32 {
+		if fopts.BinFixed32 && fopts.BinBigEndian {
+			err = encodeFixedBigEndian(w, rv.Uint(), 4)
+		} else if fopts.BinFixed32 {
 			err = EncodeUint32(w, uint32(rv.Uint()))
 		} else {
 			err = EncodeUvarint(w, rv.Uint())
@@ -188,7 +364,32 @@ func (cdc *Codec) encodeReflectBinary(w io.Writer, info *TypeInfo, rv reflect.Va
 		err = EncodeFloat32(w, float32(rv.Float()))
 
 	case reflect.String:
-		err = EncodeString(w, rv.String())
+		str := rv.String()
+		if es.validateUTF8 && !utf8.ValidString(str) {
+			err = fmt.Errorf("invalid UTF-8 in string at field path %v", es.fieldPath())
+			return
+		}
+		if es.normalize != nil {
+			str = es.normalize(str)
+		}
+		if es.strings != nil {
+			// Length-prefixed, so that it's still skippable like a string.
+			var ibz [binary.MaxVarintLen64]byte
+			n := binary.PutUvarint(ibz[:], es.strings.intern(str))
+			err = EncodeByteSlice(w, ibz[:n])
+			return
+		}
+		err = EncodeString(w, str)
+
+	case reflect.Complex64, reflect.Complex128:
+		if err = checkComplex(fopts, es.allowComplex); err != nil {
+			return
+		}
+		var rinfo *TypeInfo
+		if rinfo, err = cdc.getComplexReprInfo(info.Type); err != nil {
+			return
+		}
+		err = cdc.encodeReflectBinary(es, w, rinfo, toComplexRepr(rv), fopts, bare)
 
 	//----------------------------------------
 	// Default
@@ -200,7 +401,32 @@ func (cdc *Codec) encodeReflectBinary(w io.Writer, info *TypeInfo, rv reflect.Va
 	return err
 }
 
-func (cdc *Codec) encodeReflectBinaryInterface(w io.Writer, iinfo *TypeInfo, rv reflect.Value,
+// Writes the disambiguation bytes (if needed), the prefix bytes and the
+// version (if any) of the concrete type cinfo of an interface value.
+func writeDisambPrefixBytes(buf *bytes.Buffer, iinfo, cinfo *TypeInfo) error {
+	// Write disambiguation bytes if needed.
+	needDisamb := false
+	if iinfo.AlwaysDisambiguate {
+		needDisamb = true
+	} else if len(iinfo.Implementers[cinfo.Prefix]) > 1 {
+		needDisamb = true
+	}
+	if cinfo.ConcreteOptions.NoDisamb {
+		needDisamb = false
+	}
+	if needDisamb {
+		buf.Write(append([]byte{0x00}, cinfo.Disamb[:]...)) // nolint: errcheck
+	}
+
+	// Write prefix bytes.
+	buf.Write(cinfo.Prefix.Bytes()) // nolint: errcheck
+	if cinfo.Version > 0 {
+		return EncodeUvarint(buf, uint64(cinfo.Version))
+	}
+	return nil
+}
+
+func (cdc *Codec) encodeReflectBinaryInterface(es *encodeState, w io.Writer, iinfo *TypeInfo, rv reflect.Value,
 	fopts FieldOptions, bare bool) (err error) {
 	if printLog {
 		fmt.Println("(e) encodeReflectBinaryInterface")
@@ -234,35 +460,66 @@ func (cdc *Codec) encodeReflectBinaryInterface(w io.Writer, iinfo *TypeInfo, rv
 		return
 	}
 	if !cinfo.Registered {
-		err = fmt.Errorf("cannot encode unregistered concrete type %v", crt)
-		return
+		cinfo, err = cdc.getRegisteredTypeInfoForEncode(crt)
+		if err != nil {
+			return
+		}
+	}
+
+	if len(iinfo.OneofVariants) > 0 {
+		return cdc.encodeReflectBinaryOneof(es, w, iinfo, cinfo, crv, fopts, bare)
 	}
 
 	// For Proto3 compatibility, encode interfaces as ByteLength.
 	buf := bytes.NewBuffer(nil)
 
-	// Write disambiguation bytes if needed.
-	needDisamb := false
-	if iinfo.AlwaysDisambiguate {
-		needDisamb = true
-	} else if len(iinfo.Implementers[cinfo.Prefix]) > 1 {
-		needDisamb = true
-	}
-	if needDisamb {
-		_, err = buf.Write(append([]byte{0x00}, cinfo.Disamb[:]...))
-		if err != nil {
+	if es.compactIDs {
+		// Write the compact ID instead, see EnableCompactInterfaceIDs.
+		if cinfo.CompactID == 0 {
+			err = fmt.Errorf("no compact ID registered for %v", cinfo.Type)
 			return
 		}
+		if err = EncodeUvarint(buf, cinfo.CompactID); err != nil {
+			return
+		}
+	} else if err = writeDisambPrefixBytes(buf, iinfo, cinfo); err != nil {
+		return
 	}
 
-	// Write prefix bytes.
-	_, err = buf.Write(cinfo.Prefix.Bytes())
+	// Write actual concrete value.
+	err = cdc.encodeReflectBinary(es, buf, cinfo, crv, fopts, true)
 	if err != nil {
 		return
 	}
 
-	// Write actual concrete value.
-	err = cdc.encodeReflectBinary(buf, cinfo, crv, fopts, true)
+	if bare {
+		// Write byteslice without byte-length prefixing.
+		_, err = w.Write(buf.Bytes())
+	} else {
+		// Write byte-length prefixed byteslice.
+		err = EncodeByteSlice(w, buf.Bytes())
+	}
+	return err
+}
+
+// Interfaces registered with RegisterOneof are encoded as a message with just
+// the field of the concrete type's variant, rather than with prefix bytes.
+func (cdc *Codec) encodeReflectBinaryOneof(es *encodeState, w io.Writer, iinfo *TypeInfo, cinfo *TypeInfo, crv reflect.Value,
+	fopts FieldOptions, bare bool) (err error) {
+	fnum := oneofFieldNum(iinfo, cinfo)
+	if fnum == 0 {
+		return fmt.Errorf("%v is not a oneof variant of %v", cinfo.Type, iinfo.Type)
+	}
+	cfopts := fopts
+	cfopts.BinFieldNum = fnum
+
+	// Write the field even if empty, for it determines the concrete type.
+	buf := bytes.NewBuffer(nil)
+	err = encodeFieldNumberAndTyp3(buf, fnum, typeToTyp3(cinfo.Type, cfopts))
+	if err != nil {
+		return
+	}
+	err = cdc.encodeReflectBinary(es, buf, cinfo, crv, cfopts, false)
 	if err != nil {
 		return
 	}
@@ -277,7 +534,7 @@ func (cdc *Codec) encodeReflectBinaryInterface(w io.Writer, iinfo *TypeInfo, rv
 	return err
 }
 
-func (cdc *Codec) encodeReflectBinaryByteArray(w io.Writer, info *TypeInfo, rv reflect.Value,
+func (cdc *Codec) encodeReflectBinaryByteArray(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
 	fopts FieldOptions) (err error) {
 	ert := info.Type.Elem()
 	if ert.Kind() != reflect.Uint8 {
@@ -299,7 +556,7 @@ func (cdc *Codec) encodeReflectBinaryByteArray(w io.Writer, info *TypeInfo, rv r
 	return
 }
 
-func (cdc *Codec) encodeReflectBinaryList(w io.Writer, info *TypeInfo, rv reflect.Value,
+func (cdc *Codec) encodeReflectBinaryList(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
 	fopts FieldOptions, bare bool) (err error) {
 	if printLog {
 		fmt.Println("(e) encodeReflectBinaryList")
@@ -307,6 +564,42 @@ func (cdc *Codec) encodeReflectBinaryList(w io.Writer, info *TypeInfo, rv reflec
 			fmt.Printf("(e) -> err: %v\n", err)
 		}()
 	}
+
+	// Fail rather than recurse forever if rv contains itself.
+	exit, err := es.enter(rv)
+	if err != nil {
+		return
+	}
+	defer exit()
+
+	bz, ends, err := cdc.encodeReflectBinaryListElements(es, info, rv, fopts)
+	if err != nil {
+		return
+	}
+	// Write the elements in order of their encodings, for `amino:"sorted"`.
+	if fopts.BinSorted {
+		sorted := make([]byte, 0, len(bz))
+		for _, i := range listEncodingOrder(bz, ends) {
+			sorted = append(sorted, bz[listElementStart(ends, i):ends[i]]...)
+		}
+		bz = sorted
+	}
+
+	if bare {
+		// Write byteslice without byte-length prefixing.
+		_, err = w.Write(bz)
+	} else {
+		// Write byte-length prefixed byteslice.
+		err = EncodeByteSlice(w, bz)
+	}
+	return err
+}
+
+// Returns the encoded elements of the list rv, as written by
+// encodeReflectBinaryList, where the encoding of element i (including its
+// field key if unpacked) ends at ends[i].
+func (cdc *Codec) encodeReflectBinaryListElements(es *encodeState, info *TypeInfo, rv reflect.Value,
+	fopts FieldOptions) (bz []byte, ends []int, err error) {
 	ert := info.Type.Elem()
 	if ert.Kind() == reflect.Uint8 {
 		panic("should not happen")
@@ -315,6 +608,7 @@ func (cdc *Codec) encodeReflectBinaryList(w io.Writer, info *TypeInfo, rv reflec
 	if err != nil {
 		return
 	}
+	ends = make([]int, 0, rv.Len())
 
 	// Proto3 byte-length prefixing incurs alloc cost on the encoder.
 	// Here we incur it for unpacked form for ease of dev.
@@ -324,16 +618,39 @@ func (cdc *Codec) encodeReflectBinaryList(w io.Writer, info *TypeInfo, rv reflec
 	// This is a Proto wart due to Proto backwards compatibility issues.
 	// Amino2 will probably migrate to use the List typ3.  Please?  :)
 	typ3 := typeToTyp3(einfo.Type, fopts)
-	if typ3 != Typ3ByteLength {
+	if typ3 != Typ3ByteLength && !fopts.BinUnpacked {
 		// Write elems in packed form.
 		for i := 0; i < rv.Len(); i++ {
 			// Get dereferenced element value (or zero).
 			var erv, _, _ = derefPointersZero(rv.Index(i))
 			// Write the element value.
-			err = cdc.encodeReflectBinary(buf, einfo, erv, fopts, false)
+			err = cdc.encodeReflectBinary(es, buf, einfo, erv, fopts, false)
 			if err != nil {
 				return
 			}
+			ends = append(ends, buf.Len())
+			if err = es.checkSize(buf.Len()); err != nil {
+				return
+			}
+		}
+	} else if typ3 != Typ3ByteLength {
+		// Write elems in unpacked form, for `amino:"unpacked"`.
+		for i := 0; i < rv.Len(); i++ {
+			// Write each element (even zero) as a repeated field of the
+			// parent struct.
+			err = encodeFieldNumberAndTyp3(buf, fopts.BinFieldNum, typ3)
+			if err != nil {
+				return
+			}
+			var erv, _, _ = derefPointersZero(rv.Index(i))
+			err = cdc.encodeReflectBinary(es, buf, einfo, erv, fopts, false)
+			if err != nil {
+				return
+			}
+			ends = append(ends, buf.Len())
+			if err = es.checkSize(buf.Len()); err != nil {
+				return
+			}
 		}
 	} else { // typ3 == Typ3ByteLength
 		// NOTE: ert is for the element value, while einfo.Type is dereferenced.
@@ -358,7 +675,8 @@ func (cdc *Codec) encodeReflectBinaryList(w io.Writer, info *TypeInfo, rv reflec
 					// Proto3's Golang client does.
 					// This also makes it easier to upgrade to Amino2
 					// which would enable the encoding of nil structs.
-					return errors.New("nil struct pointers not supported when empty_elements field tag is set")
+					err = errors.New("nil struct pointers not supported when empty_elements field tag is set")
+					return
 				}
 				// Nothing to encode, so the length is 0.
 				err = EncodeByte(buf, byte(0x00))
@@ -370,26 +688,74 @@ func (cdc *Codec) encodeReflectBinaryList(w io.Writer, info *TypeInfo, rv reflec
 				// In case of any inner lists in unpacked form.
 				efopts := fopts
 				efopts.BinFieldNum = 1
-				err = cdc.encodeReflectBinary(buf, einfo, erv, efopts, false)
+				err = cdc.encodeReflectBinary(es, buf, einfo, erv, efopts, false)
 				if err != nil {
 					return
 				}
 			}
+			ends = append(ends, buf.Len())
+			if err = es.checkSize(buf.Len()); err != nil {
+				return
+			}
 		}
 	}
 
-	if bare {
-		// Write byteslice without byte-length prefixing.
-		_, err = w.Write(buf.Bytes())
-	} else {
-		// Write byte-length prefixed byteslice.
-		err = EncodeByteSlice(w, buf.Bytes())
+	return buf.Bytes(), ends, nil
+}
+
+// Returns the indices of the list elements encoded in bz, where the encoding
+// of element i ends at ends[i], in order of their encodings.
+func listEncodingOrder(bz []byte, ends []int) []int {
+	order := make([]int, len(ends))
+	for i := range order {
+		order[i] = i
 	}
-	return err
+	sort.SliceStable(order, func(a, b int) bool {
+		i, j := order[a], order[b]
+		return bytes.Compare(bz[listElementStart(ends, i):ends[i]], bz[listElementStart(ends, j):ends[j]]) < 0
+	})
+	return order
+}
+
+// Returns where the encoding of list element i starts, see listEncodingOrder.
+func listElementStart(ends []int, i int) int {
+	if i == 0 {
+		return 0
+	}
+	return ends[i-1]
+}
+
+// Sorts the elements of the list rv (a slice or an array) in place, in order
+// of their encodings, for decoding fields tagged `amino:"sorted"` with
+// Codec.SetSortDecodedLists.  The elements are encoded with the options of
+// ds that apply to encoding.
+func (cdc *Codec) sortListByEncoding(ds *decodeState, info *TypeInfo, rv reflect.Value, fopts FieldOptions) error {
+	es := &encodeState{encodeOptions: encodeOptions{
+		emptyStringPtrs: ds.emptyStringPtrs,
+		timeEpoch:       ds.timeEpoch,
+		compactIDs:      ds.compactIDs,
+		allowMaps:       ds.allowMaps,
+		allowComplex:    ds.allowComplex,
+		drainChannels:   ds.drainChannels,
+	}}
+	bz, ends, err := cdc.encodeReflectBinaryListElements(es, info, rv, fopts)
+	if err != nil {
+		return err
+	}
+	order := listEncodingOrder(bz, ends)
+	elems := make([]reflect.Value, len(order))
+	for i, j := range order {
+		elems[i] = reflect.New(info.Type.Elem()).Elem()
+		elems[i].Set(rv.Index(j))
+	}
+	for i, erv := range elems {
+		rv.Index(i).Set(erv)
+	}
+	return nil
 }
 
 // CONTRACT: info.Type.Elem().Kind() == reflect.Uint8
-func (cdc *Codec) encodeReflectBinaryByteSlice(w io.Writer, info *TypeInfo, rv reflect.Value,
+func (cdc *Codec) encodeReflectBinaryByteSlice(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
 	fopts FieldOptions) (err error) {
 	if printLog {
 		fmt.Println("(e) encodeReflectBinaryByteSlice")
@@ -404,11 +770,14 @@ func (cdc *Codec) encodeReflectBinaryByteSlice(w io.Writer, info *TypeInfo, rv r
 
 	// Write byte-length prefixed byte-slice.
 	var byteslice = rv.Bytes()
+	if err = es.checkSize(len(byteslice)); err != nil {
+		return
+	}
 	err = EncodeByteSlice(w, byteslice)
 	return
 }
 
-func (cdc *Codec) encodeReflectBinaryStruct(w io.Writer, info *TypeInfo, rv reflect.Value,
+func (cdc *Codec) encodeReflectBinaryStruct(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
 	fopts FieldOptions, bare bool) (err error) {
 	if printLog {
 		fmt.Println("(e) encodeReflectBinaryBinaryStruct")
@@ -417,6 +786,17 @@ func (cdc *Codec) encodeReflectBinaryStruct(w io.Writer, info *TypeInfo, rv refl
 		}()
 	}
 
+	// Fail rather than recurse forever if rv contains itself.
+	exit, err := es.enter(rv)
+	if err != nil {
+		return
+	}
+	defer exit()
+
+	if info.fixedWidth && es.fieldHook == nil && es.omit == nil {
+		return cdc.encodeReflectBinaryFixedStruct(es, w, info, rv, bare)
+	}
+
 	// Proto3 incurs a cost in writing non-root structs.
 	// Here we incur it for root structs as well for ease of dev.
 	buf := bytes.NewBuffer(nil)
@@ -425,7 +805,47 @@ func (cdc *Codec) encodeReflectBinaryStruct(w io.Writer, info *TypeInfo, rv refl
 
 	case timeType:
 		// Special case: time.Time
-		err = EncodeTime(buf, rv.Interface().(time.Time))
+		err = encodeTimeSince(buf, rv.Interface().(time.Time), es.timeEpoch)
+		if err != nil {
+			return
+		}
+
+	case bigFloatType:
+		// Special case: big.Float, encoded like a string.
+		_, err = buf.WriteString(bigFloatText(rv))
+		if err != nil {
+			return
+		}
+
+	case urlType:
+		// Special case: url.URL, encoded like a string.
+		_, err = buf.WriteString(urlText(rv))
+		if err != nil {
+			return
+		}
+
+	case netipAddrType:
+		// Special case: netip.Addr, encoded like a byte slice.
+		var bz []byte
+		bz, err = netipAddrBytes(rv)
+		if err != nil {
+			return
+		}
+		_, err = buf.Write(bz)
+		if err != nil {
+			return
+		}
+
+	case netipPrefixType:
+		// Special case: netip.Prefix, encoded like a string.
+		_, err = buf.WriteString(netipText(rv))
+		if err != nil {
+			return
+		}
+
+	case bufferType:
+		// Special case: bytes.Buffer, encoded like a byte slice.
+		_, err = buf.Write(bufferBytes(rv))
 		if err != nil {
 			return
 		}
@@ -440,28 +860,246 @@ func (cdc *Codec) encodeReflectBinaryStruct(w io.Writer, info *TypeInfo, rv refl
 			}
 			// Get dereferenced field value and info.
 			var frv = rv.Field(field.Index)
+			if es.fieldHook != nil {
+				frv, err = es.callFieldHook(info, field, frv)
+				if err != nil {
+					return
+				}
+			}
 			var frvIsPtr = frv.Kind() == reflect.Ptr
 			var dfrv, isDefault = isDefaultValue(frv)
+			if isDefault && es.emptyStringPtrs && frvIsPtr && !frv.IsNil() && dfrv.Kind() == reflect.String {
+				// Write the empty string, to decode as a non-nil pointer.
+				isDefault = false
+			}
 			if isDefault && !field.WriteEmpty {
 				// Do not encode default value fields
 				// (except when `amino:"write_empty"` is set).
 				continue
 			}
+			es.pushField(field.Name)
+			if es.omit != nil && es.omit(es.fieldPath(), frv.Interface()) {
+				es.popField()
+				continue
+			}
 			if field.UnpackedList {
-				// Write repeated field entries for each list item.
-				err = cdc.encodeReflectBinaryList(buf, finfo, dfrv, field.FieldOptions, true)
-				if err != nil {
-					return
+				// Write repeated field entries for each list item (or map entry).
+				switch finfo.Type.Kind() {
+				case reflect.Map:
+					err = cdc.encodeReflectBinaryMap(es, buf, finfo, dfrv, field.FieldOptions, true)
+				case reflect.Chan:
+					err = cdc.encodeReflectBinaryChan(es, buf, finfo, dfrv, field.FieldOptions, true)
+				default:
+					err = cdc.encodeReflectBinaryList(es, buf, finfo, dfrv, field.FieldOptions, true)
 				}
 			} else {
 				// write empty if explicitly set or if this is a pointer:
 				writeEmpty := field.WriteEmpty || frvIsPtr
-				err = cdc.writeFieldIfNotEmpty(buf, field.BinFieldNum, finfo, fopts, field.FieldOptions, dfrv, writeEmpty, false)
-				if err != nil {
-					return
+				err = cdc.writeFieldIfNotEmpty(es, buf, field.BinFieldNum, finfo, fopts, field.FieldOptions, dfrv, writeEmpty, false)
+			}
+			es.popField()
+			if err != nil {
+				return
+			}
+			if err = es.checkSize(buf.Len()); err != nil {
+				return
+			}
+		}
+	}
+
+	if bare {
+		// Write byteslice without byte-length prefixing.
+		_, err = w.Write(buf.Bytes())
+	} else {
+		// Write byte-length prefixed byteslice.
+		err = EncodeByteSlice(w, buf.Bytes())
+	}
+	return err
+}
+
+// Returns the shortest decimal text that identifies the big.Float rv.
+func bigFloatText(rv reflect.Value) string {
+	if rv.CanAddr() {
+		return rv.Addr().Interface().(*big.Float).Text('g', -1)
+	}
+	f := rv.Interface().(big.Float)
+	return f.Text('g', -1)
+}
+
+// Returns the string form of the url.URL rv.
+func urlText(rv reflect.Value) string {
+	if rv.CanAddr() {
+		return rv.Addr().Interface().(*url.URL).String()
+	}
+	u := rv.Interface().(url.URL)
+	return u.String()
+}
+
+// Encodes t like EncodeTime, but as the seconds and nanoseconds since epoch
+// (which may be negative), or since the Unix epoch if epoch is zero.
+// See Codec.SetTimeEpoch.
+func encodeTimeSince(w io.Writer, t time.Time, epoch time.Time) error {
+	if epoch.IsZero() {
+		return EncodeTime(w, t)
+	}
+	if s := t.Unix(); s < minSeconds || s >= maxSeconds {
+		return InvalidTimeErr(fmt.Sprintf("seconds have to be >= %d and < %d, got: %d",
+			minSeconds, maxSeconds, s))
+	}
+	return EncodeTime(w, time.Unix(t.Unix()-epoch.Unix(), int64(t.Nanosecond()-epoch.Nanosecond())))
+}
+
+// Writes the low size (4 or 8) bytes of u in big-endian order, for fields
+// tagged with `amino:"bigendian"`.
+func encodeFixedBigEndian(w io.Writer, u uint64, size int) (err error) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], u)
+	_, err = w.Write(buf[8-size:])
+	return
+}
+
+// Fast path for structs whose fields are all integers or bools, e.g. with
+// `binary:"fixed64"`.  The output is the same as encodeReflectBinaryStruct's,
+// but field keys are precomputed, and no field TypeInfo is looked up.
+// CONTRACT: info.fixedWidth is true.
+func (cdc *Codec) encodeReflectBinaryFixedStruct(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
+	bare bool) (err error) {
+	if printLog {
+		fmt.Println("(e) encodeReflectBinaryFixedStruct")
+		defer func() {
+			fmt.Printf("(e) -> err: %v\n", err)
+		}()
+	}
+
+	// At most 5 bytes for the key and 10 for the value per field.
+	bz := make([]byte, 0, len(info.Fields)*15)
+	var tmp [10]byte
+	for i, field := range info.Fields {
+		var frv = rv.Field(field.Index)
+		var u64 uint64
+		var isZero bool
+		switch frv.Kind() {
+		case reflect.Bool:
+			isZero = !frv.Bool()
+			if !isZero {
+				u64 = 1
+			}
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			u64 = uint64(frv.Int())
+			isZero = u64 == 0
+		default:
+			u64 = frv.Uint()
+			isZero = u64 == 0
+		}
+		if isZero && !field.WriteEmpty {
+			// Do not encode default value fields
+			// (except when `amino:"write_empty"` is set).
+			continue
+		}
+		bz = append(bz, info.fieldKeys[i]...)
+		switch frv.Kind() {
+		case reflect.Int64, reflect.Uint64:
+			if field.BinFixed64 {
+				if field.BinBigEndian {
+					binary.BigEndian.PutUint64(tmp[:8], u64)
+				} else {
+					binary.LittleEndian.PutUint64(tmp[:8], u64)
+				}
+				bz = append(bz, tmp[:8]...)
+				continue
+			}
+		case reflect.Int32, reflect.Uint32:
+			if field.BinFixed32 {
+				if field.BinBigEndian {
+					binary.BigEndian.PutUint32(tmp[:4], uint32(u64))
+				} else {
+					binary.LittleEndian.PutUint32(tmp[:4], uint32(u64))
 				}
+				bz = append(bz, tmp[:4]...)
+				continue
+			}
+		case reflect.Int16, reflect.Int8:
+			// See EncodeInt16 and EncodeInt8.
+			n := binary.PutVarint(tmp[:], frv.Int())
+			bz = append(bz, tmp[:n]...)
+			continue
+		}
+		n := binary.PutUvarint(tmp[:], u64)
+		bz = append(bz, tmp[:n]...)
+	}
+
+	if bare {
+		// Write byteslice without byte-length prefixing.
+		_, err = w.Write(bz)
+	} else {
+		// Write byte-length prefixed byteslice.
+		err = EncodeByteSlice(w, bz)
+	}
+	return err
+}
+
+// Maps are encoded like a list of key/value structs (as in Proto3), where the
+// key is field 1 and the value is field 2.  Entries are sorted by key.
+func (cdc *Codec) encodeReflectBinaryMap(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
+	fopts FieldOptions, bare bool) (err error) {
+	if printLog {
+		fmt.Println("(e) encodeReflectBinaryMap")
+		defer func() {
+			fmt.Printf("(e) -> err: %v\n", err)
+		}()
+	}
+
+	// Fail rather than recurse forever if rv contains itself.
+	exit, err := es.enter(rv)
+	if err != nil {
+		return
+	}
+	defer exit()
+	krt, vrt := info.Type.Key(), info.Type.Elem()
+	if !isMapKeyKind(krt.Kind()) {
+		return fmt.Errorf("unsupported map key type %v, must be a string or integer", krt)
+	}
+	kinfo, err := cdc.getTypeInfoWlock(krt)
+	if err != nil {
+		return
+	}
+	vinfo, err := cdc.getTypeInfoWlock(vrt)
+	if err != nil {
+		return
+	}
+	kfopts := FieldOptions{BinFieldNum: 1}
+	vfopts := fopts
+	vfopts.BinFieldNum = 2
+
+	buf := bytes.NewBuffer(nil)
+	ebuf := bytes.NewBuffer(nil)
+	for _, krv := range sortedMapKeys(rv) {
+		// Write each entry as a repeated field of the parent struct.
+		err = encodeFieldNumberAndTyp3(buf, fopts.BinFieldNum, Typ3ByteLength)
+		if err != nil {
+			return
+		}
+		ebuf.Reset()
+		err = cdc.writeFieldIfNotEmpty(es, ebuf, 1, kinfo, fopts, kfopts, krv, false, false)
+		if err != nil {
+			return
+		}
+		var vrv, isDefault = isDefaultValue(rv.MapIndex(krv))
+		if !isDefault {
+			// Like struct fields, pointers are written even if empty.
+			writeEmpty := vrt.Kind() == reflect.Ptr
+			err = cdc.writeFieldIfNotEmpty(es, ebuf, 2, vinfo, fopts, vfopts, vrv, writeEmpty, false)
+			if err != nil {
+				return
 			}
 		}
+		err = EncodeByteSlice(buf, ebuf.Bytes())
+		if err != nil {
+			return
+		}
+		if err = es.checkSize(buf.Len()); err != nil {
+			return
+		}
 	}
 
 	if bare {
@@ -474,15 +1112,83 @@ func (cdc *Codec) encodeReflectBinaryStruct(w io.Writer, info *TypeInfo, rv refl
 	return err
 }
 
+// Channels are drained without blocking, and the received values are encoded
+// as a slice.  NOTE: This is destructive, see Codec.SetDrainChannels.
+// CONTRACT: fopts.DrainChan is true.
+func (cdc *Codec) encodeReflectBinaryChan(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
+	fopts FieldOptions, bare bool) (err error) {
+	if printLog {
+		fmt.Println("(e) encodeReflectBinaryChan")
+		defer func() {
+			fmt.Printf("(e) -> err: %v\n", err)
+		}()
+	}
+	if !es.drainChannels {
+		return errors.New("amino chan support requires Codec.SetDrainChannels(true)")
+	}
+	srt := reflect.SliceOf(info.Type.Elem())
+	sinfo, err := cdc.getTypeInfoWlock(srt)
+	if err != nil {
+		return
+	}
+	var srv = reflect.MakeSlice(srt, 0, rv.Len())
+	for {
+		erv, ok := rv.TryRecv()
+		if !ok {
+			break
+		}
+		srv = reflect.Append(srv, erv)
+	}
+	return cdc.encodeReflectBinary(es, w, sinfo, srv, fopts, bare)
+}
+
 //----------------------------------------
 // Misc.
 
+// Returns true iff keys of this kind can be encoded deterministically.
+func isMapKeyKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the keys of map rv in ascending order.  Strings are ordered
+// lexicographically and integers numerically.
+// CONTRACT: isMapKeyKind(rv.Type().Key().Kind())
+func sortedMapKeys(rv reflect.Value) []reflect.Value {
+	keys := rv.MapKeys()
+	switch rv.Type().Key().Kind() {
+	case reflect.String:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Int() < keys[j].Int() })
+	default:
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Uint() < keys[j].Uint() })
+	}
+	return keys
+}
+
+// Returns true iff rt is a list of lists whose innermost elements aren't
+// bytes, e.g. [][]int.  Lists of byte lists (e.g. [][]byte) are allowed.
+func isMultidimensionalNonBytes(rt reflect.Type) bool {
+	elem := rt.Elem()
+	for elem.Kind() == reflect.Slice || elem.Kind() == reflect.Array {
+		elem = elem.Elem()
+	}
+	return elem.Kind() != reflect.Uint8 // byte is an alias for uint8
+}
+
 // Write field key.
 func encodeFieldNumberAndTyp3(w io.Writer, num uint32, typ Typ3) (err error) {
 	if (typ & 0xF8) != 0 {
 		panic(fmt.Sprintf("invalid Typ3 byte %v", typ))
 	}
-	if num > (1<<29 - 1) {
+	if num > MaxFieldNumber {
 		panic(fmt.Sprintf("invalid field number %v", num))
 	}
 
@@ -497,6 +1203,7 @@ func encodeFieldNumberAndTyp3(w io.Writer, num uint32, typ Typ3) (err error) {
 }
 
 func (cdc *Codec) writeFieldIfNotEmpty(
+	es *encodeState,
 	buf *bytes.Buffer,
 	fieldNum uint32,
 	finfo *TypeInfo,
@@ -515,7 +1222,7 @@ func (cdc *Codec) writeFieldIfNotEmpty(
 	lBeforeValue := buf.Len()
 
 	// Write field value from rv.
-	err = cdc.encodeReflectBinary(buf, finfo, derefedVal, fieldOpts, bare)
+	err = cdc.encodeReflectBinary(es, buf, finfo, derefedVal, fieldOpts, bare)
 	if err != nil {
 		return err
 	}
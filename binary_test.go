@@ -1,10 +1,20 @@
 package amino_test
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/big"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -314,3 +324,2142 @@ func TestUnmarshalFuncBinary(t *testing.T) {
 		assert.Fail(t, "should have paniced but got bz: %X err: %v", bz, err)
 	})
 }
+
+func TestByteSliceSliceEncoding(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	type Proof struct {
+		Hashes [][]byte
+	}
+
+	// Each inner slice is its own length-delimited entry of field 1.
+	bz, err := cdc.MarshalBinaryBare(Proof{Hashes: [][]byte{{0x01, 0x02}, {0x03}}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x0a, 0x02, 0x01, 0x02, 0x0a, 0x01, 0x03}, bz)
+
+	// A nil (or empty) outer slice is omitted.
+	bz, err = cdc.MarshalBinaryBare(Proof{Hashes: nil})
+	require.NoError(t, err)
+	assert.Empty(t, bz)
+	bz, err = cdc.MarshalBinaryBare(Proof{Hashes: [][]byte{}})
+	require.NoError(t, err)
+	assert.Empty(t, bz)
+
+	// Nil and empty inner entries both encode as zero-length entries.
+	nilInner, err := cdc.MarshalBinaryBare(Proof{Hashes: [][]byte{nil, {0x01}}})
+	require.NoError(t, err)
+	emptyInner, err := cdc.MarshalBinaryBare(Proof{Hashes: [][]byte{{}, {0x01}}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x0a, 0x00, 0x0a, 0x01, 0x01}, nilInner)
+	assert.Equal(t, nilInner, emptyInner)
+}
+
+func TestByteSliceSliceRoundtrip(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	type Proof struct {
+		Hashes [][]byte
+		Arr    [2][]byte
+		Fixed  [][4]byte
+	}
+
+	cases := []Proof{
+		{},
+		{Hashes: [][]byte{{0x01, 0x02}, {0x03}}},
+		// Zero-length inner entries decode as nil (we prefer nil slices).
+		{Hashes: [][]byte{nil, {0x01}, nil}},
+		{Arr: [2][]byte{nil, {0x01}}},
+		{Fixed: [][4]byte{{1, 2, 3, 4}, {}}},
+	}
+	for i, tc := range cases {
+		bz, err := cdc.MarshalBinaryBare(tc)
+		require.NoError(t, err, "#%d", i)
+		var got Proof
+		err = cdc.UnmarshalBinaryBare(bz, &got)
+		require.NoError(t, err, "#%d", i)
+		assert.Equal(t, tc, got, "#%d", i)
+	}
+
+	// Top-level [][]byte is encoded like a repeated struct: one entry per
+	// inner slice, as if it was field 1 of a struct.
+	hashes := [][]byte{{0x01, 0x02}, nil, {0x03}}
+	bz, err := cdc.MarshalBinaryBare(hashes)
+	require.NoError(t, err)
+	pbz, err := cdc.MarshalBinaryBare(struct{ Hashes [][]byte }{hashes})
+	require.NoError(t, err)
+	assert.Equal(t, pbz, bz)
+
+	var got [][]byte
+	err = cdc.UnmarshalBinaryBare(bz, &got)
+	require.NoError(t, err)
+	assert.Equal(t, hashes, got)
+}
+
+type emptyMarker struct{}
+
+type emptyMarkerIface interface{}
+
+func TestEmptyStruct(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.RegisterInterface((*emptyMarkerIface)(nil), nil)
+	cdc.RegisterConcrete(emptyMarker{}, "amino_test/emptyMarker", nil)
+
+	type Tagged struct {
+		Marker    emptyMarker
+		MarkerPtr *emptyMarker
+		Markers   []emptyMarker
+		Iface     emptyMarkerIface
+	}
+
+	// An (unregistered) empty struct encodes to zero bytes.
+	bz, err := cdc.MarshalBinaryBare(struct{}{})
+	require.NoError(t, err)
+	assert.Empty(t, bz)
+	var es struct{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &es))
+
+	// A registered empty struct encodes to its prefix bytes only.
+	bz, err = cdc.MarshalBinaryBare(emptyMarker{})
+	require.NoError(t, err)
+	_, pb := amino.NameToDisfix("amino_test/emptyMarker")
+	assert.Equal(t, pb.Bytes(), bz)
+	var em emptyMarker
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &em))
+
+	cases := []Tagged{
+		{},
+		{MarkerPtr: &emptyMarker{}},
+		{Iface: emptyMarker{}},
+		// Only the count matters for a slice of empty structs.
+		{Markers: []emptyMarker{{}, {}, {}}},
+	}
+	for i, tc := range cases {
+		bz, err := cdc.MarshalBinaryBare(tc)
+		require.NoError(t, err, "#%d", i)
+		var got Tagged
+		require.NoError(t, cdc.UnmarshalBinaryBare(bz, &got), "#%d", i)
+		assert.Equal(t, tc, got, "#%d", i)
+
+		bz, err = cdc.MarshalJSON(tc)
+		require.NoError(t, err, "#%d", i)
+		got = Tagged{}
+		require.NoError(t, cdc.UnmarshalJSON(bz, &got), "#%d", i)
+		assert.Equal(t, tc, got, "#%d", i)
+	}
+
+	// Each empty struct element is a zero-length entry.
+	bz, err = cdc.MarshalBinaryBare(Tagged{Markers: []emptyMarker{{}, {}, {}}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1a, 0x00, 0x1a, 0x00, 0x1a, 0x00}, bz)
+}
+
+type mapTables struct {
+	Sparse  map[uint32]string
+	Offsets map[int64]int64
+	Names   map[string]uint8
+}
+
+func TestMapIntegerKeys(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.SetAllowMaps(true)
+
+	// Entries are written as repeated key/value messages in key order.
+	bz, err := cdc.MarshalBinaryBare(mapTables{Sparse: map[uint32]string{1000: "b", 2: "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x0a, 0x05, 0x08, 0x02, 0x12, 0x01, 'a',
+		0x0a, 0x06, 0x08, 0xe8, 0x07, 0x12, 0x01, 'b',
+	}, bz)
+
+	// Round trip with signed keys (ordered numerically, not by encoding)
+	// and zero keys or values.
+	tables := mapTables{
+		Sparse:  map[uint32]string{0: "zero", 7: "", 1 << 31: "big"},
+		Offsets: map[int64]int64{-5: 1, 3: -1, 0: 0, -1 << 40: 42},
+		Names:   map[string]uint8{"b": 2, "a": 1, "": 0},
+	}
+	bz, err = cdc.MarshalBinaryBare(tables)
+	require.NoError(t, err)
+	var tables2 mapTables
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &tables2))
+	assert.Equal(t, tables, tables2)
+
+	// The encoding is deterministic.
+	for i := 0; i < 10; i++ {
+		bz2, err := cdc.MarshalBinaryBare(tables)
+		require.NoError(t, err)
+		assert.Equal(t, bz, bz2)
+	}
+
+	// Top-level maps work too.
+	top := map[int8]string{-1: "neg", 1: "pos"}
+	bz, err = cdc.MarshalBinaryBare(top)
+	require.NoError(t, err)
+	var top2 map[int8]string
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &top2))
+	assert.Equal(t, top, top2)
+
+	// Empty maps decode as nil.
+	bz, err = cdc.MarshalBinaryBare(mapTables{Sparse: map[uint32]string{}})
+	require.NoError(t, err)
+	assert.Empty(t, bz)
+}
+
+func TestMapDuplicateKeys(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.SetAllowMaps(true)
+
+	entry := []byte{0x0a, 0x05, 0x08, 0x02, 0x12, 0x01, 'a'}
+	var tables mapTables
+	err := cdc.UnmarshalBinaryBare(append(entry, entry...), &tables)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "duplicate map key 2")
+}
+
+func TestMapUnsupportedKeys(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.SetAllowMaps(true)
+
+	type boolKeys struct {
+		Flags map[bool]string
+	}
+	_, err := cdc.MarshalBinaryBare(boolKeys{map[bool]string{true: "yes"}})
+	assert.Error(t, err)
+}
+
+func TestAminoFixedTags(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	type fixedWide struct {
+		Hash  uint64 `amino:"fixed64"`
+		Seed  int64  `amino:"fixed64"`
+		Check uint32 `amino:"fixed32"`
+	}
+	type varintWide struct {
+		Hash  uint64
+		Seed  int64
+		Check uint32
+	}
+
+	// Fixed-width values are written in little endian.
+	o := fixedWide{Hash: 1<<64 - 1, Seed: 1, Check: 2}
+	bz, err := cdc.MarshalBinaryBare(o)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x09, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+		0x11, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x1d, 0x02, 0x00, 0x00, 0x00,
+	}, bz)
+	var o2 fixedWide
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &o2))
+	assert.Equal(t, o, o2)
+
+	// Same as the binary tag.
+	type binaryWide struct {
+		Hash  uint64 `binary:"fixed64"`
+		Seed  int64  `binary:"fixed64"`
+		Check uint32 `binary:"fixed32"`
+	}
+	bz2, err := cdc.MarshalBinaryBare(binaryWide(o))
+	require.NoError(t, err)
+	assert.Equal(t, bz, bz2)
+
+	// Wire type mismatches are errors.
+	var v varintWide
+	assert.Error(t, cdc.UnmarshalBinaryBare(bz, &v))
+	bz, err = cdc.MarshalBinaryBare(varintWide(o))
+	require.NoError(t, err)
+	assert.Error(t, cdc.UnmarshalBinaryBare(bz, &o2))
+}
+
+type chanSnapshot struct {
+	Name    string
+	Pending chan int64            `amino:"drain_chan"`
+	Jobs    chan *SimpleStruct    `amino:"drain_chan"`
+	Ignored chan string           `json:"-"`
+	Done    chan struct{ X int8 } `amino:"drain_chan"`
+}
+
+func TestDrainChannels(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	s := chanSnapshot{Name: "snap", Pending: make(chan int64, 4), Jobs: make(chan *SimpleStruct, 2)}
+	s.Pending <- 1
+	s.Pending <- 2
+	s.Jobs <- &SimpleStruct{String: "job"}
+
+	// Draining must be enabled on the codec.
+	_, err := cdc.MarshalBinaryBare(s)
+	assert.Error(t, err)
+	assert.Len(t, s.Pending, 2)
+
+	cdc.SetDrainChannels(true)
+	bz, err := cdc.MarshalBinaryBare(s)
+	require.NoError(t, err)
+
+	// Encoding drained the channels.
+	assert.Len(t, s.Pending, 0)
+	assert.Len(t, s.Jobs, 0)
+
+	// Channels are encoded like slices.
+	type sliceSnapshot struct {
+		Name    string
+		Pending []int64
+		Jobs    []*SimpleStruct
+	}
+	var ss sliceSnapshot
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &ss))
+	assert.Equal(t, sliceSnapshot{"snap", []int64{1, 2}, []*SimpleStruct{{String: "job"}}}, ss)
+
+	// Decoding constructs buffered channels.
+	var s2 chanSnapshot
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &s2))
+	assert.Equal(t, "snap", s2.Name)
+	require.Len(t, s2.Pending, 2)
+	assert.Equal(t, 2, cap(s2.Pending))
+	assert.Equal(t, int64(1), <-s2.Pending)
+	assert.Equal(t, int64(2), <-s2.Pending)
+	require.Len(t, s2.Jobs, 1)
+	assert.Equal(t, "job", (<-s2.Jobs).String)
+	assert.Nil(t, s2.Done)
+
+	// Untagged channels are still unsupported.
+	type untagged struct {
+		C chan int
+	}
+	u := untagged{make(chan int, 1)}
+	u.C <- 1
+	assert.Panics(t, func() {
+		_, _ = cdc.MarshalBinaryBare(u)
+	})
+}
+
+type oneofShape interface{ Sides() int }
+
+type oneofSquare struct{ Side uint32 }
+
+type oneofCircle struct{ Radius uint32 }
+
+func (oneofSquare) Sides() int  { return 4 }
+func (*oneofCircle) Sides() int { return 0 }
+
+type oneofCanvas struct {
+	Main   oneofShape
+	Shapes []oneofShape
+}
+
+func TestRegisterOneof(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.RegisterConcrete(oneofSquare{}, "oneof/square", nil)
+	cdc.RegisterConcrete(&oneofCircle{}, "oneof/circle", nil)
+	cdc.RegisterOneof((*oneofShape)(nil), oneofSquare{}, &oneofCircle{})
+
+	// The variant is identified by field number instead of prefix bytes,
+	// like a Proto3 oneof.
+	bz, err := cdc.MarshalBinaryBare(oneofCanvas{Main: &oneofCircle{Radius: 3}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x0a, 0x04, // Main:
+		0x12, 0x02, //   oneof field 2 (circle):
+		0x08, 0x03, //     Radius 3.
+	}, bz)
+
+	canvas := oneofCanvas{
+		Main:   oneofSquare{Side: 2},
+		Shapes: []oneofShape{&oneofCircle{Radius: 1}, oneofSquare{}, oneofSquare{Side: 5}},
+	}
+	bz, err = cdc.MarshalBinaryBare(canvas)
+	require.NoError(t, err)
+	var canvas2 oneofCanvas
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &canvas2))
+	assert.Equal(t, canvas, canvas2)
+
+	// JSON is unaffected.
+	jbz, err := cdc.MarshalJSON(oneofCanvas{Main: oneofSquare{Side: 2}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Main":{"type":"oneof/square","value":{"Side":2}},"Shapes":null}`, string(jbz))
+
+	// Unknown field numbers are errors.
+	canvas2 = oneofCanvas{}
+	err = cdc.UnmarshalBinaryBare([]byte{0x0a, 0x02, 0x1a, 0x00}, &canvas2)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown oneof field number 3")
+}
+
+func TestRegisterOneofErrors(t *testing.T) {
+	type notAShape struct{}
+
+	var cdc = amino.NewCodec()
+	cdc.RegisterConcrete(oneofSquare{}, "oneof/square", nil)
+	cdc.RegisterConcrete(notAShape{}, "oneof/not", nil)
+	assert.Panics(t, func() { cdc.RegisterOneof((*oneofShape)(nil)) })
+	assert.Panics(t, func() { cdc.RegisterOneof((*oneofShape)(nil), &oneofCircle{}) }, "unregistered")
+	assert.Panics(t, func() { cdc.RegisterOneof((*oneofShape)(nil), notAShape{}) }, "not implementing")
+	assert.Panics(t, func() { cdc.RegisterOneof((*oneofShape)(nil), oneofSquare{}, oneofSquare{}) }, "duplicate")
+
+	// Registered implementations that aren't variants can't be encoded.
+	cdc = amino.NewCodec()
+	cdc.RegisterConcrete(oneofSquare{}, "oneof/square", nil)
+	cdc.RegisterConcrete(&oneofCircle{}, "oneof/circle", nil)
+	cdc.RegisterOneof((*oneofShape)(nil), oneofSquare{})
+	_, err := cdc.MarshalBinaryBare(oneofCanvas{Main: &oneofCircle{}})
+	assert.Error(t, err)
+}
+
+func TestStrictTypes(t *testing.T) {
+	type record struct {
+		A int64
+		B uint32
+		C string
+		D []string
+	}
+
+	var cdc = amino.NewCodec()
+	// Field 3 is encoded as a varint, rather than a string.
+	bz := []byte{0x08, 0x01, 0x10, 0x02, 0x18, 0x01}
+
+	var r record
+	err := cdc.UnmarshalBinaryBare(bz, &r)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "expected field type ByteLength for # 3")
+
+	cdc.SetStrictTypes(true)
+	r = record{}
+	err = cdc.UnmarshalBinaryBare(bz, &r)
+	require.Error(t, err)
+	assert.Equal(t, "field 3: expected length-delimited for string, got varint", err.Error())
+	wterr, ok := err.(*amino.WireTypeError)
+	require.True(t, ok)
+	assert.Equal(t, uint32(3), wterr.FieldNum)
+	assert.Equal(t, amino.Typ3ByteLength, wterr.Expected)
+	assert.Equal(t, amino.Typ3Varint, wterr.Got)
+
+	// Mismatches in repeated fields are reported too.
+	bz = []byte{0x22, 0x01, 0x61, 0x20, 0x01}
+	r = record{}
+	err = cdc.UnmarshalBinaryBare(bz, &r)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "field 4: expected length-delimited for string, got varint")
+
+	// Valid input is unaffected.
+	bz, err = cdc.MarshalBinaryBare(record{A: 1, B: 2, C: "c", D: []string{"a", "b"}})
+	require.NoError(t, err)
+	r = record{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &r))
+	assert.Equal(t, record{A: 1, B: 2, C: "c", D: []string{"a", "b"}}, r)
+}
+
+func TestTimeSlices(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	type timeLists struct {
+		Times    []time.Time
+		TimePtrs []*time.Time
+		TimeArr  [2]*time.Time
+	}
+
+	epoch := time.Unix(0, 0).UTC()
+	now := time.Unix(1546300800, 123).UTC()
+	tl := timeLists{
+		Times:    []time.Time{now, epoch, now},
+		TimePtrs: []*time.Time{&now, nil, &epoch, nil},
+		TimeArr:  [2]*time.Time{nil, &now},
+	}
+	bz, err := cdc.MarshalBinaryBare(tl)
+	require.NoError(t, err)
+
+	// Nil pointers decode to the 1970 default, like a nil *time.Time field.
+	var tl2 timeLists
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &tl2))
+	assert.Equal(t, tl.Times, tl2.Times)
+	require.Len(t, tl2.TimePtrs, 4)
+	for i, want := range []time.Time{now, epoch, epoch, epoch} {
+		require.NotNil(t, tl2.TimePtrs[i])
+		assert.Equal(t, want, *tl2.TimePtrs[i])
+	}
+	require.NotNil(t, tl2.TimeArr[0])
+	assert.Equal(t, epoch, *tl2.TimeArr[0])
+	assert.Equal(t, now, *tl2.TimeArr[1])
+
+	// A nil element encodes just like the 1970 default.
+	bz1, err := cdc.MarshalBinaryBare(timeLists{TimePtrs: []*time.Time{nil}})
+	require.NoError(t, err)
+	bz2, err := cdc.MarshalBinaryBare(timeLists{TimePtrs: []*time.Time{&epoch}})
+	require.NoError(t, err)
+	assert.Equal(t, bz1, bz2)
+
+	// Top-level lists of times round-trip too.
+	bz, err = cdc.MarshalBinaryBare([]*time.Time{nil, &now})
+	require.NoError(t, err)
+	var ptrs []*time.Time
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &ptrs))
+	require.Len(t, ptrs, 2)
+	assert.Equal(t, epoch, *ptrs[0])
+	assert.Equal(t, now, *ptrs[1])
+	bz, err = cdc.MarshalBinaryBare([]time.Time{epoch, now})
+	require.NoError(t, err)
+	var times []time.Time
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &times))
+	assert.Equal(t, []time.Time{epoch, now}, times)
+
+	// JSON keeps nil elements as null.
+	jsonBz, err := cdc.MarshalJSON(tl)
+	require.NoError(t, err)
+	var tl3 timeLists
+	require.NoError(t, cdc.UnmarshalJSON(jsonBz, &tl3))
+	assert.Equal(t, tl, tl3)
+}
+
+func TestArrayLengthValidation(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	type fixedShape struct {
+		Words [4]uint64
+		Keys  [2]string
+		Tail  int8
+	}
+	type looseShape struct {
+		Words []uint64
+		Keys  []string
+		Tail  int8
+	}
+
+	// Exact lengths decode fine.
+	bz, err := cdc.MarshalBinaryBare(looseShape{Words: []uint64{1, 2, 3, 4}, Keys: []string{"a", "b"}, Tail: 1})
+	require.NoError(t, err)
+	var fs fixedShape
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &fs))
+	assert.Equal(t, fixedShape{Words: [4]uint64{1, 2, 3, 4}, Keys: [2]string{"a", "b"}, Tail: 1}, fs)
+
+	cases := []struct {
+		loose  looseShape
+		errMsg string
+	}{
+		{looseShape{Words: []uint64{1, 2, 3}, Keys: []string{"a", "b"}}, "too few elements for [4]uint64, got 3"},
+		{looseShape{Words: []uint64{1, 2, 3, 4, 5}, Keys: []string{"a", "b"}}, "bytes left over"},
+		{looseShape{Words: []uint64{1, 2, 3, 4}, Keys: []string{"a"}, Tail: 1}, "too few elements for [2]string, got 1"},
+		{looseShape{Words: []uint64{1, 2, 3, 4}, Keys: []string{"a"}}, "too few elements for [2]string, got 1"},
+		{looseShape{Words: []uint64{1, 2, 3, 4}, Keys: []string{"a", "b", "c"}}, "too many elements for [2]string"},
+	}
+	for _, tc := range cases {
+		bz, err := cdc.MarshalBinaryBare(tc.loose)
+		require.NoError(t, err)
+		var fs fixedShape
+		err = cdc.UnmarshalBinaryBare(bz, &fs)
+		require.Error(t, err, "%v", tc.loose)
+		assert.Contains(t, err.Error(), tc.errMsg)
+	}
+
+	// Top-level arrays are validated too.
+	bz, err = cdc.MarshalBinaryBare([]string{"a", "b", "c"})
+	require.NoError(t, err)
+	var keys [2]string
+	assert.Error(t, cdc.UnmarshalBinaryBare(bz, &keys))
+	var moreKeys [4]string
+	assert.Error(t, cdc.UnmarshalBinaryBare(bz, &moreKeys))
+}
+
+type legacyHeader struct {
+	Version uint32
+	Tags    []string
+	Height  int64
+	Hash    []byte
+}
+
+type legacyCounters struct {
+	A uint64
+	B uint64
+}
+
+func TestConcreteFieldOrder(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.RegisterConcrete(legacyHeader{}, "test/legacyHeader", &amino.ConcreteOptions{
+		FieldOrder: []string{"Hash", "Height", "Tags", "Version"},
+	})
+	cdc.RegisterConcrete(legacyCounters{}, "test/legacyCounters", &amino.ConcreteOptions{
+		FieldOrder: []string{"B", "A"},
+	})
+
+	h := legacyHeader{Version: 1, Tags: []string{"a", "b"}, Height: 100, Hash: []byte{0xAB}}
+	bz, err := cdc.MarshalBinaryBare(h)
+	require.NoError(t, err)
+	prefix := bz[:4]
+	assert.Equal(t, []byte{
+		0x22, 0x01, 0xAB, // Hash, field 4
+		0x18, 0x64, // Height, field 3
+		0x12, 0x01, 'a', 0x12, 0x01, 'b', // Tags, field 2
+		0x08, 0x01, // Version, field 1
+	}, bz[4:])
+	var h2 legacyHeader
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &h2))
+	assert.Equal(t, h, h2)
+
+	// Missing fields, including lists, decode as empty.
+	for _, h := range []legacyHeader{{Version: 1}, {Tags: []string{"c"}}, {Height: 5, Version: 2}} {
+		bz, err = cdc.MarshalBinaryBare(h)
+		require.NoError(t, err)
+		var h2 legacyHeader
+		require.NoError(t, cdc.UnmarshalBinaryBare(bz, &h2))
+		assert.Equal(t, h, h2)
+	}
+
+	// Fields in declaration order are now out of order.
+	bz = append(append([]byte{}, prefix...), 0x08, 0x01, 0x18, 0x64)
+	assert.Error(t, cdc.UnmarshalBinaryBare(bz, &h2))
+
+	// The fixed-width fast path follows the order too.
+	bz, err = cdc.MarshalBinaryBare(legacyCounters{A: 1, B: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x10, 0x02, 0x08, 0x01}, bz[4:])
+	var c legacyCounters
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &c))
+	assert.Equal(t, legacyCounters{A: 1, B: 2}, c)
+
+	assert.Panics(t, func() {
+		cdc.RegisterConcrete(legacyHeader{}, "test/legacyHeader2", &amino.ConcreteOptions{
+			FieldOrder: []string{"Hash", "Height", "Tags"},
+		})
+	}, "missing field")
+	assert.Panics(t, func() {
+		cdc.RegisterConcrete(legacyHeader{}, "test/legacyHeader2", &amino.ConcreteOptions{
+			FieldOrder: []string{"Hash", "Height", "Tags", "Hash"},
+		})
+	}, "duplicate field")
+	assert.Panics(t, func() {
+		cdc.RegisterConcrete(legacyHeader{}, "test/legacyHeader2", &amino.ConcreteOptions{
+			FieldOrder: []string{"Hash", "Height", "Tags", "Other"},
+		})
+	}, "unknown field")
+}
+
+func TestBigFloat(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	type sample struct {
+		Mean  *big.Float
+		Total big.Float
+		Skip  *big.Float
+	}
+
+	pi, _, err := big.ParseFloat("3.14159265358979323846264338327950288419716939937510", 10, 200, big.ToNearestEven)
+	require.NoError(t, err)
+	s := sample{Mean: pi, Total: *big.NewFloat(0.1)}
+
+	bz, err := cdc.MarshalBinaryBare(s)
+	require.NoError(t, err)
+	var s2 sample
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &s2))
+	assert.Equal(t, pi.Text('g', -1), s2.Mean.Text('g', -1))
+	assert.Equal(t, "0.1", s2.Total.Text('g', -1))
+	assert.Nil(t, s2.Skip)
+	// Enough precision is used for all digits.
+	assert.True(t, s2.Mean.Prec() >= 160)
+	assert.Equal(t, uint(64), s2.Total.Prec())
+
+	// A preset precision is kept.
+	s3 := sample{Mean: new(big.Float).SetPrec(200)}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &s3))
+	assert.Equal(t, uint(200), s3.Mean.Prec())
+	assert.Equal(t, 0, pi.Cmp(s3.Mean))
+
+	jsonBz, err := cdc.MarshalJSON(s)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Mean":"`+pi.Text('g', -1)+`","Total":"0.1","Skip":null}`, string(jsonBz))
+	var s4 sample
+	require.NoError(t, cdc.UnmarshalJSON(jsonBz, &s4))
+	assert.Equal(t, pi.Text('g', -1), s4.Mean.Text('g', -1))
+	assert.Equal(t, "0.1", s4.Total.Text('g', -1))
+
+	// Infinities are supported.
+	bz, err = cdc.MarshalBinaryBare(sample{Mean: new(big.Float).SetInf(true)})
+	require.NoError(t, err)
+	s2 = sample{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &s2))
+	assert.True(t, s2.Mean.IsInf() && s2.Mean.Sign() < 0)
+
+	assert.Error(t, cdc.UnmarshalJSON([]byte(`{"Mean":1.5}`), &s4))
+	assert.Error(t, cdc.UnmarshalJSON([]byte(`{"Mean":"one"}`), &s4))
+}
+
+func TestURL(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	type webhook struct {
+		Endpoint *url.URL
+		Fallback url.URL
+		Retry    *url.URL
+	}
+
+	endpoint, err := url.Parse("https://user@example.com:8443/hook?a=1&b=2#frag")
+	require.NoError(t, err)
+	w := webhook{Endpoint: endpoint, Fallback: url.URL{Scheme: "http", Host: "localhost", Path: "/x"}}
+
+	bz, err := cdc.MarshalBinaryBare(w)
+	require.NoError(t, err)
+	assert.Equal(t, append([]byte{0x0A, byte(len(endpoint.String()))}, endpoint.String()...), bz[:2+len(endpoint.String())])
+	var w2 webhook
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &w2))
+	assert.Equal(t, w, w2)
+	assert.Nil(t, w2.Retry)
+
+	jsonBz, err := cdc.MarshalJSON(w)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Endpoint":"https://user@example.com:8443/hook?a=1\u0026b=2#frag","Fallback":"http://localhost/x","Retry":null}`, string(jsonBz))
+	var w3 webhook
+	require.NoError(t, cdc.UnmarshalJSON(jsonBz, &w3))
+	assert.Equal(t, w, w3)
+
+	assert.Error(t, cdc.UnmarshalJSON([]byte(`{"Endpoint":42}`), &w3))
+	assert.Error(t, cdc.UnmarshalJSON([]byte(`{"Endpoint":"http://a b.com/"}`), &w3))
+}
+
+type compactMsg interface{ compact() }
+
+type compactPing struct{ Seq uint64 }
+type compactPong struct{ Seq uint64 }
+
+func (compactPing) compact() {}
+func (compactPong) compact() {}
+
+type compactEnvelope struct {
+	Msg compactMsg
+}
+
+func TestConcreteNoDisamb(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.RegisterInterface((*compactMsg)(nil), &amino.InterfaceOptions{AlwaysDisambiguate: true})
+	cdc.RegisterConcrete(compactPing{}, "test/compactPing", &amino.ConcreteOptions{NoDisamb: true})
+	cdc.RegisterConcrete(compactPong{}, "test/compactPong", nil)
+
+	// Only the prefix bytes are written for compactPing.
+	disamb, prefix := amino.NameToDisfix("test/compactPing")
+	bz, err := cdc.MarshalBinaryBare(compactEnvelope{compactPing{Seq: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, append(append([]byte{0x0A, 0x06}, prefix.Bytes()...), 0x08, 0x01), bz)
+	var env compactEnvelope
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &env))
+	assert.Equal(t, compactEnvelope{compactPing{Seq: 1}}, env)
+
+	// Other implementations are unaffected.
+	bz, err = cdc.MarshalBinaryBare(compactEnvelope{compactPong{Seq: 1}})
+	require.NoError(t, err)
+	assert.Len(t, bz, 2+4+4+2)
+
+	// Encodings with disambiguation bytes are still recognized.
+	bz = []byte{0x0A, 0x0A, 0x00}
+	bz = append(bz, disamb.Bytes()...)
+	bz = append(bz, prefix.Bytes()...)
+	bz = append(bz, 0x08, 0x02)
+	env = compactEnvelope{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &env))
+	assert.Equal(t, compactEnvelope{compactPing{Seq: 2}}, env)
+
+	// Prefix conflicts can't be resolved without disambiguation bytes.
+	// These names share the prefix bytes 3C9258BD.
+	cdc = amino.NewCodec()
+	cdc.RegisterInterface((*compactMsg)(nil), nil)
+	cdc.RegisterConcrete(compactPing{}, "test/collide74681", &amino.ConcreteOptions{NoDisamb: true})
+	func() {
+		defer func() {
+			err, _ := recover().(error)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), "NoDisamb")
+		}()
+		cdc.RegisterConcrete(compactPong{}, "test/collide109023", nil)
+	}()
+}
+
+func TestUnknownFieldHook(t *testing.T) {
+	type statusV2 struct {
+		Height  int64
+		Moniker string
+		Peers   []string
+		Uptime  uint32 `binary:"fixed32"`
+	}
+	type statusV1 struct {
+		Height  int64
+		Moniker string
+	}
+
+	type unknownField struct {
+		typeName string
+		fieldNum uint32
+		wireType byte
+		raw      []byte
+	}
+	var seen []unknownField
+	var hook = func(typeName string, fieldNum uint32, wireType byte, raw []byte) {
+		seen = append(seen, unknownField{typeName, fieldNum, wireType, append([]byte(nil), raw...)})
+	}
+
+	var cdc = amino.NewCodec()
+	cdc.SetUnknownFieldHook(hook)
+	bz, err := cdc.MarshalBinaryBare(statusV2{Height: 1, Moniker: "m", Peers: []string{"a"}, Uptime: 7})
+	require.NoError(t, err)
+	var s statusV1
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &s))
+	assert.Equal(t, statusV1{Height: 1, Moniker: "m"}, s)
+	assert.Equal(t, []unknownField{
+		{"amino_test.statusV1", 3, 2, []byte{0x01, 'a'}},
+		{"amino_test.statusV1", 4, 5, []byte{0x07, 0x00, 0x00, 0x00}},
+	}, seen)
+
+	// Registered types are reported by name.
+	var cdc2 = amino.NewCodec()
+	cdc2.RegisterConcrete(statusV2{}, "test/status", nil)
+	bz, err = cdc2.MarshalBinaryBare(statusV2{Height: 1, Uptime: 7})
+	require.NoError(t, err)
+	cdc.RegisterConcrete(statusV1{}, "test/status", nil)
+	seen = nil
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &s))
+	assert.Equal(t, []unknownField{{"test/status", 4, 5, []byte{0x07, 0x00, 0x00, 0x00}}}, seen)
+
+	// Known fields aren't reported.
+	seen = nil
+	bz, err = cdc.MarshalBinaryBare(statusV1{Height: 1, Moniker: "m"})
+	require.NoError(t, err)
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &s))
+	assert.Empty(t, seen)
+}
+
+func TestFieldValidators(t *testing.T) {
+	type order struct {
+		Quantity uint32   `amino:"min=1,max=100"`
+		Price    *float64 `amino:"unsafe,min=0.01"`
+		Symbol   string   `amino:"nonempty,len=3"`
+		Tags     []string `amino:"len=2"`
+		Side     string   `amino:"side"`
+	}
+
+	var cdc = amino.NewCodec()
+	cdc.RegisterValidator("side", func(rv reflect.Value, _ string) error {
+		if s := rv.String(); s != "buy" && s != "sell" {
+			return fmt.Errorf("unknown side %q", s)
+		}
+		return nil
+	})
+
+	var valid = order{Quantity: 10, Symbol: "ABC", Tags: []string{"a", "b"}, Side: "buy"}
+	var cases = []struct {
+		name   string
+		modify func(*order)
+		errStr string
+	}{
+		{"valid", func(o *order) {}, ""},
+		{"min", func(o *order) { o.Quantity = 0 }, "Quantity (min=1): less than 1"},
+		{"max", func(o *order) { o.Quantity = 101 }, "Quantity (max=100): greater than 100"},
+		{"float min", func(o *order) { p := 0.001; o.Price = &p }, "Price (min=0.01): less than 0.01"},
+		{"nonempty", func(o *order) { o.Symbol = "" }, "Symbol (nonempty): empty"},
+		{"len", func(o *order) { o.Symbol = "ABCD" }, "Symbol (len=3): length 4, expected 3"},
+		{"list len", func(o *order) { o.Tags = nil }, "Tags (len=2): length 0, expected 2"},
+		{"custom", func(o *order) { o.Side = "hold" }, `Side (side): unknown side "hold"`},
+	}
+	for _, tc := range cases {
+		var o = valid
+		tc.modify(&o)
+
+		bz, err := cdc.MarshalBinaryBare(o)
+		require.NoError(t, err, tc.name)
+		var o2 order
+		err = cdc.UnmarshalBinaryBare(bz, &o2)
+		if tc.errStr == "" {
+			assert.NoError(t, err, tc.name)
+		} else if assert.Error(t, err, tc.name) {
+			assert.Contains(t, err.Error(), tc.errStr, tc.name)
+		}
+
+		bz, err = cdc.MarshalJSON(o)
+		require.NoError(t, err, tc.name)
+		err = cdc.UnmarshalJSON(bz, &o2)
+		if tc.errStr == "" {
+			assert.NoError(t, err, tc.name)
+		} else if assert.Error(t, err, tc.name) {
+			assert.Contains(t, err.Error(), tc.errStr, tc.name)
+		}
+	}
+
+	// Collected validation errors are reported per field.
+	bz, err := cdc.MarshalBinaryBare(order{Quantity: 0, Symbol: "AB", Tags: []string{"a", "b"}, Side: "sell"})
+	require.NoError(t, err)
+	var o order
+	err = cdc.UnmarshalBinaryBareCollectErrors(bz, &o)
+	if assert.IsType(t, amino.FieldErrors{}, err) {
+		var paths []string
+		for _, ferr := range err.(amino.FieldErrors) {
+			paths = append(paths, ferr.Path)
+		}
+		assert.Equal(t, []string{"Quantity", "Symbol"}, paths)
+	}
+
+	// Unknown validators fail decoding.
+	type badTag struct {
+		A int64 `amino:"positive"`
+	}
+	bz, err = cdc.MarshalBinaryBare(badTag{A: 1})
+	require.NoError(t, err)
+	var b badTag
+	err = cdc.UnmarshalBinaryBare(bz, &b)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unknown validator positive")
+	}
+}
+
+func TestMaxDecodeAlloc(t *testing.T) {
+	type point struct {
+		X, Y, Z, W int64
+	}
+	type shape struct {
+		Name   string
+		Points []point
+		Tags   []string
+	}
+
+	var cdc = amino.NewCodec()
+	// 100 empty points take 2 bytes each to encode, but 32 bytes each to decode.
+	s := shape{Name: "blob", Points: make([]point, 100)}
+	bz, err := cdc.MarshalBinaryBare(s)
+	require.NoError(t, err)
+	assert.True(t, len(bz) < 300)
+
+	cdc.SetMaxDecodeAlloc(4 + 3200)
+	var s2 shape
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &s2))
+	assert.Equal(t, s, s2)
+
+	cdc.SetMaxDecodeAlloc(1000)
+	err = cdc.UnmarshalBinaryBare(bz, &s2)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "max allocation of 1000 bytes")
+	}
+	// The limit can't be skipped over when collecting errors.
+	err = cdc.UnmarshalBinaryBareCollectErrors(bz, &s2)
+	assert.Error(t, err)
+	_, isFieldErrors := err.(amino.FieldErrors)
+	assert.False(t, isFieldErrors)
+
+	// Strings add up across fields and list elements.
+	s = shape{Name: "0123456789", Tags: []string{"0123456789", "0123456789"}}
+	bz, err = cdc.MarshalBinaryLengthPrefixed(s)
+	require.NoError(t, err)
+	cdc.SetMaxDecodeAlloc(30 + 2*16 - 1) // 30 bytes of strings, and 2 string headers.
+	err = cdc.UnmarshalBinaryLengthPrefixed(bz, &s2)
+	assert.Error(t, err)
+	cdc.SetMaxDecodeAlloc(0)
+	require.NoError(t, cdc.UnmarshalBinaryLengthPrefixed(bz, &s2))
+	assert.Equal(t, s, s2)
+
+	assert.Panics(t, func() { cdc.SetMaxDecodeAlloc(-1) })
+}
+
+func TestDecodeWidenedIntegers(t *testing.T) {
+	type accountV2 struct {
+		Balance int64
+		Nonce   uint64
+		Shard   int64
+	}
+	type accountV1 struct {
+		Balance int32
+		Nonce   uint32
+		Shard   int
+	}
+
+	var cdc = amino.NewCodec()
+
+	// Values that fit are decoded, including negative ones.
+	bz, err := cdc.MarshalBinaryBare(accountV2{Balance: -5, Nonce: math.MaxUint32, Shard: -1})
+	require.NoError(t, err)
+	var a accountV1
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &a))
+	assert.Equal(t, accountV1{Balance: -5, Nonce: math.MaxUint32, Shard: -1}, a)
+
+	for _, v2 := range []accountV2{
+		{Balance: math.MaxInt32 + 1},
+		{Balance: math.MinInt32 - 1},
+		{Nonce: math.MaxUint32 + 1},
+	} {
+		bz, err := cdc.MarshalBinaryBare(v2)
+		require.NoError(t, err)
+		err = cdc.UnmarshalBinaryBare(bz, &a)
+		if assert.Error(t, err, "%+v", v2) {
+			assert.Contains(t, err.Error(), "overflow", "%+v", v2)
+		}
+	}
+
+	// Narrower types are checked too.
+	type counterV2 struct{ Count int32 }
+	type counterV1 struct{ Count uint16 }
+	bz, err = cdc.MarshalBinaryBare(counterV2{Count: math.MaxUint16 + 1})
+	require.NoError(t, err)
+	var c counterV1
+	err = cdc.UnmarshalBinaryBare(bz, &c)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "overflow decoding uint16")
+	}
+}
+
+func TestMaxSliceLen(t *testing.T) {
+	type entry struct{ Key string }
+	type batch struct {
+		Heights []int64
+		Entries []entry
+		Nested  [][]int64
+		Labels  map[string]int64
+	}
+
+	var cdc = amino.NewCodec()
+	cdc.SetAllowMaps(true)
+	b := batch{
+		Heights: []int64{1, 2, 3},
+		Entries: make([]entry, 3),
+		Nested:  [][]int64{{1, 2, 3}, {4}},
+		Labels:  map[string]int64{"a": 1, "b": 2, "c": 3},
+	}
+	bz, err := cdc.MarshalBinaryBare(b)
+	require.NoError(t, err)
+
+	cdc.SetMaxSliceLen(3)
+	var b2 batch
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &b2))
+	assert.Equal(t, b, b2)
+
+	for _, b := range []batch{
+		{Heights: []int64{1, 2, 3, 4}},
+		{Entries: make([]entry, 4)},
+		{Nested: [][]int64{{1, 2, 3, 4}}},
+		{Labels: map[string]int64{"a": 1, "b": 2, "c": 3, "d": 4}},
+	} {
+		bz, err := cdc.MarshalBinaryBare(b)
+		require.NoError(t, err)
+		err = cdc.UnmarshalBinaryBare(bz, &b2)
+		if assert.Error(t, err, "%+v", b) {
+			assert.Contains(t, err.Error(), "too many elements", "%+v", b)
+		}
+	}
+
+	cdc.SetMaxSliceLen(0)
+	bz, err = cdc.MarshalBinaryBare(batch{Heights: make([]int64, 1000)})
+	require.NoError(t, err)
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &b2))
+	assert.Len(t, b2.Heights, 1000)
+
+	assert.Panics(t, func() { cdc.SetMaxSliceLen(-1) })
+}
+
+func TestStrictBool(t *testing.T) {
+	type flags struct {
+		On   bool
+		Bits []bool
+	}
+
+	var cdc = amino.NewCodec()
+	bz, err := cdc.MarshalBinaryBare(flags{On: true, Bits: []bool{true, false, true}})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x08, 0x01, 0x12, 0x03, 0x01, 0x00, 0x01}, bz)
+
+	for _, bz := range [][]byte{
+		{0x08, 0x02},                   // Not 0 or 1.
+		{0x08, 0xFF, 0x01},             // Not 0 or 1, as a varint.
+		{0x08, 0x81, 0x00},             // Non-minimal varint for 1.
+		{0x12, 0x02, 0x01, 0x02},       // In a packed list.
+		{0x08, 0x01, 0x12, 0x01, 0x80}, // Truncated varint in a packed list.
+	} {
+		var f flags
+		err := cdc.UnmarshalBinaryBare(bz, &f)
+		assert.Error(t, err, "%X", bz)
+	}
+
+	_, _, err = amino.DecodeBool([]byte{0x02})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "0x02")
+	}
+}
+
+func TestUnmarshalBinaryBareMapFunc(t *testing.T) {
+	type quote struct {
+		Bid, Ask int64
+	}
+
+	var cdc = amino.NewCodec()
+	cdc.SetAllowMaps(true)
+	quotes := map[string]quote{"ATOM": {1, 2}, "BTC": {3, 4}, "ETH": {5, 6}}
+	bz, err := cdc.MarshalBinaryBare(quotes)
+	require.NoError(t, err)
+
+	var cache sync.Map
+	var keys []string
+	err = cdc.UnmarshalBinaryBareMapFunc(bz, "", quote{}, func(key, value interface{}) {
+		keys = append(keys, key.(string))
+		cache.Store(key, value)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ATOM", "BTC", "ETH"}, keys, "in encoded order")
+	for k, q := range quotes {
+		v, ok := cache.Load(k)
+		assert.True(t, ok)
+		assert.Equal(t, q, v)
+	}
+
+	// Values can be decoded as pointers or interfaces.
+	err = cdc.UnmarshalBinaryBareMapFunc(bz, "", &quote{}, func(key, value interface{}) {
+		assert.Equal(t, quotes[key.(string)], *value.(*quote))
+	})
+	require.NoError(t, err)
+
+	cdc.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc.RegisterConcrete(hintCat{}, "zoo/Cat", nil)
+	bz2, err := cdc.MarshalBinaryBare(map[uint32]hintAnimal{7: hintCat{"Tom"}})
+	require.NoError(t, err)
+	var animals = map[uint32]hintAnimal{}
+	err = cdc.UnmarshalBinaryBareMapFunc(bz2, uint32(0), (*hintAnimal)(nil), func(key, value interface{}) {
+		animals[key.(uint32)] = value.(hintAnimal)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[uint32]hintAnimal{7: hintCat{"Tom"}}, animals)
+
+	// Limits apply.
+	cdc.SetMaxSliceLen(2)
+	err = cdc.UnmarshalBinaryBareMapFunc(bz, "", quote{}, func(key, value interface{}) {})
+	assert.Error(t, err)
+	cdc.SetMaxSliceLen(0)
+
+	noop := func(key, value interface{}) {}
+	assert.Error(t, cdc.UnmarshalBinaryBareMapFunc(bz[:len(bz)-1], "", quote{}, noop), "truncated")
+	assert.Error(t, cdc.UnmarshalBinaryBareMapFunc(append(bz, 0x10, 0x01), "", quote{}, noop), "trailing field")
+	assert.Error(t, cdc.UnmarshalBinaryBareMapFunc(bz, 1.5, quote{}, noop), "float key")
+	assert.Error(t, cdc.UnmarshalBinaryBareMapFunc(bz, "", nil, noop), "nil template")
+}
+
+type cycleNode struct {
+	Name     string
+	Next     *cycleNode
+	Children []*cycleNode
+}
+
+func TestMarshalBinaryCycle(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	loop := &cycleNode{Name: "a"}
+	loop.Next = &cycleNode{Name: "b", Next: loop}
+	_, err := cdc.MarshalBinaryBare(loop)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "cyclic reference")
+		assert.Contains(t, err.Error(), "Next.Next")
+	}
+
+	self := &cycleNode{Name: "self"}
+	self.Children = []*cycleNode{self}
+	_, err = cdc.MarshalBinaryBare(self)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "Children")
+	}
+
+	// A node shared by several parents isn't a cycle.
+	leaf := &cycleNode{Name: "leaf"}
+	dag := &cycleNode{Name: "root", Next: leaf, Children: []*cycleNode{leaf, leaf}}
+	bz, err := cdc.MarshalBinaryBare(dag)
+	require.NoError(t, err)
+	var dag2 cycleNode
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &dag2))
+	assert.Equal(t, "leaf", dag2.Children[1].Name)
+}
+
+func TestBigEndianFixedFields(t *testing.T) {
+	type legacyHeader struct {
+		Magic   uint32 `amino:"fixed32,bigendian"`
+		Offset  int64  `binary:"fixed64" amino:"bigendian"`
+		Version uint32 `binary:"fixed32"`
+		Flags   uint64
+	}
+	type legacyRecord struct {
+		Header legacyHeader
+		Name   string
+		Stamps []int32 `amino:"fixed32,bigendian"`
+	}
+
+	var cdc = amino.NewCodec()
+	h := legacyHeader{Magic: 0xCAFEBABE, Offset: -2, Version: 1, Flags: 1}
+	bz, err := cdc.MarshalBinaryBare(h)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x0d, 0xCA, 0xFE, 0xBA, 0xBE,
+		0x11, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE,
+		0x1d, 0x01, 0x00, 0x00, 0x00,
+		0x20, 0x01,
+	}, bz)
+	var h2 legacyHeader
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &h2))
+	assert.Equal(t, h, h2)
+
+	rec := legacyRecord{Header: h, Name: "log", Stamps: []int32{1, -1}}
+	bz, err = cdc.MarshalBinaryBare(rec)
+	require.NoError(t, err)
+	assert.Contains(t, string(bz), string([]byte{0x00, 0x00, 0x00, 0x01, 0xFF, 0xFF, 0xFF, 0xFF}))
+	var rec2 legacyRecord
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &rec2))
+	assert.Equal(t, rec, rec2)
+
+	err = cdc.UnmarshalBinaryBare([]byte{0x0d, 0xCA, 0xFE}, &h2)
+	assert.Error(t, err, "truncated")
+
+	// Only fixed-width fields can be big-endian.
+	type varintBigEndian struct {
+		Flags uint64 `amino:"bigendian"`
+	}
+	assert.Panics(t, func() { cdc.MarshalBinaryBare(varintBigEndian{}) }) // nolint: errcheck
+}
+
+type getFieldSigner struct {
+	Name string
+	Keys []string
+}
+
+type getFieldHeader struct {
+	Height   int64
+	Time     time.Time
+	Proposer *getFieldSigner
+}
+
+type getFieldBlock struct {
+	Header getFieldHeader
+	Txs    [][]byte
+	Note   string
+}
+
+func TestGetField(t *testing.T) {
+	var cdc = amino.NewCodec()
+	cdc.RegisterConcrete(getFieldBlock{}, "test/Block", nil)
+
+	now := time.Unix(1500000000, 0).UTC()
+	b := getFieldBlock{
+		Header: getFieldHeader{Height: 7, Time: now, Proposer: &getFieldSigner{"val", []string{"k1", "k2"}}},
+		Txs:    [][]byte{{0x01}, {0x02, 0x03}},
+	}
+	bz, err := cdc.MarshalBinaryBare(b)
+	require.NoError(t, err)
+
+	var height int64
+	require.NoError(t, cdc.GetField(bz, getFieldBlock{}, "Header.Height", &height))
+	assert.Equal(t, int64(7), height)
+	var tm time.Time
+	require.NoError(t, cdc.GetField(bz, (*getFieldBlock)(nil), "Header.Time", &tm))
+	assert.Equal(t, now, tm)
+	var keys []string
+	require.NoError(t, cdc.GetField(bz, getFieldBlock{}, "Header.Proposer.Keys", &keys))
+	assert.Equal(t, []string{"k1", "k2"}, keys)
+	var txs [][]byte
+	require.NoError(t, cdc.GetField(bz, getFieldBlock{}, "Txs", &txs))
+	assert.Equal(t, b.Txs, txs)
+
+	// Pointer fields can be read into pointers or values.
+	var proposer *getFieldSigner
+	require.NoError(t, cdc.GetField(bz, getFieldBlock{}, "Header.Proposer", &proposer))
+	assert.Equal(t, b.Header.Proposer, proposer)
+	var signer getFieldSigner
+	require.NoError(t, cdc.GetField(bz, getFieldBlock{}, "Header.Proposer", &signer))
+	assert.Equal(t, *b.Header.Proposer, signer)
+
+	// Empty fields aren't encoded, and neither are their subfields.
+	var note string
+	err = cdc.GetField(bz, getFieldBlock{}, "Note", &note)
+	assert.Equal(t, amino.ErrFieldNotFound, errors.Cause(err))
+	b.Header.Proposer = nil
+	bz, err = cdc.MarshalBinaryBare(b)
+	require.NoError(t, err)
+	err = cdc.GetField(bz, getFieldBlock{}, "Header.Proposer.Name", &note)
+	assert.Equal(t, amino.ErrFieldNotFound, errors.Cause(err))
+	assert.Contains(t, err.Error(), "Header.Proposer")
+
+	assert.Error(t, cdc.GetField(bz, getFieldBlock{}, "Header.Missing", &note), "unknown field")
+	assert.Error(t, cdc.GetField(bz, getFieldBlock{}, "Header.Height.X", &note), "not a struct")
+	assert.Error(t, cdc.GetField(bz, getFieldBlock{}, "Header.Height", &note), "wrong out type")
+	assert.Error(t, cdc.GetField(bz, getFieldBlock{}, "Header.Height", height), "not a pointer")
+	assert.Error(t, cdc.GetField(bz[4:], getFieldBlock{}, "Header.Height", &height), "no prefix")
+	assert.Error(t, cdc.GetField(bz, nil, "Header.Height", &height), "nil type")
+
+	// The version is skipped after the prefix bytes.
+	cdc = amino.NewCodec()
+	cdc.RegisterConcrete(getFieldBlock{}, "test/Block", &amino.ConcreteOptions{Version: 300})
+	bz, err = cdc.MarshalBinaryBare(b)
+	require.NoError(t, err)
+	height = 0
+	require.NoError(t, cdc.GetField(bz, getFieldBlock{}, "Header.Height", &height))
+	assert.Equal(t, int64(7), height)
+	bz[4] ^= 0x01
+	assert.Error(t, cdc.GetField(bz, getFieldBlock{}, "Header.Height", &height), "wrong version")
+}
+
+func TestMaxFieldNumber(t *testing.T) {
+	type record struct {
+		A int64
+		B string
+	}
+
+	cdc := amino.NewCodec()
+	bz, err := cdc.MarshalBinaryBare(record{A: 1, B: "b"})
+	require.NoError(t, err)
+
+	// Appends an unknown varint field with the given field number.
+	withField := func(num uint64) []byte {
+		buf := new(bytes.Buffer)
+		require.NoError(t, amino.EncodeUvarint(buf, num<<3|uint64(amino.Typ3Varint)))
+		require.NoError(t, amino.EncodeUvarint(buf, 7))
+		return append(append([]byte{}, bz...), buf.Bytes()...)
+	}
+
+	// Unknown fields are skipped up to the protobuf limit by default.
+	var r record
+	require.NoError(t, cdc.UnmarshalBinaryBare(withField(amino.MaxFieldNumber), &r))
+	assert.Equal(t, record{A: 1, B: "b"}, r)
+	err = cdc.UnmarshalBinaryBare(withField(math.MaxUint32-1), &r)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid field num 4294967294")
+	}
+
+	cdc.SetMaxFieldNumber(100)
+	require.NoError(t, cdc.UnmarshalBinaryBare(withField(100), &r))
+	err = cdc.UnmarshalBinaryBare(withField(101), &r)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "field number 101")
+		assert.Contains(t, err.Error(), "exceeds max field number 100")
+	}
+
+	cdc.SetMaxFieldNumber(0)
+	require.NoError(t, cdc.UnmarshalBinaryBare(withField(101), &r))
+	assert.Panics(t, func() { cdc.SetMaxFieldNumber(amino.MaxFieldNumber + 1) })
+}
+
+type nestedNode interface{}
+
+type nestedBox struct {
+	Inner nestedNode
+	Label string
+}
+
+func TestMaxInterfaceDepth(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*nestedNode)(nil), nil)
+	cdc.RegisterConcrete(nestedBox{}, "nested/box", nil)
+
+	// Four interface values, each holding a struct with the next one.
+	var box = nestedBox{Label: "leaf"}
+	for i := 0; i < 4; i++ {
+		box = nestedBox{Inner: box}
+	}
+	bz, err := cdc.MarshalBinaryBare(box)
+	require.NoError(t, err)
+	jbz, err := cdc.MarshalJSON(box)
+	require.NoError(t, err)
+
+	cdc.SetMaxInterfaceDepth(4)
+	var box2 nestedBox
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &box2))
+	assert.Equal(t, box, box2)
+	box2 = nestedBox{}
+	require.NoError(t, cdc.UnmarshalJSON(jbz, &box2))
+	assert.Equal(t, box, box2)
+
+	cdc.SetMaxInterfaceDepth(3)
+	err = cdc.UnmarshalBinaryBare(bz, &nestedBox{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exceeds the max interface depth of 3")
+	}
+	err = cdc.UnmarshalJSON(jbz, &nestedBox{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exceeds the max interface depth of 3")
+	}
+
+	// Only nesting counts, not the number of interface values.
+	wide := struct{ Boxes []nestedNode }{[]nestedNode{box2, box2, box2, box2}}
+	bz, err = cdc.MarshalBinaryBare(wide)
+	require.NoError(t, err)
+	cdc.SetMaxInterfaceDepth(5)
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &struct{ Boxes []nestedNode }{}))
+
+	cdc.SetMaxInterfaceDepth(0)
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &struct{ Boxes []nestedNode }{}))
+	assert.Panics(t, func() { cdc.SetMaxInterfaceDepth(-1) })
+}
+
+func TestComplexFields(t *testing.T) {
+	type signal struct {
+		Sample   complex128   `amino:"unsafe"`
+		Small    complex64    `amino:"unsafe"`
+		Spectrum []complex128 `amino:"unsafe"`
+	}
+	s := signal{
+		Sample:   complex(1.0/3, -math.Pi),
+		Small:    complex(float32(0.1), float32(-2.5e-8)),
+		Spectrum: []complex128{0, complex(math.MaxFloat64, math.SmallestNonzeroFloat64), 1i},
+	}
+
+	cdc := amino.NewCodec()
+	_, err := cdc.MarshalBinaryBare(s)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "SetAllowComplex")
+	}
+	_, err = cdc.MarshalJSON(s)
+	assert.Error(t, err)
+
+	cdc.SetAllowComplex(true)
+	bz, err := cdc.MarshalBinaryBare(s)
+	require.NoError(t, err)
+	var s2 signal
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &s2))
+	assert.Equal(t, s, s2)
+
+	bz, err = cdc.MarshalJSON(s)
+	require.NoError(t, err)
+	assert.Contains(t, string(bz), `"Small":{"real":0.1,"imag":-2.5e-8}`)
+	var s3 signal
+	require.NoError(t, cdc.UnmarshalJSON(bz, &s3))
+	assert.Equal(t, s, s3)
+
+	// Like floats, complex fields require `amino:"unsafe"`.
+	assert.Panics(t, func() {
+		cdc.MarshalBinaryBare(struct{ C complex128 }{1i}) // nolint: errcheck
+	})
+}
+
+func TestEqualBinaryIgnoring(t *testing.T) {
+	type sig struct {
+		PubKey    []byte
+		Signature []byte
+	}
+	type header struct {
+		Height int64
+		Time   time.Time
+	}
+	type signedMsg struct {
+		Header  *header
+		Payload string
+		Sigs    []sig
+	}
+
+	cdc := amino.NewCodec()
+	t1 := time.Unix(1000, 0).UTC()
+	a := signedMsg{
+		Header:  &header{Height: 1, Time: t1},
+		Payload: "transfer",
+		Sigs:    []sig{{[]byte{1}, []byte{0xAA}}, {[]byte{2}, []byte{0xBB}}},
+	}
+	b := signedMsg{
+		Header:  &header{Height: 1, Time: t1.Add(time.Hour)},
+		Payload: "transfer",
+		Sigs:    []sig{{[]byte{1}, []byte{0xCC}}, {[]byte{2}, []byte{0xDD}}},
+	}
+
+	eq, err := cdc.EqualBinaryIgnoring(a, b)
+	require.NoError(t, err)
+	assert.False(t, eq)
+	eq, err = cdc.EqualBinaryIgnoring(a, b, "Header.Time")
+	require.NoError(t, err)
+	assert.False(t, eq, "signatures still differ")
+	eq, err = cdc.EqualBinaryIgnoring(&a, &b, "Header.Time", "Sigs.Signature")
+	require.NoError(t, err)
+	assert.True(t, eq)
+
+	// Whole struct fields can be ignored too.
+	b.Header.Height = 2
+	eq, err = cdc.EqualBinaryIgnoring(a, b, "Header", "Sigs")
+	require.NoError(t, err)
+	assert.True(t, eq)
+	eq, err = cdc.EqualBinaryIgnoring(a, b, "Header.Time", "Sigs.Signature")
+	require.NoError(t, err)
+	assert.False(t, eq, "heights differ")
+
+	// The values themselves are untouched.
+	assert.Equal(t, t1, a.Header.Time)
+	assert.Equal(t, []byte{0xCC}, b.Sigs[0].Signature)
+
+	eq, err = cdc.EqualBinaryIgnoring(a, &b)
+	require.NoError(t, err)
+	assert.False(t, eq, "different types")
+	_, err = cdc.EqualBinaryIgnoring(a, b, "Header.Nonce")
+	assert.Error(t, err)
+	_, err = cdc.EqualBinaryIgnoring(a, b, "Payload.Length")
+	assert.Error(t, err)
+}
+
+func TestValidateUTF8Strings(t *testing.T) {
+	type profile struct {
+		Name string
+		Tags []string
+	}
+	bad := profile{Name: "ok", Tags: []string{"fine", "bad\xff"}}
+
+	cdc := amino.NewCodec()
+	bz, err := cdc.MarshalBinaryBare(bad)
+	require.NoError(t, err, "not validated by default")
+
+	cdc.SetValidateUTF8Strings(true)
+	_, err = cdc.MarshalBinaryBare(bad)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid UTF-8")
+		assert.Contains(t, err.Error(), "Tags")
+	}
+	var p profile
+	err = cdc.UnmarshalBinaryBare(bz, &p)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "invalid UTF-8")
+		assert.Contains(t, err.Error(), "Tags")
+	}
+
+	good := profile{Name: "héllo, 世界", Tags: []string{"🙂"}}
+	bz, err = cdc.MarshalBinaryBare(good)
+	require.NoError(t, err)
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &p))
+	assert.Equal(t, good, p)
+}
+
+func TestMapStructValues(t *testing.T) {
+	type endpoint struct {
+		Host string
+		Port uint16
+	}
+	type service struct {
+		Name      string
+		Endpoints []endpoint
+		Primary   *endpoint
+	}
+	type registry struct {
+		Services map[string]*service
+		Defaults map[string]service
+	}
+
+	cdc := amino.NewCodec()
+	cdc.SetAllowMaps(true)
+	r := registry{
+		Services: map[string]*service{
+			"api": {
+				Name:      "api",
+				Endpoints: []endpoint{{"a.local", 80}, {"b.local", 8080}},
+				Primary:   &endpoint{"a.local", 80},
+			},
+			"empty":    {},
+			"disabled": nil,
+		},
+		Defaults: map[string]service{
+			"db":   {Name: "db", Primary: &endpoint{Port: 5432}},
+			"none": {},
+		},
+	}
+	bz, err := cdc.MarshalBinaryBare(r)
+	require.NoError(t, err)
+	var r2 registry
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &r2))
+	assert.Equal(t, r, r2)
+	assert.Nil(t, r2.Services["disabled"])
+	assert.NotNil(t, r2.Services["empty"])
+
+	// Entries are ordered by key, regardless of insertion order.
+	for i := 0; i < 10; i++ {
+		bz2, err := cdc.MarshalBinaryBare(r)
+		require.NoError(t, err)
+		assert.Equal(t, bz, bz2)
+	}
+}
+
+func TestMarshalBinaryBareMasked(t *testing.T) {
+	type address struct {
+		Street string
+		City   string
+	}
+	type contact struct {
+		Email string
+		Phone string
+	}
+	type user struct {
+		ID       int64
+		Name     string
+		Address  *address
+		Contacts []contact
+	}
+
+	cdc := amino.NewCodec()
+	u := user{
+		ID:       7,
+		Name:     "ann",
+		Address:  &address{"Main St", "Springfield"},
+		Contacts: []contact{{"a@x", "123"}, {"b@x", "456"}},
+	}
+	bz, err := cdc.MarshalBinaryBareMasked(u, []string{"Name", "Address.City", "Contacts.Email"})
+	require.NoError(t, err)
+	var partial user
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &partial))
+	assert.Equal(t, user{
+		Name:     "ann",
+		Address:  &address{City: "Springfield"},
+		Contacts: []contact{{Email: "a@x"}, {Email: "b@x"}},
+	}, partial)
+
+	// A whole field includes its nested fields.
+	bz, err = cdc.MarshalBinaryBareMasked(&u, []string{"Address", "Address.City"})
+	require.NoError(t, err)
+	partial = user{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &partial))
+	assert.Equal(t, user{Address: u.Address}, partial)
+
+	// All fields give the full encoding, and u is untouched.
+	bz, err = cdc.MarshalBinaryBareMasked(u, []string{"ID", "Name", "Address", "Contacts"})
+	require.NoError(t, err)
+	assert.Equal(t, cdc.MustMarshalBinaryBare(u), bz)
+	assert.Equal(t, "Main St", u.Address.Street)
+	assert.Equal(t, "123", u.Contacts[0].Phone)
+
+	_, err = cdc.MarshalBinaryBareMasked(u, []string{"Address.Zip"})
+	assert.Error(t, err)
+	_, err = cdc.MarshalBinaryBareMasked(u, []string{""})
+	assert.Error(t, err)
+}
+
+func TestBufferAndReaderFields(t *testing.T) {
+	type message struct {
+		ID      uint64
+		Payload *bytes.Buffer
+		Body    io.Reader
+	}
+	type plain struct {
+		ID      uint64
+		Payload []byte
+		Body    []byte
+	}
+
+	cdc := amino.NewCodec()
+	msg := message{
+		ID:      7,
+		Payload: bytes.NewBufferString("payload"),
+		Body:    bytes.NewReader([]byte("body")),
+	}
+	// Only the unread bytes of the buffer are encoded.
+	msg.Payload.Next(3)
+	bz, err := cdc.MarshalBinaryBare(msg)
+	require.NoError(t, err)
+	assert.Equal(t, "load", msg.Payload.String(), "buffer should not be consumed")
+
+	expected, err := cdc.MarshalBinaryBare(plain{ID: 7, Payload: []byte("load"), Body: []byte("body")})
+	require.NoError(t, err)
+	assert.Equal(t, expected, bz, "should be encoded like byte slices")
+
+	// The reader was consumed by encoding.
+	bz2, err := cdc.MarshalBinaryBare(msg)
+	require.NoError(t, err)
+	assert.NotEqual(t, bz, bz2)
+
+	var msg2 message
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &msg2))
+	assert.Equal(t, uint64(7), msg2.ID)
+	assert.Equal(t, "load", msg2.Payload.String())
+	body, err := ioutil.ReadAll(msg2.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "body", string(body))
+
+	// Decoding resets an existing buffer.
+	msg3 := message{Payload: bytes.NewBufferString("stale")}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &msg3))
+	assert.Equal(t, "load", msg3.Payload.String())
+
+	// Nil fields are omitted.
+	bz, err = cdc.MarshalBinaryBare(message{ID: 7})
+	require.NoError(t, err)
+	expected, err = cdc.MarshalBinaryBare(plain{ID: 7})
+	require.NoError(t, err)
+	assert.Equal(t, expected, bz)
+
+	// JSON uses base64 strings, like byte slices.
+	msg = message{ID: 7, Payload: bytes.NewBufferString("load"), Body: bytes.NewReader([]byte("body"))}
+	js, err := cdc.MarshalJSON(msg)
+	require.NoError(t, err)
+	expected, err = cdc.MarshalJSON(plain{ID: 7, Payload: []byte("load"), Body: []byte("body")})
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(js))
+	var msg4 message
+	require.NoError(t, cdc.UnmarshalJSON(js, &msg4))
+	assert.Equal(t, "load", msg4.Payload.String())
+	body, err = ioutil.ReadAll(msg4.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "body", string(body))
+}
+
+func TestRejectNonMinimalVarints(t *testing.T) {
+	type record struct {
+		Num  uint64
+		Name string
+		Time time.Time
+	}
+
+	cases := []struct {
+		name string
+		bz   []byte
+	}{
+		{"padded value", []byte{0x08, 0x81, 0x00}},
+		{"padded value, two extra bytes", []byte{0x08, 0xac, 0x82, 0x00}},
+		{"padded field key", []byte{0x88, 0x00, 0x01}},
+		{"padded string length", []byte{0x12, 0x82, 0x00, 'h', 'i'}},
+		{"padded time seconds", []byte{0x1a, 0x03, 0x08, 0x81, 0x00}},
+		{"padded unknown field", []byte{0x08, 0x01, 0x20, 0x81, 0x00}},
+	}
+	for _, tc := range cases {
+		cdc := amino.NewCodec()
+		var r record
+		assert.NoError(t, cdc.UnmarshalBinaryBare(tc.bz, &r), "%v: accepted by default", tc.name)
+
+		cdc.SetRejectNonMinimalVarints(true)
+		err := cdc.UnmarshalBinaryBare(tc.bz, &r)
+		if assert.Error(t, err, tc.name) {
+			assert.Contains(t, err.Error(), "non-", tc.name)
+		}
+	}
+
+	cdc := amino.NewCodec()
+	cdc.SetRejectNonMinimalVarints(true)
+
+	// Minimal encodings, including of multi-byte varints, are accepted.
+	r := record{Num: 300, Name: "hi", Time: time.Unix(1, 0).UTC()}
+	bz, err := cdc.MarshalBinaryBare(r)
+	require.NoError(t, err)
+	var r2 record
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &r2))
+	assert.Equal(t, r, r2)
+
+	// So is the byte-length prefix.
+	bz, err = cdc.MarshalBinaryLengthPrefixed(r)
+	require.NoError(t, err)
+	require.NoError(t, cdc.UnmarshalBinaryLengthPrefixed(bz, &r2))
+	padded := append([]byte{bz[0] | 0x80, 0x00}, bz[1:]...)
+	err = cdc.UnmarshalBinaryLengthPrefixed(padded, &r2)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "non-minimal varint")
+	}
+	_, err = cdc.UnmarshalBinaryLengthPrefixedN(padded, &r2)
+	assert.Error(t, err)
+}
+
+func TestUnpackedLists(t *testing.T) {
+	type legacy struct {
+		IDs   []int64 `amino:"unpacked"`
+		Flags []bool  `amino:"unpacked"`
+		Name  string
+		Pair  [2]uint32 `amino:"unpacked,fixed32"`
+	}
+	type packed struct {
+		IDs   []int64
+		Flags []bool
+		Name  string
+		Pair  [2]uint32 `amino:"fixed32"`
+	}
+
+	cdc := amino.NewCodec()
+	l := legacy{IDs: []int64{1, 0, 300}, Flags: []bool{true}, Name: "x", Pair: [2]uint32{1, 2}}
+	p := packed{IDs: l.IDs, Flags: l.Flags, Name: l.Name, Pair: l.Pair}
+
+	lbz, err := cdc.MarshalBinaryBare(l)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x08, 0x01, 0x08, 0x00, 0x08, 0xac, 0x02, // IDs, one entry per element
+		0x10, 0x01, // Flags
+		0x1a, 0x01, 'x', // Name
+		0x25, 0x01, 0x00, 0x00, 0x00, 0x25, 0x02, 0x00, 0x00, 0x00, // Pair
+	}, lbz)
+	pbz, err := cdc.MarshalBinaryBare(p)
+	require.NoError(t, err)
+	assert.NotEqual(t, lbz, pbz)
+
+	// Either form decodes, whether the field is tagged or not.
+	var l2 legacy
+	require.NoError(t, cdc.UnmarshalBinaryBare(lbz, &l2))
+	assert.Equal(t, l, l2)
+	l2 = legacy{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(pbz, &l2))
+	assert.Equal(t, l, l2)
+	var p2 packed
+	require.NoError(t, cdc.UnmarshalBinaryBare(lbz, &p2))
+	assert.Equal(t, p, p2)
+
+	// Entries may even mix both forms.
+	mixed := []byte{0x08, 0x01, 0x0a, 0x02, 0x00, 0x05, 0x08, 0x07}
+	l2 = legacy{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(mixed, &l2))
+	assert.Equal(t, []int64{1, 0, 5, 7}, l2.IDs)
+	p2 = packed{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(mixed, &p2))
+	assert.Equal(t, []int64{1, 0, 5, 7}, p2.IDs)
+
+	// Arrays must still have the right number of elements.
+	err = cdc.UnmarshalBinaryBare([]byte{0x25, 0x01, 0x00, 0x00, 0x00}, &l2)
+	assert.Error(t, err)
+
+	type badTag struct {
+		Name string `amino:"unpacked"`
+	}
+	assert.Panics(t, func() { _, _ = cdc.MarshalBinaryBare(badTag{}) })
+}
+
+func TestUnmarshalProto(t *testing.T) {
+	type transfer struct {
+		From   string
+		Amount int64
+		IDs    []uint32
+		Time   time.Time
+	}
+
+	cdc := amino.NewCodec()
+	cdc.RegisterConcrete(transfer{}, "bank/Transfer", nil)
+
+	// As encoded by a protobuf library for:
+	// message Transfer {
+	//   string from = 1;
+	//   int64 amount = 2;
+	//   repeated uint32 ids = 3;
+	//   google.protobuf.Timestamp time = 4;
+	//   uint64 fee = 5; // unknown to transfer
+	// }
+	bz := []byte{
+		0x0a, 0x05, 'a', 'l', 'i', 'c', 'e',
+		0x10, 0xf6, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01,
+		0x1a, 0x02, 0x01, 0x02,
+		0x22, 0x02, 0x08, 0x01,
+		0x28, 0x07,
+	}
+	expected := transfer{From: "alice", Amount: -10, IDs: []uint32{1, 2}, Time: time.Unix(1, 0).UTC()}
+
+	var tr transfer
+	assert.Error(t, cdc.UnmarshalBinaryBare(bz, &tr), "expects prefix bytes")
+	require.NoError(t, cdc.UnmarshalProto(bz, &tr))
+	assert.Equal(t, expected, tr)
+
+	// Repeated scalars may be unpacked too.
+	bz = []byte{0x0a, 0x05, 'a', 'l', 'i', 'c', 'e', 0x18, 0x01, 0x18, 0x02}
+	tr = transfer{}
+	require.NoError(t, cdc.UnmarshalProto(bz, &tr))
+	assert.Equal(t, transfer{From: "alice", IDs: []uint32{1, 2}, Time: time.Unix(0, 0).UTC()}, tr)
+
+	// Amino:binary without the prefix bytes is the same.
+	abz, err := cdc.MarshalBinaryBare(expected)
+	require.NoError(t, err)
+	tr = transfer{}
+	require.NoError(t, cdc.UnmarshalProto(abz[4:], &tr))
+	assert.Equal(t, expected, tr)
+}
+
+func TestWriteEmptyStringPointers(t *testing.T) {
+	type patch struct {
+		Name *string
+		Note *string
+		Rank int64
+	}
+	empty, x := "", "x"
+	cases := []patch{
+		{},
+		{Name: &empty},
+		{Name: &x},
+		{Name: &empty, Note: &x, Rank: 1},
+		{Note: &empty, Rank: 1},
+	}
+
+	// By default, pointers to "" are omitted like nil pointers.
+	cdc := amino.NewCodec()
+	bz, err := cdc.MarshalBinaryBare(patch{Name: &empty})
+	require.NoError(t, err)
+	assert.Empty(t, bz)
+
+	cdc.SetWriteEmptyStringPointers(true)
+	bz, err = cdc.MarshalBinaryBare(patch{Name: &empty})
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x0A, 0x00}, bz)
+
+	for _, p := range cases {
+		bz, err := cdc.MarshalBinaryBare(p)
+		require.NoError(t, err)
+		var p2 patch
+		require.NoError(t, cdc.UnmarshalBinaryBare(bz, &p2))
+		assert.Equal(t, p, p2, "%X", bz)
+		// assert.Equal doesn't tell nil from &"".
+		assert.Equal(t, p.Name == nil, p2.Name == nil, "%X", bz)
+		assert.Equal(t, p.Note == nil, p2.Note == nil, "%X", bz)
+
+		js, err := cdc.MarshalJSON(p)
+		require.NoError(t, err)
+		var p3 patch
+		require.NoError(t, cdc.UnmarshalJSON(js, &p3))
+		assert.Equal(t, p.Name == nil, p3.Name == nil, "%s", js)
+		assert.Equal(t, p.Note == nil, p3.Note == nil, "%s", js)
+	}
+}
+
+type sortedSet struct {
+	Names   []string      `amino:"sorted"`
+	Heights []int64       `amino:"sorted"`
+	Items   []*walletItem `amino:"sorted"`
+	Ports   [3]uint16     `amino:"sorted,unpacked"`
+	Order   []string
+}
+
+type walletItem struct {
+	Denom  string
+	Amount int64
+}
+
+func TestSortedLists(t *testing.T) {
+	cdc := amino.NewCodec()
+	a := sortedSet{
+		Names:   []string{"carol", "alice", "bob"},
+		Heights: []int64{300, 1, 20},
+		Items:   []*walletItem{{"btc", 2}, nil, {"atom", 5}},
+		Ports:   [3]uint16{443, 80, 8080},
+		Order:   []string{"z", "a"},
+	}
+	b := sortedSet{
+		Names:   []string{"bob", "carol", "alice"},
+		Heights: []int64{20, 300, 1},
+		Items:   []*walletItem{{"atom", 5}, {"btc", 2}, nil},
+		Ports:   [3]uint16{8080, 443, 80},
+		Order:   []string{"z", "a"},
+	}
+	bza, err := cdc.MarshalBinaryBare(a)
+	require.NoError(t, err)
+	bzb, err := cdc.MarshalBinaryBare(b)
+	require.NoError(t, err)
+	assert.Equal(t, bza, bzb, "differently ordered sets encode the same")
+	assert.Equal(t, []string{"carol", "alice", "bob"}, a.Names, "not modified")
+
+	// Untagged lists keep their order.
+	b.Order = []string{"a", "z"}
+	bzb, err = cdc.MarshalBinaryBare(b)
+	require.NoError(t, err)
+	assert.NotEqual(t, bza, bzb)
+
+	// Decoding keeps the encoded order by default, where shorter strings
+	// come first.
+	var got sortedSet
+	require.NoError(t, cdc.UnmarshalBinaryBare(bza, &got))
+	assert.Equal(t, []string{"bob", "alice", "carol"}, got.Names)
+	assert.Equal(t, []int64{1, 20, 300}, got.Heights)
+	assert.Equal(t, []*walletItem{nil, {"btc", 2}, {"atom", 5}}, got.Items)
+	assert.Equal(t, []string{"z", "a"}, got.Order)
+
+	// An unsorted input (e.g. from another encoder) is kept as is, unless
+	// decoded lists are sorted.
+	unsorted, err := amino.NewCodec().MarshalBinaryBare(struct{ Names []string }{[]string{"b", "c", "a"}})
+	require.NoError(t, err)
+	got = sortedSet{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(unsorted, &got))
+	assert.Equal(t, []string{"b", "c", "a"}, got.Names)
+
+	cdc.SetSortDecodedLists(true)
+	got = sortedSet{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(unsorted, &got))
+	assert.Equal(t, []string{"a", "b", "c"}, got.Names)
+	var gota, gotb sortedSet
+	require.NoError(t, cdc.UnmarshalBinaryBare(bza, &gota))
+	require.NoError(t, cdc.UnmarshalBinaryBare(bzb, &gotb))
+	gotb.Order = gota.Order
+	assert.Equal(t, gota, gotb)
+	bz, err := cdc.MarshalBinaryBare(gota)
+	require.NoError(t, err)
+	assert.Equal(t, bza, bz)
+
+	assert.Panics(t, func() {
+		cdc.MarshalBinaryBare(struct { // nolint: errcheck
+			Raw []byte `amino:"sorted"`
+		}{})
+	})
+}
+
+type timedEvent struct {
+	At    time.Time
+	Until *time.Time
+}
+
+func TestSetTimeEpoch(t *testing.T) {
+	epoch := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	recent := time.Date(2020, 1, 1, 0, 1, 40, 0, time.UTC)
+	until := time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)
+	ev := timedEvent{At: recent, Until: &until}
+
+	cdc := amino.NewCodec()
+	bz, err := cdc.MarshalBinaryBare(ev)
+	require.NoError(t, err)
+
+	ecdc := amino.NewCodec()
+	ecdc.SetTimeEpoch(epoch)
+	ebz, err := ecdc.MarshalBinaryBare(ev)
+	require.NoError(t, err)
+	assert.True(t, len(ebz) < len(bz), "%X vs %X", ebz, bz)
+
+	for _, tm := range []time.Time{recent, until, epoch, time.Unix(0, 0).UTC(),
+		time.Date(2019, 12, 31, 23, 59, 59, 999999999, time.UTC),
+		time.Date(100, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(9999, 12, 31, 23, 59, 59, 999999999, time.UTC)} {
+		ev := timedEvent{At: tm, Until: &tm}
+		ebz, err := ecdc.MarshalBinaryBare(ev)
+		require.NoError(t, err, "%v", tm)
+		var ev2 timedEvent
+		require.NoError(t, ecdc.UnmarshalBinaryBare(ebz, &ev2), "%v", tm)
+		assert.Equal(t, ev, ev2)
+
+		// Codecs without the epoch decode a time off by the epoch.
+		var ev3 timedEvent
+		require.NoError(t, cdc.UnmarshalBinaryBare(ebz, &ev3), "%v", tm)
+		assert.Equal(t, tm.Sub(epoch), ev3.At.Sub(time.Unix(0, 0)))
+	}
+
+	// The epoch itself encodes as no bytes, like the Unix epoch by default,
+	// and is the default of absent times.
+	ebz, err = ecdc.MarshalBinaryBare(timedEvent{At: epoch})
+	require.NoError(t, err)
+	assert.Empty(t, ebz)
+	var ev4 timedEvent
+	require.NoError(t, ecdc.UnmarshalBinaryBare(ebz, &ev4))
+	assert.Equal(t, epoch, ev4.At)
+
+	// Epochs may have nanoseconds.
+	ecdc.SetTimeEpoch(epoch.Add(500))
+	for _, tm := range []time.Time{recent, epoch, epoch.Add(499), epoch.Add(501)} {
+		ebz, err := ecdc.MarshalBinaryBare(timedEvent{At: tm})
+		require.NoError(t, err)
+		var ev2 timedEvent
+		require.NoError(t, ecdc.UnmarshalBinaryBare(ebz, &ev2))
+		assert.Equal(t, tm, ev2.At)
+	}
+
+	// Canonical checks use the epoch too.
+	ecdc.SetRejectNonMinimalVarints(true)
+	ebz, err = ecdc.MarshalBinaryBare(ev)
+	require.NoError(t, err)
+	var ev2 timedEvent
+	require.NoError(t, ecdc.UnmarshalBinaryBare(ebz, &ev2))
+	assert.Equal(t, ev, ev2)
+
+	_, err = ecdc.MarshalBinaryBare(time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Error(t, err)
+
+	// A zero epoch restores the Unix epoch.
+	ecdc.SetTimeEpoch(time.Time{})
+	ebz, err = ecdc.MarshalBinaryBare(ev)
+	require.NoError(t, err)
+	assert.Equal(t, bz, ebz)
+}
+
+type auditLogin struct {
+	User     string
+	Password string
+	Token    *string
+	Attempt  auditCounter
+}
+
+type auditCounter struct {
+	Count int64
+	Max   int64
+}
+
+func TestSetFieldEncodeHook(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterConcrete(auditLogin{}, "test/Login", nil)
+	token := "t0k3n"
+	login := auditLogin{User: "alice", Password: "hunter2", Token: &token, Attempt: auditCounter{1, 3}}
+
+	var seen []string
+	cdc.SetFieldEncodeHook(func(typeName, fieldName string, v interface{}) interface{} {
+		seen = append(seen, typeName+"."+fieldName)
+		switch fieldName {
+		case "Password":
+			return "***"
+		case "Token":
+			return nil
+		case "Max":
+			return v.(int64) * 10
+		}
+		return v
+	})
+	bz, err := cdc.MarshalBinaryBare(login)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"test/Login.User", "test/Login.Password", "test/Login.Token", "test/Login.Attempt",
+		"amino_test.auditCounter.Count", "amino_test.auditCounter.Max"}, seen)
+	assert.Equal(t, "hunter2", login.Password, "not modified")
+
+	var got auditLogin
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &got))
+	assert.Equal(t, auditLogin{User: "alice", Password: "***", Attempt: auditCounter{1, 30}}, got)
+
+	// Amino:JSON is unaffected.
+	js, err := cdc.MarshalJSON(login)
+	require.NoError(t, err)
+	assert.Contains(t, string(js), "hunter2")
+
+	// Replacements must be of the field's type.
+	cdc.SetFieldEncodeHook(func(typeName, fieldName string, v interface{}) interface{} {
+		if fieldName == "Max" {
+			return "many"
+		}
+		return v
+	})
+	_, err = cdc.MarshalBinaryBare(login)
+	assert.Error(t, err)
+
+	cdc.SetFieldEncodeHook(nil)
+	bz, err = cdc.MarshalBinaryBare(login)
+	require.NoError(t, err)
+	got = auditLogin{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &got))
+	assert.Equal(t, login, got)
+}
+
+func TestSetNormalizeStrings(t *testing.T) {
+	type account struct {
+		Name  string
+		Tags  []string
+		Alias *string
+	}
+	// A stand-in for norm.NFC.String, composing just "é" into "é".
+	var calls int
+	nfc := func(s string) string {
+		calls++
+		return strings.Replace(s, "é", "é", -1)
+	}
+	decomposed := "café"
+	acc := account{Name: decomposed, Tags: []string{"x", decomposed}, Alias: &decomposed}
+	composed := "café"
+	want := account{Name: composed, Tags: []string{"x", composed}, Alias: &composed}
+
+	cdc := amino.NewCodec()
+	bz, err := cdc.MarshalBinaryBare(acc)
+	require.NoError(t, err)
+
+	// Decoding normalizes, encoding doesn't by default.
+	cdc.SetNormalizeStrings(nfc)
+	bz2, err := cdc.MarshalBinaryBare(acc)
+	require.NoError(t, err)
+	assert.Equal(t, bz, bz2)
+	assert.Zero(t, calls)
+	var acc2 account
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &acc2))
+	assert.Equal(t, want, acc2)
+	assert.Equal(t, 4, calls)
+
+	// Encoding may normalize too.
+	cdc.SetNormalizeEncodedStrings(true)
+	bz2, err = cdc.MarshalBinaryBare(acc)
+	require.NoError(t, err)
+	bz3, err := cdc.MarshalBinaryBare(want)
+	require.NoError(t, err)
+	assert.Equal(t, bz3, bz2)
+	assert.Equal(t, decomposed, acc.Name)
+
+	// Including interned strings.
+	bz, err = cdc.MarshalBinaryBareInterned(acc)
+	require.NoError(t, err)
+	cdc.SetNormalizeEncodedStrings(false)
+	bz2, err = cdc.MarshalBinaryBareInterned(want)
+	require.NoError(t, err)
+	assert.Equal(t, bz2, bz)
+	acc2 = account{}
+	require.NoError(t, cdc.UnmarshalBinaryBareInterned(bz, &acc2))
+	assert.Equal(t, want, acc2)
+
+	// Amino:JSON is unaffected.
+	js, err := cdc.MarshalJSON(acc)
+	require.NoError(t, err)
+	acc2 = account{}
+	require.NoError(t, cdc.UnmarshalJSON(js, &acc2))
+	assert.Equal(t, acc, acc2)
+}
@@ -0,0 +1,58 @@
+package amino
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+//----------------------------------------
+// bytes.Buffer and io.Reader
+
+// bytes.Buffer values are encoded as byte strings of their unread bytes, and
+// io.Reader values as byte strings of everything read from them.  NOTE:
+// Encoding an io.Reader consumes it, so encoding the same value twice (or
+// after it was read elsewhere) gives different bytes.  Decoding sets an
+// io.Reader to a *bytes.Reader over the decoded bytes.
+
+var (
+	bufferType   = reflect.TypeOf(bytes.Buffer{})
+	ioReaderType = reflect.TypeOf(new(io.Reader)).Elem()
+)
+
+// Returns the unread bytes of the bytes.Buffer rv, without consuming them.
+func bufferBytes(rv reflect.Value) []byte {
+	if rv.CanAddr() {
+		return rv.Addr().Interface().(*bytes.Buffer).Bytes()
+	}
+	b := rv.Interface().(bytes.Buffer)
+	return b.Bytes()
+}
+
+// Sets the bytes.Buffer rv to hold a copy of bz.
+// CONTRACT: rv.CanAddr() is true.
+func setBufferBytes(rv reflect.Value, bz []byte) {
+	b := rv.Addr().Interface().(*bytes.Buffer)
+	b.Reset()
+	b.Write(bz)
+}
+
+// Reads all the bytes from the io.Reader rv, which may be nil.
+func readerBytes(rv reflect.Value) ([]byte, error) {
+	if rv.IsNil() {
+		return nil, nil
+	}
+	bz, err := ioutil.ReadAll(rv.Interface().(io.Reader))
+	if err != nil {
+		return nil, errors.Wrap(err, "cannot read io.Reader")
+	}
+	return bz, nil
+}
+
+// Sets the io.Reader rv to a *bytes.Reader over a copy of bz.
+func setReaderBytes(rv reflect.Value, bz []byte) {
+	rv.Set(reflect.ValueOf(bytes.NewReader(append([]byte(nil), bz...))))
+}
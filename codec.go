@@ -4,10 +4,15 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"fmt"
+	"hash"
+	"hash/crc32"
 	"io"
 	"reflect"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 	"unicode"
 
 	"github.com/pkg/errors"
@@ -63,8 +68,9 @@ type TypeInfo struct {
 }
 
 type InterfaceInfo struct {
-	Priority     []DisfixBytes               // Disfix priority.
-	Implementers map[PrefixBytes][]*TypeInfo // Mutated over time.
+	Priority      []DisfixBytes               // Disfix priority.
+	Implementers  map[PrefixBytes][]*TypeInfo // Mutated over time.
+	OneofVariants []*TypeInfo                 // If registered with RegisterOneof, by field number - 1.
 	InterfaceOptions
 }
 
@@ -84,6 +90,12 @@ type ConcreteInfo struct {
 	Prefix          PrefixBytes // Prefix bytes derived from name.
 	ConcreteOptions             // Registration options.
 
+	// Set iff registered with RegisterConcreteFactory.
+	factory func() interface{}
+
+	// Set iff registered with RegisterConcreteWithID, never zero.
+	CompactID uint64
+
 	// These fields get set for all concrete types,
 	// even those not manually registered (e.g. are never interface values).
 	IsAminoMarshaler       bool         // Implements MarshalAmino() (<ReprObject>, error).
@@ -94,6 +106,43 @@ type ConcreteInfo struct {
 
 type StructInfo struct {
 	Fields []FieldInfo // If a struct.
+
+	// Set iff every field is a fixed-width integer or bool,
+	// in which case the struct is encoded by encodeReflectBinaryFixedStruct.
+	fixedWidth bool
+	fieldKeys  [][]byte // Precomputed field number and typ3 bytes.
+
+	// Set iff ConcreteOptions.FieldOrder is, in which case positions[fnum-1]
+	// is the index in Fields of the field with BinFieldNum fnum.
+	positions []int
+}
+
+// Returns the position of field number fnum in the encoding, for checking
+// the order of fields while decoding.  Unknown field numbers come last.
+func (sinfo StructInfo) fieldPosition(fnum uint32) uint32 {
+	if sinfo.positions == nil || fnum == 0 || int(fnum) > len(sinfo.positions) {
+		return fnum
+	}
+	return uint32(sinfo.positions[fnum-1]) + 1
+}
+
+// Returns the field with field number fnum, which must be in the range
+// [1, len(sinfo.Fields)].
+func (sinfo StructInfo) fieldByNum(fnum uint32) FieldInfo {
+	if sinfo.positions == nil {
+		return sinfo.Fields[fnum-1]
+	}
+	return sinfo.Fields[sinfo.positions[fnum-1]]
+}
+
+// Returns the field with the Go name name.
+func (sinfo StructInfo) fieldByName(name string) (field FieldInfo, ok bool) {
+	for _, field := range sinfo.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return FieldInfo{}, false
 }
 
 func (cinfo ConcreteInfo) GetDisfix() DisfixBytes {
@@ -101,6 +150,67 @@ func (cinfo ConcreteInfo) GetDisfix() DisfixBytes {
 }
 
 type ConcreteOptions struct {
+	// If set, struct fields are encoded in this order rather than in
+	// declaration order, e.g. to match a foreign layout.  Field numbers
+	// still follow declaration order.  Must list the name of each exported
+	// field (that isn't skipped with `json:"-"`) exactly once.
+	FieldOrder []string
+
+	// If true, the disambiguation bytes are never written before the prefix
+	// bytes when encoding this type as an interface, even with
+	// InterfaceOptions.AlwaysDisambiguate, saving 4 bytes.  Decoding then
+	// relies on the prefix bytes alone, so registration panics if another
+	// implementation of the same interface shares the prefix bytes.  Beware
+	// that the prefix may still collide with types registered later, or by
+	// other codecs decoding the same data.  Encodings with disambiguation
+	// bytes can still be decoded.
+	NoDisamb bool
+
+	// A human-readable description of the type for tooling, e.g. the Notes
+	// column of PrintTypes and the description in Schema.  It doesn't affect
+	// the encoding.
+	Description string
+
+	// If true, this struct is encoded in Amino:JSON as an array of its field
+	// values in field number order, rather than as an object, e.g. [1,"a"]
+	// instead of {"id":1,"name":"a"}.  Every field is written, even with
+	// omitempty.  When decoding, missing trailing values are set to their
+	// defaults and extra ones are ignored, so fields may be added last, but
+	// never removed or reordered, unlike with objects.  Amino:binary is
+	// unaffected.
+	JSONArray bool
+
+	// If nonzero, this type is the given version of the registered name,
+	// and other Go types may be registered under the same name as other
+	// versions, e.g. V1 and V2 of a message with different layouts.  The
+	// version is encoded after the prefix bytes (as a uvarint), or as
+	// "version" in the Amino:JSON type wrapper, and decoding an interface
+	// value picks the Go type of the encoded version.  A value is encoded
+	// with the version of its Go type, so encoding with an older version
+	// just takes a value of the older type.  Versions of a name may not be
+	// mixed with an unversioned registration.
+	Version uint32
+
+	// If set, called with every decoded value of this type, wherever it
+	// appears (e.g. in an interface, slice or struct field), after it's
+	// fully decoded from Amino:binary or Amino:JSON.  The value is a pointer
+	// if the type was registered as a pointer, like when decoded into an
+	// interface.  An error fails the decoding, wrapping the error.
+	Validate func(interface{}) error
+
+	// If set, tells whether two values of this type are equal, instead of
+	// comparing their encodings, in EqualBinary, EqualBinaryIgnoring and
+	// DedupBinary, e.g. for a type with several encodings of the same
+	// value, like normalized and non-normalized forms.  It's called with the
+	// values as given (both of this type, or both pointers to it), and only
+	// for top-level values, not for fields of other types.
+	Equal func(a, b interface{}) bool
+
+	// If true, encoding a value of this type (in Amino:binary or Amino:JSON)
+	// logs a warning with the logger set by SetWarnLogger, once per type, to
+	// track down the remaining producers of a legacy type before removing
+	// it.  It's still encoded as usual, and decoding is unaffected.
+	Deprecated bool
 }
 
 type FieldInfo struct {
@@ -108,7 +218,7 @@ type FieldInfo struct {
 	Type         reflect.Type  // Struct field type
 	Index        int           // Struct field index
 	ZeroValue    reflect.Value // Could be nil pointer unlike TypeInfo.ZeroValue.
-	UnpackedList bool          // True iff this field should be encoded as an unpacked list.
+	UnpackedList bool          // True iff this field should be encoded as an unpacked list (or map).
 	FieldOptions               // Encoding options
 }
 
@@ -117,13 +227,37 @@ type FieldOptions struct {
 	JSONOmitEmpty bool   // (JSON) omitempty
 	BinFixed64    bool   // (Binary) Encode as fixed64
 	BinFixed32    bool   // (Binary) Encode as fixed32
+	BinBigEndian  bool   // (Binary) Encode fixed32 and fixed64 as big-endian
+	BinUnpacked   bool   // (Binary) Encode a list of scalars as repeated fields, not packed
+	BinSorted     bool   // (Binary) Encode list elements in order of their encodings
 	BinFieldNum   uint32 // (Binary) max 1<<29-1
 
 	Unsafe        bool // e.g. if this field is a float.
 	WriteEmpty    bool // write empty structs and lists (default false except for pointers)
 	EmptyElements bool // Slice and Array elements are never nil, decode 0x00 as empty struct.
+	DrainChan     bool // Encode a chan as a list by draining it, see Codec.SetDrainChannels.
+
+	Validators []FieldValidator // Checked after decoding, e.g. `amino:"min=1"`.
+	Comment    string           // See Codec.SetJSONComments.
+
+	JSONAliases []string // Names also accepted when decoding JSON, e.g. `amino:"jsonaliases=ts;time"`.
 }
 
+// JSONNonFiniteFloats determines how NaN and ±Inf float values (which
+// require `amino:"unsafe"`) are encoded in Amino:JSON, which has no
+// representation for them.  Amino:binary always uses the IEEE 754 bit pattern.
+type JSONNonFiniteFloats uint8
+
+const (
+	// Encoding NaN or ±Inf fails.  This is the default.
+	JSONNonFiniteError JSONNonFiniteFloats = iota
+	// NaN and ±Inf are encoded as the strings "NaN", "Infinity" and
+	// "-Infinity", which are accepted when decoding as well.
+	JSONNonFiniteString
+	// NaN and ±Inf are encoded as null, which decodes as zero.
+	JSONNonFiniteNull
+)
+
 //----------------------------------------
 // Codec
 
@@ -135,6 +269,42 @@ type Codec struct {
 	concreteInfos    []*TypeInfo
 	disfixToTypeInfo map[DisfixBytes]*TypeInfo
 	nameToTypeInfo   map[string]*TypeInfo
+	versions         map[string][]*TypeInfo // Name -> versions, in ascending order.
+	idToTypeInfo     map[uint64]*TypeInfo   // See RegisterConcreteWithID.
+
+	unregisteredHandler func(rt reflect.Type) error
+	allowMaps           bool
+	allowComplex        bool
+	drainChannels       bool
+	strictTypes         bool
+	jsonNonFiniteFloats JSONNonFiniteFloats
+	namespacedNames     bool
+	unknownFieldHook    func(typeName string, fieldNum uint32, wireType byte, raw []byte)
+	validators          map[string]Validator
+	maxDecodeAlloc      int
+	maxSliceLen         int
+	maxFieldNum         uint32
+	maxIfaceDepth       int
+	jsonComments        bool
+	enums               map[reflect.Type]*enumInfo
+	maxEncodeSize       int
+	rejectDupJSONKeys   bool
+	validateUTF8        bool
+	bareJSON            bool
+	rejectNonMinVarints bool
+	emptyStringPtrs     bool
+	jsonFieldNameFunc   func(goName string) string
+	bufferPool          *sync.Pool
+	warnLogger          func(string)
+	checksumHash        func() hash.Hash
+	sortDecodedLists    bool
+	timeEpoch           time.Time
+	fieldEncodeHook     func(typeName, fieldName string, v interface{}) interface{}
+	deprecatedWarned    map[reflect.Type]bool
+	compactIDs          bool
+	normalizeString     func(string) string
+	normalizeOnEncode   bool
+	maxDecompressedSize int
 }
 
 func NewCodec() *Codec {
@@ -143,6 +313,16 @@ func NewCodec() *Codec {
 		typeInfos:        make(map[reflect.Type]*TypeInfo),
 		disfixToTypeInfo: make(map[DisfixBytes]*TypeInfo),
 		nameToTypeInfo:   make(map[string]*TypeInfo),
+		versions:         make(map[string][]*TypeInfo),
+		idToTypeInfo:     make(map[uint64]*TypeInfo),
+		validators:       make(map[string]Validator, len(defaultValidators)),
+		enums:            make(map[reflect.Type]*enumInfo, len(defaultEnums)),
+	}
+	for name, validator := range defaultValidators {
+		cdc.validators[name] = validator
+	}
+	for rt, enum := range defaultEnums {
+		cdc.enums[rt] = enum
 	}
 	return cdc
 }
@@ -154,108 +334,977 @@ func NewCodec() *Codec {
 func (cdc *Codec) RegisterInterface(ptr interface{}, iopts *InterfaceOptions) {
 	cdc.assertNotSealed()
 
-	// Get reflect.Type from ptr.
-	rt := getTypeFromPointer(ptr)
-	if rt.Kind() != reflect.Interface {
-		panic(fmt.Sprintf("RegisterInterface expects an interface, got %v", rt))
-	}
+	// Get reflect.Type from ptr.
+	rt := getTypeFromPointer(ptr)
+	if rt.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("RegisterInterface expects an interface, got %v", rt))
+	}
+
+	// Construct InterfaceInfo
+	var info = cdc.newTypeInfoFromInterfaceType(rt, iopts)
+
+	// Finally, check conflicts and register.
+	func() {
+		cdc.mtx.Lock()
+		defer cdc.mtx.Unlock()
+
+		cdc.collectImplementersNolock(info)
+		err := cdc.checkConflictsInPrioNolock(info)
+		if err != nil {
+			panic(err)
+		}
+		cdc.setTypeInfoNolock(info)
+	}()
+	/*
+		NOTE: The above func block is a defensive pattern.
+
+		First of all, the defer call is necessary to recover from panics,
+		otherwise the Codec would become unusable after a single panic.
+
+		This “defer-panic-unlock” pattern requires a func block to denote the
+		boundary outside of which the defer call is guaranteed to have been
+		called.  In other words, using any other form of curly braces (e.g.  in
+		the form of a conditional or looping block) won't actually unlock when
+		it might appear to visually.  Consider:
+
+		```
+		var info = ...
+		{
+			cdc.mtx.Lock()
+			defer cdc.mtx.Unlock()
+
+			...
+		}
+		// Here, cdc.mtx.Unlock() hasn't been called yet.
+		```
+
+		So, while the above code could be simplified, it's there for defense.
+	*/
+}
+
+// RegisterOneof registers an interface like RegisterInterface, but its values
+// are encoded in binary like a Proto3 oneof, rather than with prefix bytes.
+// The variants are registered concrete types implementing the interface,
+// which get field numbers 1, 2, 3... in the given order.  An interface value
+// is encoded as a message with just the field of its concrete type, which is
+// more compact than prefix bytes.  JSON encoding is unaffected.
+//
+// For interop, declare the interface as a message with a oneof of the
+// variants, numbered in the same order:
+//
+//	message Shape {
+//	    oneof sum {
+//	        Square square = 1;
+//	        Circle circle = 2;
+//	    }
+//	}
+//
+// Since variants are identified by field number, changing the order of the
+// variants breaks compatibility, while appending new ones is fine.
+// Usage:
+// `amino.RegisterConcrete(Square{}, "com.tendermint/Square", nil)`
+// `amino.RegisterConcrete(Circle{}, "com.tendermint/Circle", nil)`
+// `amino.RegisterOneof((*Shape)(nil), Square{}, Circle{})`
+func (cdc *Codec) RegisterOneof(ptr interface{}, variants ...interface{}) {
+	cdc.assertNotSealed()
+
+	// Get reflect.Type from ptr.
+	rt := getTypeFromPointer(ptr)
+	if rt.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("RegisterOneof expects an interface, got %v", rt))
+	}
+	if len(variants) == 0 {
+		panic(fmt.Sprintf("RegisterOneof expects at least one variant for %v", rt))
+	}
+
+	// Construct InterfaceInfo
+	var info = cdc.newTypeInfoFromInterfaceType(rt, nil)
+
+	// Finally, check variants and register.
+	func() {
+		cdc.mtx.Lock()
+		defer cdc.mtx.Unlock()
+
+		for _, o := range variants {
+			crt := reflect.TypeOf(o)
+			if crt.Kind() == reflect.Ptr {
+				crt = crt.Elem()
+			}
+			cinfo, ok := cdc.typeInfos[crt]
+			if !ok || !cinfo.Registered {
+				panic(fmt.Sprintf("oneof variant %v of %v must be registered with RegisterConcrete first", crt, rt))
+			}
+			if !cinfo.PtrToType.Implements(rt) {
+				panic(fmt.Sprintf("oneof variant %v does not implement %v", crt, rt))
+			}
+			for _, other := range info.OneofVariants {
+				if other == cinfo {
+					panic(fmt.Sprintf("duplicate oneof variant %v of %v", crt, rt))
+				}
+			}
+			info.OneofVariants = append(info.OneofVariants, cinfo)
+		}
+		cdc.collectImplementersNolock(info)
+		cdc.setTypeInfoNolock(info)
+	}()
+}
+
+// This function should be used to register concrete types that will appear in
+// interface fields/elements to be encoded/decoded by go-amino.
+// A type may be registered more than once under different names, e.g. for
+// distinct messages sharing a Go type.  Interface values are decoded as the
+// registration named by their prefix bytes, but are encoded with the first
+// registration; use MarshalBinaryBareAs or MarshalJSONAs to encode with
+// another one.
+// Usage:
+// `amino.RegisterConcrete(MyStruct1{}, "com.tendermint/MyStruct1", nil)`
+func (cdc *Codec) RegisterConcrete(o interface{}, name string, copts *ConcreteOptions) {
+	cdc.registerConcrete(reflect.TypeOf(o), name, copts, nil, 0)
+}
+
+// RegisterConcreteWithID is like RegisterConcrete, but also assigns id to the
+// concrete type, to be encoded instead of the disambiguation and prefix bytes
+// (and version) of interface values of the type once compact IDs are enabled
+// with EnableCompactInterfaceIDs.  id must be nonzero and unique within the
+// codec, and like names, IDs must stay the same across every codec decoding
+// the same data, so they should never be reused or reassigned.
+// Usage:
+// `amino.RegisterConcreteWithID(MyStruct1{}, "com.tendermint/MyStruct1", 1, nil)`
+func (cdc *Codec) RegisterConcreteWithID(o interface{}, name string, id uint64, copts *ConcreteOptions) {
+	if id == 0 {
+		panic(fmt.Sprintf("compact ID of %v must be nonzero", name))
+	}
+	cdc.registerConcrete(reflect.TypeOf(o), name, copts, nil, id)
+}
+
+// RegisterConcreteType is like RegisterConcrete, but takes the type directly,
+// e.g. for types constructed with reflect.StructOf.  If rt is a pointer type,
+// the pointer is preferred, as with RegisterConcrete(&MyStruct1{}, ...).
+// Usage:
+// `amino.RegisterConcreteType(reflect.TypeOf(MyStruct1{}), "com.tendermint/MyStruct1", nil)`
+func (cdc *Codec) RegisterConcreteType(rt reflect.Type, name string, copts *ConcreteOptions) {
+	if rt == nil {
+		panic("cannot register a nil type")
+	}
+	switch derefType(rt).Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer, reflect.Complex64, reflect.Complex128:
+		panic(fmt.Sprintf("unsupported type %v", rt))
+	}
+	cdc.registerConcrete(rt, name, copts, nil, 0)
+}
+
+// RegisterConcreteFactory is like RegisterConcrete, but takes a function
+// returning a fresh zero value of the concrete type (or a pointer to one, if
+// the pointer is preferred), e.g. for types contributed by plugins loaded
+// after program start.  The factory is called once to determine the type, and
+// then to construct the value whenever an interface value of the type is
+// decoded, so it must always return a value of the same type (or decoding
+// returns an error).
+// Usage:
+// `amino.RegisterConcreteFactory("com.tendermint/MyStruct1", func() interface{} { return &MyStruct1{} }, nil)`
+func (cdc *Codec) RegisterConcreteFactory(name string, factory func() interface{}, copts *ConcreteOptions) {
+	if factory == nil {
+		panic("cannot register a nil factory")
+	}
+	o := factory()
+	if o == nil {
+		panic(fmt.Sprintf("factory for %v returned nil", name))
+	}
+	rv := reflect.ValueOf(o)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		panic(fmt.Sprintf("factory for %v returned a nil pointer", name))
+	}
+	cdc.registerConcrete(rv.Type(), name, copts, factory, 0)
+}
+
+// TryRegisterInterface is like RegisterInterface, but returns an error
+// instead of panicking, e.g. if the codec is sealed or the interface conflicts
+// with registered concrete types.  The codec is left unchanged upon an error.
+func (cdc *Codec) TryRegisterInterface(ptr interface{}, iopts *InterfaceOptions) error {
+	if reflect.TypeOf(ptr) == nil {
+		return errors.New("cannot register a nil interface pointer")
+	}
+	return tryRegister(func() { cdc.RegisterInterface(ptr, iopts) })
+}
+
+// TryRegisterConcrete is like RegisterConcrete, but returns an error instead
+// of panicking, e.g. if the codec is sealed, the name or prefix bytes are
+// already registered, or the type isn't supported, so that types from
+// plugins loaded at runtime can be rejected gracefully.  The codec is left
+// unchanged upon an error.
+func (cdc *Codec) TryRegisterConcrete(o interface{}, name string, copts *ConcreteOptions) error {
+	if reflect.TypeOf(o) == nil {
+		return errors.New("cannot register a nil value")
+	}
+	return tryRegister(func() { cdc.RegisterConcrete(o, name, copts) })
+}
+
+// Calls register, returning a panic from a registration problem as an error.
+// Runtime errors (i.e. bugs) still panic.
+func tryRegister(register func()) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				panic(r)
+			}
+			if rerr, ok := r.(error); ok {
+				err = rerr
+			} else {
+				err = errors.Errorf("%v", r)
+			}
+		}
+	}()
+	register()
+	return nil
+}
+
+func (cdc *Codec) registerConcrete(rt reflect.Type, name string, copts *ConcreteOptions, factory func() interface{}, id uint64) {
+	cdc.assertNotSealed()
+
+	if err := cdc.validateConcreteName(name); err != nil {
+		panic(fmt.Sprintf("invalid name for %v: %v", rt, err))
+	}
+
+	var pointerPreferred bool
+
+	// Get reflect.Type.
+	if rt.Kind() == reflect.Interface {
+		panic(fmt.Sprintf("expected a non-interface: %v", rt))
+	}
+	if rt.Kind() == reflect.Ptr {
+		rt = rt.Elem()
+		if rt.Kind() == reflect.Ptr {
+			// We can encode/decode pointer-pointers, but not register them.
+			panic(fmt.Sprintf("registering pointer-pointers not yet supported: *%v", rt))
+		}
+		if rt.Kind() == reflect.Interface {
+			// MARKER: No interface-pointers
+			panic(fmt.Sprintf("registering interface-pointers not yet supported: *%v", rt))
+		}
+		pointerPreferred = true
+	}
+
+	// Construct ConcreteInfo.
+	// NOTE: Read locked, since parsing struct fields reads codec settings.
+	var info = func() *TypeInfo {
+		cdc.mtx.RLock()
+		defer cdc.mtx.RUnlock()
+
+		return cdc.newTypeInfoFromRegisteredConcreteType(rt, pointerPreferred, name, copts)
+	}()
+	info.factory = factory
+	info.CompactID = id
+
+	// Finally, check conflicts and register.
+	func() {
+		cdc.mtx.Lock()
+		defer cdc.mtx.Unlock()
+
+		cdc.checkVersionNolock(info)
+		cdc.checkTypeInfoNolock(info)
+		if existing, ok := cdc.idToTypeInfo[id]; ok && id != 0 {
+			panic(fmt.Sprintf("compact ID %v already registered for %v", id, existing.Type))
+		}
+		cdc.addCheckConflictsWithConcreteNolock(info)
+		cdc.setTypeInfoNolock(info)
+		if id != 0 {
+			cdc.idToTypeInfo[id] = info
+		}
+	}()
+}
+
+func (cdc *Codec) Seal() *Codec {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.sealed = true
+	return cdc
+}
+
+// SetUnknownFieldHook sets a function to be called whenever binary decoding
+// skips a field unknown to the struct being decoded, e.g. to monitor version
+// skew between peers.  typeName is the registered name of the struct, or its
+// Go type if not registered.  raw is the encoded value of the field (after
+// the field key), which must not be retained or modified.  The hook doesn't
+// affect decoding.
+func (cdc *Codec) SetUnknownFieldHook(hook func(typeName string, fieldNum uint32, wireType byte, raw []byte)) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.unknownFieldHook = hook
+}
+
+// SetBufferPool sets a pool of *[]byte buffers for the transient allocations
+// of binary decoding, instead of allocating a buffer each time, to reduce GC
+// pressure when decoding many messages.  Pooled are:
+//   - the messages read by UnmarshalBinaryLengthPrefixedReader and
+//     FrameReader.Read (and so Conn.ReadMsg) before decoding them,
+//   - the bytes of strings, before they're copied into the string, and
+//   - the copies of the length-prefixed encodings of nested structs, lists,
+//     maps, interface values and byte arrays, which are decoded from them.
+//
+// Byte slices are still allocated, as they're part of the decoded value.  A
+// buffer is taken from the pool (if its capacity fits, otherwise a larger
+// one is allocated) and put back once the message is decoded, whether or not
+// decoding failed.  Decoded values never alias the buffers, so they may then
+// be reused.  Note that buffers as large as the largest message are kept in
+// the pool.  The pool's New may be nil, and values other than *[]byte are
+// ignored, so it should only be used to pool buffers.  Defaults to nil, with
+// no pooling.
+func (cdc *Codec) SetBufferPool(pool *sync.Pool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.bufferPool = pool
+}
+
+// Returns a buffer of length n from pool, or a new one if pool is nil or
+// has no buffer that fits.
+func getPooledBuffer(pool *sync.Pool, n int) *[]byte {
+	if pool != nil {
+		if buf, ok := pool.Get().(*[]byte); ok && buf != nil && cap(*buf) >= n {
+			*buf = (*buf)[:n]
+			return buf
+		}
+	}
+	bz := make([]byte, n)
+	return &bz
+}
+
+// SetMaxDecodeAlloc limits the total number of bytes allocated while binary
+// decoding a single message, including nested lists, strings, byte slices,
+// map entries, pointers and interface values.  Unlike a limit on the size of
+// the input, this also rejects small messages that expand into many
+// allocations, e.g. a long list of empty structs.  Errors from exceeding the
+// limit are never collected by UnmarshalBinaryBareCollectErrors.  The count
+// is approximate, as it doesn't include the spare capacity of lists.  Zero
+// means no limit, which is the default.
+func (cdc *Codec) SetMaxDecodeAlloc(n int) {
+	if n < 0 {
+		panic("max decode allocation cannot be negative.")
+	}
+
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.maxDecodeAlloc = n
+}
+
+// SetMaxSliceLen limits the number of elements of each list (or map) when
+// binary decoding, since many small elements (e.g. empty structs, of 2 bytes
+// each) may pass size checks on the input but still be expensive to decode.
+// Zero means no limit, which is the default.
+func (cdc *Codec) SetMaxSliceLen(n int) {
+	if n < 0 {
+		panic("max slice length cannot be negative.")
+	}
+
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.maxSliceLen = n
+}
+
+// SetMaxFieldNumber limits the field numbers accepted when binary decoding a
+// struct, so that unknown fields with larger numbers are rejected instead of
+// skipped.  Zero restores the default, MaxFieldNumber (as in protobuf), and
+// field numbers larger than MaxFieldNumber are always rejected.
+func (cdc *Codec) SetMaxFieldNumber(n uint32) {
+	if n > MaxFieldNumber {
+		panic(fmt.Sprintf("max field number cannot exceed %v.", MaxFieldNumber))
+	}
+
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.maxFieldNum = n
+}
+
+// SetMaxInterfaceDepth limits how deeply interface values may be nested
+// within each other (e.g. an interface holding a struct with an interface
+// field, and so on) when decoding, since each one requires a registry lookup
+// and a new value, so that crafted messages can't amplify that work.  Other
+// values between the interface values don't count.  It applies to both
+// Amino:binary and Amino:JSON.  Zero means no limit, which is the default.
+func (cdc *Codec) SetMaxInterfaceDepth(n int) {
+	if n < 0 {
+		panic("max interface depth cannot be negative.")
+	}
+
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.maxIfaceDepth = n
+}
+
+// SetMaxEncodeSize limits the size of the Amino:binary encoding of each
+// value (before any length prefix, e.g. of MarshalBinaryLengthPrefixed).
+// Encoding fails as soon as the encoding of a struct, list or map gets
+// larger, rather than after the whole output is buffered.  Zero means no
+// limit, which is the default.
+func (cdc *Codec) SetMaxEncodeSize(n int) {
+	if n < 0 {
+		panic("max encode size cannot be negative.")
+	}
+
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.maxEncodeSize = n
+}
+
+// DefaultMaxDecompressedSize is the default of SetMaxDecompressedSize.
+const DefaultMaxDecompressedSize = 64 << 20
+
+// SetMaxDecompressedSize limits the size of the JSON decompressed by
+// UnmarshalJSONGzip, since a small gzip stream can expand into gigabytes.
+// Decoding fails once the limit is exceeded, before the JSON is decoded.
+// Zero restores the default, DefaultMaxDecompressedSize.
+func (cdc *Codec) SetMaxDecompressedSize(n int) {
+	if n < 0 {
+		panic("max decompressed size cannot be negative.")
+	}
+
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.maxDecompressedSize = n
+}
+
+// SetRequireNamespacedNames enables (or disables) requiring registered names
+// of the form "domain/Type", e.g. "com.tendermint/MyStruct1", where neither
+// part is empty.  Regardless, names must not be empty, nor contain whitespace
+// or control characters.
+func (cdc *Codec) SetRequireNamespacedNames(require bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.namespacedNames = require
+}
+
+func (cdc *Codec) validateConcreteName(name string) error {
+	cdc.mtx.RLock()
+	defer cdc.mtx.RUnlock()
+
+	if name == "" {
+		return errors.New("name is empty")
+	}
+	for _, c := range name {
+		if unicode.IsSpace(c) || unicode.IsControl(c) {
+			return fmt.Errorf("name %q contains whitespace or control characters", name)
+		}
+	}
+	if cdc.namespacedNames {
+		slash := strings.Index(name, "/")
+		if slash <= 0 || slash == len(name)-1 {
+			return fmt.Errorf("name %q is not of the form \"domain/Type\"", name)
+		}
+	}
+	return nil
+}
+
+// SetUnregisteredHandler sets a function to be called when an unregistered
+// concrete type is encountered while encoding an interface value, before
+// failing.  The handler may register the type (e.g. with a name derived from
+// rt) and return nil to let encoding proceed, or return a domain-specific
+// error to be returned instead.  Since registering requires an unsealed
+// codec, this is mostly useful before sealing.
+func (cdc *Codec) SetUnregisteredHandler(handler func(rt reflect.Type) error) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.unregisteredHandler = handler
+}
+
+// SetChecksumHash sets the checksum used by MarshalBinaryChecksummed and
+// UnmarshalBinaryChecksummed, which must be the same for both, e.g. sha256.New
+// or a function returning crc32.New(crc32.MakeTable(crc32.Castagnoli)).
+// newHash is called for each value.  Defaults to nil, which uses CRC-32
+// (IEEE).
+func (cdc *Codec) SetChecksumHash(newHash func() hash.Hash) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.checksumHash = newHash
+}
+
+func (cdc *Codec) newChecksumHash() hash.Hash {
+	cdc.mtx.RLock()
+	newHash := cdc.checksumHash
+	cdc.mtx.RUnlock()
+
+	if newHash == nil {
+		return crc32.NewIEEE()
+	}
+	return newHash()
+}
+
+// EnableCompactInterfaceIDs makes interface values encode in Amino:binary
+// with the uvarint ID of their concrete type registered with
+// RegisterConcreteWithID, instead of its disambiguation and prefix bytes (and
+// version), e.g. to save space in a closed ecosystem where every party
+// registers the same IDs.  Interface values are then decoded by ID as well,
+// so it must be enabled on every codec decoding the same data.  Encoding an
+// interface value of a concrete type without an ID is an error.  Amino:JSON
+// is unaffected.
+//
+// NOTE: This is not Amino:binary, as other implementations can't decode it.
+func (cdc *Codec) EnableCompactInterfaceIDs() {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.compactIDs = true
+}
+
+// SetSortDecodedLists enables (or disables) sorting the elements of list
+// fields tagged `amino:"sorted"` after binary decoding them, in order of
+// their encodings like when encoding, so that they're sorted even if the
+// input wasn't, e.g. from another encoder.  Disabled by default, which keeps
+// the order of the input.
+func (cdc *Codec) SetSortDecodedLists(sort bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.sortDecodedLists = sort
+}
+
+// SetTimeEpoch sets the epoch that time.Time values are encoded relative to
+// in Amino:binary, as the seconds and nanoseconds since epoch (negative if
+// before it) rather than since the Unix epoch, so that times close to epoch
+// (e.g. recent times, with a recent epoch) take fewer bytes.  A zero
+// time.Time restores the Unix epoch, the default.
+//
+// WARNING: This changes the encoding of every time.Time, and the epoch isn't
+// encoded, so encodings can only be decoded by codecs with the same epoch.
+// Other decoders (or codecs with another epoch) silently decode times off by
+// the difference between the epochs.  Times must be between the years 1 and
+// 9999, also when taken as an offset from the Unix epoch instead of epoch.
+// Amino:JSON is unaffected.
+func (cdc *Codec) SetTimeEpoch(epoch time.Time) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.timeEpoch = epoch.Round(0).UTC()
+}
+
+// SetFieldEncodeHook sets a function to be called with each struct field
+// value while binary encoding, e.g. to collect metrics or redact secrets in an
+// audit pipeline.  typeName is the registered name of the struct, or its Go
+// type if not registered, and fieldName is the Go name of the field.  The
+// returned value is encoded instead of v, so the hook should return v to
+// leave the field as is.  It must be assignable to the field's type, or nil
+// for the zero value of the type.  The hook is called for each field (even
+// zero ones) of each struct, including nested ones, so it should be fast.
+// Amino:JSON is unaffected.  Defaults to nil, which costs nothing.
+func (cdc *Codec) SetFieldEncodeHook(hook func(typeName, fieldName string, v interface{}) interface{}) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.fieldEncodeHook = hook
+}
+
+// SetWarnLogger sets a function to be called with warnings, e.g. the first
+// time a type registered with ConcreteOptions.Deprecated is encoded.  The
+// function may be called concurrently.  Defaults to nil, which drops them.
+func (cdc *Codec) SetWarnLogger(logger func(string)) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.warnLogger = logger
+}
+
+// Logs a warning the first time the deprecated type of info is encoded.
+func (cdc *Codec) warnDeprecated(info *TypeInfo) {
+	// Most calls are after the warning, so check under the read lock first.
+	cdc.mtx.RLock()
+	warned := cdc.warnLogger == nil || cdc.deprecatedWarned[info.Type]
+	cdc.mtx.RUnlock()
+	if warned {
+		return
+	}
+
+	cdc.mtx.Lock()
+	logger := cdc.warnLogger
+	if logger == nil || cdc.deprecatedWarned[info.Type] {
+		cdc.mtx.Unlock()
+		return
+	}
+	if cdc.deprecatedWarned == nil {
+		cdc.deprecatedWarned = make(map[reflect.Type]bool)
+	}
+	cdc.deprecatedWarned[info.Type] = true
+	cdc.mtx.Unlock()
+
+	logger(fmt.Sprintf("amino: encoding deprecated type %v (%v)", info.Name, info.Type))
+}
+
+// SetAllowMaps enables (or disables) the binary encoding of maps with string
+// or integer keys.  Each entry is encoded as a repeated key/value message with
+// the key as field 1 and the value as field 2, like Proto3 maps, in order of
+// ascending key.  As with struct fields, a nil pointer value is encoded as
+// an absent value field and decoded as nil, while other pointer values are
+// always written, so that e.g. map[string]*MyStruct round-trips.  Maps are
+// disabled by default, and encoding or decoding one panics, as with other
+// unsupported types.
+func (cdc *Codec) SetAllowMaps(allow bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.allowMaps = allow
+}
+
+// SetAllowComplex enables (or disables) encoding complex64 and complex128
+// fields, which like floats also require `amino:"unsafe"`, e.g. for
+// scientific data that is never part of consensus.  A complex value is
+// encoded as a message with its real and imaginary parts as float fields,
+// i.e. `{"real":...,"imag":...}` in Amino:JSON, so both parts round-trip
+// exactly.  Complex values are disabled by default.
+func (cdc *Codec) SetAllowComplex(allow bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.allowComplex = allow
+}
+
+// SetDrainChannels enables (or disables) the binary encoding of chan fields
+// tagged with `amino:"drain_chan"`, as a snapshot of their buffered values.
+//
+// WARNING: Encoding is destructive.  The values buffered in the channel are
+// received without blocking and encoded as a list, so they are gone from the
+// channel afterwards, even if encoding fails.  Decoding constructs a new
+// channel buffering the decoded values, with capacity for exactly those
+// values, or a nil channel if there are none.  This is meant for snapshot
+// tools, where nothing else is receiving from or sending to the channel.
+func (cdc *Codec) SetDrainChannels(drain bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.drainChannels = drain
+}
+
+// SetStrictTypes enables (or disables) precise errors for binary decoding,
+// when the wire type of a field doesn't match its Go type, e.g. "field 3:
+// expected length-delimited for string, got varint".  Such errors are
+// returned as *WireTypeError (use errors.Cause if the field is within a
+// list), to detect schema drift between the producer and the consumer.
+func (cdc *Codec) SetStrictTypes(strict bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.strictTypes = strict
+}
+
+// SetValidateUTF8Strings enables (or disables) rejecting strings that aren't
+// valid UTF-8 when binary encoding and decoding, as proto3 requires of
+// string fields.  The error has the path of the field.  Disabled by default,
+// for compatibility with strings holding arbitrary bytes.
+func (cdc *Codec) SetValidateUTF8Strings(validate bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.validateUTF8 = validate
+}
+
+// SetNormalizeStrings sets a function to normalize every string when binary
+// decoding, e.g. norm.NFC.String from golang.org/x/text/unicode/norm, so
+// that strings of equivalent but differently composed Unicode decode (and so
+// re-encode and hash) the same.  See also SetNormalizeEncodedStrings.  The
+// function must be deterministic, and should be idempotent.  Beware that it
+// costs a pass over (and possibly a copy of) every decoded string, which
+// NFC does even for strings that are already normalized.  Amino:JSON is
+// unaffected.  Defaults to nil, with no normalization.
+func (cdc *Codec) SetNormalizeStrings(normalize func(string) string) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.normalizeString = normalize
+}
+
+// SetNormalizeEncodedStrings enables (or disables) normalizing every string
+// with the function set by SetNormalizeStrings when binary encoding as well,
+// so that encodings (e.g. sign bytes) don't depend on how the strings were
+// composed.  Disabled by default.
+func (cdc *Codec) SetNormalizeEncodedStrings(normalize bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.normalizeOnEncode = normalize
+}
+
+// SetWriteEmptyStringPointers enables (or disables) binary encoding struct
+// fields that are non-nil pointers to empty strings (e.g. a *string field
+// set to &""), rather than omitting them like nil pointers, so that they
+// decode as pointers to "" while omitted fields decode as nil, e.g. to tell
+// apart fields cleared from fields left unset in a partial update.
+// Amino:JSON always tells them apart, as "" and null.  Disabled by default,
+// since it changes the encoding of such fields.
+func (cdc *Codec) SetWriteEmptyStringPointers(write bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.emptyStringPtrs = write
+}
+
+// SetRejectNonMinimalVarints enables (or disables) rejecting varints that
+// are encoded with more bytes than necessary (i.e. that end with a zero byte
+// after a continuation byte, like 0x8100 for 1) when binary decoding, so
+// that every value has exactly one valid encoding.  This covers integer and
+// bool values, field keys, byte-length prefixes and versions, as well as the
+// fields of time values.  Disabled by default, for compatibility with
+// encoders that pad varints.
+func (cdc *Codec) SetRejectNonMinimalVarints(reject bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.rejectNonMinVarints = reject
+}
+
+// SetRejectDuplicateJSONKeys enables (or disables) rejecting Amino:JSON
+// objects that repeat a key when decoding into a struct or map, rather than
+// taking the last value like encoding/json.  Disabled by default.  It doesn't
+// affect Amino:binary decoding, which always rejects non-repeated field
+// numbers that appear more than once (as well as fields out of order).
+func (cdc *Codec) SetRejectDuplicateJSONKeys(reject bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.rejectDupJSONKeys = reject
+}
+
+// SetBareTopLevelJSON enables (or disables) omitting the
+// {"type":...,"value":...} wrapper of registered concrete values passed
+// directly to MarshalJSON (and expected by UnmarshalJSON), like for
+// unregistered types, e.g. for APIs whose responses always have the same type.
+// Interface values are always wrapped, since their type is needed to decode
+// them, including in interface fields and when marshaling a pointer to an
+// interface, e.g. MarshalJSON(&msg) where msg is of an interface type.
+// Disabled by default.
+func (cdc *Codec) SetBareTopLevelJSON(bare bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.bareJSON = bare
+}
+
+// SetJSONComments enables (or disables) writing field comments in the output
+// of MarshalJSONIndent, e.g. for self-documenting config files.  A comment is
+// set with the amino tag `amino:"comment=..."`, which must come last in the
+// tag since the comment may contain commas.  It's written as a sibling key of
+// the field, named after the field with a "_comment_" prefix, e.g.
+//
+//	"_comment_timeout": "In seconds, zero means no timeout.",
+//	"timeout": "30",
+//
+// Such keys are ignored when decoding.  Other Marshal methods never write
+// comments.
+func (cdc *Codec) SetJSONComments(enable bool) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.jsonComments = enable
+}
+
+// SetJSONFieldNameFunc sets a function deriving the Amino:JSON name of struct
+// fields without an explicit name in their json tag from their Go name, e.g.
+// to convert "ChainID" to "chainID" for a camelCase API, instead of tagging
+// every field.  Decoding expects the derived names too.  Since field names
+// are computed once per type, this must be called before registering or
+// encoding any struct types.  Defaults to nil, which uses the Go name.
+func (cdc *Codec) SetJSONFieldNameFunc(fn func(goName string) string) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.jsonFieldNameFunc = fn
+}
+
+// SetJSONNonFiniteFloats sets how NaN and ±Inf float values are encoded in
+// Amino:JSON.  See JSONNonFiniteFloats.
+func (cdc *Codec) SetJSONNonFiniteFloats(mode JSONNonFiniteFloats) {
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.jsonNonFiniteFloats = mode
+}
+
+// The settings of a codec used when encoding, read once per top-level call
+// with Codec.encodeOptions, rather than under the lock for each value.
+type encodeOptions struct {
+	maxSize int // See Codec.SetMaxEncodeSize.
+
+	validateUTF8 bool // See Codec.SetValidateUTF8Strings.
+
+	emptyStringPtrs bool // See Codec.SetWriteEmptyStringPointers.
+
+	timeEpoch time.Time // See Codec.SetTimeEpoch, zero for the Unix epoch.
+
+	fieldHook func(typeName, fieldName string, v interface{}) interface{} // See Codec.SetFieldEncodeHook.
+
+	normalize func(string) string // See Codec.SetNormalizeEncodedStrings.
+
+	compactIDs bool // See Codec.EnableCompactInterfaceIDs.
+
+	allowMaps bool // See Codec.SetAllowMaps.
+
+	allowComplex bool // See Codec.SetAllowComplex.
+
+	drainChannels bool // See Codec.SetDrainChannels.
+
+	enums map[reflect.Type]*enumInfo // See Codec.RegisterEnum.
+
+	jsonNonFinite JSONNonFiniteFloats // See Codec.SetJSONNonFiniteFloats.
+
+	bareJSON bool // See Codec.SetBareTopLevelJSON.
+
+	jsonComments bool // See Codec.SetJSONComments.
+}
+
+func (cdc *Codec) encodeOptions() encodeOptions {
+	cdc.mtx.RLock()
+	defer cdc.mtx.RUnlock()
+
+	opts := encodeOptions{
+		maxSize:         cdc.maxEncodeSize,
+		validateUTF8:    cdc.validateUTF8,
+		emptyStringPtrs: cdc.emptyStringPtrs,
+		timeEpoch:       cdc.timeEpoch,
+		fieldHook:       cdc.fieldEncodeHook,
+		compactIDs:      cdc.compactIDs,
+		allowMaps:       cdc.allowMaps,
+		allowComplex:    cdc.allowComplex,
+		drainChannels:   cdc.drainChannels,
+		enums:           cdc.enums,
+		jsonNonFinite:   cdc.jsonNonFiniteFloats,
+		bareJSON:        cdc.bareJSON,
+		jsonComments:    cdc.jsonComments,
+	}
+	if cdc.normalizeOnEncode {
+		opts.normalize = cdc.normalizeString
+	}
+	return opts
+}
+
+// The settings of a codec used when decoding, see encodeOptions.
+type decodeOptions struct {
+	maxAlloc int // See Codec.SetMaxDecodeAlloc, zero means no limit.
+
+	maxSliceLen int // See Codec.SetMaxSliceLen, zero means no limit.
+
+	maxFieldNum uint32 // See Codec.SetMaxFieldNumber, zero means MaxFieldNumber.
+
+	maxIfaceDepth int // See Codec.SetMaxInterfaceDepth, zero means no limit.
+
+	maxDecompressedSize int // See Codec.SetMaxDecompressedSize.
+
+	validateUTF8 bool // See Codec.SetValidateUTF8Strings.
 
-	// Construct InterfaceInfo
-	var info = cdc.newTypeInfoFromInterfaceType(rt, iopts)
+	rejectNonMinVarints bool // See Codec.SetRejectNonMinimalVarints.
 
-	// Finally, check conflicts and register.
-	func() {
-		cdc.mtx.Lock()
-		defer cdc.mtx.Unlock()
+	sortLists bool // See Codec.SetSortDecodedLists.
 
-		cdc.collectImplementersNolock(info)
-		err := cdc.checkConflictsInPrioNolock(info)
-		if err != nil {
-			panic(err)
-		}
-		cdc.setTypeInfoNolock(info)
-	}()
-	/*
-		NOTE: The above func block is a defensive pattern.
+	emptyStringPtrs bool // See Codec.SetWriteEmptyStringPointers, for sorting lists.
 
-		First of all, the defer call is necessary to recover from panics,
-		otherwise the Codec would become unusable after a single panic.
+	timeEpoch time.Time // See Codec.SetTimeEpoch, zero for the Unix epoch.
 
-		This “defer-panic-unlock” pattern requires a func block to denote the
-		boundary outside of which the defer call is guaranteed to have been
-		called.  In other words, using any other form of curly braces (e.g.  in
-		the form of a conditional or looping block) won't actually unlock when
-		it might appear to visually.  Consider:
+	normalize func(string) string // See Codec.SetNormalizeStrings.
 
-		```
-		var info = ...
-		{
-			cdc.mtx.Lock()
-			defer cdc.mtx.Unlock()
+	bufferPool *sync.Pool // See Codec.SetBufferPool.
 
-			...
-		}
-		// Here, cdc.mtx.Unlock() hasn't been called yet.
-		```
+	unknownFieldHook func(typeName string, fieldNum uint32, wireType byte, raw []byte) // See Codec.SetUnknownFieldHook.
 
-		So, while the above code could be simplified, it's there for defense.
-	*/
-}
+	strictTypes bool // See Codec.SetStrictTypes.
 
-// This function should be used to register concrete types that will appear in
-// interface fields/elements to be encoded/decoded by go-amino.
-// Usage:
-// `amino.RegisterConcrete(MyStruct1{}, "com.tendermint/MyStruct1", nil)`
-func (cdc *Codec) RegisterConcrete(o interface{}, name string, copts *ConcreteOptions) {
-	cdc.assertNotSealed()
+	compactIDs bool // See Codec.EnableCompactInterfaceIDs.
 
-	var pointerPreferred bool
+	allowMaps bool // See Codec.SetAllowMaps.
 
-	// Get reflect.Type.
-	rt := reflect.TypeOf(o)
-	if rt.Kind() == reflect.Interface {
-		panic(fmt.Sprintf("expected a non-interface: %v", rt))
-	}
-	if rt.Kind() == reflect.Ptr {
-		rt = rt.Elem()
-		if rt.Kind() == reflect.Ptr {
-			// We can encode/decode pointer-pointers, but not register them.
-			panic(fmt.Sprintf("registering pointer-pointers not yet supported: *%v", rt))
-		}
-		if rt.Kind() == reflect.Interface {
-			// MARKER: No interface-pointers
-			panic(fmt.Sprintf("registering interface-pointers not yet supported: *%v", rt))
-		}
-		pointerPreferred = true
-	}
+	allowComplex bool // See Codec.SetAllowComplex.
 
-	// Construct ConcreteInfo.
-	var info = cdc.newTypeInfoFromRegisteredConcreteType(rt, pointerPreferred, name, copts)
+	drainChannels bool // See Codec.SetDrainChannels.
 
-	// Finally, check conflicts and register.
-	func() {
-		cdc.mtx.Lock()
-		defer cdc.mtx.Unlock()
+	enums map[reflect.Type]*enumInfo // See Codec.RegisterEnum.
 
-		cdc.addCheckConflictsWithConcreteNolock(info)
-		cdc.setTypeInfoNolock(info)
-	}()
+	jsonNonFinite JSONNonFiniteFloats // See Codec.SetJSONNonFiniteFloats.
+
+	rejectDupJSONKeys bool // See Codec.SetRejectDuplicateJSONKeys.
+
+	bareJSON bool // See Codec.SetBareTopLevelJSON.
 }
 
-func (cdc *Codec) Seal() *Codec {
-	cdc.mtx.Lock()
-	defer cdc.mtx.Unlock()
+func (cdc *Codec) decodeOptions() decodeOptions {
+	cdc.mtx.RLock()
+	defer cdc.mtx.RUnlock()
 
-	cdc.sealed = true
-	return cdc
+	opts := decodeOptions{
+		maxAlloc:            cdc.maxDecodeAlloc,
+		maxSliceLen:         cdc.maxSliceLen,
+		maxFieldNum:         cdc.maxFieldNum,
+		maxIfaceDepth:       cdc.maxIfaceDepth,
+		maxDecompressedSize: cdc.maxDecompressedSize,
+		validateUTF8:        cdc.validateUTF8,
+		rejectNonMinVarints: cdc.rejectNonMinVarints,
+		sortLists:           cdc.sortDecodedLists,
+		emptyStringPtrs:     cdc.emptyStringPtrs,
+		timeEpoch:           cdc.timeEpoch,
+		normalize:           cdc.normalizeString,
+		bufferPool:          cdc.bufferPool,
+		unknownFieldHook:    cdc.unknownFieldHook,
+		strictTypes:         cdc.strictTypes,
+		compactIDs:          cdc.compactIDs,
+		allowMaps:           cdc.allowMaps,
+		allowComplex:        cdc.allowComplex,
+		drainChannels:       cdc.drainChannels,
+		enums:               cdc.enums,
+		jsonNonFinite:       cdc.jsonNonFiniteFloats,
+		rejectDupJSONKeys:   cdc.rejectDupJSONKeys,
+		bareJSON:            cdc.bareJSON,
+	}
+	if opts.maxDecompressedSize == 0 {
+		opts.maxDecompressedSize = DefaultMaxDecompressedSize
+	}
+	return opts
+}
+
+// InterfacesFor returns the registered interfaces that the concrete type of
+// o (or a pointer to it) can be encoded and decoded as, in order of
+// registration.  For interfaces registered with RegisterOneof, only the
+// variants are included.  Returns an error if the concrete type isn't
+// registered.
+func (cdc *Codec) InterfacesFor(o interface{}) ([]reflect.Type, error) {
+	if o == nil {
+		return nil, errors.New("cannot find interfaces for nil")
+	}
+	rt := derefType(reflect.TypeOf(o))
+	cinfo, err := cdc.getTypeInfoWlock(rt)
+	if err != nil {
+		return nil, err
+	}
+	if !cinfo.Registered {
+		return nil, fmt.Errorf("cannot find interfaces for unregistered concrete type %v", rt)
+	}
+
+	cdc.mtx.RLock()
+	defer cdc.mtx.RUnlock()
+
+	var irts = []reflect.Type{}
+	for _, iinfo := range cdc.interfaceInfos {
+		if !cinfo.PtrToType.Implements(iinfo.Type) {
+			continue
+		}
+		if len(iinfo.OneofVariants) > 0 && oneofFieldNum(iinfo, cinfo) == 0 {
+			continue
+		}
+		irts = append(irts, iinfo.Type)
+	}
+	return irts, nil
 }
 
-// PrintTypes writes all registered types in a markdown-style table.
-// The table's header is:
+// PrintTypes writes all registered types in a markdown-style table, sorted
+// by registered name.  The table's header is:
 //
 // | Type  | Name | Prefix | Notes |
 //
-// Where Type is the golang type name and Name is the name the type was registered with.
+// Where Type is the golang type name and Name is the name the type was registered with,
+// and Notes is the ConcreteOptions.Description it was registered with, if any.
 func (cdc *Codec) PrintTypes(out io.Writer) error {
 	cdc.mtx.RLock()
 	defer cdc.mtx.RUnlock()
@@ -267,7 +1316,7 @@ func (cdc *Codec) PrintTypes(out io.Writer) error {
 		return err
 	}
 	// only print concrete types for now (if we want everything, we can iterate over the typeInfos map instead)
-	for _, i := range cdc.concreteInfos {
+	for _, i := range sortedByName(cdc.concreteInfos) {
 		if _, err := io.WriteString(out, "| "); err != nil {
 			return err
 		}
@@ -298,8 +1347,10 @@ func (cdc *Codec) PrintTypes(out io.Writer) error {
 		if _, err := io.WriteString(out, " | "); err != nil {
 			return err
 		}
-		// empty notes table data by default // TODO(ismail): make this configurable
-
+		// Notes are the description, if any.
+		if _, err := io.WriteString(out, escapeTableCell(i.Description)); err != nil {
+			return err
+		}
 		if _, err := io.WriteString(out, " |\n"); err != nil {
 			return err
 		}
@@ -308,6 +1359,22 @@ func (cdc *Codec) PrintTypes(out io.Writer) error {
 	return nil
 }
 
+// Returns a copy of the registered concrete types infos, sorted by name, so
+// that introspection doesn't depend on the order of registration.
+func sortedByName(infos []*TypeInfo) []*TypeInfo {
+	sorted := make([]*TypeInfo, len(infos))
+	copy(sorted, infos)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	return sorted
+}
+
+// Escapes s for a cell of a markdown-style table, which must be a single line
+// without unescaped pipes.
+func escapeTableCell(s string) string {
+	s = strings.Replace(s, "|", "\\|", -1)
+	return strings.Join(strings.Fields(s), " ")
+}
+
 // A heuristic to guess the size of a registered type and return it as a string.
 // If the size is not fixed it returns "variable".
 func getLengthStr(info *TypeInfo) string {
@@ -336,33 +1403,107 @@ func (cdc *Codec) assertNotSealed() {
 }
 
 func (cdc *Codec) setTypeInfoNolock(info *TypeInfo) {
+	// Check everything first, so as not to leave a partial registration.
+	isAlt := cdc.checkTypeInfoNolock(info)
 
-	if info.Type.Kind() == reflect.Ptr {
-		panic(fmt.Sprintf("unexpected pointer type"))
-	}
-	if _, ok := cdc.typeInfos[info.Type]; ok {
-		panic(fmt.Sprintf("TypeInfo already exists for %v", info.Type))
+	if !isAlt {
+		cdc.typeInfos[info.Type] = info
 	}
-
-	cdc.typeInfos[info.Type] = info
-	if info.Type.Kind() == reflect.Interface {
+	if info.Type == ioReaderType {
+		// io.Reader is encoded as bytes, not as a registered interface.
+	} else if info.Type.Kind() == reflect.Interface {
 		cdc.interfaceInfos = append(cdc.interfaceInfos, info)
 	} else if info.Registered {
 		cdc.concreteInfos = append(cdc.concreteInfos, info)
-		disfix := info.GetDisfix()
-		if existing, ok := cdc.disfixToTypeInfo[disfix]; ok {
-			panic(fmt.Sprintf("disfix <%X> already registered for %v", disfix, existing.Type))
-		}
-		if existing, ok := cdc.nameToTypeInfo[info.Name]; ok {
-			panic(fmt.Sprintf("name <%s> already registered for %v", info.Name, existing.Type))
+		if info.Version > 0 && cdc.addVersionNolock(info) {
+			return
 		}
-		cdc.disfixToTypeInfo[disfix] = info
+		cdc.disfixToTypeInfo[info.GetDisfix()] = info
 		cdc.nameToTypeInfo[info.Name] = info
 		//cdc.prefixToTypeInfos[prefix] =
 		//	append(cdc.prefixToTypeInfos[prefix], info)
 	}
 }
 
+// Panics if info can't be set by setTypeInfoNolock, e.g. if its name is
+// already registered.  Returns true if info is an alternative registration
+// of an already registered type.
+func (cdc *Codec) checkTypeInfoNolock(info *TypeInfo) (isAlt bool) {
+	if info.Type.Kind() == reflect.Ptr {
+		panic(fmt.Sprintf("unexpected pointer type"))
+	}
+	// NOTE: An unregistered TypeInfo may have been constructed automatically
+	// when the type was first encoded or decoded, so allow replacing it
+	// upon registration.  Registering a concrete type again under another
+	// name adds an alternative registration, while the first one remains
+	// the default for encoding.
+	existing, ok := cdc.typeInfos[info.Type]
+	isAlt = ok && existing.Registered && info.Registered && existing.Name != info.Name
+	if ok && !isAlt && (existing.Registered || !info.Registered) {
+		panic(fmt.Sprintf("TypeInfo already exists for %v", info.Type))
+	}
+	if info.Type.Kind() == reflect.Interface || !info.Registered ||
+		(info.Version > 0 && len(cdc.versions[info.Name]) > 0) {
+		return isAlt
+	}
+	disfix := info.GetDisfix()
+	if existing, ok := cdc.disfixToTypeInfo[disfix]; ok {
+		panic(fmt.Sprintf("disfix <%X> already registered for %v", disfix, existing.Type))
+	}
+	if existing, ok := cdc.nameToTypeInfo[info.Name]; ok {
+		panic(fmt.Sprintf("name <%s> already registered for %v", info.Name, existing.Type))
+	}
+	return isAlt
+}
+
+// Panics unless the registered concrete type info can be added as a version
+// of its name, see ConcreteOptions.Version.
+func (cdc *Codec) checkVersionNolock(info *TypeInfo) {
+	existing, ok := cdc.nameToTypeInfo[info.Name]
+	if !ok || existing.Type == info.Type {
+		return
+	}
+	if info.Version == 0 || existing.Version == 0 {
+		panic(fmt.Sprintf("name <%s> already registered for %v, versions require ConcreteOptions.Version",
+			info.Name, existing.Type))
+	}
+	for _, other := range cdc.versions[info.Name] {
+		if other.Version == info.Version {
+			panic(fmt.Sprintf("version %v of <%s> already registered for %v", info.Version, info.Name, other.Type))
+		}
+	}
+}
+
+// Records the registered concrete type info as a version of its name.
+// Returns true if an earlier registration of the name exists, in which case
+// the name (and its disfix) are updated to refer to the latest version.
+func (cdc *Codec) addVersionNolock(info *TypeInfo) (hasEarlier bool) {
+	versions := append(cdc.versions[info.Name], info)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	cdc.versions[info.Name] = versions
+	if len(versions) == 1 {
+		return false
+	}
+	latest := versions[len(versions)-1]
+	cdc.nameToTypeInfo[info.Name] = latest
+	cdc.disfixToTypeInfo[latest.GetDisfix()] = latest
+	return true
+}
+
+// Returns the given version of the registered concrete type cinfo, which
+// is a version of its name.
+func (cdc *Codec) getTypeInfoFromVersionRlock(cinfo *TypeInfo, version uint32) (info *TypeInfo, err error) {
+	cdc.mtx.RLock()
+	defer cdc.mtx.RUnlock()
+
+	for _, info := range cdc.versions[cinfo.Name] {
+		if info.Version == version {
+			return info, nil
+		}
+	}
+	return nil, fmt.Errorf("unrecognized version %v of %v", version, cinfo.Name)
+}
+
 func (cdc *Codec) getTypeInfoWlock(rt reflect.Type) (info *TypeInfo, err error) {
 	// We do not use defer cdc.mtx.Unlock() here due to performance overhead of
 	// defer in go1.11 (and prior versions). Ensure new code paths unlock the
@@ -376,19 +1517,75 @@ func (cdc *Codec) getTypeInfoWlock(rt reflect.Type) (info *TypeInfo, err error)
 
 	info, ok := cdc.typeInfos[rt]
 	if !ok {
-		if rt.Kind() == reflect.Interface {
+		if rt.Kind() == reflect.Interface && rt != ioReaderType {
 			err = fmt.Errorf("unregistered interface %v", rt)
 			cdc.mtx.Unlock()
 			return
 		}
 
-		info = cdc.newTypeInfoUnregistered(rt)
-		cdc.setTypeInfoNolock(info)
+		info, err = cdc.setTypeInfoUnregisteredWlocked(rt)
+		if err != nil {
+			cdc.mtx.Unlock()
+			return
+		}
 	}
 	cdc.mtx.Unlock()
 	return info, nil
 }
 
+// Constructs and sets the TypeInfo of the unregistered type rt, while the
+// caller holds cdc.mtx.  Since it's built lazily upon encoding or decoding,
+// invalid types return an error, and panics (e.g. upon invalid struct tags)
+// unlock cdc.mtx first, so that the codec remains usable.
+func (cdc *Codec) setTypeInfoUnregisteredWlocked(rt reflect.Type) (info *TypeInfo, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			cdc.mtx.Unlock()
+			panic(r)
+		}
+	}()
+	info = cdc.newTypeInfoUnregistered(rt)
+	if err = checkAminoReprTypes(info); err != nil {
+		return nil, err
+	}
+	cdc.setTypeInfoNolock(info)
+	return info, nil
+}
+
+// Gives the unregistered handler a chance to register the concrete type crt
+// encountered while encoding an interface value.  Returns the registered
+// *TypeInfo for crt, or an error.
+func (cdc *Codec) getRegisteredTypeInfoForEncode(crt reflect.Type) (cinfo *TypeInfo, err error) {
+	cdc.mtx.RLock()
+	handler := cdc.unregisteredHandler
+	cdc.mtx.RUnlock()
+
+	if handler != nil {
+		err = handler(crt)
+		if err != nil {
+			return nil, err
+		}
+		cinfo, err = cdc.getTypeInfoWlock(crt)
+		if err != nil {
+			return nil, err
+		}
+		if cinfo.Registered {
+			return cinfo, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot encode unregistered concrete type %v", crt)
+}
+
+// Returns the ConcreteOptions.Equal of the registered type rt (or the type
+// it points to), or nil.
+func (cdc *Codec) getEqualFunc(rt reflect.Type) func(a, b interface{}) bool {
+	info, err := cdc.getTypeInfoWlock(rt)
+	if err != nil || !info.Registered {
+		return nil
+	}
+	return info.Equal
+}
+
 // iinfo: TypeInfo for the interface for which we must decode a
 // concrete type with prefix bytes pb.
 func (cdc *Codec) getTypeInfoFromPrefixRlock(iinfo *TypeInfo, pb PrefixBytes) (info *TypeInfo, err error) {
@@ -413,6 +1610,24 @@ func (cdc *Codec) getTypeInfoFromPrefixRlock(iinfo *TypeInfo, pb PrefixBytes) (i
 	return
 }
 
+// Returns the concrete type registered with compact ID id, which must
+// implement the interface of iinfo.
+func (cdc *Codec) getTypeInfoFromCompactIDRlock(iinfo *TypeInfo, id uint64) (info *TypeInfo, err error) {
+	cdc.mtx.RLock()
+	defer cdc.mtx.RUnlock()
+
+	info, ok := cdc.idToTypeInfo[id]
+	if !ok {
+		return nil, fmt.Errorf("unrecognized compact ID %v", id)
+	}
+	// NOTE: Not iinfo.Implementers, which only has the latest version of
+	// each name, see ConcreteOptions.Version.
+	if info.PtrToType.Implements(iinfo.Type) {
+		return info, nil
+	}
+	return nil, fmt.Errorf("concrete type %v of compact ID %v doesn't implement %v", info.Type, id, iinfo.Type)
+}
+
 func (cdc *Codec) getTypeInfoFromDisfixRlock(df DisfixBytes) (info *TypeInfo, err error) {
 	// We do not use defer cdc.mtx.Unlock() here due to performance overhead of
 	// defer in go1.11 (and prior versions). Ensure new code paths unlock the
@@ -429,6 +1644,29 @@ func (cdc *Codec) getTypeInfoFromDisfixRlock(df DisfixBytes) (info *TypeInfo, er
 	return
 }
 
+// Returns the registration of the concrete type rt named name, which may be
+// an alternative to the one returned by getTypeInfoWlock.
+func (cdc *Codec) getTypeInfoForNameRlock(rt reflect.Type, name string) (info *TypeInfo, err error) {
+	info, err = cdc.getTypeInfoFromNameRlock(name)
+	if err != nil {
+		return nil, err
+	}
+	if info.Version > 0 && info.Type != derefType(rt) {
+		// Look for an earlier version.
+		cdc.mtx.RLock()
+		for _, vinfo := range cdc.versions[name] {
+			if vinfo.Type == derefType(rt) {
+				info = vinfo
+			}
+		}
+		cdc.mtx.RUnlock()
+	}
+	if info.Type != derefType(rt) {
+		return nil, fmt.Errorf("%v is registered for %v, not %v", name, info.Type, derefType(rt))
+	}
+	return info, nil
+}
+
 func (cdc *Codec) getTypeInfoFromNameRlock(name string) (info *TypeInfo, err error) {
 	// We do not use defer cdc.mtx.Unlock() here due to performance overhead of
 	// defer in go1.11 (and prior versions). Ensure new code paths unlock the
@@ -445,6 +1683,45 @@ func (cdc *Codec) getTypeInfoFromNameRlock(name string) (info *TypeInfo, err err
 	return
 }
 
+// Returns the field number of concrete type cinfo for interface iinfo
+// registered with RegisterOneof, or 0 if cinfo is not a variant.
+func oneofFieldNum(iinfo *TypeInfo, cinfo *TypeInfo) uint32 {
+	for i, vinfo := range iinfo.OneofVariants {
+		if vinfo == cinfo {
+			return uint32(i + 1)
+		}
+	}
+	return 0
+}
+
+// Returns the only concrete type registered for interface iinfo, or an error
+// if there are none or more than one.
+func (cdc *Codec) getSoleImplementerRlock(iinfo *TypeInfo) (info *TypeInfo, err error) {
+	// We do not use defer cdc.mtx.Unlock() here due to performance overhead of
+	// defer in go1.11 (and prior versions). Ensure new code paths unlock the
+	// mutex.
+	cdc.mtx.RLock()
+
+	for _, infos := range iinfo.Implementers {
+		for _, cinfo := range infos {
+			if info != nil {
+				err = fmt.Errorf("multiple concrete types registered for %v: e.g. %v and %v",
+					iinfo.Type, info.Type, cinfo.Type)
+				cdc.mtx.RUnlock()
+				return nil, err
+			}
+			info = cinfo
+		}
+	}
+	if info == nil {
+		err = fmt.Errorf("no concrete types registered for %v", iinfo.Type)
+		cdc.mtx.RUnlock()
+		return
+	}
+	cdc.mtx.RUnlock()
+	return
+}
+
 func (cdc *Codec) parseStructInfo(rt reflect.Type) (sinfo StructInfo) {
 	if rt.Kind() != reflect.Struct {
 		panic("should not happen")
@@ -462,21 +1739,42 @@ func (cdc *Codec) parseStructInfo(rt reflect.Type) (sinfo StructInfo) {
 		if skip {
 			continue // e.g. json:"-"
 		}
-		if ftype.Kind() == reflect.Array || ftype.Kind() == reflect.Slice {
-			if ftype.Elem().Kind() == reflect.Uint8 {
+		var ltype = ftype
+		if ftype.Kind() == reflect.Chan && fopts.DrainChan {
+			// Drained channels are encoded like slices.
+			if ftype.ChanDir() != reflect.BothDir {
+				panic(fmt.Sprintf("drain_chan field %v must be a bidirectional channel, got %v", field.Name, ftype))
+			}
+			ltype = reflect.SliceOf(ftype.Elem())
+		}
+		if ltype.Kind() == reflect.Array || ltype.Kind() == reflect.Slice {
+			if ltype.Elem().Kind() == reflect.Uint8 {
 				// These get handled by our optimized methods,
 				// encodeReflectBinaryByte[Slice/Array].
 				unpackedList = false
 			} else {
-				etype := ftype.Elem()
+				etype := ltype.Elem()
 				for etype.Kind() == reflect.Ptr {
 					etype = etype.Elem()
 				}
 				typ3 := typeToTyp3(etype, fopts)
-				if typ3 == Typ3ByteLength {
+				if typ3 == Typ3ByteLength || fopts.BinUnpacked {
 					unpackedList = true
 				}
 			}
+		} else if ftype.Kind() == reflect.Map {
+			// Map entries are written as repeated key/value messages.
+			unpackedList = true
+		}
+		if fopts.BinUnpacked && !unpackedList {
+			panic(fmt.Sprintf("unpacked field %v must be a list of non-byte elements, got %v", field.Name, ftype))
+		}
+		if fopts.BinSorted && ((ltype.Kind() != reflect.Array && ltype.Kind() != reflect.Slice) ||
+			ltype.Elem().Kind() == reflect.Uint8 || ftype.Kind() == reflect.Chan) {
+			panic(fmt.Sprintf("sorted field %v must be a list of non-byte elements, got %v", field.Name, ftype))
+		}
+		if fopts.BinBigEndian && !fopts.BinFixed32 && !fopts.BinFixed64 {
+			panic(fmt.Sprintf("bigendian field %v must also be fixed32 or fixed64", field.Name))
 		}
 		// NOTE: This is going to change a bit.
 		// NOTE: BinFieldNum starts with 1.
@@ -492,10 +1790,40 @@ func (cdc *Codec) parseStructInfo(rt reflect.Type) (sinfo StructInfo) {
 		checkUnsafe(fieldInfo)
 		infos = append(infos, fieldInfo)
 	}
-	sinfo = StructInfo{infos}
+	sinfo = StructInfo{Fields: infos}
+	if rt != timeType && rt != bigFloatType && rt != urlType && rt != bufferType && !isNetipType(rt) &&
+		isFixedWidthStruct(infos) {
+		sinfo.fixedWidth = true
+		sinfo.fieldKeys = make([][]byte, len(infos))
+		for i, field := range infos {
+			key := new(bytes.Buffer)
+			_ = encodeFieldNumberAndTyp3(key, field.BinFieldNum, typeToTyp3(field.Type, field.FieldOptions))
+			sinfo.fieldKeys[i] = key.Bytes()
+		}
+	}
 	return sinfo
 }
 
+// Returns true iff all fields are integers or bools without custom
+// MarshalAmino encoders, so no field needs a TypeInfo to be encoded.
+func isFixedWidthStruct(infos []FieldInfo) bool {
+	for _, field := range infos {
+		switch field.Type.Kind() {
+		case reflect.Bool,
+			reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		default:
+			return false
+		}
+		if _, ok := field.Type.MethodByName("MarshalAmino"); ok {
+			return false
+		}
+	}
+	return true
+}
+
+// CONTRACT: The caller holds cdc.mtx (read or write locked), since the codec
+// settings for struct fields are read, e.g. SetJSONFieldNameFunc.
 func (cdc *Codec) parseFieldOptions(field reflect.StructField) (skip bool, fopts FieldOptions) {
 	binTag := field.Tag.Get("binary")
 	aminoTag := field.Tag.Get("amino")
@@ -512,6 +1840,9 @@ func (cdc *Codec) parseFieldOptions(field reflect.StructField) (skip bool, fopts
 	jsonTagParts := strings.Split(jsonTag, ",")
 	if jsonTagParts[0] == "" {
 		fopts.JSONName = field.Name
+		if cdc.jsonFieldNameFunc != nil {
+			fopts.JSONName = cdc.jsonFieldNameFunc(field.Name)
+		}
 	} else {
 		fopts.JSONName = jsonTagParts[0]
 	}
@@ -530,17 +1861,50 @@ func (cdc *Codec) parseFieldOptions(field reflect.StructField) (skip bool, fopts
 		fopts.BinFixed32 = true
 	}
 
-	// Parse amino tags.
+	// Parse amino tags.  A comment takes the rest of the tag, commas included.
+	if i := strings.Index(aminoTag, "comment="); i == 0 || (i > 0 && aminoTag[i-1] == ',') {
+		fopts.Comment = aminoTag[i+len("comment="):]
+		aminoTag = strings.TrimSuffix(aminoTag[:i], ",")
+	}
 	aminoTags := strings.Split(aminoTag, ",")
 	for _, aminoTag := range aminoTags {
-		if aminoTag == "unsafe" {
+		switch {
+		case aminoTag == "":
+		// Names accepted besides JSONName when decoding, e.g. for input from
+		// several sources, as in `amino:"jsonaliases=ts;time"`.
+		case strings.HasPrefix(aminoTag, "jsonaliases="):
+			for _, alias := range strings.Split(strings.TrimPrefix(aminoTag, "jsonaliases="), ";") {
+				if alias != "" {
+					fopts.JSONAliases = append(fopts.JSONAliases, alias)
+				}
+			}
+		case aminoTag == "unsafe":
 			fopts.Unsafe = true
-		}
-		if aminoTag == "write_empty" {
+		case aminoTag == "write_empty":
 			fopts.WriteEmpty = true
-		}
-		if aminoTag == "empty_elements" {
+		case aminoTag == "empty_elements":
 			fopts.EmptyElements = true
+		case aminoTag == "drain_chan":
+			fopts.DrainChan = true
+		// Same as `binary:"fixed64"` and `binary:"fixed32"`.
+		case aminoTag == "fixed64":
+			fopts.BinFixed64 = true
+		case aminoTag == "fixed32":
+			fopts.BinFixed32 = true
+		// For interop with big-endian formats, requires fixed32 or fixed64,
+		// e.g. `amino:"fixed64,bigendian"`.
+		case aminoTag == "bigendian":
+			fopts.BinBigEndian = true
+		// For interop with readers that don't accept packed lists.
+		case aminoTag == "unpacked":
+			fopts.BinUnpacked = true
+		// For canonical encodings of sets, e.g. for hashing.
+		case aminoTag == "sorted":
+			fopts.BinSorted = true
+		// Anything else is a validator, e.g. "min=1" or "nonempty".  Unknown
+		// validators fail validation, so encoding isn't affected.
+		default:
+			fopts.Validators = append(fopts.Validators, parseFieldValidator(aminoTag))
 		}
 	}
 
@@ -552,7 +1916,7 @@ func (cdc *Codec) newTypeInfoUnregistered(rt reflect.Type) *TypeInfo {
 	if rt.Kind() == reflect.Ptr {
 		panic("unexpected pointer type") // should not happen.
 	}
-	if rt.Kind() == reflect.Interface {
+	if rt.Kind() == reflect.Interface && rt != ioReaderType {
 		panic("unexpected interface type") // should not happen.
 	}
 
@@ -575,6 +1939,20 @@ func (cdc *Codec) newTypeInfoUnregistered(rt reflect.Type) *TypeInfo {
 	return info
 }
 
+// Returns an error if the MarshalAmino and UnmarshalAmino methods of the type
+// of info have different repr types, as values wouldn't decode from what
+// they encode to.
+func checkAminoReprTypes(info *TypeInfo) error {
+	if !info.IsAminoMarshaler || !info.IsAminoUnmarshaler ||
+		info.AminoMarshalReprType == info.AminoUnmarshalReprType {
+		return nil
+	}
+	mrm, _ := info.Type.MethodByName("MarshalAmino")
+	urm, _ := info.PtrToType.MethodByName("UnmarshalAmino")
+	return fmt.Errorf("MarshalAmino and UnmarshalAmino of %v should have the same repr type; got %v and %v",
+		info.Type, mrm.Type, urm.Type)
+}
+
 func (cdc *Codec) newTypeInfoFromInterfaceType(rt reflect.Type, iopts *InterfaceOptions) *TypeInfo {
 	if rt.Kind() != reflect.Interface {
 		panic(fmt.Sprintf("expected interface type, got %v", rt))
@@ -607,6 +1985,9 @@ func (cdc *Codec) newTypeInfoFromRegisteredConcreteType(rt reflect.Type, pointer
 	}
 
 	var info = cdc.newTypeInfoUnregistered(rt)
+	if err := checkAminoReprTypes(info); err != nil {
+		panic(err.Error())
+	}
 	info.ConcreteInfo.Registered = true
 	info.ConcreteInfo.PointerPreferred = pointerPreferred
 	info.ConcreteInfo.Name = name
@@ -615,14 +1996,65 @@ func (cdc *Codec) newTypeInfoFromRegisteredConcreteType(rt reflect.Type, pointer
 	if copts != nil {
 		info.ConcreteOptions = *copts
 	}
+	if len(info.ConcreteOptions.FieldOrder) > 0 {
+		if rt.Kind() != reflect.Struct || rt == timeType {
+			panic(fmt.Sprintf("FieldOrder is only supported for structs, got %v", rt))
+		}
+		info.StructInfo = orderStructFields(rt, info.StructInfo, info.ConcreteOptions.FieldOrder)
+	}
+	if info.ConcreteOptions.JSONArray {
+		if rt.Kind() != reflect.Struct || rt == timeType || info.IsAminoMarshaler {
+			panic(fmt.Sprintf("JSONArray is only supported for structs, got %v", rt))
+		}
+	}
 	return info
 }
 
+// Returns sinfo with its fields reordered by name according to order.
+func orderStructFields(rt reflect.Type, sinfo StructInfo, order []string) StructInfo {
+	if len(order) != len(sinfo.Fields) {
+		panic(fmt.Sprintf("FieldOrder of %v must list all %v fields, got %v", rt, len(sinfo.Fields), order))
+	}
+	var ordered = StructInfo{
+		Fields:     make([]FieldInfo, 0, len(order)),
+		fixedWidth: sinfo.fixedWidth,
+		positions:  make([]int, len(order)),
+	}
+	var seen = make(map[string]bool, len(order))
+	for pos, name := range order {
+		if seen[name] {
+			panic(fmt.Sprintf("duplicate field %v in FieldOrder of %v", name, rt))
+		}
+		seen[name] = true
+		var found = false
+		for i, field := range sinfo.Fields {
+			if field.Name != name {
+				continue
+			}
+			ordered.Fields = append(ordered.Fields, field)
+			if sinfo.fixedWidth {
+				ordered.fieldKeys = append(ordered.fieldKeys, sinfo.fieldKeys[i])
+			}
+			ordered.positions[field.BinFieldNum-1] = pos
+			found = true
+			break
+		}
+		if !found {
+			panic(fmt.Sprintf("unknown field %v in FieldOrder of %v", name, rt))
+		}
+	}
+	return ordered
+}
+
 // Find all conflicting prefixes for concrete types
 // that "implement" the interface.  "Implement" in quotes because
 // we only consider the pointer, for extra safety.
 func (cdc *Codec) collectImplementersNolock(info *TypeInfo) {
 	for _, cinfo := range cdc.concreteInfos {
+		if cinfo.Version > 0 && cdc.nameToTypeInfo[cinfo.Name] != cinfo {
+			// Only the latest version is an implementer.
+			continue
+		}
 		if cinfo.PtrToType.Implements(info.Type) {
 			info.Implementers[cinfo.Prefix] = append(
 				info.Implementers[cinfo.Prefix], cinfo)
@@ -634,12 +2066,20 @@ func (cdc *Codec) collectImplementersNolock(info *TypeInfo) {
 // are all registered in the priority list.
 // Returns an error if a disamb conflict is found.
 func (cdc *Codec) checkConflictsInPrioNolock(iinfo *TypeInfo) error {
+	if len(iinfo.OneofVariants) > 0 {
+		// Oneof variants are identified by field number, not prefix bytes.
+		return nil
+	}
 
 	for _, cinfos := range iinfo.Implementers {
 		if len(cinfos) < 2 {
 			continue
 		}
 		for _, cinfo := range cinfos {
+			if cinfo.ConcreteOptions.NoDisamb {
+				return errors.Errorf("%v has NoDisamb set, but conflicts with %v other(s) for %v.",
+					cinfo.Type, len(cinfos)-1, iinfo.Type)
+			}
 			var inPrio = false
 			for _, disfix := range iinfo.InterfaceInfo.Priority {
 				if cinfo.GetDisfix() == disfix {
@@ -657,6 +2097,11 @@ func (cdc *Codec) checkConflictsInPrioNolock(iinfo *TypeInfo) error {
 
 func (cdc *Codec) addCheckConflictsWithConcreteNolock(cinfo *TypeInfo) {
 
+	// The previous implementers of the interfaces updated so far, to return
+	// to the previous state upon a conflict.
+	var updated []*TypeInfo
+	var origImplss [][]*TypeInfo
+
 	// Iterate over registered interfaces that this "implements".
 	// "Implement" in quotes because we only consider the pointer, for extra
 	// safety.
@@ -667,6 +2112,11 @@ func (cdc *Codec) addCheckConflictsWithConcreteNolock(cinfo *TypeInfo) {
 
 		// Add cinfo to iinfo.Implementers.
 		var origImpls = iinfo.Implementers[cinfo.Prefix]
+		updated = append(updated, iinfo)
+		origImplss = append(origImplss, append([]*TypeInfo(nil), origImpls...))
+		if replaceVersion(origImpls, cinfo) {
+			continue
+		}
 		iinfo.Implementers[cinfo.Prefix] = append(origImpls, cinfo)
 
 		// Finally, check that all conflicts are in `.Priority`.
@@ -674,12 +2124,36 @@ func (cdc *Codec) addCheckConflictsWithConcreteNolock(cinfo *TypeInfo) {
 		err := cdc.checkConflictsInPrioNolock(iinfo)
 		if err != nil {
 			// Return to previous state.
-			iinfo.Implementers[cinfo.Prefix] = origImpls
+			for i, iinfo := range updated {
+				if len(origImplss[i]) == 0 {
+					delete(iinfo.Implementers, cinfo.Prefix)
+				} else {
+					iinfo.Implementers[cinfo.Prefix] = origImplss[i]
+				}
+			}
 			panic(err)
 		}
 	}
 }
 
+// If cinfos has another version of cinfo, replaces it with cinfo if that is
+// later, and returns true, so that only the latest version is an
+// implementer of interfaces.
+func replaceVersion(cinfos []*TypeInfo, cinfo *TypeInfo) bool {
+	if cinfo.Version == 0 {
+		return false
+	}
+	for i, other := range cinfos {
+		if other.Name == cinfo.Name && other.Version > 0 {
+			if other.Version < cinfo.Version {
+				cinfos[i] = cinfo
+			}
+			return true
+		}
+	}
+	return false
+}
+
 //----------------------------------------
 // .String()
 
@@ -690,9 +2164,14 @@ func (ti TypeInfo) String() string {
 	if ti.Type.Kind() == reflect.Interface {
 		buf.Write([]byte(fmt.Sprintf("Priority:%v,", ti.Priority)))
 		buf.Write([]byte("Implementers:{"))
-		for pb, cinfos := range ti.Implementers {
+		var pbs = make([]PrefixBytes, 0, len(ti.Implementers))
+		for pb := range ti.Implementers {
+			pbs = append(pbs, pb)
+		}
+		sort.Slice(pbs, func(i, j int) bool { return bytes.Compare(pbs[i][:], pbs[j][:]) < 0 })
+		for _, pb := range pbs {
 			buf.Write([]byte(fmt.Sprintf("\"%X\":", pb)))
-			buf.Write([]byte(fmt.Sprintf("%v,", cinfos)))
+			buf.Write([]byte(fmt.Sprintf("%v,", ti.Implementers[pb])))
 		}
 		buf.Write([]byte("}"))
 		buf.Write([]byte(fmt.Sprintf("Priority:%v,", ti.InterfaceOptions.Priority)))
@@ -721,6 +2200,10 @@ func (ti TypeInfo) String() string {
 //----------------------------------------
 // Misc.
 
+// Unexported fields (including embedded structs of unexported types) are
+// always skipped by parseStructInfo, so they are neither encoded nor decoded,
+// in binary or JSON.  Encoders and decoders only access the fields listed in
+// StructInfo, since reflect panics when setting an unexported field.
 func isExported(field reflect.StructField) bool {
 	// Test 1:
 	if field.PkgPath != "" {
@@ -3,6 +3,10 @@ package amino_test
 import (
 	"bytes"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -250,3 +254,784 @@ func TestCodecSeal(t *testing.T) {
 	assert.Panics(t, func() { cdc.RegisterInterface((*Bar)(nil), nil) })
 	assert.Panics(t, func() { cdc.RegisterConcrete(int(0), "int", nil) })
 }
+
+type pluginIface interface{}
+
+type pluginA struct{ Value string }
+
+type pluginB struct{ Value string }
+
+func TestCodecUnregisteredHandler(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*pluginIface)(nil), nil)
+
+	type Holder struct {
+		Plugin pluginIface
+	}
+
+	// Without a handler, encoding fails.
+	_, err := cdc.MarshalBinaryBare(Holder{pluginA{"a"}})
+	assert.Error(t, err)
+
+	var seen []reflect.Type
+	cdc.SetUnregisteredHandler(func(rt reflect.Type) error {
+		seen = append(seen, rt)
+		if rt == reflect.TypeOf(pluginB{}) {
+			return errors.New("pluginB is not allowed")
+		}
+		// Register lazily, with a name derived from the type.
+		cdc.RegisterConcrete(reflect.New(rt).Elem().Interface(), "plugin/"+rt.Name(), nil)
+		return nil
+	})
+
+	// The handler registers pluginA on first use, and encoding proceeds.
+	bz, err := cdc.MarshalBinaryBare(Holder{pluginA{"a"}})
+	require.NoError(t, err)
+	var h Holder
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &h))
+	assert.Equal(t, Holder{pluginA{"a"}}, h)
+
+	// Once registered, the handler isn't called again.
+	jbz, err := cdc.MarshalJSON(Holder{pluginA{"a"}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Plugin":{"type":"plugin/pluginA","value":{"Value":"a"}}}`, string(jbz))
+	assert.Equal(t, []reflect.Type{reflect.TypeOf(pluginA{})}, seen)
+
+	// Errors returned by the handler are returned as is.
+	_, err = cdc.MarshalBinaryBare(Holder{pluginB{"b"}})
+	assert.EqualError(t, err, "pluginB is not allowed")
+	_, err = cdc.MarshalJSON(Holder{pluginB{"b"}})
+	assert.EqualError(t, err, "pluginB is not allowed")
+}
+
+type schemaShape interface{}
+
+type schemaPoint struct {
+	X int32 `binary:"fixed32"`
+	Y int32 `binary:"fixed32"`
+}
+
+type schemaPolygon struct {
+	Label  string `json:"label"`
+	Points []*schemaPoint
+	Center schemaPoint
+	Raw    []byte
+	When   time.Time
+}
+
+func TestCodecSchema(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*schemaShape)(nil), nil)
+	cdc.RegisterConcrete(schemaPolygon{}, "schema/polygon", nil)
+	cdc.RegisterConcrete(&schemaPoint{}, "schema/point", nil)
+
+	bz, err := cdc.Schema()
+	require.NoError(t, err)
+	var schema amino.Schema
+	require.NoError(t, json.Unmarshal(bz, &schema))
+
+	const pkg = "github.com/tendermint/go-amino_test."
+	assert.Equal(t, amino.SchemaVersion, schema.SchemaVersion)
+	assert.Equal(t, []amino.SchemaInterface{{
+		Type:            pkg + "schemaShape",
+		Implementations: []string{"schema/point", "schema/polygon"},
+	}}, schema.Interfaces)
+
+	// Registered types come first by name, then referenced types, each only once.
+	require.Len(t, schema.Types, 2)
+	point, polygon := schema.Types[0], schema.Types[1]
+	_, prefix := amino.NameToDisfix("schema/polygon")
+	assert.Equal(t, pkg+"schemaPolygon", polygon.Type)
+	assert.Equal(t, "struct", polygon.Kind)
+	assert.Equal(t, "schema/polygon", polygon.Name)
+	assert.Equal(t, fmt.Sprintf("%X", prefix.Bytes()), polygon.Prefix)
+	assert.Equal(t, []amino.SchemaField{
+		{Name: "Label", JSONName: "label", Number: 1, Kind: "string", Type: "string", Typ3: "ByteLength"},
+		{Name: "Points", JSONName: "Points", Number: 2, Kind: "slice", Type: "[]*amino_test.schemaPoint",
+			Typ3: "ByteLength", Repeated: true, Elem: pkg + "schemaPoint"},
+		{Name: "Center", JSONName: "Center", Number: 3, Kind: "struct", Type: pkg + "schemaPoint", Typ3: "ByteLength"},
+		{Name: "Raw", JSONName: "Raw", Number: 4, Kind: "slice", Type: "[]uint8", Typ3: "ByteLength"},
+		{Name: "When", JSONName: "When", Number: 5, Kind: "struct", Type: "time.Time", Typ3: "ByteLength"},
+	}, polygon.Fields)
+	assert.Equal(t, "schema/point", point.Name)
+	assert.Equal(t, []amino.SchemaField{
+		{Name: "X", JSONName: "X", Number: 1, Kind: "int32", Type: "int32", Typ3: "4Byte", Options: []string{"fixed32"}},
+		{Name: "Y", JSONName: "Y", Number: 2, Kind: "int32", Type: "int32", Typ3: "4Byte", Options: []string{"fixed32"}},
+	}, point.Fields)
+}
+
+type dynamicHolder struct {
+	Item interface{}
+}
+
+func TestCodecRegisterConcreteType(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*interface{})(nil), nil)
+
+	rt := reflect.StructOf([]reflect.StructField{
+		{Name: "Height", Type: reflect.TypeOf(int64(0)), Tag: `json:"height"`},
+		{Name: "Memo", Type: reflect.TypeOf("")},
+	})
+	cdc.RegisterConcreteType(rt, "dynamic/Record", nil)
+
+	rv := reflect.New(rt).Elem()
+	rv.Field(0).SetInt(7)
+	rv.Field(1).SetString("hello")
+	holder := dynamicHolder{Item: rv.Interface()}
+
+	bz, err := cdc.MarshalBinaryBare(holder)
+	require.NoError(t, err)
+	var holder2 dynamicHolder
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &holder2))
+	assert.Equal(t, holder, holder2)
+
+	bz, err = cdc.MarshalJSON(holder)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Item":{"type":"dynamic/Record","value":{"height":"7","Memo":"hello"}}}`, string(bz))
+
+	// Pointer types are preferred when decoding, like RegisterConcrete.
+	cdc = amino.NewCodec()
+	cdc.RegisterInterface((*interface{})(nil), nil)
+	cdc.RegisterConcreteType(reflect.PtrTo(rt), "dynamic/Record", nil)
+	bz, err = cdc.MarshalBinaryBare(holder)
+	require.NoError(t, err)
+	holder2 = dynamicHolder{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &holder2))
+	assert.Equal(t, reflect.PtrTo(rt), reflect.TypeOf(holder2.Item))
+
+	assert.Panics(t, func() { cdc.RegisterConcreteType(nil, "dynamic/Nil", nil) })
+	assert.Panics(t, func() { cdc.RegisterConcreteType(reflect.TypeOf(func() {}), "dynamic/Func", nil) })
+	assert.Panics(t, func() { cdc.RegisterConcreteType(reflect.TypeOf((*error)(nil)).Elem(), "dynamic/Error", nil) })
+}
+
+type auditReader interface{ AuditRead() }
+type auditWriter interface{ AuditWrite() }
+
+type auditFile struct{}
+
+func (auditFile) AuditRead()   {}
+func (*auditFile) AuditWrite() {}
+
+type auditPipe struct{}
+
+func (auditPipe) AuditRead() {}
+
+func TestCodecInterfacesFor(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*auditWriter)(nil), nil)
+	cdc.RegisterInterface((*auditReader)(nil), nil)
+	cdc.RegisterConcrete(&auditFile{}, "audit/file", nil)
+	cdc.RegisterConcrete(auditPipe{}, "audit/pipe", nil)
+
+	irts, err := cdc.InterfacesFor(auditFile{})
+	require.NoError(t, err)
+	assert.Equal(t, []reflect.Type{
+		reflect.TypeOf((*auditWriter)(nil)).Elem(),
+		reflect.TypeOf((*auditReader)(nil)).Elem(),
+	}, irts)
+
+	irts, err = cdc.InterfacesFor(&auditPipe{})
+	require.NoError(t, err)
+	assert.Equal(t, []reflect.Type{reflect.TypeOf((*auditReader)(nil)).Elem()}, irts)
+
+	_, err = cdc.InterfacesFor(SimpleStruct{})
+	assert.Error(t, err)
+	_, err = cdc.InterfacesFor(nil)
+	assert.Error(t, err)
+}
+
+func TestCodecRegisterConcreteNameValidation(t *testing.T) {
+	cdc := amino.NewCodec()
+	assert.Panics(t, func() { cdc.RegisterConcrete(SimpleStruct{}, "", nil) }, "empty")
+	assert.Panics(t, func() { cdc.RegisterConcrete(SimpleStruct{}, "test/Simple ", nil) }, "trailing space")
+	assert.Panics(t, func() { cdc.RegisterConcrete(SimpleStruct{}, "test/\tSimple", nil) }, "tab")
+	assert.NotPanics(t, func() { cdc.RegisterConcrete(SimpleStruct{}, "Simple", nil) })
+
+	cdc = amino.NewCodec()
+	cdc.SetRequireNamespacedNames(true)
+	for _, name := range []string{"Simple", "/Simple", "test/"} {
+		assert.Panics(t, func() { cdc.RegisterConcrete(SimpleStruct{}, name, nil) }, name)
+	}
+	assert.NotPanics(t, func() { cdc.RegisterConcrete(SimpleStruct{}, "test/Simple", nil) })
+}
+
+type pluginMsg interface{ Plugin() string }
+
+type pluginPing struct {
+	Seq     uint64
+	decoded bool // Set by the factory, to check it was used.
+}
+
+func (pluginPing) Plugin() string { return "ping" }
+
+type pluginEnvelope struct {
+	Msg pluginMsg
+}
+
+func TestCodecRegisterConcreteFactory(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*pluginMsg)(nil), nil)
+	var calls int
+	cdc.RegisterConcreteFactory("plugin/Ping", func() interface{} {
+		calls++
+		return &pluginPing{decoded: true}
+	}, nil)
+	assert.Equal(t, 1, calls)
+
+	env := pluginEnvelope{Msg: &pluginPing{Seq: 3}}
+	bz, err := cdc.MarshalBinaryBare(env)
+	require.NoError(t, err)
+	var env2 pluginEnvelope
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &env2))
+	assert.Equal(t, &pluginPing{Seq: 3, decoded: true}, env2.Msg)
+	assert.Equal(t, 2, calls)
+
+	bz, err = cdc.MarshalJSON(env)
+	require.NoError(t, err)
+	env2 = pluginEnvelope{}
+	require.NoError(t, cdc.UnmarshalJSON(bz, &env2))
+	assert.Equal(t, &pluginPing{Seq: 3, decoded: true}, env2.Msg)
+	assert.Equal(t, 3, calls)
+
+	// Non-pointer values are copied before decoding.
+	cdc = amino.NewCodec()
+	cdc.RegisterInterface((*pluginMsg)(nil), nil)
+	cdc.RegisterConcreteFactory("plugin/Ping", func() interface{} { return pluginPing{decoded: true} }, nil)
+	env = pluginEnvelope{Msg: pluginPing{Seq: 4}}
+	bz, err = cdc.MarshalBinaryBare(env)
+	require.NoError(t, err)
+	env2 = pluginEnvelope{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &env2))
+	assert.Equal(t, pluginPing{Seq: 4, decoded: true}, env2.Msg)
+
+	// A factory that later returns a nil pointer fails the decode.
+	cdc = amino.NewCodec()
+	cdc.RegisterInterface((*pluginMsg)(nil), nil)
+	calls = 0
+	cdc.RegisterConcreteFactory("plugin/Ping", func() interface{} {
+		calls++
+		if calls > 1 {
+			return (*pluginPing)(nil)
+		}
+		return &pluginPing{}
+	}, nil)
+	env = pluginEnvelope{Msg: &pluginPing{Seq: 5}}
+	bz, err = cdc.MarshalBinaryBare(env)
+	require.NoError(t, err)
+	env2 = pluginEnvelope{}
+	assert.Error(t, cdc.UnmarshalBinaryBare(bz, &env2))
+	bz, err = cdc.MarshalJSON(env)
+	require.NoError(t, err)
+	assert.Error(t, cdc.UnmarshalJSON(bz, &env2))
+
+	assert.Panics(t, func() { cdc.RegisterConcreteFactory("plugin/Nil", nil, nil) })
+	assert.Panics(t, func() { cdc.RegisterConcreteFactory("plugin/Nil", func() interface{} { return nil }, nil) })
+	assert.Panics(t, func() {
+		cdc.RegisterConcreteFactory("plugin/Nil", func() interface{} { return (*pluginPing)(nil) }, nil)
+	})
+}
+
+func TestCodecConcreteDescription(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*schemaShape)(nil), nil)
+	cdc.RegisterConcrete(schemaPolygon{}, "schema/polygon", &amino.ConcreteOptions{
+		Description: "A closed shape.\nPoints are | separated.",
+	})
+	cdc.RegisterConcrete(&schemaPoint{}, "schema/point", nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, cdc.PrintTypes(&buf))
+	lines := strings.Split(buf.String(), "\n")
+	assert.True(t, strings.HasSuffix(lines[2], "|  |"), lines[2])
+	assert.True(t, strings.HasSuffix(lines[3], "| A closed shape. Points are \\| separated. |"), lines[3])
+
+	bz, err := cdc.Schema()
+	require.NoError(t, err)
+	var schema amino.Schema
+	require.NoError(t, json.Unmarshal(bz, &schema))
+	assert.Equal(t, "", schema.Types[0].Description)
+	assert.Equal(t, "A closed shape.\nPoints are | separated.", schema.Types[1].Description)
+
+	// The description doesn't affect the encoding.
+	cdc2 := amino.NewCodec()
+	cdc2.RegisterInterface((*schemaShape)(nil), nil)
+	cdc2.RegisterConcrete(schemaPolygon{}, "schema/polygon", nil)
+	p := schemaPolygon{Label: "tri"}
+	assert.Equal(t, cdc2.MustMarshalBinaryBare(p), cdc.MustMarshalBinaryBare(p))
+}
+
+func TestCodecIntrospectionOrder(t *testing.T) {
+	newCodec := func(reverse bool) *amino.Codec {
+		cdc := amino.NewCodec()
+		if reverse {
+			cdc.RegisterInterface((*hintAnimal)(nil), nil)
+			cdc.RegisterInterface((*schemaShape)(nil), nil)
+			cdc.RegisterConcrete(&schemaPoint{}, "schema/point", nil)
+			cdc.RegisterConcrete(schemaPolygon{}, "schema/polygon", nil)
+		} else {
+			cdc.RegisterInterface((*schemaShape)(nil), nil)
+			cdc.RegisterInterface((*hintAnimal)(nil), nil)
+			cdc.RegisterConcrete(schemaPolygon{}, "schema/polygon", nil)
+			cdc.RegisterConcrete(&schemaPoint{}, "schema/point", nil)
+		}
+		return cdc
+	}
+	var outputs [2]string
+	for i, reverse := range []bool{false, true} {
+		cdc := newCodec(reverse)
+		var buf bytes.Buffer
+		require.NoError(t, cdc.PrintTypes(&buf))
+		bz, err := cdc.Schema()
+		require.NoError(t, err)
+		outputs[i] = buf.String() + string(bz)
+	}
+	assert.Equal(t, outputs[0], outputs[1])
+	assert.True(t, strings.Index(outputs[0], "schema/point") < strings.Index(outputs[0], "schema/polygon"))
+}
+
+type routedMsg interface{}
+
+type routedPayload struct {
+	Data []byte
+}
+
+type routedTx struct {
+	Msgs []routedMsg
+}
+
+func TestRegisterConcreteSeveralNames(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*routedMsg)(nil), nil)
+	cdc.RegisterConcrete(routedPayload{}, "bank/Send", nil)
+	cdc.RegisterConcrete(routedPayload{}, "ibc/Packet", nil)
+	assert.Panics(t, func() { cdc.RegisterConcrete(routedPayload{}, "ibc/Packet", nil) })
+
+	p := routedPayload{Data: []byte("hi")}
+	send, err := cdc.MarshalBinaryBare(p)
+	require.NoError(t, err)
+	packet, err := cdc.MarshalBinaryBareAs("ibc/Packet", p)
+	require.NoError(t, err)
+	assert.NotEqual(t, send[:4], packet[:4], "distinct prefixes")
+	assert.Equal(t, send[4:], packet[4:])
+
+	// Interface values decode as the registration of their prefix.
+	var m routedMsg
+	require.NoError(t, cdc.UnmarshalBinaryBare(packet, &m))
+	assert.Equal(t, p, m)
+
+	// Top-level concrete values expect the first registration by default.
+	var p2 routedPayload
+	require.NoError(t, cdc.UnmarshalBinaryBare(send, &p2))
+	assert.Error(t, cdc.UnmarshalBinaryBare(packet, &p2))
+	require.NoError(t, cdc.UnmarshalBinaryBareAs("ibc/Packet", packet, &p2))
+	assert.Equal(t, p, p2)
+	assert.Error(t, cdc.UnmarshalBinaryBareAs("ibc/Packet", send, &p2))
+	_, err = cdc.MarshalBinaryBareAs("ibc/Unknown", p)
+	assert.Error(t, err)
+	_, err = cdc.MarshalBinaryBareAs("ibc/Packet", routedTx{})
+	assert.Error(t, err, "registered for another type")
+
+	// Likewise in JSON.
+	bz, err := cdc.MarshalJSONAs("ibc/Packet", p)
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"ibc/Packet","value":{"Data":"aGk="}}`, string(bz))
+	var p3 routedPayload
+	assert.Error(t, cdc.UnmarshalJSON(bz, &p3))
+	require.NoError(t, cdc.UnmarshalJSONAs("ibc/Packet", bz, &p3))
+	assert.Equal(t, p, p3)
+	var tx routedTx
+	require.NoError(t, cdc.UnmarshalJSON([]byte(`{"Msgs":[{"type":"ibc/Packet","value":{"Data":"aGk="}}]}`), &tx))
+	assert.Equal(t, routedTx{Msgs: []routedMsg{p}}, tx)
+
+	schema, err := cdc.Schema()
+	require.NoError(t, err)
+	assert.Contains(t, string(schema), `"name": "bank/Send"`)
+	assert.Contains(t, string(schema), `"name": "ibc/Packet"`)
+}
+
+func TestPrefixTable(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*schemaShape)(nil), nil)
+	cdc.RegisterConcrete(&schemaPoint{}, "schema/point", nil)
+	cdc.RegisterConcrete(schemaPolygon{}, "schema/polygon", nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, cdc.ExportPrefixTable(&buf))
+	var table []amino.PrefixTableEntry
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &table))
+	require.Len(t, table, 2)
+	assert.Equal(t, "schema/point", table[0].Name)
+	pb := cdc.MustMarshalBinaryBare(schemaPoint{})[:4]
+	assert.Equal(t, fmt.Sprintf("%x", pb), table[0].Prefix)
+
+	// Another service with some of the types agrees.
+	other := amino.NewCodec()
+	other.RegisterConcrete(schemaPolygon{}, "schema/polygon", nil)
+	require.NoError(t, other.ImportPrefixTable(bytes.NewReader(buf.Bytes())))
+	require.NoError(t, amino.NewCodec().ImportPrefixTable(bytes.NewReader(buf.Bytes())))
+
+	// Entries must match the bytes derived from their names.
+	table[1].Prefix = table[0].Prefix
+	bz, err := json.Marshal(table)
+	require.NoError(t, err)
+	err = other.ImportPrefixTable(bytes.NewReader(bz))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "schema/polygon")
+	}
+	assert.Error(t, other.ImportPrefixTable(strings.NewReader("not a table")))
+}
+
+type versionedMsg interface{}
+
+type transferV1 struct {
+	To     string
+	Amount int64
+}
+
+type transferV2 struct {
+	To     string
+	Amount int64
+	Memo   string
+}
+
+type versionedBatch struct {
+	Msgs []versionedMsg
+}
+
+func TestRegisterConcreteVersions(t *testing.T) {
+	for _, reverse := range []bool{false, true} {
+		cdc := amino.NewCodec()
+		cdc.RegisterInterface((*versionedMsg)(nil), nil)
+		if reverse {
+			cdc.RegisterConcrete(transferV2{}, "bank/Transfer", &amino.ConcreteOptions{Version: 2})
+			cdc.RegisterConcrete(transferV1{}, "bank/Transfer", &amino.ConcreteOptions{Version: 1})
+		} else {
+			cdc.RegisterConcrete(transferV1{}, "bank/Transfer", &amino.ConcreteOptions{Version: 1})
+			cdc.RegisterConcrete(transferV2{}, "bank/Transfer", &amino.ConcreteOptions{Version: 2})
+		}
+
+		// Each value is encoded with the version of its Go type.
+		v1, v2 := transferV1{"alice", 5}, transferV2{"bob", 7, "rent"}
+		batch := versionedBatch{Msgs: []versionedMsg{v1, v2}}
+		bz, err := cdc.MarshalBinaryBare(batch)
+		require.NoError(t, err)
+		var batch2 versionedBatch
+		require.NoError(t, cdc.UnmarshalBinaryBare(bz, &batch2))
+		assert.Equal(t, batch, batch2, "reverse: %v", reverse)
+
+		bz, err = cdc.MarshalJSON(batch)
+		require.NoError(t, err)
+		assert.Contains(t, string(bz), `{"type":"bank/Transfer","version":1,"value":{"To":"alice","Amount":"5"}}`)
+		var batch3 versionedBatch
+		require.NoError(t, cdc.UnmarshalJSON(bz, &batch3))
+		assert.Equal(t, batch, batch3, "reverse: %v", reverse)
+
+		// Top-level values carry the version marker after the prefix too.
+		bz, err = cdc.MarshalBinaryBare(v1)
+		require.NoError(t, err)
+		var m versionedMsg
+		require.NoError(t, cdc.UnmarshalBinaryBare(bz, &m))
+		assert.Equal(t, v1, m)
+		var v2b transferV2
+		err = cdc.UnmarshalBinaryBare(bz, &v2b)
+		if assert.Error(t, err) {
+			assert.Contains(t, err.Error(), "version 2")
+		}
+		bz, err = cdc.MarshalJSON(v1)
+		require.NoError(t, err)
+		assert.Error(t, cdc.UnmarshalJSON(bz, &v2b))
+	}
+
+	cdc := amino.NewCodec()
+	cdc.RegisterConcrete(transferV1{}, "bank/Transfer", &amino.ConcreteOptions{Version: 1})
+	assert.Panics(t, func() {
+		cdc.RegisterConcrete(transferV2{}, "bank/Transfer", &amino.ConcreteOptions{Version: 1})
+	}, "duplicate version")
+	assert.Panics(t, func() {
+		cdc.RegisterConcrete(transferV2{}, "bank/Transfer", nil)
+	}, "unversioned")
+
+	// Unknown versions are rejected.
+	cdc.RegisterInterface((*versionedMsg)(nil), nil)
+	bz, err := cdc.MarshalBinaryBare(versionedBatch{Msgs: []versionedMsg{transferV1{"carol", 1}}})
+	require.NoError(t, err)
+	bz = bytes.Replace(bz, []byte{0x01, 0x0a, 0x05}, []byte{0x03, 0x0a, 0x05}, 1)
+	err = cdc.UnmarshalBinaryBare(bz, &versionedBatch{})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "unrecognized version 3")
+	}
+}
+
+type validatedMsg interface{}
+
+type validatedCoin struct {
+	Denom  string
+	Amount int64
+}
+
+type validatedWallet struct {
+	Coins []validatedCoin
+	Msg   validatedMsg
+}
+
+func TestRegisterConcreteValidate(t *testing.T) {
+	var validated []validatedCoin
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*validatedMsg)(nil), nil)
+	cdc.RegisterConcrete(validatedCoin{}, "test/Coin", &amino.ConcreteOptions{
+		Validate: func(o interface{}) error {
+			coin := o.(validatedCoin)
+			validated = append(validated, coin)
+			if coin.Amount < 0 {
+				return errors.New("amount must be non-negative")
+			}
+			return nil
+		},
+	})
+
+	good := validatedWallet{
+		Coins: []validatedCoin{{"atom", 1}, {"photon", 2}},
+		Msg:   validatedCoin{"atom", 3},
+	}
+	bad := []interface{}{
+		validatedCoin{"atom", -1},
+		validatedWallet{Coins: []validatedCoin{{"atom", 1}, {"photon", -2}}},
+		validatedWallet{Msg: validatedCoin{"atom", -3}},
+	}
+
+	// Every instance is validated, wherever it appears.
+	bz, err := cdc.MarshalBinaryBare(good)
+	require.NoError(t, err)
+	var w validatedWallet
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &w))
+	assert.Equal(t, good, w)
+	assert.Equal(t, []validatedCoin{{"atom", 1}, {"photon", 2}, {"atom", 3}}, validated)
+
+	validated = nil
+	js, err := cdc.MarshalJSON(good)
+	require.NoError(t, err)
+	w = validatedWallet{}
+	require.NoError(t, cdc.UnmarshalJSON(js, &w))
+	assert.Equal(t, good, w)
+	assert.Len(t, validated, 3)
+
+	for _, o := range bad {
+		ptr := reflect.New(reflect.TypeOf(o))
+		bz, err := cdc.MarshalBinaryBare(o)
+		require.NoError(t, err, "not validated when encoding")
+		err = cdc.UnmarshalBinaryBare(bz, ptr.Interface())
+		if assert.Error(t, err, "%v", o) {
+			assert.Contains(t, err.Error(), "invalid test/Coin: amount must be non-negative")
+		}
+
+		js, err := cdc.MarshalJSON(o)
+		require.NoError(t, err)
+		err = cdc.UnmarshalJSON(js, ptr.Interface())
+		if assert.Error(t, err, "%v", o) {
+			assert.Contains(t, err.Error(), "invalid test/Coin: amount must be non-negative")
+		}
+	}
+}
+
+type equalAddr struct {
+	Addr string
+	Memo string
+}
+
+func TestRegisterConcreteEqual(t *testing.T) {
+	a, b := equalAddr{Addr: "cosmos1ABC"}, equalAddr{Addr: "COSMOS1abc"}
+
+	// Without ConcreteOptions.Equal, encodings are compared.
+	cdc := amino.NewCodec()
+	eq, err := cdc.EqualBinary(a, b)
+	require.NoError(t, err)
+	assert.False(t, eq)
+	eq, err = cdc.EqualBinary(a, equalAddr{Addr: "cosmos1ABC"})
+	require.NoError(t, err)
+	assert.True(t, eq)
+
+	cdc = amino.NewCodec()
+	cdc.RegisterConcrete(equalAddr{}, "test/Addr", &amino.ConcreteOptions{
+		Equal: func(a, b interface{}) bool {
+			var x, y equalAddr
+			switch a := a.(type) {
+			case equalAddr:
+				x, y = a, b.(equalAddr)
+			case *equalAddr:
+				x, y = *a, *b.(*equalAddr)
+			}
+			return strings.EqualFold(x.Addr, y.Addr) && x.Memo == y.Memo
+		},
+	})
+	eq, err = cdc.EqualBinary(a, b)
+	require.NoError(t, err)
+	assert.True(t, eq)
+	eq, err = cdc.EqualBinary(&a, &b)
+	require.NoError(t, err)
+	assert.True(t, eq)
+	eq, err = cdc.EqualBinary(a, &b)
+	require.NoError(t, err)
+	assert.False(t, eq, "different types")
+
+	// Fields are ignored before calling Equal.
+	c := equalAddr{Addr: "Cosmos1Abc", Memo: "hi"}
+	eq, err = cdc.EqualBinary(a, c)
+	require.NoError(t, err)
+	assert.False(t, eq)
+	eq, err = cdc.EqualBinaryIgnoring(a, c, "Memo")
+	require.NoError(t, err)
+	assert.True(t, eq)
+
+	deduped, err := cdc.DedupBinary([]interface{}{a, "x", b, c, "x", &a, uint8(1), &b})
+	require.NoError(t, err)
+	assert.Equal(t, []interface{}{a, "x", c, &a, uint8(1)}, deduped)
+}
+
+type legacyCoin struct {
+	Amount int64
+}
+
+type legacyWallet struct {
+	Coin  interface{}
+	Coins []legacyCoin
+}
+
+func TestRegisterConcreteDeprecated(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*interface{})(nil), nil)
+	cdc.RegisterConcrete(legacyCoin{}, "test/LegacyCoin", &amino.ConcreteOptions{Deprecated: true})
+	cdc.RegisterConcrete(legacyWallet{}, "test/LegacyWallet", nil)
+
+	// Without a logger, deprecated types are encoded silently.
+	w := legacyWallet{Coin: legacyCoin{1}, Coins: []legacyCoin{{2}, {3}}}
+	bz, err := cdc.MarshalBinaryBare(w)
+	require.NoError(t, err)
+
+	var warnings []string
+	cdc.SetWarnLogger(func(msg string) { warnings = append(warnings, msg) })
+	bz2, err := cdc.MarshalBinaryBare(w)
+	require.NoError(t, err)
+	assert.Equal(t, bz, bz2, "still encoded as usual")
+	require.Len(t, warnings, 1, "warned once per type")
+	assert.Contains(t, warnings[0], "test/LegacyCoin")
+
+	_, err = cdc.MarshalJSON(&w)
+	require.NoError(t, err)
+	_, err = cdc.MarshalBinaryBare(legacyCoin{4})
+	require.NoError(t, err)
+	assert.Len(t, warnings, 1)
+
+	// Decoding is silent.
+	var w2 legacyWallet
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &w2))
+	assert.Equal(t, w, w2)
+	assert.Len(t, warnings, 1)
+
+	// JSON warns too.
+	cdc = amino.NewCodec()
+	cdc.RegisterConcrete(legacyCoin{}, "test/LegacyCoin", &amino.ConcreteOptions{Deprecated: true})
+	warnings = nil
+	cdc.SetWarnLogger(func(msg string) { warnings = append(warnings, msg) })
+	_, err = cdc.MarshalJSON(legacyCoin{5})
+	require.NoError(t, err)
+	assert.Len(t, warnings, 1)
+}
+
+type pluginFloat struct {
+	Ratio float64
+}
+
+func (pluginFloat) Plugin() string { return "float" }
+
+func TestCodecTryRegister(t *testing.T) {
+	cdc := amino.NewCodec()
+	require.NoError(t, cdc.TryRegisterInterface((*pluginMsg)(nil), nil))
+	require.NoError(t, cdc.TryRegisterConcrete(&pluginPing{}, "plugin/Ping", nil))
+
+	for _, tc := range []struct {
+		o    interface{}
+		name string
+	}{
+		{&pluginPing{}, "plugin/Ping"},    // Already registered.
+		{pluginEnvelope{}, "plugin/Ping"}, // Name taken.
+		{pluginEnvelope{}, "plugin Env"},  // Invalid name.
+		{pluginFloat{}, "plugin/Float"},   // Unsafe field.
+		{new(*pluginPing), "plugin/PP"},   // Pointer-pointer.
+		{nil, "plugin/Nil"},
+	} {
+		assert.Error(t, cdc.TryRegisterConcrete(tc.o, tc.name, nil), "%T %v", tc.o, tc.name)
+	}
+	assert.Error(t, cdc.TryRegisterInterface(pluginPing{}, nil))
+	assert.Error(t, cdc.TryRegisterInterface(new(pluginPing), nil))
+	assert.Error(t, cdc.TryRegisterInterface(nil, nil))
+
+	// Failed registrations leave the codec unchanged.
+	env := pluginEnvelope{Msg: &pluginPing{Seq: 3}}
+	bz, err := cdc.MarshalBinaryBare(env)
+	require.NoError(t, err)
+	var env2 pluginEnvelope
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &env2))
+	assert.Equal(t, env, env2)
+	require.NoError(t, cdc.TryRegisterConcrete(pluginEnvelope{}, "plugin/Env", nil))
+
+	cdc.Seal()
+	assert.Error(t, cdc.TryRegisterConcrete(pluginFloat{}, "plugin/Float2", nil))
+	assert.Error(t, cdc.TryRegisterInterface((*validatedMsg)(nil), nil))
+}
+
+func TestCodecRegisterConcreteWithID(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc.RegisterInterface((*pluginMsg)(nil), nil)
+	cdc.RegisterConcreteWithID(hintCat{}, "zoo/Cat", 1, nil)
+	cdc.RegisterConcreteWithID(hintDog{}, "zoo/Dog", 300, nil)
+	cdc.RegisterConcreteWithID(&pluginPing{}, "plugin/Ping", 2, nil)
+	cdc.RegisterConcrete(hintCatV2{}, "zoo/CatV2", nil)
+
+	assert.Panics(t, func() { cdc.RegisterConcreteWithID(pluginEnvelope{}, "plugin/Env", 1, nil) })
+	assert.Panics(t, func() { cdc.RegisterConcreteWithID(pluginEnvelope{}, "plugin/Env", 0, nil) })
+	assert.Error(t, cdc.TryRegisterConcrete(hintZoo{}, "zoo/Cat", nil))
+
+	// Prefix bytes until enabled.
+	zoo := hintZoo{Star: hintCat{"Tom"}, Animals: []hintAnimal{hintDog{"Rex"}}}
+	bz, err := cdc.MarshalBinaryBare(zoo)
+	require.NoError(t, err)
+	assert.Len(t, bz, 22)
+
+	cdc.EnableCompactInterfaceIDs()
+	bz, err = cdc.MarshalBinaryBare(zoo)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{
+		0x0A, 0x06, 0x01, 0x0A, 0x03, 'T', 'o', 'm',
+		0x12, 0x07, 0xAC, 0x02, 0x0A, 0x03, 'R', 'e', 'x',
+	}, bz)
+	var zoo2 hintZoo
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &zoo2))
+	assert.Equal(t, zoo, zoo2)
+
+	// Types without IDs can't be encoded in interfaces.
+	_, err = cdc.MarshalBinaryBare(hintZoo{Star: hintCatV2{"Tom", 1}})
+	assert.Error(t, err)
+
+	// IDs must be registered, for an implementation of the interface.
+	zoo2 = hintZoo{}
+	err = cdc.UnmarshalBinaryBare([]byte{0x0A, 0x01, 0x03}, &zoo2)
+	assert.Error(t, err)
+	zoo2 = hintZoo{}
+	err = cdc.UnmarshalBinaryBare([]byte{0x0A, 0x01, 0x02}, &zoo2)
+	assert.Error(t, err)
+
+	// Each version of a name has its own ID.
+	cdc = amino.NewCodec()
+	cdc.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc.RegisterConcreteWithID(hintCat{}, "zoo/Cat", 1, &amino.ConcreteOptions{Version: 1})
+	cdc.RegisterConcreteWithID(hintCatV2{}, "zoo/Cat", 2, &amino.ConcreteOptions{Version: 2})
+	cdc.EnableCompactInterfaceIDs()
+	zoo = hintZoo{Star: hintCat{"Tom"}, Animals: []hintAnimal{hintCatV2{"Felix", 3}}}
+	bz, err = cdc.MarshalBinaryBare(zoo)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x0A, 0x06, 0x01, 0x0A, 0x03, 'T', 'o', 'm'}, bz[:8])
+	zoo2 = hintZoo{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &zoo2))
+	assert.Equal(t, zoo, zoo2)
+}
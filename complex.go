@@ -0,0 +1,66 @@
+package amino
+
+import (
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+//----------------------------------------
+// Complex numbers
+
+// complex64 and complex128 values are encoded as these structs, see
+// Codec.SetAllowComplex.
+type complex64Repr struct {
+	Real float32 `json:"real" amino:"unsafe"`
+	Imag float32 `json:"imag" amino:"unsafe"`
+}
+
+type complex128Repr struct {
+	Real float64 `json:"real" amino:"unsafe"`
+	Imag float64 `json:"imag" amino:"unsafe"`
+}
+
+var (
+	complex64ReprType  = reflect.TypeOf(complex64Repr{})
+	complex128ReprType = reflect.TypeOf(complex128Repr{})
+)
+
+// Returns an error unless complex values with the field options fopts can be
+// encoded or decoded, where allow is set by Codec.SetAllowComplex.
+func checkComplex(fopts FieldOptions, allow bool) error {
+	if !fopts.Unsafe {
+		return errors.New("amino complex* support requires `amino:\"unsafe\"`")
+	}
+	if !allow {
+		return errors.New("amino complex* support requires Codec.SetAllowComplex(true)")
+	}
+	return nil
+}
+
+// Returns the repr type of the complex type rt, and its TypeInfo.
+func (cdc *Codec) getComplexReprInfo(rt reflect.Type) (*TypeInfo, error) {
+	if rt.Kind() == reflect.Complex64 {
+		return cdc.getTypeInfoWlock(complex64ReprType)
+	}
+	return cdc.getTypeInfoWlock(complex128ReprType)
+}
+
+// Returns the repr of the complex value rv.
+func toComplexRepr(rv reflect.Value) reflect.Value {
+	c := rv.Complex()
+	if rv.Kind() == reflect.Complex64 {
+		return reflect.ValueOf(complex64Repr{float32(real(c)), float32(imag(c))})
+	}
+	return reflect.ValueOf(complex128Repr{real(c), imag(c)})
+}
+
+// Sets the complex value rv from its repr rrv.
+func setComplexFromRepr(rv, rrv reflect.Value) {
+	switch repr := rrv.Interface().(type) {
+	case complex64Repr:
+		rv.SetComplex(complex128(complex(repr.Real, repr.Imag)))
+	case complex128Repr:
+		rv.SetComplex(complex(repr.Real, repr.Imag))
+	}
+}
@@ -0,0 +1,39 @@
+package amino
+
+import (
+	"context"
+)
+
+//----------------------------------------
+// Context
+
+type codecContextKey struct{}
+
+// WithCodec returns a copy of ctx that carries cdc.
+// Use CodecFromContext to retrieve it, e.g. from request middleware
+// that selects a per-tenant type registry.
+func WithCodec(ctx context.Context, cdc *Codec) context.Context {
+	return context.WithValue(ctx, codecContextKey{}, cdc)
+}
+
+// CodecFromContext returns the *Codec carried by ctx.
+// If ctx carries no codec (or a nil one), the global sealed codec is
+// returned, so the result is never nil.
+func CodecFromContext(ctx context.Context) *Codec {
+	if cdc, ok := ctx.Value(codecContextKey{}).(*Codec); ok && cdc != nil {
+		return cdc
+	}
+	return gcdc
+}
+
+// MarshalBinaryBareCtx is like MarshalBinaryBare, but uses the codec
+// resolved from ctx via CodecFromContext.
+func MarshalBinaryBareCtx(ctx context.Context, o interface{}) ([]byte, error) {
+	return CodecFromContext(ctx).MarshalBinaryBare(o)
+}
+
+// UnmarshalBinaryBareCtx is like UnmarshalBinaryBare, but uses the codec
+// resolved from ctx via CodecFromContext.
+func UnmarshalBinaryBareCtx(ctx context.Context, bz []byte, ptr interface{}) error {
+	return CodecFromContext(ctx).UnmarshalBinaryBare(bz, ptr)
+}
@@ -0,0 +1,49 @@
+package amino_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	amino "github.com/tendermint/go-amino"
+)
+
+type tenantMsg struct {
+	Value string
+}
+
+func TestCodecFromContext(t *testing.T) {
+	// Without a codec, the global codec is returned.
+	assert.NotNil(t, amino.CodecFromContext(context.Background()))
+
+	cdc := amino.NewCodec()
+	ctx := amino.WithCodec(context.Background(), cdc)
+	assert.True(t, cdc == amino.CodecFromContext(ctx))
+
+	// A nil codec falls back to the global codec.
+	ctx = amino.WithCodec(context.Background(), nil)
+	assert.NotNil(t, amino.CodecFromContext(ctx))
+}
+
+func TestMarshalUnmarshalBinaryBareCtx(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterConcrete(tenantMsg{}, "tenant/Msg", nil)
+	ctx := amino.WithCodec(context.Background(), cdc)
+
+	bz, err := amino.MarshalBinaryBareCtx(ctx, tenantMsg{"hello"})
+	require.NoError(t, err)
+	// The registered prefix comes from the context's codec.
+	assert.Equal(t, cdc.MustMarshalBinaryBare(tenantMsg{"hello"}), bz)
+	assert.NotEqual(t, amino.MustMarshalBinaryBare(tenantMsg{"hello"}), bz)
+
+	var msg tenantMsg
+	err = amino.UnmarshalBinaryBareCtx(ctx, bz, &msg)
+	require.NoError(t, err)
+	assert.Equal(t, tenantMsg{"hello"}, msg)
+
+	// The global codec doesn't know about the registration.
+	err = amino.UnmarshalBinaryBareCtx(context.Background(), bz, &msg)
+	assert.Error(t, err)
+}
@@ -18,7 +18,7 @@ func DecodeInt8(bz []byte) (i int8, n int, err error) {
 		return
 	}
 	if i64 < int64(math.MinInt8) || i64 > int64(math.MaxInt8) {
-		err = errors.New("EOF decoding int8")
+		err = errors.New("integer overflow decoding int8")
 		return
 	}
 	i = int8(i64)
@@ -32,7 +32,7 @@ func DecodeInt16(bz []byte) (i int16, n int, err error) {
 		return
 	}
 	if i64 < int64(math.MinInt16) || i64 > int64(math.MaxInt16) {
-		err = errors.New("EOF decoding int16")
+		err = errors.New("integer overflow decoding int16")
 		return
 	}
 	i = int16(i64)
@@ -88,7 +88,7 @@ func DecodeUint8(bz []byte) (u uint8, n int, err error) {
 		return
 	}
 	if u64 > uint64(math.MaxUint8) {
-		err = errors.New("EOF decoding uint8")
+		err = errors.New("integer overflow decoding uint8")
 		return
 	}
 	u = uint8(u64)
@@ -100,7 +100,7 @@ func DecodeUint16(bz []byte) (u uint16, n int, err error) {
 		return
 	}
 	if u64 > uint64(math.MaxUint16) {
-		err = errors.New("EOF decoding uint16")
+		err = errors.New("integer overflow decoding uint16")
 		return
 	}
 	u = uint16(u64)
@@ -146,6 +146,8 @@ func DecodeUvarint(bz []byte) (u uint64, n int, err error) {
 //----------------------------------------
 // Other
 
+// DecodeBool decodes a single 0x00 (false) or 0x01 (true) byte.  Any other
+// byte is invalid, rather than true, as is any non-minimal varint.
 func DecodeBool(bz []byte) (b bool, n int, err error) {
 	const size int = 1
 	if len(bz) < size {
@@ -158,7 +160,7 @@ func DecodeBool(bz []byte) (b bool, n int, err error) {
 	case 1:
 		b = true
 	default:
-		err = errors.New("invalid bool")
+		err = fmt.Errorf("invalid bool byte 0x%02X, must be 0x00 or 0x01", bz[0])
 	}
 	n = size
 	return
@@ -278,23 +280,34 @@ func decodeNanos(bz *[]byte, n *int) (int32, error) {
 }
 
 func DecodeByteSlice(bz []byte) (bz2 []byte, n int, err error) {
-	var count uint64
-	var _n int
-	count, _n, err = DecodeUvarint(bz)
-	if slide(&bz, &n, _n) && err != nil {
+	var count int
+	count, n, err = decodeByteSliceLength(bz)
+	if err != nil {
 		return
 	}
-	if int(count) < 0 {
-		err = fmt.Errorf("invalid negative length %v decoding []byte", count)
+	bz2 = make([]byte, count)
+	copy(bz2, bz[n:n+count])
+	n += count
+	return
+}
+
+// Decodes the length prefix of a byte slice, checking that bz has that many
+// bytes after it.  n is the size of the prefix.
+func decodeByteSliceLength(bz []byte) (count int, n int, err error) {
+	var ucount uint64
+	ucount, n, err = DecodeUvarint(bz)
+	if err != nil {
 		return
 	}
-	if len(bz) < int(count) {
-		err = fmt.Errorf("insufficient bytes decoding []byte of length %v", count)
+	count = int(ucount)
+	if count < 0 {
+		err = fmt.Errorf("invalid negative length %v decoding []byte", ucount)
+		return
+	}
+	if len(bz)-n < count {
+		err = fmt.Errorf("insufficient bytes decoding []byte of length %v", ucount)
 		return
 	}
-	bz2 = make([]byte, count)
-	copy(bz2, bz[0:count])
-	n += int(count)
 	return
 }
 
@@ -99,7 +99,7 @@ func _deepCopy(src, dst reflect.Value) {
 
 	case reflect.Struct:
 		switch src.Type() {
-		case timeType:
+		case timeType, netipAddrType, netipPrefixType:
 			dst.Set(src)
 			return
 		default:
@@ -94,6 +94,8 @@ func UvarintSize(u uint64) int {
 //----------------------------------------
 // Other
 
+// EncodeBool writes exactly one byte, 0x01 for true or 0x00 for false, which
+// is also the varint encoding of 1 or 0.
 func EncodeBool(w io.Writer, b bool) (err error) {
 	if b {
 		err = EncodeUint8(w, 1) // same as EncodeUvarint(w, 1).
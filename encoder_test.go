@@ -1,8 +1,13 @@
 package amino
 
 import (
+	"bytes"
+	"math"
+	"reflect"
 	"testing"
+	"time"
 
+	fuzz "github.com/google/gofuzz"
 	"github.com/stretchr/testify/require"
 )
 
@@ -27,3 +32,114 @@ func TestUvarintSize(t *testing.T) {
 		})
 	}
 }
+
+type fixedWidthStruct struct {
+	A int64  `binary:"fixed64"`
+	B uint64 `binary:"fixed64"`
+	C int32  `binary:"fixed32"`
+	D uint32 `binary:"fixed32"`
+	E int64
+	F int32
+	G int16
+	H int8
+	I uint16
+	J uint8
+	K int
+	L uint
+	M bool
+	N int64 `amino:"write_empty"`
+	O bool  `amino:"write_empty"`
+}
+
+// Encodes o with both the fixed-width fast path and the generic struct encoder.
+func encodeFixedWidthBothWays(t testing.TB, cdc *Codec, o fixedWidthStruct) (fast, slow []byte) {
+	rv := reflect.ValueOf(o)
+	info, err := cdc.getTypeInfoWlock(rv.Type())
+	require.NoError(t, err)
+	require.True(t, info.fixedWidth)
+	slowInfo := *info
+	slowInfo.fixedWidth = false
+
+	fbuf, sbuf := new(bytes.Buffer), new(bytes.Buffer)
+	require.NoError(t, cdc.encodeReflectBinaryStruct(cdc.newEncodeState(), fbuf, info, rv, FieldOptions{}, false))
+	require.NoError(t, cdc.encodeReflectBinaryStruct(cdc.newEncodeState(), sbuf, &slowInfo, rv, FieldOptions{}, false))
+	return fbuf.Bytes(), sbuf.Bytes()
+}
+
+func TestFixedWidthStructEncoding(t *testing.T) {
+	cdc := NewCodec()
+	cases := []fixedWidthStruct{
+		{},
+		{A: -1, B: math.MaxUint64, C: math.MinInt32, D: math.MaxUint32, E: -1, F: -1,
+			G: math.MinInt16, H: math.MinInt8, I: math.MaxUint16, J: math.MaxUint8,
+			K: -1, L: 1, M: true, N: 1, O: true},
+		{E: math.MaxInt64, F: math.MaxInt32, G: -1, H: 1, K: math.MinInt64},
+	}
+	f := fuzz.New().NilChance(0)
+	for i := 0; i < 100; i++ {
+		var o fixedWidthStruct
+		f.Fuzz(&o)
+		cases = append(cases, o)
+	}
+	for i, o := range cases {
+		fast, slow := encodeFixedWidthBothWays(t, cdc, o)
+		require.Equal(t, slow, fast, "#%d %v", i, o)
+
+		bz, _, err := DecodeByteSlice(fast)
+		require.NoError(t, err)
+		var o2 fixedWidthStruct
+		require.NoError(t, cdc.UnmarshalBinaryBare(bz, &o2), "#%d", i)
+		require.Equal(t, o, o2, "#%d", i)
+	}
+}
+
+func TestFixedWidthStructDetection(t *testing.T) {
+	cdc := NewCodec()
+	for _, tc := range []struct {
+		o     interface{}
+		fixed bool
+	}{
+		{fixedWidthStruct{}, true},
+		{struct{ A, B int64 }{}, true},
+		{struct{ A string }{}, false},
+		{struct{ A *int64 }{}, false},
+		{struct{ A []int64 }{}, false},
+		{struct {
+			A float64 `amino:"unsafe"`
+		}{}, false},
+		{time.Time{}, false},
+	} {
+		info, err := cdc.getTypeInfoWlock(reflect.TypeOf(tc.o))
+		require.NoError(t, err)
+		require.Equal(t, tc.fixed, info.fixedWidth, "%T", tc.o)
+	}
+}
+
+func BenchmarkFixedWidthStructFast(b *testing.B) {
+	benchmarkFixedWidthStruct(b, true)
+}
+
+func BenchmarkFixedWidthStructGeneric(b *testing.B) {
+	benchmarkFixedWidthStruct(b, false)
+}
+
+func benchmarkFixedWidthStruct(b *testing.B, fast bool) {
+	cdc := NewCodec()
+	o := fixedWidthStruct{A: 1 << 40, B: 1 << 50, C: 1 << 20, D: 1 << 30,
+		E: 123456789, F: -42, G: 300, H: -3, I: 65000, J: 200, K: 7, L: 8, M: true}
+	rv := reflect.ValueOf(o)
+	info, err := cdc.getTypeInfoWlock(rv.Type())
+	require.NoError(b, err)
+	binfo := *info
+	binfo.fixedWidth = fast
+	buf := new(bytes.Buffer)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		if err := cdc.encodeReflectBinaryStruct(cdc.newEncodeState(), buf, &binfo, rv, FieldOptions{}, true); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
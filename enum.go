@@ -0,0 +1,157 @@
+package amino
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//----------------------------------------
+// Enum
+
+// The names of the values of an enum type, see Codec.RegisterEnum.
+type enumInfo struct {
+	names  map[int64]string
+	values map[string]int64
+}
+
+// The enums registered with every new codec.
+var defaultEnums = map[reflect.Type]*enumInfo{
+	reflect.TypeOf(time.Month(0)):   newEnumInfoFromStringer(time.January, time.December),
+	reflect.TypeOf(time.Weekday(0)): newEnumInfoFromStringer(time.Sunday, time.Saturday),
+}
+
+func newEnumInfo(names map[int64]string) *enumInfo {
+	enum := &enumInfo{
+		names:  make(map[int64]string, len(names)),
+		values: make(map[string]int64, len(names)),
+	}
+	for value, name := range names {
+		// Names that are numbers would be ambiguous when decoding.
+		if _, err := strconv.ParseInt(name, 10, 64); err == nil || name == "" {
+			panic(fmt.Sprintf("invalid enum name %q", name))
+		}
+		if other, ok := enum.values[name]; ok {
+			panic(fmt.Sprintf("duplicate enum name %q for %v and %v", name, other, value))
+		}
+		enum.names[value] = name
+		enum.values[name] = value
+	}
+	return enum
+}
+
+// Returns the enum of the values from first to last, named by their String
+// method.
+func newEnumInfoFromStringer(first, last fmt.Stringer) *enumInfo {
+	rt := reflect.TypeOf(first)
+	names := make(map[int64]string)
+	for i := reflect.ValueOf(first).Int(); i <= reflect.ValueOf(last).Int(); i++ {
+		names[i] = reflect.ValueOf(i).Convert(rt).Interface().(fmt.Stringer).String()
+	}
+	return newEnumInfo(names)
+}
+
+// RegisterEnum registers the names of the values of the integer type of
+// typ, e.g. RegisterEnum(Color(0), map[int64]string{0: "Red", 1: "Green"}).
+// Values with a name are encoded as their name in Amino:JSON, and can be
+// decoded from their name or their number.  Amino:binary is unaffected.
+// time.Month and time.Weekday are registered by default, with the names
+// returned by their String methods.  Registering an enum again replaces it.
+func (cdc *Codec) RegisterEnum(typ interface{}, names map[int64]string) {
+	cdc.assertNotSealed()
+
+	rt := reflect.TypeOf(typ)
+	if rt == nil || !isIntegerKind(rt.Kind()) {
+		panic(fmt.Sprintf("RegisterEnum expects an integer type, got %v", rt))
+	}
+	enum := newEnumInfo(names)
+
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	// Copy the enums, since they're read without the lock while encoding
+	// and decoding, see Codec.encodeOptions.
+	enums := make(map[reflect.Type]*enumInfo, len(cdc.enums)+1)
+	for ert, eenum := range cdc.enums {
+		enums[ert] = eenum
+	}
+	enums[rt] = enum
+	cdc.enums = enums
+}
+
+func isIntegerKind(kind reflect.Kind) bool {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns the name of the value rv of a registered enum type, if any.
+func (enum *enumInfo) name(rv reflect.Value) (name string, ok bool) {
+	var value int64
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return "", false
+		}
+		value = int64(rv.Uint())
+	default:
+		value = rv.Int()
+	}
+	name, ok = enum.names[value]
+	return
+}
+
+// Reads the value of an enum from its name, or its number, quoted or not.
+func (enum *enumInfo) decodeJSON(bz []byte, rv reflect.Value) error {
+	var s string
+	if len(bz) > 0 && bz[0] == '"' {
+		if err := json.Unmarshal(bz, &s); err != nil {
+			return err
+		}
+		if value, ok := enum.values[s]; ok {
+			return setEnumValue(rv, value)
+		}
+	} else {
+		s = string(bz)
+	}
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, 64)
+		if err != nil || rv.OverflowUint(u) {
+			return errors.Errorf("invalid %v %s, expected a name or number", rv.Type(), bz)
+		}
+		rv.SetUint(u)
+	default:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil || rv.OverflowInt(i) {
+			return errors.Errorf("invalid %v %s, expected a name or number", rv.Type(), bz)
+		}
+		rv.SetInt(i)
+	}
+	return nil
+}
+
+func setEnumValue(rv reflect.Value, value int64) error {
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value < 0 || rv.OverflowUint(uint64(value)) {
+			return errors.Errorf("%v value %v overflows", rv.Type(), value)
+		}
+		rv.SetUint(uint64(value))
+	default:
+		if rv.OverflowInt(value) {
+			return errors.Errorf("%v value %v overflows", rv.Type(), value)
+		}
+		rv.SetInt(value)
+	}
+	return nil
+}
@@ -0,0 +1,192 @@
+package amino
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+//----------------------------------------
+// FrameWriter
+
+// FrameWriter writes a stream of length-prefixed Amino:binary messages, e.g.
+// for appending to a log file.  Use a FrameReader to read them back.
+type FrameWriter struct {
+	w       io.Writer
+	cdc     *Codec
+	maxSize int64
+}
+
+func NewFrameWriter(w io.Writer, cdc *Codec) *FrameWriter {
+	return &FrameWriter{w: w, cdc: cdc}
+}
+
+// SetMaxSize limits the size of a frame's contents (excluding the length
+// prefix), like FrameReader.SetMaxSize, so that a message the other end
+// would reject isn't written.  Zero means no limit, which is the default.
+func (fw *FrameWriter) SetMaxSize(maxSize int64) {
+	if maxSize < 0 {
+		panic("maxSize cannot be negative.")
+	}
+	fw.maxSize = maxSize
+}
+
+// Write encodes o with MarshalBinaryLengthPrefixed and writes it as a single
+// frame.
+func (fw *FrameWriter) Write(o interface{}) error {
+	bz, err := fw.cdc.MarshalBinaryLengthPrefixed(o)
+	if err != nil {
+		return err
+	}
+	if fw.maxSize > 0 {
+		u64, _ := binary.Uvarint(bz)
+		if u64 > uint64(fw.maxSize) {
+			return errors.Errorf("write overflow, maxSize is %v but this amino binary object is %v bytes", fw.maxSize, u64)
+		}
+	}
+	_, err = fw.w.Write(bz)
+	return err
+}
+
+//----------------------------------------
+// FrameReader
+
+// FrameReader reads a stream of length-prefixed Amino:binary messages, as
+// written by a FrameWriter.  It may read ahead of the current frame, so the
+// underlying reader shouldn't be read from directly.
+type FrameReader struct {
+	r       *bufio.Reader
+	cdc     *Codec
+	maxSize int64
+}
+
+func NewFrameReader(r io.Reader, cdc *Codec) *FrameReader {
+	return &FrameReader{r: bufio.NewReader(r), cdc: cdc}
+}
+
+// SetMaxSize limits the size of a frame's contents (excluding the length
+// prefix), to avoid allocating a huge buffer for a corrupt prefix.  Zero
+// means no limit, which is the default.
+func (fr *FrameReader) SetMaxSize(maxSize int64) {
+	if maxSize < 0 {
+		panic("maxSize cannot be negative.")
+	}
+	fr.maxSize = maxSize
+}
+
+// Read decodes the next frame into ptr.  It returns io.EOF if there are no
+// more frames, or io.ErrUnexpectedEOF if the stream ends within a frame, e.g.
+// if the last write to a log was interrupted.
+func (fr *FrameReader) Read(ptr interface{}) error {
+	// Read byte-length prefix.
+	if _, err := fr.r.Peek(1); err != nil {
+		return err // io.EOF between frames.
+	}
+	u64, err := binary.ReadUvarint(fr.r)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+	if int64(u64) < 0 {
+		return errors.Errorf("read overflow, invalid length-prefix %v", u64)
+	}
+	if fr.maxSize > 0 && u64 > uint64(fr.maxSize) {
+		return errors.Errorf("read overflow, maxSize is %v but this amino binary object is %v bytes", fr.maxSize, u64)
+	}
+
+	// Read that many bytes.
+	ds := fr.cdc.newDecodeState()
+	defer ds.releaseBuffers()
+	bz := ds.getBuffer(int(u64))
+	_, err = io.ReadFull(fr.r, bz)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	} else if err != nil {
+		return err
+	}
+
+	return fr.cdc.unmarshalBinaryBare(ds, bz, ptr)
+}
+
+//----------------------------------------
+// Conn
+
+// Conn reads and writes length-prefixed Amino:binary messages over a
+// net.Conn, with a FrameReader and a FrameWriter, and optional per-message
+// timeouts.  One goroutine may call ReadMsg while another calls WriteMsg,
+// but neither may be called concurrently with itself.  The Set* methods
+// should be called before any messages are read or written.
+type Conn struct {
+	conn         net.Conn
+	fr           *FrameReader
+	fw           *FrameWriter
+	readTimeout  time.Duration
+	writeTimeout time.Duration
+}
+
+func NewConn(conn net.Conn, cdc *Codec) *Conn {
+	return &Conn{
+		conn: conn,
+		fr:   NewFrameReader(conn, cdc),
+		fw:   NewFrameWriter(conn, cdc),
+	}
+}
+
+// SetMaxMsgSize limits the size of the messages read and written (excluding
+// the length prefix).  Zero means no limit, which is the default.
+func (c *Conn) SetMaxMsgSize(maxSize int64) {
+	c.fr.SetMaxSize(maxSize)
+	c.fw.SetMaxSize(maxSize)
+}
+
+// SetReadTimeout sets how long ReadMsg waits for a whole message.  Zero
+// means no timeout, which is the default.  After a timeout, the connection
+// may be within a message, so it should be closed.
+func (c *Conn) SetReadTimeout(timeout time.Duration) {
+	if timeout < 0 {
+		panic("timeout cannot be negative.")
+	}
+	c.readTimeout = timeout
+}
+
+// SetWriteTimeout sets how long WriteMsg waits to write a whole message.
+// Zero means no timeout, which is the default.  After a timeout, part of
+// the message may have been written, so the connection should be closed.
+func (c *Conn) SetWriteTimeout(timeout time.Duration) {
+	if timeout < 0 {
+		panic("timeout cannot be negative.")
+	}
+	c.writeTimeout = timeout
+}
+
+// WriteMsg encodes o and writes it as a single message.
+func (c *Conn) WriteMsg(o interface{}) error {
+	if c.writeTimeout > 0 {
+		if err := c.conn.SetWriteDeadline(time.Now().Add(c.writeTimeout)); err != nil {
+			return err
+		}
+	}
+	return c.fw.Write(o)
+}
+
+// ReadMsg reads the next message and decodes it into ptr.  It returns
+// io.EOF if the connection was closed between messages, or a net.Error
+// whose Timeout() is true if the read timeout passed.
+func (c *Conn) ReadMsg(ptr interface{}) error {
+	if c.readTimeout > 0 {
+		if err := c.conn.SetReadDeadline(time.Now().Add(c.readTimeout)); err != nil {
+			return err
+		}
+	}
+	return c.fr.Read(ptr)
+}
+
+// Close closes the underlying net.Conn.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,212 @@
+package amino_test
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	amino "github.com/tendermint/go-amino"
+)
+
+type walEntry struct {
+	Height int64
+	Data   []byte
+}
+
+func TestFrameWriterReader(t *testing.T) {
+	cdc := amino.NewCodec()
+
+	var buf bytes.Buffer
+	fw := amino.NewFrameWriter(&buf, cdc)
+	entries := []walEntry{{Height: 1, Data: []byte("a")}, {}, {Height: 3, Data: bytes.Repeat([]byte{0xFF}, 300)}}
+	for _, entry := range entries {
+		require.NoError(t, fw.Write(entry))
+	}
+
+	// Frames can be read back from a reader returning one byte at a time.
+	fr := amino.NewFrameReader(&oneByteReader{buf.Bytes()}, cdc)
+	for _, entry := range entries {
+		var entry2 walEntry
+		require.NoError(t, fr.Read(&entry2))
+		assert.Equal(t, entry, entry2)
+	}
+	var entry walEntry
+	assert.Equal(t, io.EOF, fr.Read(&entry))
+	assert.Equal(t, io.EOF, fr.Read(&entry))
+
+	// A truncated frame is an unexpected EOF.
+	for _, cut := range []int{1, 2, 5} {
+		bz := buf.Bytes()[:buf.Len()-cut]
+		fr = amino.NewFrameReader(bytes.NewReader(bz), cdc)
+		for i := 0; i < len(entries)-1; i++ {
+			require.NoError(t, fr.Read(&entry))
+		}
+		assert.Equal(t, io.ErrUnexpectedEOF, fr.Read(&entry), "cut %v", cut)
+	}
+
+	fr = amino.NewFrameReader(bytes.NewReader([]byte{0xAC}), cdc)
+	assert.Equal(t, io.ErrUnexpectedEOF, fr.Read(&entry), "cut in length prefix")
+
+	// Frames larger than the max size are rejected.
+	fr = amino.NewFrameReader(bytes.NewReader(buf.Bytes()), cdc)
+	fr.SetMaxSize(100)
+	require.NoError(t, fr.Read(&entry))
+	require.NoError(t, fr.Read(&entry))
+	assert.Error(t, fr.Read(&entry))
+}
+
+type pooledEntry struct {
+	Name string
+	Data []byte
+}
+
+func TestSetBufferPool(t *testing.T) {
+	cdc := amino.NewCodec()
+	var news int
+	pool := &sync.Pool{New: func() interface{} {
+		news++
+		bz := make([]byte, 0, 16)
+		return &bz
+	}}
+	cdc.SetBufferPool(pool)
+
+	var buf bytes.Buffer
+	fw := amino.NewFrameWriter(&buf, cdc)
+	entries := []pooledEntry{
+		{"a", []byte("aa")},
+		{"b", []byte("bb")},
+		{"long", bytes.Repeat([]byte{0xFF}, 100)}, // Too large for pooled buffers.
+		{"c", []byte("cc")},
+	}
+	for _, entry := range entries {
+		require.NoError(t, fw.Write(entry))
+	}
+	frames := buf.Bytes()
+
+	// Decoded values don't alias the reused buffers.
+	fr := amino.NewFrameReader(bytes.NewReader(frames), cdc)
+	var got []pooledEntry
+	for range entries {
+		var entry pooledEntry
+		require.NoError(t, fr.Read(&entry))
+		got = append(got, entry)
+	}
+	assert.Equal(t, entries, got)
+	assert.NotZero(t, news)
+
+	r := bytes.NewReader(frames)
+	got = nil
+	for range entries {
+		var entry pooledEntry
+		_, err := cdc.UnmarshalBinaryLengthPrefixedReader(r, &entry, 0)
+		require.NoError(t, err)
+		got = append(got, entry)
+	}
+	assert.Equal(t, entries, got)
+
+	// Other values in the pool are ignored.
+	cdc.SetBufferPool(&sync.Pool{New: func() interface{} { return "junk" }})
+	fr = amino.NewFrameReader(bytes.NewReader(frames), cdc)
+	var entry pooledEntry
+	require.NoError(t, fr.Read(&entry))
+	assert.Equal(t, entries[0], entry)
+
+	// Strings and nested encodings are decoded from pooled buffers too.
+	type pooledLog struct {
+		Entries []pooledEntry
+		Tags    []string
+	}
+	cdc.SetBufferPool(pool)
+	news = 0
+	log1 := pooledLog{Entries: entries[:2], Tags: []string{"x", "y"}}
+	log2 := pooledLog{Entries: entries[2:], Tags: []string{"zzz"}}
+	var got1, got2 pooledLog
+	require.NoError(t, cdc.UnmarshalBinaryBare(cdc.MustMarshalBinaryBare(log1), &got1))
+	assert.NotZero(t, news)
+	require.NoError(t, cdc.UnmarshalBinaryBare(cdc.MustMarshalBinaryBare(log2), &got2))
+	assert.Equal(t, log1, got1)
+	assert.Equal(t, log2, got2)
+}
+
+func TestConn(t *testing.T) {
+	cdc := amino.NewCodec()
+	c1, c2 := net.Pipe()
+	conn1, conn2 := amino.NewConn(c1, cdc), amino.NewConn(c2, cdc)
+	defer conn1.Close()
+	defer conn2.Close()
+	conn1.SetMaxMsgSize(100)
+	conn2.SetMaxMsgSize(100)
+	conn1.SetWriteTimeout(time.Second)
+	conn2.SetReadTimeout(time.Second)
+
+	entries := []walEntry{{Height: 1, Data: []byte("a")}, {}, {Height: 3, Data: []byte("c")}}
+	go func() {
+		for _, entry := range entries {
+			if err := conn1.WriteMsg(entry); err != nil {
+				panic(err)
+			}
+		}
+	}()
+	for _, entry := range entries {
+		var entry2 walEntry
+		require.NoError(t, conn2.ReadMsg(&entry2))
+		assert.Equal(t, entry, entry2)
+	}
+
+	// Messages larger than the max size aren't written.
+	err := conn1.WriteMsg(walEntry{Data: bytes.Repeat([]byte{0xFF}, 300)})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "maxSize is 100")
+	}
+
+	// Nothing to read before the read timeout.
+	conn2.SetReadTimeout(10 * time.Millisecond)
+	var entry walEntry
+	err = conn2.ReadMsg(&entry)
+	if assert.Error(t, err) {
+		nerr, ok := err.(net.Error)
+		require.True(t, ok, "should be a net.Error, got %v", err)
+		assert.True(t, nerr.Timeout())
+	}
+
+	// Nobody reading before the write timeout.
+	conn1.SetWriteTimeout(10 * time.Millisecond)
+	err = conn1.WriteMsg(entries[0])
+	if assert.Error(t, err) {
+		nerr, ok := err.(net.Error)
+		require.True(t, ok, "should be a net.Error, got %v", err)
+		assert.True(t, nerr.Timeout())
+	}
+
+	// The closed connection ends the stream.
+	conn3, conn4 := net.Pipe()
+	go func() {
+		_ = amino.NewConn(conn3, cdc).WriteMsg(entries[0])
+		conn3.Close()
+	}()
+	conn := amino.NewConn(conn4, cdc)
+	require.NoError(t, conn.ReadMsg(&entry))
+	assert.Equal(t, io.EOF, conn.ReadMsg(&entry))
+}
+
+type oneByteReader struct {
+	bz []byte
+}
+
+func (r *oneByteReader) Read(p []byte) (int, error) {
+	if len(r.bz) == 0 {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	p[0] = r.bz[0]
+	r.bz = r.bz[1:]
+	return 1, nil
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 
 	"github.com/pkg/errors"
@@ -15,7 +16,7 @@ import (
 // cdc.decodeReflectJSON
 
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectJSON(bz []byte, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
+func (cdc *Codec) decodeReflectJSON(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
 	}
@@ -47,6 +48,16 @@ func (cdc *Codec) decodeReflectJSON(bz []byte, info *TypeInfo, rv reflect.Value,
 		rv = rv.Elem()
 	}
 
+	// Validate the decoded value of a registered type, see
+	// ConcreteOptions.Validate.
+	if info.Registered && info.Validate != nil {
+		defer func() {
+			if err == nil {
+				err = validateConcrete(info, rv)
+			}
+		}()
+	}
+
 	// Special case:
 	if rv.Type() == timeType {
 		// Amino time strips the timezone, so must end with Z.
@@ -61,6 +72,62 @@ func (cdc *Codec) decodeReflectJSON(bz []byte, info *TypeInfo, rv reflect.Value,
 		}
 	}
 
+	// Special case: big.Float is read from a decimal string.
+	if rv.Type() == bigFloatType {
+		if len(bz) < 2 || bz[0] != '"' || bz[len(bz)-1] != '"' {
+			err = errors.Errorf("amino:JSON big.Float must be a string, but got %s", bz)
+			return
+		}
+		err = decodeBigFloat(string(bz[1:len(bz)-1]), rv)
+		return
+	}
+
+	// Special case: values of registered enums are read from their names,
+	// or numbers.
+	if isIntegerKind(rv.Kind()) {
+		if enum, ok := ds.enums[rv.Type()]; ok {
+			err = enum.decodeJSON(bz, rv)
+			return
+		}
+	}
+
+	// Special case: url.URL is read from a string.
+	if rv.Type() == urlType {
+		var s string
+		if err = json.Unmarshal(bz, &s); err != nil {
+			err = errors.Errorf("amino:JSON url.URL must be a string, but got %s", bz)
+			return
+		}
+		err = decodeURL(s, rv)
+		return
+	}
+
+	// Special case: netip.Addr and netip.Prefix are read from their text forms.
+	if isNetipType(rv.Type()) {
+		var s string
+		if err = json.Unmarshal(bz, &s); err != nil {
+			err = errors.Errorf("amino:JSON %v must be a string, but got %s", rv.Type(), bz)
+			return
+		}
+		err = decodeNetipText(s, rv)
+		return
+	}
+
+	// Special case: bytes.Buffer and io.Reader are read like byte slices.
+	if rv.Type() == bufferType || rv.Type() == ioReaderType {
+		var byteslice []byte
+		if err = json.Unmarshal(bz, &byteslice); err != nil {
+			err = errors.Errorf("amino:JSON %v must be a base64 string, but got %s", rv.Type(), bz)
+			return
+		}
+		if rv.Type() == bufferType {
+			setBufferBytes(rv, byteslice)
+		} else {
+			setReaderBytes(rv, byteslice)
+		}
+		return
+	}
+
 	// Handle override if a pointer to rv implements json.Unmarshaler.
 	if rv.Addr().Type().Implements(jsonUnmarshalerType) {
 		err = rv.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(bz)
@@ -76,7 +143,7 @@ func (cdc *Codec) decodeReflectJSON(bz []byte, info *TypeInfo, rv reflect.Value,
 		if err != nil {
 			return
 		}
-		err = cdc.decodeReflectJSON(bz, rinfo, rrv, fopts)
+		err = cdc.decodeReflectJSON(ds, bz, rinfo, rrv, fopts)
 		if err != nil {
 			return
 		}
@@ -96,19 +163,19 @@ func (cdc *Codec) decodeReflectJSON(bz []byte, info *TypeInfo, rv reflect.Value,
 	// Complex
 
 	case reflect.Interface:
-		err = cdc.decodeReflectJSONInterface(bz, info, rv, fopts)
+		err = cdc.decodeReflectJSONInterface(ds, bz, info, rv, fopts)
 
 	case reflect.Array:
-		err = cdc.decodeReflectJSONArray(bz, info, rv, fopts)
+		err = cdc.decodeReflectJSONArray(ds, bz, info, rv, fopts)
 
 	case reflect.Slice:
-		err = cdc.decodeReflectJSONSlice(bz, info, rv, fopts)
+		err = cdc.decodeReflectJSONSlice(ds, bz, info, rv, fopts)
 
 	case reflect.Struct:
-		err = cdc.decodeReflectJSONStruct(bz, info, rv, fopts)
+		err = cdc.decodeReflectJSONStruct(ds, bz, info, rv, fopts)
 
 	case reflect.Map:
-		err = cdc.decodeReflectJSONMap(bz, info, rv, fopts)
+		err = cdc.decodeReflectJSONMap(ds, bz, info, rv, fopts)
 
 	//----------------------------------------
 	// Signed, Unsigned
@@ -138,10 +205,27 @@ func (cdc *Codec) decodeReflectJSON(bz []byte, info *TypeInfo, rv reflect.Value,
 		if !fopts.Unsafe {
 			return errors.New("amino:JSON float* support requires `amino:\"unsafe\"`")
 		}
+		if len(bz) > 0 && bz[0] == '"' && ds.jsonNonFinite == JSONNonFiniteString {
+			return decodeJSONNonFiniteFloat(bz, rv)
+		}
 		fallthrough
 	case reflect.Bool, reflect.String:
 		err = invokeStdlibJSONUnmarshal(bz, rv, fopts)
 
+	case reflect.Complex64, reflect.Complex128:
+		if err = checkComplex(fopts, ds.allowComplex); err != nil {
+			return
+		}
+		var rinfo *TypeInfo
+		if rinfo, err = cdc.getComplexReprInfo(info.Type); err != nil {
+			return
+		}
+		rrv := reflect.New(rinfo.Type).Elem()
+		if err = cdc.decodeReflectJSON(ds, bz, rinfo, rrv, fopts); err != nil {
+			return
+		}
+		setComplexFromRepr(rv, rrv)
+
 	//----------------------------------------
 	// Default
 
@@ -152,6 +236,21 @@ func (cdc *Codec) decodeReflectJSON(bz []byte, info *TypeInfo, rv reflect.Value,
 	return err
 }
 
+// Reads NaN or ±Inf as encoded with JSONNonFiniteString.
+func decodeJSONNonFiniteFloat(bz []byte, rv reflect.Value) error {
+	switch string(bz) {
+	case `"NaN"`:
+		rv.SetFloat(math.NaN())
+	case `"Infinity"`:
+		rv.SetFloat(math.Inf(1))
+	case `"-Infinity"`:
+		rv.SetFloat(math.Inf(-1))
+	default:
+		return errors.Errorf("invalid amino:JSON float %s", bz)
+	}
+	return nil
+}
+
 func invokeStdlibJSONUnmarshal(bz []byte, rv reflect.Value, fopts FieldOptions) error {
 	if !rv.CanAddr() && rv.Kind() != reflect.Ptr {
 		panic("rv not addressable nor pointer")
@@ -170,7 +269,7 @@ func invokeStdlibJSONUnmarshal(bz []byte, rv reflect.Value, fopts FieldOptions)
 }
 
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectJSONInterface(bz []byte, iinfo *TypeInfo, rv reflect.Value,
+func (cdc *Codec) decodeReflectJSONInterface(ds *decodeState, bz []byte, iinfo *TypeInfo, rv reflect.Value,
 	fopts FieldOptions) (err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
@@ -195,31 +294,59 @@ func (cdc *Codec) decodeReflectJSONInterface(bz []byte, iinfo *TypeInfo, rv refl
 		// while in case we forget, for defensive purposes.
 		rv.Set(iinfo.ZeroValue)
 	}
-
-	// Consume type wrapper info.
-	name, bz, err := decodeInterfaceJSON(bz)
-	if err != nil {
+	if err = ds.enterInterface(iinfo); err != nil {
 		return
 	}
-	// XXX: Check name against interface to make sure that it actually
-	// matches, and return an error if it doesn't.
+	defer ds.exitInterface()
 
+	// Get concrete type info from the type hint if any, else from the type
+	// wrapper.  Bare values, e.g. written before interface values were
+	// wrapped, are decoded as the only concrete type of the interface.
+	// NOTE: Unlike decodeReflectBinaryInterface, uses the full name string.
 	// NOTE: Unlike decodeReflectBinaryInterface, we already dealt with nil in decodeReflectJSON.
-	// NOTE: We also "consumed" the interface wrapper by replacing `bz` above.
+	var cinfo, hinted = ds.typeHint()
+	if dfw, ok := parseInterfaceJSONWrapper(bz); ok {
+		// Consume type wrapper info.
+		// NOTE: We "consume" the interface wrapper by replacing `bz`.
+		var (
+			name    string
+			version uint32
+		)
+		name, version, bz, err = dfw.unwrap()
+		if err != nil {
+			return
+		}
+		// XXX: Check name against interface to make sure that it actually
+		// matches, and return an error if it doesn't.
+		if !hinted {
+			cinfo, err = cdc.getTypeInfoFromNameRlock(name)
+			if err != nil {
+				return
+			}
+		}
+		if cinfo.Version > 0 {
+			// Pick the Go type of the encoded version.
+			cinfo, err = cdc.getTypeInfoFromVersionRlock(cinfo, version)
+			if err != nil {
+				return
+			}
+		}
+	} else if !hinted {
+		cinfo, err = cdc.getSoleImplementerRlock(iinfo)
+		if err != nil {
+			err = fmt.Errorf("cannot decode bare (not wrapped) JSON value for interface: %v", err)
+			return
+		}
+	}
 
-	// Get concrete type info.
-	// NOTE: Unlike decodeReflectBinaryInterface, uses the full name string.
-	var cinfo *TypeInfo
-	cinfo, err = cdc.getTypeInfoFromNameRlock(name)
+	// Construct the concrete type.
+	crv, irvSet, err := constructConcreteType(cinfo)
 	if err != nil {
 		return
 	}
 
-	// Construct the concrete type.
-	var crv, irvSet = constructConcreteType(cinfo)
-
 	// Decode into the concrete type.
-	err = cdc.decodeReflectJSON(bz, cinfo, crv, fopts)
+	err = cdc.decodeReflectJSON(ds, bz, cinfo, crv, fopts)
 	if err != nil {
 		rv.Set(irvSet) // Helps with debugging
 		return
@@ -233,7 +360,7 @@ func (cdc *Codec) decodeReflectJSONInterface(bz []byte, iinfo *TypeInfo, rv refl
 }
 
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectJSONArray(bz []byte, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
+func (cdc *Codec) decodeReflectJSONArray(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
 	}
@@ -282,7 +409,7 @@ func (cdc *Codec) decodeReflectJSONArray(bz []byte, info *TypeInfo, rv reflect.V
 		for i := 0; i < length; i++ {
 			erv := rv.Index(i)
 			ebz := rawSlice[i]
-			err = cdc.decodeReflectJSON(ebz, einfo, erv, fopts)
+			err = cdc.decodeReflectJSON(ds, ebz, einfo, erv, fopts)
 			if err != nil {
 				return
 			}
@@ -292,7 +419,7 @@ func (cdc *Codec) decodeReflectJSONArray(bz []byte, info *TypeInfo, rv reflect.V
 }
 
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectJSONSlice(bz []byte, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
+func (cdc *Codec) decodeReflectJSONSlice(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
 	}
@@ -349,7 +476,7 @@ func (cdc *Codec) decodeReflectJSONSlice(bz []byte, info *TypeInfo, rv reflect.V
 		for i := 0; i < length; i++ {
 			erv := srv.Index(i)
 			ebz := rawSlice[i]
-			err = cdc.decodeReflectJSON(ebz, einfo, erv, fopts)
+			err = cdc.decodeReflectJSON(ds, ebz, einfo, erv, fopts)
 			if err != nil {
 				return
 			}
@@ -362,7 +489,7 @@ func (cdc *Codec) decodeReflectJSONSlice(bz []byte, info *TypeInfo, rv reflect.V
 }
 
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectJSONStruct(bz []byte, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
+func (cdc *Codec) decodeReflectJSONStruct(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
 	}
@@ -373,6 +500,14 @@ func (cdc *Codec) decodeReflectJSONStruct(bz []byte, info *TypeInfo, rv reflect.
 		}()
 	}
 
+	if info.JSONArray {
+		err = cdc.decodeReflectJSONStructArray(ds, bz, info, rv)
+		if err != nil {
+			return
+		}
+		return cdc.validateStructFields(ds, info, rv)
+	}
+
 	// Map all the fields(keys) to their blobs/bytes.
 	// NOTE: In decodeReflectBinaryStruct, we don't need to do this,
 	// since fields are encoded in order.
@@ -381,6 +516,11 @@ func (cdc *Codec) decodeReflectJSONStruct(bz []byte, info *TypeInfo, rv reflect.
 	if err != nil {
 		return
 	}
+	if ds.rejectDupJSONKeys {
+		if err = checkDuplicateJSONKeys(bz, info.Type); err != nil {
+			return
+		}
+	}
 
 	for _, field := range info.Fields {
 
@@ -392,8 +532,14 @@ func (cdc *Codec) decodeReflectJSONStruct(bz []byte, info *TypeInfo, rv reflect.
 			return
 		}
 
-		// Get value from rawMap.
+		// Get value from rawMap, by name or else by the first alias present.
 		var valueBytes = rawMap[field.JSONName]
+		for _, alias := range field.JSONAliases {
+			if len(valueBytes) != 0 {
+				break
+			}
+			valueBytes = rawMap[alias]
+		}
 		if len(valueBytes) == 0 {
 			// TODO: Since the Go stdlib's JSON codec allows case-insensitive
 			// keys perhaps we need to also do case-insensitive lookups here.
@@ -413,17 +559,52 @@ func (cdc *Codec) decodeReflectJSONStruct(bz []byte, info *TypeInfo, rv reflect.
 		}
 
 		// Decode into field rv.
-		err = cdc.decodeReflectJSON(valueBytes, finfo, frv, fopts)
+		ds.pushField(field.Name)
+		err = cdc.decodeReflectJSON(ds, valueBytes, finfo, frv, field.FieldOptions)
+		ds.popField()
 		if err != nil {
 			return
 		}
 	}
 
+	// Validate the decoded fields.
+	return cdc.validateStructFields(ds, info, rv)
+}
+
+// Reads the field values of the struct rv from an array, in field number
+// order, see ConcreteOptions.JSONArray.
+// CONTRACT: rv.CanAddr() is true.
+func (cdc *Codec) decodeReflectJSONStructArray(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value) (err error) {
+	var rawSlice []json.RawMessage
+	err = json.Unmarshal(bz, &rawSlice)
+	if err != nil {
+		return errors.Errorf("amino:JSON %v must be an array, got %s", info.Type, bz)
+	}
+	for fnum := 1; fnum <= len(info.Fields); fnum++ {
+		field := info.fieldByNum(uint32(fnum))
+		var frv = rv.Field(field.Index)
+		// Missing trailing values are defaults.
+		if fnum > len(rawSlice) {
+			frv.Set(reflect.Zero(frv.Type()))
+			continue
+		}
+		var finfo *TypeInfo
+		finfo, err = cdc.getTypeInfoWlock(field.Type)
+		if err != nil {
+			return
+		}
+		ds.pushField(field.Name)
+		err = cdc.decodeReflectJSON(ds, rawSlice[fnum-1], finfo, frv, field.FieldOptions)
+		ds.popField()
+		if err != nil {
+			return
+		}
+	}
 	return nil
 }
 
 // CONTRACT: rv.CanAddr() is true.
-func (cdc *Codec) decodeReflectJSONMap(bz []byte, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
+func (cdc *Codec) decodeReflectJSONMap(ds *decodeState, bz []byte, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
 	if !rv.CanAddr() {
 		panic("rv not addressable")
 	}
@@ -442,6 +623,11 @@ func (cdc *Codec) decodeReflectJSONMap(bz []byte, info *TypeInfo, rv reflect.Val
 	if err != nil {
 		return
 	}
+	if ds.rejectDupJSONKeys {
+		if err = checkDuplicateJSONKeys(bz, info.Type); err != nil {
+			return
+		}
+	}
 
 	var krt = rv.Type().Key()
 	if krt.Kind() != reflect.String {
@@ -461,7 +647,7 @@ func (cdc *Codec) decodeReflectJSONMap(bz []byte, info *TypeInfo, rv reflect.Val
 		vrv := reflect.New(mrv.Type().Elem()).Elem()
 
 		// Decode valueBytes into vrv.
-		err = cdc.decodeReflectJSON(valueBytes, vinfo, vrv, fopts)
+		err = cdc.decodeReflectJSON(ds, valueBytes, vinfo, vrv, fopts)
 		if err != nil {
 			return
 		}
@@ -480,30 +666,38 @@ func (cdc *Codec) decodeReflectJSONMap(bz []byte, info *TypeInfo, rv reflect.Val
 // Misc.
 
 type disfixWrapper struct {
-	Name string          `json:"type"`
-	Data json.RawMessage `json:"value"`
+	Name    string          `json:"type"`
+	Version uint32          `json:"version"`
+	Data    json.RawMessage `json:"value"`
 }
 
-// decodeInterfaceJSON helps unravel the type name and
+// decodeInterfaceJSON helps unravel the type name, version (if any) and
 // the stored data, which are expected in the form:
 // {
 //    "type": "<canonical concrete type name>",
+//    "version": <version>, (see ConcreteOptions.Version)
 //    "value":  {}
 // }
-func decodeInterfaceJSON(bz []byte) (name string, data []byte, err error) {
+func decodeInterfaceJSON(bz []byte) (name string, version uint32, data []byte, err error) {
 	dfw := new(disfixWrapper)
 	err = json.Unmarshal(bz, dfw)
 	if err != nil {
 		err = fmt.Errorf("cannot parse disfix JSON wrapper: %v", err)
 		return
 	}
+	return dfw.unwrap()
+}
 
+// Returns the type name, version and data of the wrapper, or an error if the
+// name or data is missing.
+func (dfw *disfixWrapper) unwrap() (name string, version uint32, data []byte, err error) {
 	// Get name.
 	if dfw.Name == "" {
 		err = errors.New("JSON encoding of interfaces require non-empty type field")
 		return
 	}
 	name = dfw.Name
+	version = dfw.Version
 
 	// Get data.
 	if len(dfw.Data) == 0 {
@@ -514,6 +708,46 @@ func decodeInterfaceJSON(bz []byte) (name string, data []byte, err error) {
 	return
 }
 
+// Parses bz as an interface wrapper (see decodeInterfaceJSON), returning
+// ok=false if it isn't one, i.e. if bz isn't a JSON object with a non-empty
+// "type" string and a "value".  Other keys are ignored, as by
+// decodeInterfaceJSON.  Values that aren't wrappers are decoded as bare
+// values of the interface's concrete type.
+// NOTE: This is ambiguous for bare values that happen to be such objects,
+// e.g. of a struct with "type" and "value" fields, which are read as
+// wrappers.  So values of such types must always be wrapped.
+func parseInterfaceJSONWrapper(bz []byte) (dfw *disfixWrapper, ok bool) {
+	dfw = new(disfixWrapper)
+	if err := json.Unmarshal(bz, dfw); err != nil {
+		return nil, false
+	}
+	return dfw, dfw.Name != "" && len(dfw.Data) > 0
+}
+
 func nullBytes(b []byte) bool {
 	return bytes.Equal(b, []byte(`null`))
 }
+
+// Returns an error if the JSON object bz has a key more than once.
+func checkDuplicateJSONKeys(bz []byte, rt reflect.Type) error {
+	dec := json.NewDecoder(bytes.NewReader(bz))
+	if _, err := dec.Token(); err != nil { // {
+		return err
+	}
+	var seen = make(map[string]struct{})
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ok := seen[key.(string)]; ok {
+			return errors.Errorf("duplicate key %q in amino:JSON %v", key, rt)
+		}
+		seen[key.(string)] = struct{}{}
+		var value json.RawMessage
+		if err = dec.Decode(&value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -1,9 +1,11 @@
 package amino
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"time"
 
@@ -20,7 +22,8 @@ import (
 // only call this one, for the disfix wrapper is only written here.
 // NOTE: Unlike encodeReflectBinary, rv may be a pointer.
 // CONTRACT: rv is valid.
-func (cdc *Codec) encodeReflectJSON(w io.Writer, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
+func (cdc *Codec) encodeReflectJSON(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
+	fopts FieldOptions) (err error) {
 	if !rv.IsValid() {
 		panic("should not happen")
 	}
@@ -41,6 +44,9 @@ func (cdc *Codec) encodeReflectJSON(w io.Writer, info *TypeInfo, rv reflect.Valu
 		err = writeStr(w, `null`)
 		return
 	}
+	if info.Deprecated {
+		cdc.warnDeprecated(info)
+	}
 
 	// Special case:
 	if rv.Type() == timeType {
@@ -49,7 +55,58 @@ func (cdc *Codec) encodeReflectJSON(w io.Writer, info *TypeInfo, rv reflect.Valu
 		ct := rv.Interface().(time.Time).Round(0).UTC()
 		rv = reflect.ValueOf(ct)
 	}
+	// Special case: big.Float is written as a decimal string.
+	if rv.Type() == bigFloatType {
+		_, err = fmt.Fprintf(w, `"%s"`, bigFloatText(rv))
+		return
+	}
+	// Special case: url.URL is written as its string form.
+	if rv.Type() == urlType {
+		err = invokeStdlibJSONMarshal(w, urlText(rv))
+		return
+	}
+	// Special case: netip.Addr and netip.Prefix are written as their text forms.
+	if isNetipType(rv.Type()) {
+		err = invokeStdlibJSONMarshal(w, netipText(rv))
+		return
+	}
+	// Special case: bytes.Buffer and io.Reader are written like byte slices.
+	if rv.Type() == bufferType {
+		err = invokeStdlibJSONMarshal(w, bufferBytes(rv))
+		return
+	}
+	if rv.Type() == ioReaderType {
+		if rv.IsNil() {
+			err = writeStr(w, `null`)
+			return
+		}
+		var bz []byte
+		bz, err = readerBytes(rv)
+		if err != nil {
+			return
+		}
+		err = invokeStdlibJSONMarshal(w, bz)
+		return
+	}
+	// Special case: values of registered enums are written as their names.
+	if isIntegerKind(rv.Kind()) {
+		if enum, ok := es.enums[rv.Type()]; ok {
+			if name, ok := enum.name(rv); ok {
+				err = invokeStdlibJSONMarshal(w, name)
+				return
+			}
+		}
+	}
+	// Special case: json.RawMessage is written as is, unlike other byte
+	// slices which are base64 encoded.  It's also a json.Marshaler, but
+	// we make sure that the output remains valid JSON.
+	if rv.Type() == jsonRawMessageType {
+		err = writeJSONRawMessage(w, rv.Bytes())
+		return
+	}
 	// Handle override if rv implements json.Marshaler.
+	// NOTE: This takes precedence over MarshalAmino, so a type can have
+	// different representations in Amino:JSON and Amino:binary.
 	if rv.CanAddr() { // Try pointer first.
 		if rv.Addr().Type().Implements(jsonMarshalerType) {
 			err = invokeMarshalJSON(w, rv.Addr())
@@ -58,9 +115,16 @@ func (cdc *Codec) encodeReflectJSON(w io.Writer, info *TypeInfo, rv reflect.Valu
 	} else if rv.Type().Implements(jsonMarshalerType) {
 		err = invokeMarshalJSON(w, rv)
 		return
+	} else if reflect.PtrTo(rv.Type()).Implements(jsonMarshalerType) {
+		// rv isn't addressable (e.g. a map value), so use a copy, like
+		// decoding which uses the json.Unmarshaler of the pointer.
+		prv := reflect.New(rv.Type())
+		prv.Elem().Set(rv)
+		err = invokeMarshalJSON(w, prv)
+		return
 	}
 
-	// Handle override if rv implements json.Marshaler.
+	// Handle override if rv implements MarshalAmino.
 	if info.IsAminoMarshaler {
 		// First, encode rv into repr instance.
 		var (
@@ -76,7 +140,7 @@ func (cdc *Codec) encodeReflectJSON(w io.Writer, info *TypeInfo, rv reflect.Valu
 			return
 		}
 		// Then, encode the repr instance.
-		err = cdc.encodeReflectJSON(w, rinfo, rrv, fopts)
+		err = cdc.encodeReflectJSON(es, w, rinfo, rrv, fopts)
 		return
 	}
 
@@ -86,16 +150,16 @@ func (cdc *Codec) encodeReflectJSON(w io.Writer, info *TypeInfo, rv reflect.Valu
 	// Complex
 
 	case reflect.Interface:
-		return cdc.encodeReflectJSONInterface(w, info, rv, fopts)
+		return cdc.encodeReflectJSONInterface(es, w, info, rv, fopts)
 
 	case reflect.Array, reflect.Slice:
-		return cdc.encodeReflectJSONList(w, info, rv, fopts)
+		return cdc.encodeReflectJSONList(es, w, info, rv, fopts)
 
 	case reflect.Struct:
-		return cdc.encodeReflectJSONStruct(w, info, rv, fopts)
+		return cdc.encodeReflectJSONStruct(es, w, info, rv, fopts)
 
 	case reflect.Map:
-		return cdc.encodeReflectJSONMap(w, info, rv, fopts)
+		return cdc.encodeReflectJSONMap(es, w, info, rv, fopts)
 
 	//----------------------------------------
 	// Signed, Unsigned
@@ -119,10 +183,23 @@ func (cdc *Codec) encodeReflectJSON(w io.Writer, info *TypeInfo, rv reflect.Valu
 		if !fopts.Unsafe {
 			return errors.New("amino.JSON float* support requires `amino:\"unsafe\"`")
 		}
+		if f := rv.Float(); math.IsNaN(f) || math.IsInf(f, 0) {
+			return es.encodeJSONNonFiniteFloat(w, f)
+		}
 		fallthrough
 	case reflect.Bool, reflect.String:
 		return invokeStdlibJSONMarshal(w, rv.Interface())
 
+	case reflect.Complex64, reflect.Complex128:
+		if err = checkComplex(fopts, es.allowComplex); err != nil {
+			return
+		}
+		var rinfo *TypeInfo
+		if rinfo, err = cdc.getComplexReprInfo(info.Type); err != nil {
+			return
+		}
+		return cdc.encodeReflectJSON(es, w, rinfo, toComplexRepr(rv), fopts)
+
 	//----------------------------------------
 	// Default
 
@@ -131,7 +208,16 @@ func (cdc *Codec) encodeReflectJSON(w io.Writer, info *TypeInfo, rv reflect.Valu
 	}
 }
 
-func (cdc *Codec) encodeReflectJSONInterface(w io.Writer, iinfo *TypeInfo, rv reflect.Value,
+// Writes the type wrapper of the registered concrete type cinfo up to its
+// value, i.e. `{"type":"<name>","value":`, with the version if any.
+func writeJSONWrapperStart(w io.Writer, cinfo *TypeInfo) error {
+	if cinfo.Version > 0 {
+		return writeStr(w, _fmt(`{"type":"%s","version":%d,"value":`, cinfo.Name, cinfo.Version))
+	}
+	return writeStr(w, _fmt(`{"type":"%s","value":`, cinfo.Name))
+}
+
+func (cdc *Codec) encodeReflectJSONInterface(es *encodeState, w io.Writer, iinfo *TypeInfo, rv reflect.Value,
 	fopts FieldOptions) (err error) {
 	if printLog {
 		fmt.Println("(e) encodeReflectJSONInterface")
@@ -165,13 +251,15 @@ func (cdc *Codec) encodeReflectJSONInterface(w io.Writer, iinfo *TypeInfo, rv re
 		return
 	}
 	if !cinfo.Registered {
-		err = errors.Errorf("cannot encode unregistered concrete type %v", crt)
-		return
+		cinfo, err = cdc.getRegisteredTypeInfoForEncode(crt)
+		if err != nil {
+			return
+		}
 	}
 
 	// Write interface wrapper.
 	// Part 1:
-	err = writeStr(w, _fmt(`{"type":"%s","value":`, cinfo.Name))
+	err = writeJSONWrapperStart(w, cinfo)
 	if err != nil {
 		return
 	}
@@ -188,11 +276,12 @@ func (cdc *Codec) encodeReflectJSONInterface(w io.Writer, iinfo *TypeInfo, rv re
 	// Currently, go-amino JSON *always* writes disfix bytes for
 	// all registered concrete types.
 
-	err = cdc.encodeReflectJSON(w, cinfo, crv, fopts)
+	err = cdc.encodeReflectJSON(es, w, cinfo, crv, fopts)
 	return err
 }
 
-func (cdc *Codec) encodeReflectJSONList(w io.Writer, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
+func (cdc *Codec) encodeReflectJSONList(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
+	fopts FieldOptions) (err error) {
 	if printLog {
 		fmt.Println("(e) encodeReflectJSONList")
 		defer func() {
@@ -250,7 +339,7 @@ func (cdc *Codec) encodeReflectJSONList(w io.Writer, info *TypeInfo, rv reflect.
 			if isNil {
 				err = writeStr(w, `null`)
 			} else {
-				err = cdc.encodeReflectJSON(w, einfo, erv, fopts)
+				err = cdc.encodeReflectJSON(es, w, einfo, erv, fopts)
 			}
 			if err != nil {
 				return
@@ -272,7 +361,8 @@ func (cdc *Codec) encodeReflectJSONList(w io.Writer, info *TypeInfo, rv reflect.
 	}
 }
 
-func (cdc *Codec) encodeReflectJSONStruct(w io.Writer, info *TypeInfo, rv reflect.Value, _ FieldOptions) (err error) {
+func (cdc *Codec) encodeReflectJSONStruct(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
+	_ FieldOptions) (err error) {
 	if printLog {
 		fmt.Println("(e) encodeReflectJSONStruct")
 		defer func() {
@@ -280,6 +370,10 @@ func (cdc *Codec) encodeReflectJSONStruct(w io.Writer, info *TypeInfo, rv reflec
 		}()
 	}
 
+	if info.JSONArray {
+		return cdc.encodeReflectJSONStructArray(es, w, info, rv)
+	}
+
 	// Part 1.
 	err = writeStr(w, `{`)
 	if err != nil {
@@ -315,6 +409,13 @@ func (cdc *Codec) encodeReflectJSONStruct(w io.Writer, info *TypeInfo, rv reflec
 			}
 			writeComma = false //nolint:ineffassign
 		}
+		// Write the field comment, if enabled.
+		if _, ok := w.(*jsonCommentWriter); ok && field.Comment != "" {
+			err = writeJSONComment(w, field)
+			if err != nil {
+				return
+			}
+		}
 		// Write field JSON name.
 		err = invokeStdlibJSONMarshal(w, field.JSONName)
 		if err != nil {
@@ -329,7 +430,7 @@ func (cdc *Codec) encodeReflectJSONStruct(w io.Writer, info *TypeInfo, rv reflec
 		if isNil {
 			err = writeStr(w, `null`)
 		} else {
-			err = cdc.encodeReflectJSON(w, finfo, frv, field.FieldOptions)
+			err = cdc.encodeReflectJSON(es, w, finfo, frv, field.FieldOptions)
 		}
 		if err != nil {
 			return
@@ -339,8 +440,43 @@ func (cdc *Codec) encodeReflectJSONStruct(w io.Writer, info *TypeInfo, rv reflec
 	return err
 }
 
+// Writes the field values of the struct rv as an array, in field number
+// order, see ConcreteOptions.JSONArray.
+func (cdc *Codec) encodeReflectJSONStructArray(es *encodeState, w io.Writer, info *TypeInfo,
+	rv reflect.Value) (err error) {
+	err = writeStr(w, `[`)
+	if err != nil {
+		return
+	}
+	for fnum := 1; fnum <= len(info.Fields); fnum++ {
+		field := info.fieldByNum(uint32(fnum))
+		if fnum > 1 {
+			err = writeStr(w, `,`)
+			if err != nil {
+				return
+			}
+		}
+		var frv, _, isNil = derefPointers(rv.Field(field.Index))
+		if isNil {
+			err = writeStr(w, `null`)
+		} else {
+			var finfo *TypeInfo
+			finfo, err = cdc.getTypeInfoWlock(field.Type)
+			if err != nil {
+				return
+			}
+			err = cdc.encodeReflectJSON(es, w, finfo, frv, field.FieldOptions)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return writeStr(w, `]`)
+}
+
 // TODO: TEST
-func (cdc *Codec) encodeReflectJSONMap(w io.Writer, info *TypeInfo, rv reflect.Value, fopts FieldOptions) (err error) {
+func (cdc *Codec) encodeReflectJSONMap(es *encodeState, w io.Writer, info *TypeInfo, rv reflect.Value,
+	fopts FieldOptions) (err error) {
 	if printLog {
 		fmt.Println("(e) encodeReflectJSONMap")
 		defer func() {
@@ -398,7 +534,7 @@ func (cdc *Codec) encodeReflectJSONMap(w io.Writer, info *TypeInfo, rv reflect.V
 			if err != nil {
 				return
 			}
-			err = cdc.encodeReflectJSON(w, vinfo, vrv, fopts) // pass through fopts
+			err = cdc.encodeReflectJSON(es, w, vinfo, vrv, fopts) // pass through fopts
 		}
 		if err != nil {
 			return
@@ -412,6 +548,30 @@ func (cdc *Codec) encodeReflectJSONMap(w io.Writer, info *TypeInfo, rv reflect.V
 //----------------------------------------
 // Misc.
 
+// The prefix of the keys of field comments, see Codec.SetJSONComments.
+const jsonCommentKeyPrefix = "_comment_"
+
+// jsonCommentWriter is the writer of MarshalJSONIndent, if field comments
+// are enabled with Codec.SetJSONComments.
+type jsonCommentWriter struct {
+	*bytes.Buffer
+}
+
+// Writes the comment of field as a sibling key before it, followed by a comma.
+func writeJSONComment(w io.Writer, field FieldInfo) error {
+	err := invokeStdlibJSONMarshal(w, jsonCommentKeyPrefix+field.JSONName)
+	if err != nil {
+		return err
+	}
+	if err = writeStr(w, `:`); err != nil {
+		return err
+	}
+	if err = invokeStdlibJSONMarshal(w, field.Comment); err != nil {
+		return err
+	}
+	return writeStr(w, `,`)
+}
+
 // CONTRACT: rv implements json.Marshaler.
 func invokeMarshalJSON(w io.Writer, rv reflect.Value) error {
 	blob, err := rv.Interface().(json.Marshaler).MarshalJSON()
@@ -422,6 +582,36 @@ func invokeMarshalJSON(w io.Writer, rv reflect.Value) error {
 	return err
 }
 
+func writeJSONRawMessage(w io.Writer, raw []byte) error {
+	if len(raw) == 0 {
+		return writeStr(w, `null`)
+	}
+	if !json.Valid(raw) {
+		return fmt.Errorf("invalid JSON in json.RawMessage: %q", raw)
+	}
+	_, err := w.Write(raw)
+	return err
+}
+
+// Writes NaN or ±Inf according to Codec.SetJSONNonFiniteFloats.
+func (es *encodeState) encodeJSONNonFiniteFloat(w io.Writer, f float64) error {
+	switch es.jsonNonFinite {
+	case JSONNonFiniteString:
+		switch {
+		case math.IsNaN(f):
+			return writeStr(w, `"NaN"`)
+		case math.IsInf(f, 1):
+			return writeStr(w, `"Infinity"`)
+		default:
+			return writeStr(w, `"-Infinity"`)
+		}
+	case JSONNonFiniteNull:
+		return writeStr(w, `null`)
+	default:
+		return errors.Errorf("amino:JSON can't encode float %v, see Codec.SetJSONNonFiniteFloats", f)
+	}
+}
+
 func invokeStdlibJSONMarshal(w io.Writer, v interface{}) error {
 	// Note: Please don't stream out the output because that adds a newline
 	// using json.NewEncoder(w).Encode(data)
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"strings"
 	"testing"
@@ -586,4 +587,719 @@ func TestMarshalJSONIndent(t *testing.T) {
 	blob, err := cdc.MarshalJSONIndent(obj, "", "  ")
 	assert.Nil(t, err)
 	assert.Equal(t, expected, string(blob))
+
+	// Indented JSON, including interface wrappers, decodes like compact JSON.
+	tr := &Transport{Vehicle: Car("Tesla"), Capacity: 2}
+	blob, err = cdc.MarshalJSONIndent(tr, "", "\t")
+	require.NoError(t, err)
+	var tr2 Transport
+	require.NoError(t, cdc.UnmarshalJSON(blob, &tr2))
+	assert.Equal(t, *tr, tr2)
+	sheet := BalanceSheet{Assets: []Asset{Car("Tesla"), insurancePlan(3)}}
+	blob, err = cdc.MarshalJSONIndent(sheet, " ", "  ")
+	require.NoError(t, err)
+	var sheet2 BalanceSheet
+	require.NoError(t, cdc.UnmarshalJSON(blob, &sheet2))
+	assert.Equal(t, sheet, sheet2)
+}
+
+type legacyShape interface{ Area() int }
+
+type legacySquare struct{ Side int }
+
+type legacyCircle struct{ Radius int }
+
+func (s legacySquare) Area() int { return s.Side * s.Side }
+func (c legacyCircle) Area() int { return 3 * c.Radius * c.Radius }
+
+type legacyDrawing struct {
+	Main   legacyShape
+	Others []legacyShape
+}
+
+func TestUnmarshalJSONBareInterface(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*legacyShape)(nil), nil)
+	cdc.RegisterConcrete(legacySquare{}, "legacy/square", nil)
+
+	// Wrapped and bare values can be mixed.
+	mixed := `{"Main":{"Side":"2"},"Others":[{"type":"legacy/square","value":{"Side":"3"}},{"Side":"4"}]}`
+	var d legacyDrawing
+	require.NoError(t, cdc.UnmarshalJSON([]byte(mixed), &d))
+	assert.Equal(t, legacyDrawing{
+		Main:   legacySquare{2},
+		Others: []legacyShape{legacySquare{3}, legacySquare{4}},
+	}, d)
+
+	// Wrappers with unknown names are still errors.
+	err := cdc.UnmarshalJSON([]byte(`{"Main":{"type":"legacy/hexagon","value":{}}}`), &d)
+	assert.Error(t, err)
+
+	// Other keys of wrappers are ignored.
+	d = legacyDrawing{}
+	err = cdc.UnmarshalJSON([]byte(`{"Main":{"type":"legacy/square","value":{"Side":"7"},"extra":1}}`), &d)
+	require.NoError(t, err)
+	assert.Equal(t, legacyDrawing{Main: legacySquare{7}}, d)
+
+	// With more than one concrete type, bare values are ambiguous...
+	cdc.RegisterConcrete(legacyCircle{}, "legacy/circle", nil)
+	err = cdc.UnmarshalJSON([]byte(mixed), &d)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "bare")
+	assert.Contains(t, err.Error(), "multiple concrete types")
+
+	// ... unless a type hint is given.
+	d = legacyDrawing{}
+	err = cdc.UnmarshalJSONWithHints([]byte(`{"Main":{"Radius":"1"},"Others":[{"Radius":"2"}]}`), &d,
+		map[string]interface{}{"Main": legacyCircle{}, "Others": legacyCircle{}})
+	require.NoError(t, err)
+	assert.Equal(t, legacyDrawing{
+		Main:   legacyCircle{1},
+		Others: []legacyShape{legacyCircle{2}},
+	}, d)
+
+	// Invalid hints are rejected.
+	err = cdc.UnmarshalJSONWithHints([]byte(mixed), &d, map[string]interface{}{"Main": legacyDrawing{}})
+	assert.Error(t, err)
+
+	// Bare objects with "type" and "value" keys are only read as wrappers if
+	// "type" is a string.
+	cdc = amino.NewCodec()
+	cdc.RegisterInterface((*legacyShape)(nil), nil)
+	cdc.RegisterConcrete(legacyTile{}, "legacy/tile", nil)
+	var ls legacyShape
+	require.NoError(t, cdc.UnmarshalJSON([]byte(`{"type":true,"value":"3"}`), &ls))
+	assert.Equal(t, legacyTile{Flipped: true, Value: 3}, ls)
+}
+
+type legacyTile struct {
+	Flipped bool `json:"type"`
+	Value   int  `json:"value"`
+}
+
+func (t legacyTile) Area() int { return t.Value }
+
+type extensionEnvelope struct {
+	Kind    string
+	Payload json.RawMessage
+	Extra   *json.RawMessage `json:"extra,omitempty"`
+}
+
+func TestJSONRawMessage(t *testing.T) {
+	cdc := amino.NewCodec()
+
+	extra := json.RawMessage(`[1,"two",null]`)
+	env := extensionEnvelope{
+		Kind:    "ext",
+		Payload: json.RawMessage(`{"b": 2, "a": [true]}`),
+		Extra:   &extra,
+	}
+
+	// JSON embeds raw messages verbatim.
+	bz, err := cdc.MarshalJSON(env)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Kind":"ext","Payload":{"b": 2, "a": [true]},"extra":[1,"two",null]}`, string(bz))
+	var env2 extensionEnvelope
+	require.NoError(t, cdc.UnmarshalJSON(bz, &env2))
+	assert.Equal(t, env, env2)
+
+	// Binary stores raw messages as bytes.
+	bz, err = cdc.MarshalBinaryBare(env)
+	require.NoError(t, err)
+	env2 = extensionEnvelope{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &env2))
+	assert.Equal(t, env, env2)
+
+	// Empty raw messages are null.
+	bz, err = cdc.MarshalJSON(extensionEnvelope{Kind: "none"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Kind":"none","Payload":null}`, string(bz))
+	env2 = extensionEnvelope{}
+	require.NoError(t, cdc.UnmarshalJSON(bz, &env2))
+	assert.Equal(t, extensionEnvelope{Kind: "none"}, env2)
+
+	// Invalid raw messages can't be encoded.
+	_, err = cdc.MarshalJSON(extensionEnvelope{Payload: json.RawMessage(`{"a":`)})
+	assert.Error(t, err)
+}
+
+type measurement struct {
+	Value  float64 `amino:"unsafe"`
+	Weight float32 `amino:"unsafe"`
+}
+
+func TestJSONNonFiniteFloats(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	// Finite values are unaffected.
+	bz, err := cdc.MarshalJSON(measurement{Value: 1.5, Weight: -2})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Value":1.5,"Weight":-2}`, string(bz))
+
+	// By default, NaN and Inf can't be encoded.
+	_, err = cdc.MarshalJSON(measurement{Value: math.NaN()})
+	assert.Error(t, err)
+	_, err = cdc.MarshalJSON(measurement{Weight: float32(math.Inf(-1))})
+	assert.Error(t, err)
+
+	cdc.SetJSONNonFiniteFloats(amino.JSONNonFiniteString)
+	bz, err = cdc.MarshalJSON(measurement{Value: math.NaN(), Weight: float32(math.Inf(1))})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Value":"NaN","Weight":"Infinity"}`, string(bz))
+	var m measurement
+	require.NoError(t, cdc.UnmarshalJSON(bz, &m))
+	assert.True(t, math.IsNaN(m.Value))
+	assert.True(t, math.IsInf(float64(m.Weight), 1))
+	require.NoError(t, cdc.UnmarshalJSON([]byte(`{"Value":"-Infinity","Weight":3}`), &m))
+	assert.True(t, math.IsInf(m.Value, -1))
+	assert.Equal(t, float32(3), m.Weight)
+	assert.Error(t, cdc.UnmarshalJSON([]byte(`{"Value":"nan"}`), &m))
+
+	cdc.SetJSONNonFiniteFloats(amino.JSONNonFiniteNull)
+	bz, err = cdc.MarshalJSON(measurement{Value: math.Inf(-1), Weight: 2})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Value":null,"Weight":2}`, string(bz))
+	m = measurement{}
+	require.NoError(t, cdc.UnmarshalJSON(bz, &m))
+	assert.Equal(t, measurement{Weight: 2}, m)
+
+	// The binary encoding keeps the IEEE 754 bits.
+	bz, err = cdc.MarshalBinaryBare(measurement{Value: math.NaN(), Weight: float32(math.Inf(-1))})
+	require.NoError(t, err)
+	m = measurement{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &m))
+	assert.Equal(t, math.Float64bits(math.NaN()), math.Float64bits(m.Value))
+	assert.True(t, math.IsInf(float64(m.Weight), -1))
+}
+
+func TestMarshalUnmarshalJSONGzip(t *testing.T) {
+	var cdc = amino.NewCodec()
+
+	type config struct {
+		Name  string
+		Peers []string
+	}
+	c := config{Name: "node", Peers: []string{"a", "b"}}
+
+	bz, err := cdc.MarshalJSONGzip(c)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x1f, 0x8b}, bz[:2])
+	var c2 config
+	require.NoError(t, cdc.UnmarshalJSONGzip(bz, &c2))
+	assert.Equal(t, c, c2)
+
+	// Plain JSON is decoded as is.
+	c2 = config{}
+	require.NoError(t, cdc.UnmarshalJSONGzip([]byte(`{"Name":"node","Peers":["a","b"]}`), &c2))
+	assert.Equal(t, c, c2)
+
+	// Corrupt gzip data fails.
+	assert.Error(t, cdc.UnmarshalJSONGzip(bz[:len(bz)-4], &c2))
+
+	// The decompressed size is limited, so highly compressed input can't
+	// expand without bound.
+	c = config{Name: strings.Repeat("a", 100000)}
+	bz, err = cdc.MarshalJSONGzip(c)
+	require.NoError(t, err)
+	size := len(cdc.MustMarshalJSON(c))
+	cdc.SetMaxDecompressedSize(size - 1)
+	err = cdc.UnmarshalJSONGzip(bz, &c2)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "exceeds max size")
+	}
+	cdc.SetMaxDecompressedSize(size)
+	require.NoError(t, cdc.UnmarshalJSONGzip(bz, &c2))
+	assert.Equal(t, c, c2)
+	assert.Panics(t, func() { cdc.SetMaxDecompressedSize(-1) })
+}
+
+func TestDecodeJSONArrayStream(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc.RegisterConcrete(hintCat{}, "zoo/Cat", nil)
+	cdc.RegisterConcrete(&hintDog{}, "zoo/Dog", nil)
+
+	animals := []hintAnimal{hintCat{"Tom"}, &hintDog{"Rex"}, hintCat{"Kit"}}
+	bz, err := cdc.MarshalJSON(animals)
+	require.NoError(t, err)
+
+	// Interface elements are decoded from their envelopes.
+	var got []hintAnimal
+	err = cdc.DecodeJSONArrayStream(bytes.NewReader(bz), (*hintAnimal)(nil), func(o interface{}) error {
+		got = append(got, o.(hintAnimal))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, animals, got)
+
+	// Struct elements are decoded as the template's type.
+	var cats []*hintCat
+	err = cdc.DecodeJSONArrayStream(strings.NewReader(` [ {"type":"zoo/Cat","value":{"Name":"A"}},
+		{"type":"zoo/Cat","value":{"Name":"B"}} ] `), &hintCat{}, func(o interface{}) error {
+		cats = append(cats, o.(*hintCat))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*hintCat{{"A"}, {"B"}}, cats)
+
+	// Decoding stops at the first error from fn.
+	stop := fmt.Errorf("stop")
+	var n int
+	err = cdc.DecodeJSONArrayStream(bytes.NewReader(bz), (*hintAnimal)(nil), func(o interface{}) error {
+		n++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, n)
+
+	for _, bad := range []string{``, `{}`, `[`, `[{"type":"zoo/Cat","value":{"Name":"A"}}`, `[1]`} {
+		err = cdc.DecodeJSONArrayStream(strings.NewReader(bad), (*hintAnimal)(nil), func(o interface{}) error { return nil })
+		assert.Error(t, err, bad)
+	}
+
+	err = cdc.DecodeJSONArrayStream(strings.NewReader(`[]`), (*hintAnimal)(nil), func(o interface{}) error {
+		t.Fatal("fn called for an empty array")
+		return nil
+	})
+	assert.NoError(t, err)
+}
+
+func TestDecodeJSONLines(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*hintAnimal)(nil), nil)
+	cdc.RegisterConcrete(hintCat{}, "zoo/Cat", nil)
+	cdc.RegisterConcrete(&hintDog{}, "zoo/Dog", nil)
+
+	animals := []hintAnimal{hintCat{"Tom"}, &hintDog{"Rex"}, hintCat{"Kit"}}
+	var buf bytes.Buffer
+	for i, a := range animals {
+		bz, err := cdc.MarshalJSON(&a)
+		require.NoError(t, err)
+		buf.Write(bz)
+		if i == 1 {
+			buf.WriteString("\r\n\n   \n") // Blank lines are skipped.
+		} else {
+			buf.WriteString("\n")
+		}
+	}
+	lines := buf.String()
+
+	// Interface values are decoded from their envelopes.
+	var got []hintAnimal
+	err := cdc.DecodeJSONLines(strings.NewReader(lines), (*hintAnimal)(nil), func(o interface{}) error {
+		got = append(got, o.(hintAnimal))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, animals, got)
+
+	// Struct values are decoded as the template's type, and the last line
+	// needn't end with a newline.
+	var cats []*hintCat
+	err = cdc.DecodeJSONLines(strings.NewReader(`{"type":"zoo/Cat","value":{"Name":"A"}}`+"\n"+
+		`{"type":"zoo/Cat","value":{"Name":"B"}}`), &hintCat{}, func(o interface{}) error {
+		cats = append(cats, o.(*hintCat))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*hintCat{{"A"}, {"B"}}, cats)
+
+	// Decoding stops at the first error from fn.
+	stop := fmt.Errorf("stop")
+	var n int
+	err = cdc.DecodeJSONLines(strings.NewReader(lines), (*hintAnimal)(nil), func(o interface{}) error {
+		n++
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, n)
+
+	// Errors tell the line number.
+	n = 0
+	err = cdc.DecodeJSONLines(strings.NewReader(lines+"{\n"), (*hintAnimal)(nil), func(o interface{}) error {
+		n++
+		return nil
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "line 6")
+	assert.Equal(t, 3, n)
+
+	err = cdc.DecodeJSONLines(strings.NewReader("\n\n"), (*hintAnimal)(nil), func(o interface{}) error {
+		t.Fatal("fn called for blank lines")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Error(t, cdc.DecodeJSONLines(strings.NewReader(lines), nil, func(o interface{}) error { return nil }))
+}
+
+func TestJSONComments(t *testing.T) {
+	type limits struct {
+		Timeout int64 `json:"timeout" amino:"comment=In seconds, zero means no timeout."`
+		Peers   int32 `json:"peers,omitempty" amino:"min=1,comment=Max peers."`
+	}
+	type config struct {
+		Moniker string `amino:"comment=Shown to \"peers\"."`
+		Limits  limits
+	}
+
+	cdc := amino.NewCodec()
+	c := config{Moniker: "node0", Limits: limits{Timeout: 30, Peers: 5}}
+
+	// Comments are only written when enabled, and only by MarshalJSONIndent.
+	bz, err := cdc.MarshalJSONIndent(c, "", "  ")
+	require.NoError(t, err)
+	assert.NotContains(t, string(bz), "_comment_")
+
+	cdc.SetJSONComments(true)
+	bz, err = cdc.MarshalJSONIndent(c, "", "  ")
+	require.NoError(t, err)
+	assert.Equal(t, `{
+  "_comment_Moniker": "Shown to \"peers\".",
+  "Moniker": "node0",
+  "Limits": {
+    "_comment_timeout": "In seconds, zero means no timeout.",
+    "timeout": "30",
+    "_comment_peers": "Max peers.",
+    "peers": 5
+  }
+}`, string(bz))
+	jsonBz, err := cdc.MarshalJSON(c)
+	require.NoError(t, err)
+	assert.NotContains(t, string(jsonBz), "_comment_")
+
+	// Comments are skipped when decoding, and the other tags still apply.
+	var c2 config
+	require.NoError(t, cdc.UnmarshalJSON(bz, &c2))
+	assert.Equal(t, c, c2)
+	bz, err = cdc.MarshalJSONIndent(config{Moniker: "node0"}, "", "  ")
+	require.NoError(t, err)
+	assert.NotContains(t, string(bz), "_comment_peers", "omitted fields have no comment")
+	var c3 config
+	assert.Error(t, cdc.UnmarshalJSON(bz, &c3), "min=1")
+}
+
+// geoPoint is compact bytes in Amino:binary, but a rich object in JSON.
+type geoPoint struct {
+	Lat, Lng int32
+}
+
+func (gp geoPoint) MarshalAmino() ([]byte, error) {
+	return []byte{byte(gp.Lat), byte(gp.Lng)}, nil
+}
+
+func (gp *geoPoint) UnmarshalAmino(bz []byte) error {
+	if len(bz) != 2 {
+		return fmt.Errorf("invalid geoPoint %X", bz)
+	}
+	gp.Lat, gp.Lng = int32(int8(bz[0])), int32(int8(bz[1]))
+	return nil
+}
+
+func (gp *geoPoint) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]int32{"latitude": gp.Lat, "longitude": gp.Lng})
+}
+
+func (gp *geoPoint) UnmarshalJSON(bz []byte) error {
+	var obj map[string]int32
+	if err := json.Unmarshal(bz, &obj); err != nil {
+		return err
+	}
+	gp.Lat, gp.Lng = obj["latitude"], obj["longitude"]
+	return nil
+}
+
+type geoPlace struct {
+	Name  string
+	Point geoPoint
+	Alt   *geoPoint
+}
+
+func TestSeparateJSONAndBinaryRepr(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterConcrete(geoPoint{}, "geo/Point", nil)
+
+	place := geoPlace{"Seoul", geoPoint{37, 127}, &geoPoint{-1, 2}}
+
+	bz, err := cdc.MarshalBinaryBare(place)
+	require.NoError(t, err)
+	assert.Equal(t, []byte{0x0a, 0x05, 'S', 'e', 'o', 'u', 'l', 0x12, 0x02, 37, 127, 0x1a, 0x02, 0xff, 0x02}, bz)
+	var place2 geoPlace
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &place2))
+	assert.Equal(t, place, place2)
+
+	js, err := cdc.MarshalJSON(place)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Name":"Seoul","Point":{"latitude":37,"longitude":127},"Alt":{"latitude":-1,"longitude":2}}`, string(js))
+	var place3 geoPlace
+	require.NoError(t, cdc.UnmarshalJSON(js, &place3))
+	assert.Equal(t, place, place3)
+
+	// Registered types keep their disfix wrapper.
+	js, err = cdc.MarshalJSON(geoPoint{1, 2})
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"geo/Point","value":{"latitude":1,"longitude":2}}`, string(js))
+	var gp geoPoint
+	require.NoError(t, cdc.UnmarshalJSON(js, &gp))
+	assert.Equal(t, geoPoint{1, 2}, gp)
+
+	bz, err = cdc.MarshalBinaryBare(geoPoint{1, 2})
+	require.NoError(t, err)
+	gp = geoPoint{}
+	require.NoError(t, cdc.UnmarshalBinaryBare(bz, &gp))
+	assert.Equal(t, geoPoint{1, 2}, gp)
+
+	// Map values aren't addressable, but use the pointer's MarshalJSON too.
+	cdc.SetAllowMaps(true)
+	js, err = cdc.MarshalJSON(map[string]geoPoint{"a": {3, 4}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":{"latitude":3,"longitude":4}}`, string(js))
+	var points map[string]geoPoint
+	require.NoError(t, cdc.UnmarshalJSON(js, &points))
+	assert.Equal(t, map[string]geoPoint{"a": {3, 4}}, points)
+}
+
+type shiftKind uint8
+
+type shiftSchedule struct {
+	Month time.Month
+	Days  []time.Weekday
+	Kind  shiftKind
+	Next  *time.Month
+}
+
+func TestJSONEnums(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterEnum(shiftKind(0), map[int64]string{0: "DAY", 1: "NIGHT"})
+
+	next := time.February
+	s := shiftSchedule{time.January, []time.Weekday{time.Monday, time.Friday}, 1, &next}
+	bz, err := cdc.MarshalJSON(s)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Month":"January","Days":["Monday","Friday"],"Kind":"NIGHT","Next":"February"}`, string(bz))
+	var s2 shiftSchedule
+	require.NoError(t, cdc.UnmarshalJSON(bz, &s2))
+	assert.Equal(t, s, s2)
+
+	// Numbers are accepted too, quoted or not.
+	var s3 shiftSchedule
+	require.NoError(t, cdc.UnmarshalJSON([]byte(`{"Month":"3","Days":[0,"6"],"Kind":1,"Next":null}`), &s3))
+	assert.Equal(t, shiftSchedule{time.March, []time.Weekday{time.Sunday, time.Saturday}, 1, nil}, s3)
+
+	// Values without a name are written as numbers.
+	bz, err = cdc.MarshalJSON(shiftSchedule{Month: 13, Kind: 7})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Month":"13","Days":null,"Kind":7,"Next":null}`, string(bz))
+
+	// Amino:binary is unaffected.
+	bz, err = cdc.MarshalBinaryBare(s)
+	require.NoError(t, err)
+	plain := amino.NewCodec()
+	two := 2
+	bz2, err := plain.MarshalBinaryBare(struct {
+		Month int
+		Days  []int
+		Kind  uint8
+		Next  *int
+	}{1, []int{1, 5}, 1, &two})
+	require.NoError(t, err)
+	bz3, err := plain.MarshalBinaryBare(s)
+	require.NoError(t, err)
+	assert.Equal(t, bz2, bz)
+	assert.Equal(t, bz3, bz)
+
+	for _, invalid := range []string{`{"Month":"Smarch"}`, `{"Kind":"256"}`, `{"Kind":-1}`, `{"Month":true}`} {
+		assert.Error(t, cdc.UnmarshalJSON([]byte(invalid), &s3), invalid)
+	}
+	assert.Panics(t, func() { cdc.RegisterEnum("", map[int64]string{}) })
+	assert.Panics(t, func() { cdc.RegisterEnum(shiftKind(0), map[int64]string{0: "A", 1: "A"}) })
+	assert.Panics(t, func() { cdc.RegisterEnum(shiftKind(0), map[int64]string{0: "1"}) })
+}
+
+func TestRejectDuplicateJSONKeys(t *testing.T) {
+	type account struct {
+		Owner   string
+		Balance int32
+		Tags    []string
+	}
+	cdc := amino.NewCodec()
+	cdc.SetAllowMaps(true)
+	dup := []byte(`{"Owner":"alice","Balance":1,"Balance":1000}`)
+
+	// Lenient by default, like encoding/json.
+	var acc account
+	require.NoError(t, cdc.UnmarshalJSON(dup, &acc))
+	assert.Equal(t, int32(1000), acc.Balance)
+
+	cdc.SetRejectDuplicateJSONKeys(true)
+	err := cdc.UnmarshalJSON(dup, &acc)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `duplicate key "Balance"`)
+	}
+	var m map[string]int32
+	assert.Error(t, cdc.UnmarshalJSON([]byte(`{"a":1,"a":2}`), &m))
+	require.NoError(t, cdc.UnmarshalJSON([]byte(`{"Owner":"bob","Tags":["x","x"]}`), &acc))
+	assert.Equal(t, account{"bob", 0, []string{"x", "x"}}, acc)
+
+	// Amino:binary always rejects repeated non-repeated fields.
+	cdc.SetRejectDuplicateJSONKeys(false)
+	assert.Error(t, cdc.UnmarshalBinaryBare([]byte{0x10, 0x01, 0x10, 0x02}, &acc))
+	require.NoError(t, cdc.UnmarshalBinaryBare([]byte{0x1a, 0x01, 'x', 0x1a, 0x01, 'x'}, &acc))
+	assert.Equal(t, []string{"x", "x"}, acc.Tags)
+}
+
+type compactTrade struct {
+	Price  int32
+	Symbol string
+	Side   *string
+	Time   time.Time
+	Notes  []string `json:",omitempty"`
+}
+
+func TestJSONArrayStruct(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterConcrete(compactTrade{}, "test/Trade", &amino.ConcreteOptions{JSONArray: true})
+
+	now := time.Unix(1500000000, 0).UTC()
+	trade := compactTrade{Price: 101, Symbol: "ATOM", Time: now}
+	bz, err := cdc.MarshalJSON(trade)
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"test/Trade","value":[101,"ATOM",null,"2017-07-14T02:40:00Z",null]}`, string(bz))
+	var trade2 compactTrade
+	require.NoError(t, cdc.UnmarshalJSON(bz, &trade2))
+	assert.Equal(t, trade, trade2)
+
+	// Also as a field, and within lists.
+	trades := struct{ Trades []compactTrade }{[]compactTrade{trade, {Price: 1, Notes: []string{"x"}}}}
+	bz, err = cdc.MarshalJSON(trades)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Trades":[[101,"ATOM",null,"2017-07-14T02:40:00Z",null],[1,"",null,"0001-01-01T00:00:00Z",["x"]]]}`, string(bz))
+	trades2 := trades
+	trades2.Trades = nil
+	require.NoError(t, cdc.UnmarshalJSON(bz, &trades2))
+	assert.Equal(t, trades, trades2)
+
+	// Missing trailing values are defaults, and extra ones are ignored.
+	trade2 = compactTrade{Notes: []string{"stale"}}
+	require.NoError(t, cdc.UnmarshalJSON([]byte(`{"type":"test/Trade","value":[5,"BTC"]}`), &trade2))
+	assert.Equal(t, compactTrade{Price: 5, Symbol: "BTC"}, trade2)
+	require.NoError(t, cdc.UnmarshalJSON([]byte(`{"type":"test/Trade","value":[5,"BTC",null,null,null,"new"]}`), &trade2))
+	assert.Equal(t, compactTrade{Price: 5, Symbol: "BTC"}, trade2)
+	err = cdc.UnmarshalJSON([]byte(`{"type":"test/Trade","value":{"Price":5}}`), &trade2)
+	assert.Error(t, err, "not an array")
+
+	// Amino:binary is unaffected.
+	plain := amino.NewCodec()
+	plain.RegisterConcrete(compactTrade{}, "test/Trade", nil)
+	assert.Equal(t, plain.MustMarshalBinaryBare(trade), cdc.MustMarshalBinaryBare(trade))
+
+	assert.Panics(t, func() {
+		cdc.RegisterConcrete("", "test/String", &amino.ConcreteOptions{JSONArray: true})
+	})
+}
+
+func TestBareTopLevelJSON(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.RegisterInterface((*legacyShape)(nil), nil)
+	cdc.RegisterConcrete(legacySquare{}, "legacy/square", nil)
+	cdc.RegisterConcrete(legacyCircle{}, "legacy/circle", nil)
+	var shape legacyShape = legacyCircle{1}
+	d := legacyDrawing{Main: legacySquare{2}, Others: []legacyShape{shape}}
+	const wrappedDrawing = `{"Main":{"type":"legacy/square","value":{"Side":"2"}},` +
+		`"Others":[{"type":"legacy/circle","value":{"Radius":"1"}}]}`
+
+	// Registered concrete values are wrapped by default, even at the top level.
+	bz, err := cdc.MarshalJSON(legacySquare{2})
+	require.NoError(t, err)
+	assert.Equal(t, `{"type":"legacy/square","value":{"Side":"2"}}`, string(bz))
+
+	cdc.SetBareTopLevelJSON(true)
+	for _, tc := range []struct {
+		o    interface{}
+		ptr  interface{}
+		want string
+	}{
+		// Top-level concrete values are bare.
+		{legacySquare{2}, new(legacySquare), `{"Side":"2"}`},
+		{&legacySquare{2}, new(legacySquare), `{"Side":"2"}`},
+		// Interface fields are always wrapped.
+		{d, new(legacyDrawing), wrappedDrawing},
+		// As are top-level interface values, through a pointer.
+		{&shape, new(legacyShape), `{"type":"legacy/circle","value":{"Radius":"1"}}`},
+	} {
+		bz, err := cdc.MarshalJSON(tc.o)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, string(bz))
+		require.NoError(t, cdc.UnmarshalJSON(bz, tc.ptr))
+		assert.Equal(t, reflect.Indirect(reflect.ValueOf(tc.o)).Interface(),
+			reflect.ValueOf(tc.ptr).Elem().Interface())
+	}
+}
+
+type camelAccount struct {
+	ChainID   string
+	Balance   int64  `json:",omitempty"`
+	PubKeyHex string `json:"pub_key"`
+}
+
+func TestSetJSONFieldNameFunc(t *testing.T) {
+	cdc := amino.NewCodec()
+	cdc.SetJSONFieldNameFunc(func(goName string) string {
+		return strings.ToLower(goName[:1]) + goName[1:]
+	})
+	cdc.RegisterConcrete(camelAccount{}, "test/camelAccount", nil)
+
+	acc := camelAccount{ChainID: "test", Balance: 7, PubKeyHex: "AB"}
+	bz, err := cdc.MarshalJSON(acc)
+	require.NoError(t, err)
+	// Explicitly named fields keep their names.
+	assert.Equal(t,
+		`{"type":"test/camelAccount","value":{"chainID":"test","balance":"7","pub_key":"AB"}}`,
+		string(bz))
+
+	var acc2 camelAccount
+	require.NoError(t, cdc.UnmarshalJSON(bz, &acc2))
+	assert.Equal(t, acc, acc2)
+
+	// Unregistered types use the derived names too.
+	type wrapper struct{ Inner camelAccount }
+	bz, err = cdc.MarshalJSON(wrapper{acc})
+	require.NoError(t, err)
+	assert.Equal(t, `{"inner":{"chainID":"test","balance":"7","pub_key":"AB"}}`, string(bz))
+	var w wrapper
+	require.NoError(t, cdc.UnmarshalJSON(bz, &w))
+	assert.Equal(t, acc, w.Inner)
+}
+
+type aliasedEvent struct {
+	Time  string `json:"timestamp" amino:"jsonaliases=ts;time"`
+	Level string `amino:"jsonaliases=severity,nonempty"`
+}
+
+func TestJSONAliases(t *testing.T) {
+	cdc := amino.NewCodec()
+
+	// Encoding uses the canonical names.
+	bz, err := cdc.MarshalJSON(aliasedEvent{"t1", "info"})
+	require.NoError(t, err)
+	assert.Equal(t, `{"timestamp":"t1","Level":"info"}`, string(bz))
+
+	for _, tc := range []struct {
+		in   string
+		want aliasedEvent
+	}{
+		{`{"timestamp":"t1","Level":"info"}`, aliasedEvent{"t1", "info"}},
+		{`{"ts":"t2","severity":"warn"}`, aliasedEvent{"t2", "warn"}},
+		{`{"time":"t3","Level":"info"}`, aliasedEvent{"t3", "info"}},
+		// The canonical name comes first, then aliases in order.
+		{`{"time":"t3","timestamp":"t1","ts":"t2","Level":"info"}`, aliasedEvent{"t1", "info"}},
+		{`{"time":"t3","ts":"t2","Level":"info"}`, aliasedEvent{"t2", "info"}},
+	} {
+		var ev aliasedEvent
+		require.NoError(t, cdc.UnmarshalJSON([]byte(tc.in), &ev), tc.in)
+		assert.Equal(t, tc.want, ev, tc.in)
+	}
+
+	// Validators still apply alongside aliases.
+	var ev aliasedEvent
+	assert.Error(t, cdc.UnmarshalJSON([]byte(`{"ts":"t2"}`), &ev))
 }
@@ -0,0 +1,89 @@
+//go:build go1.18
+// +build go1.18
+
+package amino
+
+import (
+	"fmt"
+	"net/netip"
+	"reflect"
+)
+
+//----------------------------------------
+// netip.Addr and netip.Prefix
+
+// netip.Addr values are encoded as byte strings of their 4 or 16 bytes (or
+// none for the zero Addr) in Amino:binary, and netip.Prefix values as
+// strings of the form "addr/bits".  Both are encoded as their text forms in
+// Amino:JSON, e.g. "10.0.0.1" or "fe80::1%eth0", or "" for zero values.
+// NOTE: The zone of an IPv6 address can't be encoded in Amino:binary.
+
+var (
+	netipAddrType   = reflect.TypeOf(netip.Addr{})
+	netipPrefixType = reflect.TypeOf(netip.Prefix{})
+)
+
+// Returns true if rt is netip.Addr or netip.Prefix.
+func isNetipType(rt reflect.Type) bool {
+	return rt == netipAddrType || rt == netipPrefixType
+}
+
+// Returns the 4 or 16 bytes of the netip.Addr rv, or none if it's zero.
+func netipAddrBytes(rv reflect.Value) ([]byte, error) {
+	addr := rv.Interface().(netip.Addr)
+	if addr.Zone() != "" {
+		return nil, fmt.Errorf("netip.Addr %v has a zone, which can't be encoded in Amino:binary", addr)
+	}
+	return addr.AsSlice(), nil
+}
+
+// Sets the netip.Addr rv from its 4 or 16 bytes, or none for the zero Addr.
+func decodeNetipAddrBytes(bz []byte, rv reflect.Value) error {
+	var addr netip.Addr
+	switch len(bz) {
+	case 0:
+	case 4, 16:
+		addr, _ = netip.AddrFromSlice(bz)
+	default:
+		return fmt.Errorf("invalid netip.Addr %X: expected 4 or 16 bytes, got %v", bz, len(bz))
+	}
+	rv.Set(reflect.ValueOf(addr))
+	return nil
+}
+
+// Returns the text form of the netip.Addr or netip.Prefix rv, or "" if it's
+// zero.
+func netipText(rv reflect.Value) string {
+	var bz []byte
+	switch o := rv.Interface().(type) {
+	case netip.Addr:
+		bz, _ = o.MarshalText()
+	case netip.Prefix:
+		bz, _ = o.MarshalText()
+	}
+	return string(bz)
+}
+
+// Sets the netip.Addr or netip.Prefix rv from its text form, or "" for the
+// zero value.
+func decodeNetipText(s string, rv reflect.Value) error {
+	var err error
+	switch rv.Type() {
+	case netipAddrType:
+		var addr netip.Addr
+		if s != "" {
+			addr, err = netip.ParseAddr(s)
+		}
+		rv.Set(reflect.ValueOf(addr))
+	case netipPrefixType:
+		var prefix netip.Prefix
+		if s != "" {
+			prefix, err = netip.ParsePrefix(s)
+		}
+		rv.Set(reflect.ValueOf(prefix))
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %v %q: %v", rv.Type(), s, err)
+	}
+	return nil
+}
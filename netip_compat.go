@@ -0,0 +1,35 @@
+//go:build !go1.18
+// +build !go1.18
+
+package amino
+
+import (
+	"reflect"
+)
+
+// Before Go 1.18 there's no net/netip, see netip.go.
+
+var (
+	netipAddrType   reflect.Type
+	netipPrefixType reflect.Type
+)
+
+func isNetipType(rt reflect.Type) bool {
+	return false
+}
+
+func netipAddrBytes(rv reflect.Value) ([]byte, error) {
+	panic("should not happen")
+}
+
+func decodeNetipAddrBytes(bz []byte, rv reflect.Value) error {
+	panic("should not happen")
+}
+
+func netipText(rv reflect.Value) string {
+	panic("should not happen")
+}
+
+func decodeNetipText(s string, rv reflect.Value) error {
+	panic("should not happen")
+}
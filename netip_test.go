@@ -0,0 +1,74 @@
+//go:build go1.18
+// +build go1.18
+
+package amino_test
+
+import (
+	"fmt"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	amino "github.com/tendermint/go-amino"
+)
+
+type netipPeer struct {
+	Addr    netip.Addr
+	Subnet  netip.Prefix
+	Gateway *netip.Addr
+	Routes  []netip.Prefix
+}
+
+func TestNetipFields(t *testing.T) {
+	cdc := amino.NewCodec()
+	gw := netip.MustParseAddr("2001:db8::1")
+
+	for _, peer := range []netipPeer{
+		{},
+		{Addr: netip.MustParseAddr("10.0.0.1"), Subnet: netip.MustParsePrefix("10.0.0.0/8")},
+		{Addr: netip.MustParseAddr("::ffff:10.0.0.1"), Gateway: &gw},
+		{Addr: gw, Routes: []netip.Prefix{netip.MustParsePrefix("2001:db8::/32"), {}}},
+	} {
+		bz, err := cdc.MarshalBinaryBare(peer)
+		require.NoError(t, err)
+		var peer2 netipPeer
+		require.NoError(t, cdc.UnmarshalBinaryBare(bz, &peer2), "%X", bz)
+		assert.Equal(t, peer, peer2)
+
+		js, err := cdc.MarshalJSON(peer)
+		require.NoError(t, err)
+		var peer3 netipPeer
+		require.NoError(t, cdc.UnmarshalJSON(js, &peer3), "%s", js)
+		assert.Equal(t, peer, peer3)
+
+		assert.Equal(t, peer, amino.DeepCopy(peer))
+	}
+
+	// Addresses are their bytes, and prefixes their strings.
+	bz, err := cdc.MarshalBinaryBare(netipPeer{
+		Addr:   netip.MustParseAddr("10.0.0.1"),
+		Subnet: netip.MustParsePrefix("10.0.0.0/8"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "0A040A000001120A31302E302E302E302F38", fmt.Sprintf("%X", bz))
+	js, err := cdc.MarshalJSON(netipPeer{Addr: netip.MustParseAddr("10.0.0.1")})
+	require.NoError(t, err)
+	assert.Equal(t, `{"Addr":"10.0.0.1","Subnet":"","Gateway":null,"Routes":null}`, string(js))
+
+	// Zones are only encoded in JSON.
+	zoned := netipPeer{Addr: netip.MustParseAddr("fe80::1%eth0")}
+	_, err = cdc.MarshalBinaryBare(zoned)
+	assert.Error(t, err)
+	js, err = cdc.MarshalJSON(zoned)
+	require.NoError(t, err)
+	var peer netipPeer
+	require.NoError(t, cdc.UnmarshalJSON(js, &peer))
+	assert.Equal(t, zoned, peer)
+
+	assert.Error(t, cdc.UnmarshalBinaryBare([]byte{0x0A, 0x03, 0x0A, 0x00, 0x00}, &peer), "3-byte address")
+	assert.Error(t, cdc.UnmarshalBinaryBare([]byte{0x12, 0x01, 0x78}, &peer), "bad prefix")
+	assert.Error(t, cdc.UnmarshalJSON([]byte(`{"Addr":"10.0.0"}`), &peer))
+	assert.Error(t, cdc.UnmarshalJSON([]byte(`{"Addr":10}`), &peer))
+}
@@ -0,0 +1,74 @@
+package amino
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//----------------------------------------
+// Prefix table
+
+// PrefixTableEntry is the name of a registered concrete type, with its prefix
+// and disambiguation bytes in hex, as written by Codec.ExportPrefixTable.
+type PrefixTableEntry struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+	Disamb string `json:"disamb"`
+}
+
+// ExportPrefixTable writes the names, prefix bytes and disambiguation bytes
+// of the registered concrete types to w, as a JSON array of
+// PrefixTableEntry sorted by name, e.g. for another service to check with
+// ImportPrefixTable that it agrees on the wire format.
+func (cdc *Codec) ExportPrefixTable(w io.Writer) error {
+	cdc.mtx.RLock()
+	var table = make([]PrefixTableEntry, 0, len(cdc.concreteInfos))
+	for _, cinfo := range sortedByName(cdc.concreteInfos) {
+		table = append(table, PrefixTableEntry{
+			Name:   cinfo.Name,
+			Prefix: hex.EncodeToString(cinfo.Prefix.Bytes()),
+			Disamb: hex.EncodeToString(cinfo.Disamb.Bytes()),
+		})
+	}
+	cdc.mtx.RUnlock()
+
+	return json.NewEncoder(w).Encode(table)
+}
+
+// ImportPrefixTable reads a table written by ExportPrefixTable from r, and
+// checks that it is consistent with this codec: each entry's bytes must be
+// those derived from its name, and no concrete type may be registered here
+// under another name with the same prefix bytes.  Entries for types not
+// registered here are only checked, not registered, since registering
+// requires the Go type.
+func (cdc *Codec) ImportPrefixTable(r io.Reader) error {
+	var table []PrefixTableEntry
+	if err := json.NewDecoder(r).Decode(&table); err != nil {
+		return errors.Wrap(err, "cannot read prefix table")
+	}
+
+	cdc.mtx.RLock()
+	defer cdc.mtx.RUnlock()
+
+	var byPrefix = make(map[PrefixBytes]*TypeInfo, len(cdc.concreteInfos))
+	for _, cinfo := range cdc.concreteInfos {
+		byPrefix[cinfo.Prefix] = cinfo
+	}
+	for _, entry := range table {
+		db, pb := nameToDisfix(entry.Name)
+		if !strings.EqualFold(entry.Prefix, hex.EncodeToString(pb.Bytes())) ||
+			!strings.EqualFold(entry.Disamb, hex.EncodeToString(db.Bytes())) {
+			return errors.Errorf("prefix table entry %v has prefix %v and disamb %v, expected %X and %X",
+				entry.Name, entry.Prefix, entry.Disamb, pb.Bytes(), db.Bytes())
+		}
+		if cinfo, ok := byPrefix[pb]; ok && cinfo.Name != entry.Name {
+			return errors.Errorf("prefix %X of %v in prefix table conflicts with %v registered for %v",
+				pb.Bytes(), entry.Name, cinfo.Name, cinfo.Type)
+		}
+	}
+	return nil
+}
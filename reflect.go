@@ -3,7 +3,10 @@ package amino
 import (
 	"encoding/json"
 	"fmt"
+	"math/big"
+	"net/url"
 	"reflect"
+	"strings"
 	"time"
 )
 
@@ -14,8 +17,11 @@ const printLog = false
 
 var (
 	timeType            = reflect.TypeOf(time.Time{})
+	bigFloatType        = reflect.TypeOf(big.Float{})
+	urlType             = reflect.TypeOf(url.URL{})
 	jsonMarshalerType   = reflect.TypeOf(new(json.Marshaler)).Elem()
 	jsonUnmarshalerType = reflect.TypeOf(new(json.Unmarshaler)).Elem()
+	jsonRawMessageType  = reflect.TypeOf(json.RawMessage(nil))
 	errorType           = reflect.TypeOf(new(error)).Elem()
 )
 
@@ -41,6 +47,147 @@ func checkUnsafe(field FieldInfo) {
 	switch field.Type.Kind() {
 	case reflect.Float32, reflect.Float64:
 		panic("floating point types are unsafe for go-amino")
+	case reflect.Complex64, reflect.Complex128:
+		panic("complex types are unsafe for go-amino")
+	}
+}
+
+// Returns the type of the (possibly nested) exported struct field at the
+// dot-separated path of Go field names, relative to rt.  Pointers and list
+// element types are dereferenced along the way.  The empty path refers to rt.
+func fieldTypeByPath(rt reflect.Type, path string) (reflect.Type, error) {
+	if path == "" {
+		return rt, nil
+	}
+	for _, name := range strings.Split(path, ".") {
+		srt := derefListType(rt)
+		if srt.Kind() != reflect.Struct {
+			return nil, fmt.Errorf("field path %q: %v is not a struct", path, srt)
+		}
+		field, ok := srt.FieldByName(name)
+		if !ok || !isExported(field) {
+			return nil, fmt.Errorf("field path %q: %v has no exported field %v", path, srt, name)
+		}
+		rt = field.Type
+	}
+	return rt, nil
+}
+
+// Sets the (possibly nested) field at the dot-separated path of Go field
+// names, relative to rv, to its zero value, as validated by fieldTypeByPath.
+// Along lists, the field is zeroed in every element.  Pointers and slices
+// along the path are copied instead of modified, since rv may share them.
+// CONTRACT: rv is settable.
+func zeroFieldByPath(rv reflect.Value, names []string) {
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return
+		}
+		cpy := reflect.New(rv.Type().Elem())
+		cpy.Elem().Set(rv.Elem())
+		rv.Set(cpy)
+		zeroFieldByPath(cpy.Elem(), names)
+	case reflect.Slice:
+		if rv.IsNil() {
+			return
+		}
+		cpy := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		reflect.Copy(cpy, rv)
+		rv.Set(cpy)
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			zeroFieldByPath(rv.Index(i), names)
+		}
+	case reflect.Struct:
+		frv := rv.FieldByName(names[0])
+		if len(names) == 1 {
+			frv.Set(reflect.Zero(frv.Type()))
+		} else {
+			zeroFieldByPath(frv, names[1:])
+		}
+	}
+}
+
+// A set of field paths as a tree of Go field names, see
+// Codec.MarshalBinaryBareMasked.  A nil subtree means the whole field.
+type fieldMask map[string]fieldMask
+
+// Adds the dot-separated path of Go field names to mask.
+func (mask fieldMask) add(path string) {
+	names := strings.Split(path, ".")
+	for i, name := range names {
+		sub, ok := mask[name]
+		switch {
+		case ok && sub == nil:
+			return // Already the whole field.
+		case i == len(names)-1:
+			mask[name] = nil
+		case !ok:
+			sub = make(fieldMask)
+			mask[name] = sub
+		}
+		mask = sub
+	}
+}
+
+// Sets the fields of rv that aren't in mask to their zero values, like
+// zeroFieldByPath.  Along lists, this applies to every element.
+// CONTRACT: rv is settable.
+func zeroUnmaskedFields(rv reflect.Value, mask fieldMask) {
+	switch rv.Kind() {
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return
+		}
+		cpy := reflect.New(rv.Type().Elem())
+		cpy.Elem().Set(rv.Elem())
+		rv.Set(cpy)
+		zeroUnmaskedFields(cpy.Elem(), mask)
+	case reflect.Slice:
+		if rv.IsNil() {
+			return
+		}
+		cpy := reflect.MakeSlice(rv.Type(), rv.Len(), rv.Len())
+		reflect.Copy(cpy, rv)
+		rv.Set(cpy)
+		fallthrough
+	case reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			zeroUnmaskedFields(rv.Index(i), mask)
+		}
+	case reflect.Struct:
+		for i := 0; i < rv.NumField(); i++ {
+			field := rv.Type().Field(i)
+			if !isExported(field) {
+				continue
+			}
+			frv := rv.Field(i)
+			if sub, ok := mask[field.Name]; !ok {
+				frv.Set(reflect.Zero(field.Type))
+			} else if sub != nil {
+				zeroUnmaskedFields(frv, sub)
+			}
+		}
+	}
+}
+
+// Dereferences pointer types and list element types (except for byte lists)
+// recursively, e.g. []*[2]*Foo becomes Foo.
+func derefListType(rt reflect.Type) reflect.Type {
+	for {
+		switch rt.Kind() {
+		case reflect.Ptr:
+			rt = rt.Elem()
+		case reflect.Array, reflect.Slice:
+			if rt.Elem().Kind() == reflect.Uint8 {
+				return rt
+			}
+			rt = rt.Elem()
+		default:
+			return rt
+		}
 	}
 }
 
@@ -175,7 +322,11 @@ func isNil(rv reflect.Value) bool {
 // constructConcreteType creates the concrete value as
 // well as the corresponding settable value for it.
 // Return irvSet which should be set on caller's interface rv.
-func constructConcreteType(cinfo *TypeInfo) (crv, irvSet reflect.Value) {
+func constructConcreteType(cinfo *TypeInfo) (crv, irvSet reflect.Value, err error) {
+	// Construct new concrete type with the factory, if any.
+	if cinfo.factory != nil {
+		return constructConcreteTypeFromFactory(cinfo)
+	}
 	// Construct new concrete type.
 	if cinfo.PointerPreferred {
 		cPtrRv := reflect.New(cinfo.Type)
@@ -188,6 +339,29 @@ func constructConcreteType(cinfo *TypeInfo) (crv, irvSet reflect.Value) {
 	return
 }
 
+// Like constructConcreteType, but uses the factory registered with
+// RegisterConcreteFactory.  Returns an error if the factory returns a value
+// of the wrong type, or a nil pointer.
+func constructConcreteTypeFromFactory(cinfo *TypeInfo) (crv, irvSet reflect.Value, err error) {
+	o := cinfo.factory()
+	rv := reflect.ValueOf(o)
+	if cinfo.PointerPreferred {
+		if !rv.IsValid() || rv.Type() != reflect.PtrTo(cinfo.Type) || rv.IsNil() {
+			err = fmt.Errorf("factory for %v returned %#v, expected a non-nil *%v", cinfo.Name, o, cinfo.Type)
+			return
+		}
+		return rv.Elem(), rv, nil
+	}
+	if !rv.IsValid() || rv.Type() != cinfo.Type {
+		err = fmt.Errorf("factory for %v returned %#v, expected %v", cinfo.Name, o, cinfo.Type)
+		return
+	}
+	// The value must be addressable to be decoded into.
+	crv = reflect.New(cinfo.Type).Elem()
+	crv.Set(rv)
+	return crv, crv, nil
+}
+
 // CONTRACT: rt.Kind() != reflect.Ptr
 func typeToTyp3(rt reflect.Type, opts FieldOptions) Typ3 {
 	switch rt.Kind() {
@@ -195,6 +369,9 @@ func typeToTyp3(rt reflect.Type, opts FieldOptions) Typ3 {
 		return Typ3ByteLength
 	case reflect.Array, reflect.Slice:
 		return Typ3ByteLength
+	case reflect.Chan:
+		// Only with `amino:"drain_chan"`, encoded like a slice.
+		return Typ3ByteLength
 	case reflect.String:
 		return Typ3ByteLength
 	case reflect.Struct, reflect.Map:
@@ -217,11 +394,32 @@ func typeToTyp3(rt reflect.Type, opts FieldOptions) Typ3 {
 		return Typ38Byte
 	case reflect.Float32:
 		return Typ3_4Byte
+	case reflect.Complex64, reflect.Complex128:
+		// Encoded as a struct, see Codec.SetAllowComplex.
+		return Typ3ByteLength
 	default:
 		panic(fmt.Sprintf("unsupported field type %v", rt))
 	}
 }
 
+// Returns true if info is a struct that's encoded as its fields, rather
+// than specially (e.g. time.Time) or as a repr type.
+func hasStructFields(info *TypeInfo) bool {
+	rt := info.Type
+	return rt.Kind() == reflect.Struct && !info.IsAminoMarshaler &&
+		rt != timeType && rt != bigFloatType && rt != urlType && rt != bufferType && !isNetipType(rt)
+}
+
+// Returns the typ3 of the elements of the list type rt, and true if they're
+// scalars, i.e. encoded packed unless `amino:"unpacked"` is set.
+func scalarListTyp3(rt reflect.Type, opts FieldOptions) (Typ3, bool) {
+	if (rt.Kind() != reflect.Array && rt.Kind() != reflect.Slice) || rt.Elem().Kind() == reflect.Uint8 {
+		return 0, false
+	}
+	typ3 := typeToTyp3(derefType(rt.Elem()), opts)
+	return typ3, typ3 != Typ3ByteLength
+}
+
 func toReprObject(rv reflect.Value) (rrv reflect.Value, err error) {
 	var mwrm reflect.Value
 	if rv.CanAddr() {
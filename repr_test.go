@@ -97,3 +97,97 @@ func TestMarshalAminoJSON(t *testing.T) {
 	assert.Equal(t, f, f2)
 	assert.Equal(t, f.a, f2.a) // In case the above doesn't check private fields?
 }
+
+type paint interface{}
+
+// reprColor is encoded as a hex string through its repr.
+type reprColor struct {
+	r, g, b uint8
+}
+
+func (c reprColor) MarshalAmino() (string, error) {
+	return fmt.Sprintf("#%02x%02x%02x", c.r, c.g, c.b), nil
+}
+
+func (c *reprColor) UnmarshalAmino(repr string) error {
+	_, err := fmt.Sscanf(repr, "#%02x%02x%02x", &c.r, &c.g, &c.b)
+	return err
+}
+
+type reprCanvas struct {
+	Fill    paint
+	Strokes []paint
+}
+
+func TestMarshalAminoInterface(t *testing.T) {
+	for _, ptr := range []bool{false, true} {
+		cdc := NewCodec()
+		cdc.RegisterInterface((*paint)(nil), nil)
+		red, blue := paint(reprColor{255, 0, 0}), paint(reprColor{0, 0, 255})
+		if ptr {
+			cdc.RegisterConcrete(&reprColor{}, "Color", nil)
+			red, blue = &reprColor{255, 0, 0}, &reprColor{0, 0, 255}
+		} else {
+			cdc.RegisterConcrete(reprColor{}, "Color", nil)
+		}
+		c := reprCanvas{Fill: red, Strokes: []paint{blue, red}}
+
+		bz, err := cdc.MarshalBinaryBare(c)
+		assert.NoError(t, err)
+		assert.Contains(t, string(bz), "#ff0000")
+		var c2 reprCanvas
+		assert.NoError(t, cdc.UnmarshalBinaryBare(bz, &c2))
+		assert.Equal(t, c, c2, "pointer preferred: %v", ptr)
+
+		bz, err = cdc.MarshalJSON(c)
+		assert.NoError(t, err)
+		assert.Contains(t, string(bz), `"value":"#0000ff"`)
+		var c3 reprCanvas
+		assert.NoError(t, cdc.UnmarshalJSON(bz, &c3))
+		assert.Equal(t, c, c3, "pointer preferred: %v", ptr)
+
+		// Also as the top-level interface value.
+		bz, err = cdc.MarshalBinaryBare(red)
+		assert.NoError(t, err)
+		var p paint
+		assert.NoError(t, cdc.UnmarshalBinaryBare(bz, &p))
+		assert.Equal(t, red, p)
+	}
+}
+
+type reprMismatch struct{ n int }
+
+func (rm reprMismatch) MarshalAmino() (string, error)  { return fmt.Sprint(rm.n), nil }
+func (rm *reprMismatch) UnmarshalAmino(repr int) error { rm.n = repr; return nil }
+
+func TestMarshalAminoReprMismatch(t *testing.T) {
+	cdc := NewCodec()
+	defer func() {
+		r := recover()
+		if assert.NotNil(t, r, "registration should panic") {
+			msg := fmt.Sprint(r)
+			assert.Contains(t, msg, "func(amino.reprMismatch) (string, error)")
+			assert.Contains(t, msg, "func(*amino.reprMismatch, int) error")
+		}
+	}()
+	cdc.RegisterConcrete(reprMismatch{}, "reprMismatch", nil)
+}
+
+func TestMarshalAminoReprMismatchUnregistered(t *testing.T) {
+	cdc := NewCodec()
+	for i := 0; i < 2; i++ {
+		_, err := cdc.MarshalBinaryBare(reprMismatch{1})
+		assert.Error(t, err)
+		var rm reprMismatch
+		assert.Error(t, cdc.UnmarshalBinaryBare([]byte{0x0A, 0x01, '1'}, &rm))
+	}
+
+	// Panics while building type infos don't leave the codec locked.
+	type badTag struct {
+		N int64 `amino:"sorted"`
+	}
+	assert.Panics(t, func() { cdc.MarshalBinaryBare(badTag{}) }) // nolint: errcheck
+	bz, err := cdc.MarshalBinaryBare("ok")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x0A, 0x02, 'o', 'k'}, bz)
+}
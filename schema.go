@@ -0,0 +1,320 @@
+package amino
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+//----------------------------------------
+// Schema
+
+// SchemaVersion is the version of the document returned by Codec.Schema.
+// It is incremented whenever the format changes incompatibly.
+const SchemaVersion = 1
+
+// Schema is a machine-readable description of the types known to a codec,
+// e.g. for documentation or code generation in other languages.
+type Schema struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	Interfaces    []SchemaInterface `json:"interfaces"`
+	Types         []SchemaType      `json:"types"`
+}
+
+// SchemaInterface describes a registered interface.
+type SchemaInterface struct {
+	Type               string   `json:"type"`
+	AlwaysDisambiguate bool     `json:"alwaysDisambiguate,omitempty"`
+	Implementations    []string `json:"implementations"` // Registered names.
+	Oneof              []string `json:"oneof,omitempty"` // Registered names by field number - 1, see RegisterOneof.
+}
+
+// SchemaType describes a registered concrete type, or a struct type
+// referenced by the fields of another SchemaType.
+type SchemaType struct {
+	Type     string        `json:"type"` // Referenced by SchemaField.Type.
+	Kind     string        `json:"kind"`
+	Name     string        `json:"name,omitempty"`   // Registered name.
+	Prefix   string        `json:"prefix,omitempty"` // Hex, if registered.
+	Disamb   string        `json:"disamb,omitempty"` // Hex, if registered.
+	Repr     string        `json:"repr,omitempty"`   // Encoded as this type, see MarshalAmino.
+	Fields   []SchemaField `json:"fields,omitempty"`
+	Elem     string        `json:"elem,omitempty"`     // If a list or map.
+	MapKey   string        `json:"mapKey,omitempty"`   // If a map.
+	Repeated bool          `json:"repeated,omitempty"` // If a (non-byte) list.
+
+	Description string `json:"description,omitempty"` // See ConcreteOptions.Description.
+	JSONArray   bool   `json:"jsonArray,omitempty"`   // See ConcreteOptions.JSONArray.
+	Version     uint32 `json:"version,omitempty"`     // See ConcreteOptions.Version.
+}
+
+// SchemaField describes a struct field.  Type refers to the type of the
+// field after dereferencing pointers, and in the case of lists and maps,
+// Elem refers to the element type.
+type SchemaField struct {
+	Name     string   `json:"name"`
+	JSONName string   `json:"jsonName"`
+	Number   uint32   `json:"number"`
+	Kind     string   `json:"kind"`
+	Type     string   `json:"type"`
+	Typ3     string   `json:"typ3"`
+	Pointer  bool     `json:"pointer,omitempty"`
+	Repeated bool     `json:"repeated,omitempty"` // If a (non-byte) list.
+	Elem     string   `json:"elem,omitempty"`     // If a list or map.
+	MapKey   string   `json:"mapKey,omitempty"`   // If a map.
+	Options  []string `json:"options,omitempty"`  // e.g. "fixed64", "unsafe".
+}
+
+// Schema returns a JSON document describing every registered interface and
+// concrete type, as well as the struct types their fields refer to, with
+// field numbers and wire types.  See the Schema type for the format, which
+// is versioned by the schemaVersion field.  This is a structured version of
+// PrintTypes, meant for programmatic consumption.  Interfaces are sorted by
+// type, and registered types by name, followed by the types they refer to,
+// so the output doesn't depend on the order of registration.  Types
+// registered again under another name come last, again sorted by name.
+func (cdc *Codec) Schema() ([]byte, error) {
+	schema, err := cdc.schema()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+func (cdc *Codec) schema() (*Schema, error) {
+	schema := &Schema{
+		SchemaVersion: SchemaVersion,
+		Interfaces:    []SchemaInterface{},
+		Types:         []SchemaType{},
+	}
+
+	// Take a snapshot of registered types, since collecting the rest
+	// requires cdc.getTypeInfoWlock.
+	cdc.mtx.RLock()
+	for _, iinfo := range cdc.interfaceInfos {
+		names := []string{}
+		for _, cinfos := range iinfo.Implementers {
+			for _, cinfo := range cinfos {
+				names = append(names, cinfo.Name)
+			}
+		}
+		sort.Strings(names)
+		var oneof []string
+		for _, cinfo := range iinfo.OneofVariants {
+			oneof = append(oneof, cinfo.Name)
+		}
+		schema.Interfaces = append(schema.Interfaces, SchemaInterface{
+			Type:               schemaTypeName(iinfo.Type),
+			AlwaysDisambiguate: iinfo.AlwaysDisambiguate,
+			Implementations:    names,
+			Oneof:              oneof,
+		})
+	}
+	var pending = make([]reflect.Type, 0, len(cdc.concreteInfos))
+	var alts []*TypeInfo // Types registered again under another name.
+	for _, cinfo := range sortedByName(cdc.concreteInfos) {
+		if cdc.typeInfos[cinfo.Type] != cinfo {
+			alts = append(alts, cinfo)
+			continue
+		}
+		pending = append(pending, cinfo.Type)
+	}
+	cdc.mtx.RUnlock()
+	sort.Slice(schema.Interfaces, func(i, j int) bool {
+		return schema.Interfaces[i].Type < schema.Interfaces[j].Type
+	})
+
+	// Describe registered concrete types, and the types they refer to.
+	types, err := cdc.schemaTypes(pending)
+	if err != nil {
+		return nil, err
+	}
+	schema.Types = append(schema.Types, types...)
+	for _, cinfo := range alts {
+		// The types it refers to are those of its first registration.
+		stype, _, err := cdc.schemaType(cinfo)
+		if err != nil {
+			return nil, err
+		}
+		schema.Types = append(schema.Types, stype)
+	}
+	return schema, nil
+}
+
+// Returns the descriptions of pending, and of the types they refer to,
+// recursively, each once.
+func (cdc *Codec) schemaTypes(pending []reflect.Type) (types []SchemaType, err error) {
+	var seen = make(map[reflect.Type]bool)
+	for len(pending) > 0 {
+		rt := pending[0]
+		pending = pending[1:]
+		if seen[rt] {
+			continue
+		}
+		seen[rt] = true
+		info, err := cdc.getTypeInfoWlock(rt)
+		if err != nil {
+			return nil, err
+		}
+		stype, refs, err := cdc.schemaType(info)
+		if err != nil {
+			return nil, err
+		}
+		types = append(types, stype)
+		pending = append(pending, refs...)
+	}
+	return types, nil
+}
+
+// SchemaHashLen is the length of the hashes returned by Codec.SchemaHash.
+const SchemaHashLen = 8
+
+// SchemaHash returns a fingerprint of the type of o: the first SchemaHashLen
+// bytes of the SHA256 of its description and the descriptions of the types
+// it refers to, as in Codec.Schema, but without the descriptions set with
+// ConcreteOptions.Description.  The hash changes whenever the encoding of o
+// may change, e.g. when a field is added or renumbered, but also when a
+// field or a Go type is renamed.
+func (cdc *Codec) SchemaHash(o interface{}) ([]byte, error) {
+	rt := reflect.TypeOf(o)
+	if rt == nil {
+		return nil, errors.New("SchemaHash cannot hash the schema of nil")
+	}
+	types, err := cdc.schemaTypes([]reflect.Type{derefType(rt)})
+	if err != nil {
+		return nil, err
+	}
+	for i := range types {
+		types[i].Description = ""
+	}
+	bz, err := json.Marshal(types)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256(bz)
+	return hash[:SchemaHashLen], nil
+}
+
+// Returns the description of info, and the struct types it refers to.
+func (cdc *Codec) schemaType(info *TypeInfo) (stype SchemaType, refs []reflect.Type, err error) {
+	rt := info.Type
+	stype = SchemaType{
+		Type: schemaTypeName(rt),
+		Kind: rt.Kind().String(),
+	}
+	if info.Registered {
+		stype.Name = info.Name
+		stype.Prefix = fmt.Sprintf("%X", info.Prefix.Bytes())
+		stype.Disamb = fmt.Sprintf("%X", info.Disamb.Bytes())
+		stype.Description = info.Description
+		stype.JSONArray = info.JSONArray
+		stype.Version = info.Version
+	}
+	if info.IsAminoMarshaler {
+		stype.Repr = schemaTypeName(info.AminoMarshalReprType)
+		refs = appendSchemaRef(refs, info.AminoMarshalReprType)
+	}
+	switch rt.Kind() {
+	case reflect.Array, reflect.Slice:
+		if rt.Elem().Kind() != reflect.Uint8 {
+			ert := derefType(rt.Elem())
+			stype.Repeated = true
+			stype.Elem = schemaTypeName(ert)
+			refs = appendSchemaRef(refs, ert)
+		}
+	case reflect.Map:
+		ert := derefType(rt.Elem())
+		stype.MapKey = schemaTypeName(rt.Key())
+		stype.Elem = schemaTypeName(ert)
+		refs = appendSchemaRef(refs, ert)
+	case reflect.Struct:
+		if rt == timeType {
+			return
+		}
+		stype.Fields = make([]SchemaField, 0, len(info.Fields))
+		for _, field := range info.Fields {
+			frt := derefType(field.Type)
+			sfield := SchemaField{
+				Name:     field.Name,
+				JSONName: field.JSONName,
+				Number:   field.BinFieldNum,
+				Kind:     frt.Kind().String(),
+				Type:     schemaTypeName(frt),
+				Pointer:  field.Type.Kind() == reflect.Ptr,
+				Options:  schemaFieldOptions(field.FieldOptions),
+			}
+			if frt.Kind() == reflect.Func || (frt.Kind() == reflect.Chan && !field.DrainChan) {
+				err = fmt.Errorf("unsupported field type %v for field %v of %v", frt, field.Name, rt)
+				return
+			}
+			sfield.Typ3 = typeToTyp3(frt, field.FieldOptions).String()
+			switch frt.Kind() {
+			case reflect.Array, reflect.Slice, reflect.Chan:
+				if frt.Elem().Kind() != reflect.Uint8 {
+					ert := derefType(frt.Elem())
+					sfield.Repeated = true
+					sfield.Elem = schemaTypeName(ert)
+					refs = appendSchemaRef(refs, ert)
+				}
+			case reflect.Map:
+				ert := derefType(frt.Elem())
+				sfield.MapKey = schemaTypeName(frt.Key())
+				sfield.Elem = schemaTypeName(ert)
+				refs = appendSchemaRef(refs, ert)
+			default:
+				refs = appendSchemaRef(refs, frt)
+			}
+			stype.Fields = append(stype.Fields, sfield)
+		}
+	}
+	return
+}
+
+// Appends rt to refs if it should be described by its own SchemaType.
+func appendSchemaRef(refs []reflect.Type, rt reflect.Type) []reflect.Type {
+	rt = derefType(rt)
+	if rt.Kind() == reflect.Struct && rt != timeType {
+		return append(refs, rt)
+	}
+	return refs
+}
+
+func schemaFieldOptions(fopts FieldOptions) (options []string) {
+	if fopts.BinFixed64 {
+		options = append(options, "fixed64")
+	}
+	if fopts.BinFixed32 {
+		options = append(options, "fixed32")
+	}
+	if fopts.BinBigEndian {
+		options = append(options, "bigendian")
+	}
+	if fopts.Unsafe {
+		options = append(options, "unsafe")
+	}
+	if fopts.WriteEmpty {
+		options = append(options, "write_empty")
+	}
+	if fopts.EmptyElements {
+		options = append(options, "empty_elements")
+	}
+	if fopts.DrainChan {
+		options = append(options, "drain_chan")
+	}
+	if fopts.JSONOmitEmpty {
+		options = append(options, "omitempty")
+	}
+	return
+}
+
+// Returns the fully qualified name of rt, e.g. "github.com/foo/bar.Baz".
+func schemaTypeName(rt reflect.Type) string {
+	if rt.Name() != "" && rt.PkgPath() != "" {
+		return rt.PkgPath() + "." + rt.Name()
+	}
+	return rt.String()
+}
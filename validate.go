@@ -0,0 +1,222 @@
+package amino
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+//----------------------------------------
+// Validator
+
+// Validator checks the decoded value of a struct field tagged with
+// `amino:"<name>"` or `amino:"<name>=<arg>"`, and returns an error if it's
+// invalid.  rv is the field value, which may be a (nil) pointer.
+type Validator func(rv reflect.Value, arg string) error
+
+// FieldValidator is a validator declared by a field's amino tag.
+type FieldValidator struct {
+	Name string
+	Arg  string
+}
+
+func (fv FieldValidator) String() string {
+	if fv.Arg == "" {
+		return fv.Name
+	}
+	return fv.Name + "=" + fv.Arg
+}
+
+func parseFieldValidator(tag string) FieldValidator {
+	if eq := strings.Index(tag, "="); eq >= 0 {
+		return FieldValidator{Name: tag[:eq], Arg: tag[eq+1:]}
+	}
+	return FieldValidator{Name: tag}
+}
+
+// The validators registered with every new codec.
+var defaultValidators = map[string]Validator{
+	"min":      validateMin,
+	"max":      validateMax,
+	"nonempty": validateNonEmpty,
+	"len":      validateLen,
+}
+
+// RegisterValidator registers a validator that decoding runs on the fields
+// tagged with `amino:"<name>"` or `amino:"<name>=<arg>"`, after the struct
+// is decoded (in binary or JSON), including fields absent from the encoding.
+// The built-in validators are:
+//
+//   - min=<n>, max=<n>: integers and floats must be at least (most) n.
+//   - len=<n>: strings, lists and maps must have exactly n elements.
+//   - nonempty: the value must not be empty, as per the encoding.
+//
+// Except for nonempty, the built-in validators pass nil pointers.
+// Registering a validator with an existing name replaces it.
+func (cdc *Codec) RegisterValidator(name string, validator Validator) {
+	cdc.assertNotSealed()
+
+	if name == "" || strings.ContainsAny(name, "=,") {
+		panic(fmt.Sprintf("invalid validator name %q", name))
+	}
+
+	cdc.mtx.Lock()
+	defer cdc.mtx.Unlock()
+
+	cdc.validators[name] = validator
+}
+
+func (cdc *Codec) getValidator(name string) (validator Validator, ok bool) {
+	cdc.mtx.RLock()
+	defer cdc.mtx.RUnlock()
+
+	validator, ok = cdc.validators[name]
+	return
+}
+
+// Runs the validators of the fields of the struct rv, after decoding.
+// CONTRACT: info.Type is a struct.
+func (cdc *Codec) validateStructFields(ds *decodeState, info *TypeInfo, rv reflect.Value) error {
+	for _, field := range info.Fields {
+		for _, fv := range field.Validators {
+			validator, ok := cdc.getValidator(fv.Name)
+			var err error
+			if !ok {
+				err = fmt.Errorf("unknown validator %v", fv.Name)
+			} else {
+				err = validator(rv.Field(field.Index), fv.Arg)
+			}
+			if err == nil {
+				continue
+			}
+			err = fmt.Errorf("invalid %v.%v (%v): %v", info.Type, field.Name, fv, err)
+			ds.pushField(field.Name)
+			collected := ds.collectFieldError(err)
+			ds.popField()
+			if !collected {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Runs the ConcreteOptions.Validate of the registered type of info on rv,
+// after decoding.
+func validateConcrete(info *TypeInfo, rv reflect.Value) error {
+	var o interface{}
+	if info.PointerPreferred {
+		o = rv.Addr().Interface()
+	} else {
+		o = rv.Interface()
+	}
+	if err := info.Validate(o); err != nil {
+		return errors.Wrapf(err, "invalid %v", info.Name)
+	}
+	return nil
+}
+
+func validateMin(rv reflect.Value, arg string) error {
+	cmp, err := compareNumber(rv, arg)
+	if err == nil && cmp < 0 {
+		err = fmt.Errorf("less than %v", arg)
+	}
+	return err
+}
+
+func validateMax(rv reflect.Value, arg string) error {
+	cmp, err := compareNumber(rv, arg)
+	if err == nil && cmp > 0 {
+		err = fmt.Errorf("greater than %v", arg)
+	}
+	return err
+}
+
+func validateNonEmpty(rv reflect.Value, _ string) error {
+	if _, isDefault := isDefaultValue(rv); isDefault {
+		return fmt.Errorf("empty")
+	}
+	return nil
+}
+
+func validateLen(rv reflect.Value, arg string) error {
+	rv, _, isNilPtr := derefPointers(rv)
+	if isNilPtr {
+		return nil
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil {
+		return fmt.Errorf("invalid length %q", arg)
+	}
+	switch rv.Kind() {
+	case reflect.String, reflect.Array, reflect.Slice, reflect.Map:
+		if rv.Len() != n {
+			return fmt.Errorf("length %v, expected %v", rv.Len(), n)
+		}
+		return nil
+	default:
+		return fmt.Errorf("len is unsupported for %v", rv.Type())
+	}
+}
+
+// Returns -1, 0 or 1 if rv is less than, equal to, or greater than arg, or
+// 0 for nil pointers.
+func compareNumber(rv reflect.Value, arg string) (int, error) {
+	rv, _, isNilPtr := derefPointers(rv)
+	if isNilPtr {
+		return 0, nil
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(arg, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid integer %q", arg)
+		}
+		return compareInt64(rv.Int(), n), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if strings.HasPrefix(arg, "-") {
+			return 1, nil
+		}
+		n, err := strconv.ParseUint(arg, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid unsigned integer %q", arg)
+		}
+		switch v := rv.Uint(); {
+		case v < n:
+			return -1, nil
+		case v > n:
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid float %q", arg)
+		}
+		switch v := rv.Float(); {
+		case v < f:
+			return -1, nil
+		case v > f:
+			return 1, nil
+		default:
+			return 0, nil
+		}
+	default:
+		return 0, fmt.Errorf("min and max are unsupported for %v", rv.Type())
+	}
+}
+
+func compareInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}